@@ -3,11 +3,13 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// banUser bans a user by their Telegram ID
-func banUser(admin *Admin, telegramID string) string {
+// banUser bans a user by their Telegram ID.
+// Optional args: [hours] [reason...] - without hours the ban is permanent.
+func banUser(admin *Admin, telegramID string, args []string) string {
 	userID, err := strconv.ParseInt(telegramID, 10, 64)
 	if err != nil {
 		return "❌ آیدی نامعتبر"
@@ -18,16 +20,16 @@ func banUser(admin *Admin, telegramID string) string {
 		return "❌ کاربر یافت نشد"
 	}
 
-	user.IsActive = false
-	if err := db.Save(&user).Error; err != nil {
+	duration, reason := parseBanOptions(args)
+	if _, err := issueBan(userID, BanScopeAll, reason, duration, &admin.ID); err != nil {
 		return "❌ خطا در مسدود کردن کاربر"
 	}
 
-	logAdminAction(admin, "ban_user", fmt.Sprintf("Banned user %d", userID), "user", user.ID)
+	logAdminAction(admin, "ban_user", fmt.Sprintf("Banned user %d: %s", userID, reason), "user", user.ID)
 	return "✅ کاربر با موفقیت مسدود شد"
 }
 
-// unbanUser unbans a user by their Telegram ID
+// unbanUser lifts all active bans of a user by their Telegram ID
 func unbanUser(admin *Admin, telegramID string) string {
 	userID, err := strconv.ParseInt(telegramID, 10, 64)
 	if err != nil {
@@ -39,8 +41,7 @@ func unbanUser(admin *Admin, telegramID string) string {
 		return "❌ کاربر یافت نشد"
 	}
 
-	user.IsActive = true
-	if err := db.Save(&user).Error; err != nil {
+	if _, err := liftBans(userID, "", &admin.ID); err != nil {
 		return "❌ خطا در آزاد کردن کاربر"
 	}
 
@@ -48,6 +49,23 @@ func unbanUser(admin *Admin, telegramID string) string {
 	return "✅ کاربر با موفقیت آزاد شد"
 }
 
+// parseBanOptions reads the optional "[hours] [reason...]" arguments of ban commands
+func parseBanOptions(args []string) (time.Duration, string) {
+	var duration time.Duration
+	if len(args) > 0 {
+		if hours, err := strconv.Atoi(args[0]); err == nil && hours > 0 {
+			duration = time.Duration(hours) * time.Hour
+			args = args[1:]
+		}
+	}
+
+	reason := strings.Join(args, " ")
+	if reason == "" {
+		reason = "مسدود شده توسط ادمین"
+	}
+	return duration, reason
+}
+
 // editSession edits a session's details
 func editSession(admin *Admin, sessionNum, title, description string) string {
 	num, err := strconv.Atoi(sessionNum)
@@ -94,8 +112,12 @@ func deleteSession(admin *Admin, sessionNum string) string {
 		return "❌ خطا در حذف ویدیوهای جلسه"
 	}
 
-	// Delete associated exercises
-	if err := tx.Where("session_id = ?", session.ID).Delete(&Exercise{}).Error; err != nil {
+	// Delete associated exercises and their submissions
+	if err := tx.Where("session_id = ?", session.ID).Delete(&ExerciseAssignment{}).Error; err != nil {
+		tx.Rollback()
+		return "❌ خطا در حذف تمرین‌های جلسه"
+	}
+	if err := tx.Where("session_id = ?", session.ID).Delete(&ExerciseSubmission{}).Error; err != nil {
 		tx.Rollback()
 		return "❌ خطا در حذف تمرین‌های جلسه"
 	}
@@ -213,7 +235,7 @@ func getAdminStats() string {
 	db.Model(&User{}).Where("is_active = ?", true).Count(&stats.ActiveUsers)
 	db.Model(&Session{}).Count(&stats.TotalSessions)
 	db.Model(&Video{}).Count(&stats.TotalVideos)
-	db.Model(&Exercise{}).Count(&stats.TotalExercises)
+	db.Model(&ExerciseSubmission{}).Count(&stats.TotalExercises)
 
 	return fmt.Sprintf("📊 آمار سیستم:\n\n"+
 		"👥 کاربران:\n"+
@@ -4,12 +4,14 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"MonetizeeAI_bot/fieldcrypt"
 	"MonetizeeAI_bot/logger"
 
 	"github.com/gin-gonic/gin"
@@ -64,6 +66,7 @@ func setupAdminAPIRoutes(r *gin.Engine) {
 		admin.GET("/users/:id", getAdminUserDetail)
 		admin.POST("/users/:id/block", blockUserAPI)
 		admin.POST("/users/:id/unblock", unblockUserAPI)
+		admin.GET("/users/:id/bans", getUserBansAPI)
 		admin.POST("/users/:id/change-plan", changeUserPlanAPI)
 		admin.POST("/users/:id/send-message", sendMessageToUserAPI)
 		admin.POST("/users/:id/change-session", changeUserSessionAPI)
@@ -78,6 +81,14 @@ func setupAdminAPIRoutes(r *gin.Engine) {
 		admin.POST("/sessions", createSession)
 		admin.PUT("/sessions/:id", updateSession)
 		admin.DELETE("/sessions/:id", deleteSessionAPI)
+		admin.GET("/sessions/:id/rubric", getSessionRubricAPI)
+		admin.PUT("/sessions/:id/rubric", updateSessionRubricAPI)
+		admin.GET("/quiz-evaluations", getQuizEvaluationsAPI)
+
+		// Mentor review of AI-graded submissions
+		admin.GET("/reviews", getExerciseReviewsAPI)
+		admin.GET("/reviews/:id", getExerciseReviewAPI)
+		admin.POST("/reviews/:id/resolve", resolveExerciseReviewAPI)
 
 		// Videos
 		admin.GET("/videos", getAdminVideos)
@@ -90,6 +101,8 @@ func setupAdminAPIRoutes(r *gin.Engine) {
 		admin.POST("/exercises", createExercise)
 		admin.PUT("/exercises/:id", updateExercise)
 		admin.DELETE("/exercises/:id", deleteExercise)
+		admin.GET("/exercise-submissions", getExerciseSubmissionsAPI)
+		admin.GET("/exercise-submissions/:id/file", getExerciseSubmissionFileAPI)
 
 		// Licenses (old verification system)
 		admin.GET("/licenses", getAdminLicenses)
@@ -110,6 +123,7 @@ func setupAdminAPIRoutes(r *gin.Engine) {
 		// Security
 		admin.GET("/security/blocked", getBlockedUsers)
 		admin.GET("/security/suspicious", getSuspiciousActivity)
+		admin.POST("/security/events/:id/resolve", resolveSecurityEventAPI)
 
 		// Analytics
 		admin.GET("/analytics/revenue", getRevenueAnalytics)
@@ -121,6 +135,36 @@ func setupAdminAPIRoutes(r *gin.Engine) {
 		admin.GET("/tickets/:id", getAdminTicketDetail)
 		admin.POST("/tickets/:id/reply", adminReplyTicket)
 		admin.POST("/tickets/:id/change-status", adminChangeTicketStatus)
+
+		// Prompt templates
+		admin.GET("/prompts", getPromptTemplatesAPI)
+		admin.GET("/prompts/:name", getPromptTemplateAPI)
+		admin.POST("/prompts/:name/versions", createPromptVersionAPI)
+		admin.POST("/prompts/:name/activate", activatePromptVersionAPI)
+		admin.POST("/prompts/:name/rollback", rollbackPromptAPI)
+		admin.POST("/prompts/:name/preview", previewPromptAPI)
+
+		// AI usage and cost
+		admin.GET("/ai/usage", getAIUsageAPI)
+
+		// AI answer ratings
+		admin.GET("/ai/ratings", getAIRatingsAPI)
+		admin.GET("/ai/ratings/low", getLowRatedAnswersAPI)
+
+		// AI input moderation
+		admin.GET("/moderation/rules", getModerationRulesAPI)
+		admin.POST("/moderation/rules", createModerationRuleAPI)
+		admin.PUT("/moderation/rules/:id", updateModerationRuleAPI)
+		admin.DELETE("/moderation/rules/:id", deleteModerationRuleAPI)
+		admin.POST("/moderation/check", checkModerationAPI)
+
+		// Course retrieval (FAQ corpus and index)
+		admin.GET("/faq", getFAQEntriesAPI)
+		admin.POST("/faq", createFAQEntryAPI)
+		admin.PUT("/faq/:id", updateFAQEntryAPI)
+		admin.DELETE("/faq/:id", deleteFAQEntryAPI)
+		admin.GET("/retrieval/search", searchCourseIndexAPI)
+		admin.POST("/retrieval/rebuild", rebuildCourseIndexAPI)
 	}
 
 	// Legacy route support: /v1/admin/ws (for backward compatibility)
@@ -173,6 +217,8 @@ func handleWebLogin(c *gin.Context) {
 		logger.Warn("Web login failed - invalid credentials",
 			zap.String("username", req.Username),
 			zap.String("remote_addr", c.ClientIP()))
+		reportSecuritySignal(SecurityRuleWebLoginFailure, 0, c.ClientIP(),
+			"Repeated failed admin panel logins from one IP; last username: "+req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"error":   "Invalid username or password",
@@ -581,8 +627,15 @@ func getAdminUsers(c *gin.Context) {
 
 	// Apply filters
 	if search != "" {
-		query = query.Where("username LIKE ? OR first_name LIKE ? OR phone_number LIKE ? OR phone LIKE ?",
-			"%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+		// Phone and email are encrypted, so they only match exactly through their blind index
+		searchQuery := db.Where("username LIKE ? OR first_name LIKE ?", "%"+search+"%", "%"+search+"%")
+		if phoneHash := fieldcrypt.PhoneIndex(search); phoneHash != "" {
+			searchQuery = searchQuery.Or("phone_hash = ?", phoneHash)
+		}
+		if emailHash := fieldcrypt.EmailIndex(search); emailHash != "" {
+			searchQuery = searchQuery.Or("email_hash = ?", emailHash)
+		}
+		query = query.Where(searchQuery)
 	}
 
 	if filterType != "" && filterType != "all" {
@@ -722,31 +775,71 @@ func getAdminUserDetail(c *gin.Context) {
 func blockUserAPI(c *gin.Context) {
 	userID := c.Param("id")
 
+	type BlockRequest struct {
+		Scope         string `json:"scope"`          // bot, miniapp, chat, all (default: all)
+		Reason        string `json:"reason"`         // Shown to the user
+		DurationHours int    `json:"duration_hours"` // 0 = permanent
+	}
+
+	// Body is optional - an empty request issues a permanent ban on everything
+	var req BlockRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+	if req.Scope == "" {
+		req.Scope = BanScopeAll
+	}
+	if !isValidBanScope(req.Scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope. Use: bot, miniapp, chat, all"})
+		return
+	}
+	if req.DurationHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration_hours must not be negative"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "مسدود شده توسط ادمین"
+	}
+
 	var user User
 	if err := db.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	user.IsBlocked = true
-	db.Save(&user)
-
-	// ⚡ CRITICAL: Invalidate user cache so mini app gets updated data immediately
-	userCache.InvalidateUser(user.TelegramID)
+	ban, err := issueBan(user.TelegramID, req.Scope, req.Reason, time.Duration(req.DurationHours)*time.Hour, getAdminIDFromContext(c))
+	if err != nil {
+		logger.Error("Failed to ban user", zap.Error(err), zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to block user",
+		})
+		return
+	}
 
 	logger.Info("User blocked by admin",
 		zap.Uint("user_id", user.ID),
+		zap.String("scope", req.Scope),
 		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User blocked successfully",
+		"data":    ban,
 	})
 }
 
-// Unblock user
+// Unblock user (optional ?scope= lifts only bans with that scope)
 func unblockUserAPI(c *gin.Context) {
 	userID := c.Param("id")
+	scope := c.Query("scope")
+	if scope != "" && !isValidBanScope(scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope. Use: bot, miniapp, chat, all"})
+		return
+	}
 
 	var user User
 	if err := db.First(&user, userID).Error; err != nil {
@@ -754,22 +847,71 @@ func unblockUserAPI(c *gin.Context) {
 		return
 	}
 
-	user.IsBlocked = false
-	db.Save(&user)
-
-	// ⚡ CRITICAL: Invalidate user cache so mini app gets updated data immediately
-	userCache.InvalidateUser(user.TelegramID)
+	lifted, err := liftBans(user.TelegramID, scope, getAdminIDFromContext(c))
+	if err != nil {
+		logger.Error("Failed to unban user", zap.Error(err), zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to unblock user",
+		})
+		return
+	}
+	suspiciousActivityCount[user.TelegramID] = 0
 
 	logger.Info("User unblocked by admin",
 		zap.Uint("user_id", user.ID),
+		zap.Int64("lifted_bans", lifted),
 		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User unblocked successfully",
+		"data": gin.H{
+			"lifted_bans": lifted,
+		},
 	})
 }
 
+// Get user ban history
+func getUserBansAPI(c *gin.Context) {
+	userID := c.Param("id")
+
+	var user User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var bans []Ban
+	if err := db.Preload("Admin").Where("telegram_id = ?", user.TelegramID).
+		Order("created_at DESC").Find(&bans).Error; err != nil {
+		logger.Error("Failed to fetch user bans", zap.Error(err), zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch bans",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    bans,
+	})
+}
+
+// getAdminIDFromContext returns the authenticated admin's ID, or nil if unknown
+func getAdminIDFromContext(c *gin.Context) *uint {
+	value, exists := c.Get("admin_id")
+	if !exists {
+		return nil
+	}
+	id, ok := value.(uint)
+	if !ok || id == 0 {
+		return nil
+	}
+	return &id
+}
+
 // Change user plan
 func changeUserPlanAPI(c *gin.Context) {
 	userID := c.Param("id")
@@ -798,7 +940,6 @@ func changeUserPlanAPI(c *gin.Context) {
 		user.SubscriptionType = "free_trial"
 		user.PlanName = "free_trial"
 		user.SubscriptionExpiry = &expiry
-		user.IsActive = true
 		user.IsVerified = false
 		user.FreeTrialUsed = true
 	case "starter":
@@ -806,7 +947,6 @@ func changeUserPlanAPI(c *gin.Context) {
 		user.SubscriptionType = "paid"
 		user.PlanName = "starter"
 		user.SubscriptionExpiry = &expiry
-		user.IsActive = true
 		user.IsVerified = true
 		user.FreeTrialUsed = true
 	case "pro":
@@ -814,7 +954,6 @@ func changeUserPlanAPI(c *gin.Context) {
 		user.SubscriptionType = "paid"
 		user.PlanName = "pro"
 		user.SubscriptionExpiry = &expiry
-		user.IsActive = true
 		user.IsVerified = true
 		user.FreeTrialUsed = true
 	case "ultimate":
@@ -822,7 +961,6 @@ func changeUserPlanAPI(c *gin.Context) {
 		user.SubscriptionType = "paid"
 		user.PlanName = "ultimate"
 		user.SubscriptionExpiry = nil
-		user.IsActive = true
 		user.IsVerified = true
 		user.FreeTrialUsed = true
 	default:
@@ -830,8 +968,6 @@ func changeUserPlanAPI(c *gin.Context) {
 		return
 	}
 
-	// Ensure user is not blocked when changing plan (unless explicitly blocked)
-	// Only unblock if the plan change is successful
 	if err := db.Save(&user).Error; err != nil {
 		logger.Error("Failed to save user after plan change", zap.Error(err), zap.Uint("user_id", user.ID))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -841,8 +977,9 @@ func changeUserPlanAPI(c *gin.Context) {
 		return
 	}
 
-	// ⚡ CRITICAL: Invalidate user cache so mini app gets updated data immediately
-	userCache.InvalidateUser(user.TelegramID)
+	// ⚡ CRITICAL: Re-mirror the ban flags (a plan change does not lift bans) and invalidate
+	// the user cache so mini app gets updated data immediately
+	syncUserBanFlags(user.TelegramID)
 	logger.Info("User cache invalidated after plan change",
 		zap.Uint("user_id", user.ID),
 		zap.Int64("telegram_id", user.TelegramID))
@@ -996,17 +1133,26 @@ func deleteUserAPI(c *gin.Context) {
 		return
 	}
 
-	// Soft delete (set inactive)
-	user.IsActive = false
-	db.Save(&user)
+	// Erase personal data and anonymize financial records (use block to only stop access)
+	erasure, err := eraseUserData(user.TelegramID, ErasureViaAdmin, getAdminIDFromContext(c))
+	if err != nil {
+		logger.Error("Failed to delete user", zap.Error(err), zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to delete user",
+		})
+		return
+	}
 
 	logger.Warn("User deleted by admin",
 		zap.Uint("user_id", user.ID),
+		zap.Uint("erasure_id", erasure.ID),
 		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User deleted successfully",
+		"data":    erasure,
 	})
 }
 
@@ -1222,48 +1368,123 @@ func deleteVideoAPI(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// Exercises are the assignments of a session; student answers are listed under exercise-submissions
 func getAdminExercises(c *gin.Context) {
 	sessionID := c.Query("session_id")
-	query := db.Model(&Exercise{})
+	query := db.Model(&ExerciseAssignment{})
 	if sessionID != "" {
 		query = query.Where("session_id = ?", sessionID)
 	}
-	var exercises []Exercise
-	query.Order("number ASC").Find(&exercises)
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": exercises})
+	var assignments []ExerciseAssignment
+	query.Order("session_id ASC, position ASC, id ASC").Find(&assignments)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assignments})
 }
 
 func createExercise(c *gin.Context) {
-	var exercise Exercise
-	if err := c.ShouldBindJSON(&exercise); err != nil {
+	var assignment ExerciseAssignment
+	if err := c.ShouldBindJSON(&assignment); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	db.Create(&exercise)
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": exercise})
+	if err := db.First(&Session{}, assignment.SessionID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session not found"})
+		return
+	}
+	if assignment.Position == 0 {
+		// Appended after the session's other exercises
+		var last struct{ Position int }
+		db.Model(&ExerciseAssignment{}).Select("COALESCE(MAX(position), 0) AS position").
+			Where("session_id = ?", assignment.SessionID).Scan(&last)
+		assignment.Position = last.Position + 1
+	}
+	db.Create(&assignment)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assignment})
 }
 
 func updateExercise(c *gin.Context) {
 	exerciseID := c.Param("id")
-	var exercise Exercise
-	if err := db.First(&exercise, exerciseID).Error; err != nil {
+	var assignment ExerciseAssignment
+	if err := db.First(&assignment, exerciseID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
 		return
 	}
-	if err := c.ShouldBindJSON(&exercise); err != nil {
+	if err := c.ShouldBindJSON(&assignment); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	db.Save(&exercise)
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": exercise})
+	db.Save(&assignment)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assignment})
 }
 
 func deleteExercise(c *gin.Context) {
 	exerciseID := c.Param("id")
-	db.Delete(&Exercise{}, exerciseID)
+	db.Delete(&ExerciseAssignment{}, exerciseID)
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// getExerciseSubmissionsAPI lists student submissions, newest first
+func getExerciseSubmissionsAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := db.Model(&ExerciseSubmission{})
+	if sessionID := c.Query("session_id"); sessionID != "" {
+		query = query.Where("session_id = ?", sessionID)
+	}
+	if telegramID := c.Query("telegram_id"); telegramID != "" {
+		query = query.Where("telegram_id = ?", telegramID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var submissions []ExerciseSubmission
+	query.Order("submitted_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&submissions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"submissions": submissions,
+			"total":       total,
+			"page":        page,
+			"limit":       limit,
+		},
+	})
+}
+
+// getExerciseSubmissionFileAPI streams the file attached to a submission
+func getExerciseSubmissionFileAPI(c *gin.Context) {
+	var submission ExerciseSubmission
+	if err := db.First(&submission, c.Param("id")).Error; err != nil || submission.FileKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "File not found"})
+		return
+	}
+
+	file, err := getFileStorage().Open(c.Request.Context(), submission.FileKey)
+	if err != nil {
+		logger.Error("Failed to open submission file",
+			zap.Uint("submission_id", submission.ID),
+			zap.String("key", submission.FileKey),
+			zap.Error(err))
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "File not found"})
+		return
+	}
+	defer file.Close()
+
+	c.DataFromReader(http.StatusOK, submission.FileSize, submission.FileMime, file, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": submission.FileName}),
+	})
+}
+
 // Get licenses
 func getAdminLicenses(c *gin.Context) {
 	status := c.DefaultQuery("status", "pending")
@@ -1359,24 +1580,43 @@ func sendSMSBroadcast(c *gin.Context) {
 	})
 }
 
-// Get blocked users
+// Get blocked users (active bans with the banned user)
 func getBlockedUsers(c *gin.Context) {
-	var users []User
-	db.Where("is_blocked = ?", true).Find(&users)
+	bans, err := listActiveBans(c.Query("scope"))
+	if err != nil {
+		logger.Error("Failed to fetch active bans", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch blocked users",
+		})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    users,
-	})
-}
+	telegramIDs := make([]int64, 0, len(bans))
+	for _, ban := range bans {
+		telegramIDs = append(telegramIDs, ban.TelegramID)
+	}
 
-// Get suspicious activity
-func getSuspiciousActivity(c *gin.Context) {
-	// TODO: Implement logic to detect suspicious patterns
+	var users []User
+	if len(telegramIDs) > 0 {
+		db.Where("telegram_id IN ?", telegramIDs).Find(&users)
+	}
+	usersByTelegramID := make(map[int64]User, len(users))
+	for _, user := range users {
+		usersByTelegramID[user.TelegramID] = user
+	}
+
+	blocked := make([]gin.H, 0, len(bans))
+	for _, ban := range bans {
+		blocked = append(blocked, gin.H{
+			"ban":  ban,
+			"user": usersByTelegramID[ban.TelegramID],
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    []interface{}{},
+		"data":    blocked,
 	})
 }
 
@@ -79,6 +79,11 @@ var adminCommands = []AdminCommand{
 		Description: "✍️ مدیریت تمرین‌ها",
 		Handler:     handleAdminExercises,
 	},
+	{
+		Command:     "/admin_reviews",
+		Description: "👨‍🏫 صف بررسی تمرین‌های ارزیابی‌شده توسط AI",
+		Handler:     handleAdminReviews,
+	},
 	{
 		Command:     "/admin_broadcast",
 		Description: "📢 ارسال پیام به همه کاربران",
@@ -187,7 +192,7 @@ func handleAdminUsers(admin *Admin, args []string) string {
 		if len(args) < 2 {
 			return "❌ لطفا آیدی کاربر را وارد کنید"
 		}
-		return banUser(admin, args[1])
+		return banUser(admin, args[1], args[2:])
 	case "unban":
 		if len(args) < 2 {
 			return "❌ لطفا آیدی کاربر را وارد کنید"
@@ -323,13 +328,13 @@ func handleAdminVideos(admin *Admin, args []string) string {
 func handleAdminExercises(admin *Admin, args []string) string {
 	if len(args) == 0 {
 		// Show pending exercises
-		var exercises []Exercise
+		var exercises []ExerciseSubmission
 		db.Preload("User").Preload("Session").Where("status = ?", "pending").Order("created_at desc").Limit(10).Find(&exercises)
 
 		response := "✍️ تمرین‌های در انتظار بررسی:\n\n"
 		for _, exercise := range exercises {
-			response += fmt.Sprintf("🆔 آیدی: %d\n👤 کاربر: %s\n📚 جلسه: %d\n📝 محتوا: %s\n\n",
-				exercise.ID, exercise.User.Username, exercise.Session.Number, exercise.Content)
+			response += fmt.Sprintf("🆔 آیدی: %d\n👤 کاربر: %s\n📚 جلسه: %d (تلاش %d)\n📝 محتوا: %s\n\n",
+				exercise.ID, exercise.User.Username, exercise.Session.Number, exercise.Attempt, exercise.Content)
 		}
 		response += "\nدستورات:\n• approve [آیدی] [نظرات] - تایید تمرین\n• reject [آیدی] [نظرات] - رد تمرین"
 		return response
@@ -345,12 +350,23 @@ func handleAdminExercises(admin *Admin, args []string) string {
 		if err != nil {
 			return "❌ آیدی نامعتبر"
 		}
-		var exercise Exercise
+		var exercise ExerciseSubmission
 		if err := db.First(&exercise, exerciseID).Error; err != nil {
 			return "❌ تمرین یافت نشد"
 		}
+		// A queued review is resolved instead, so the student is notified and progress follows the verdict
+		if review := pendingReviewFor(ReviewSourceExercise, exercise.ID); review != nil {
+			adminID := admin.ID
+			if _, err := resolveReview(review, true, strings.Join(args[2:], " "), &adminID); err != nil {
+				return "❌ خطا در ثبت نتیجه بررسی"
+			}
+			return "✅ تمرین با موفقیت تایید شد"
+		}
+		now := time.Now()
+		adminID := admin.ID
 		exercise.Status = "approved"
 		exercise.Feedback = strings.Join(args[2:], " ")
+		exercise.ReviewedBy, exercise.ReviewedAt = &adminID, &now
 		db.Save(&exercise)
 		return "✅ تمرین با موفقیت تایید شد"
 
@@ -362,12 +378,23 @@ func handleAdminExercises(admin *Admin, args []string) string {
 		if err != nil {
 			return "❌ آیدی نامعتبر"
 		}
-		var exercise Exercise
+		var exercise ExerciseSubmission
 		if err := db.First(&exercise, exerciseID).Error; err != nil {
 			return "❌ تمرین یافت نشد"
 		}
+		// A queued review is resolved instead, so the student is notified and progress follows the verdict
+		if review := pendingReviewFor(ReviewSourceExercise, exercise.ID); review != nil {
+			adminID := admin.ID
+			if _, err := resolveReview(review, false, strings.Join(args[2:], " "), &adminID); err != nil {
+				return "❌ خطا در ثبت نتیجه بررسی"
+			}
+			return "✅ تمرین با موفقیت رد شد"
+		}
+		now := time.Now()
+		adminID := admin.ID
 		exercise.Status = "needs_revision"
 		exercise.Feedback = strings.Join(args[2:], " ")
+		exercise.ReviewedBy, exercise.ReviewedAt = &adminID, &now
 		db.Save(&exercise)
 		return "✅ تمرین با موفقیت رد شد"
 
@@ -387,6 +414,30 @@ func handleCallbackQuery(update tgbotapi.Update) {
 		return
 	}
 
+	// 🔒 SECURITY: Ban appeal button shown to banned users
+	if data == "ban_appeal" {
+		handleBanAppealCallback(callback)
+		return
+	}
+
+	// 🔒 PRIVACY: Account erasure confirmation
+	if data == "erase_confirm" || data == "erase_cancel" {
+		handleEraseCallback(callback)
+		return
+	}
+
+	// Confirmation of a transcribed voice message
+	if data == "voice_confirm" || data == "voice_cancel" {
+		handleVoiceTranscriptCallback(callback)
+		return
+	}
+
+	// Rating of an AI answer
+	if strings.HasPrefix(data, "rate:") || strings.HasPrefix(data, "rate_comment:") {
+		handleRatingCallback(callback)
+		return
+	}
+
 	// Check if it's a user callback (not admin)
 	if strings.HasPrefix(data, "has_license") || strings.HasPrefix(data, "no_license") || strings.HasPrefix(data, "start_free_trial") || data == "enter_license" || strings.HasPrefix(data, "payment:") || data == "buy_subscription" || strings.HasPrefix(data, "check_payment:") {
 		handleUserCallbackQuery(update)
@@ -617,7 +668,6 @@ func handleUserCallbackQuery(update tgbotapi.Update) {
 		// Start free trial
 		user.StartFreeTrial()
 		user.IsVerified = true // Mark user as verified so they can use the bot
-		user.IsActive = true   // Ensure user is active
 		if err := db.Save(&user).Error; err != nil {
 			logger.Error("Failed to save user with free trial", zap.Error(err), zap.Int64("user_id", userID))
 			sendMessage(userID, "❌ خطا در فعال‌سازی اشتراک رایگان. لطفا دوباره تلاش کنید.")
@@ -652,7 +702,6 @@ func handleUserCallbackQuery(update tgbotapi.Update) {
 			// Start free trial so user can access mini app
 			user.StartFreeTrial()
 			user.IsVerified = true // Mark user as verified so they can use the bot
-			user.IsActive = true   // Ensure user is active
 			if err := db.Save(&user).Error; err != nil {
 				logger.Error("Failed to save user with free trial for subscription purchase", zap.Error(err), zap.Int64("user_id", userID))
 				sendMessage(userID, "❌ خطا در فعال‌سازی دسترسی. لطفا دوباره تلاش کنید.")
@@ -728,7 +777,6 @@ func handleUserCallbackQuery(update tgbotapi.Update) {
 			// Still redirect to Mini App
 			user.StartFreeTrial()
 			user.IsVerified = true
-			user.IsActive = true
 			if err := db.Save(&user).Error; err != nil {
 				logger.Error("Failed to save user with free trial for subscription purchase", zap.Error(err), zap.Int64("user_id", userID))
 				sendMessage(userID, "❌ خطا در فعال‌سازی دسترسی. لطفا دوباره تلاش کنید.")
@@ -840,16 +888,14 @@ func handleBanUser(admin *Admin, userID string) {
 		return
 	}
 
-	user.IsActive = false
-	if err := db.Save(&user).Error; err != nil {
+	ban, err := issueBan(user.TelegramID, BanScopeAll, "مسدود شده توسط ادمین", 0, &admin.ID)
+	if err != nil {
 		sendMessage(admin.TelegramID, "❌ خطا در مسدود کردن کاربر")
 		return
 	}
 
 	// Send notification to the blocked user
-	blockMsg := tgbotapi.NewMessage(user.TelegramID, "⚠️ دسترسی شما به ربات مسدود شده است.\n\n📞 برای رفع مسدودیت با پشتیبانی تماس بگیرید:\n\n"+SUPPORT_NUMBER)
-	blockMsg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-	bot.Send(blockMsg)
+	sendBanNotice(user.TelegramID, ban)
 
 	logAdminAction(admin, "ban_user", fmt.Sprintf("کاربر %s مسدود شد", user.Username), "user", user.ID)
 	sendMessage(admin.TelegramID, fmt.Sprintf("✅ کاربر %s با موفقیت مسدود شد", user.Username))
@@ -869,11 +915,11 @@ func handleUnbanUser(admin *Admin, userID string) {
 		return
 	}
 
-	user.IsActive = true
-	if err := db.Save(&user).Error; err != nil {
+	if _, err := liftBans(user.TelegramID, "", &admin.ID); err != nil {
 		sendMessage(admin.TelegramID, "❌ خطا در رفع مسدودیت کاربر")
 		return
 	}
+	suspiciousActivityCount[user.TelegramID] = 0
 
 	// Send notification to the unblocked user
 	unblockMsg := tgbotapi.NewMessage(user.TelegramID, "✅ دسترسی شما به ربات بازگردانده شد.\n\nشما می‌توانید از خدمات ربات استفاده کنید.")
@@ -920,7 +966,7 @@ func searchUser(admin *Admin, query string) string {
 
 		// Get user's exercise submissions
 		var exerciseCount int64
-		db.Model(&Exercise{}).Where("user_id = ?", user.ID).Count(&exerciseCount)
+		db.Model(&ExerciseSubmission{}).Where("user_id = ?", user.ID).Count(&exerciseCount)
 
 		response += fmt.Sprintf("👤 اطلاعات کاربر:\n\n"+
 			"📱 آیدی تلگرام: %d\n"+
@@ -968,7 +1014,7 @@ func handleSessionStats(admin *Admin, args []string) {
 
 	db.Model(&Session{}).Count(&totalSessions)
 	db.Model(&Video{}).Count(&totalVideos)
-	db.Model(&Exercise{}).Count(&totalExercises)
+	db.Model(&ExerciseAssignment{}).Count(&totalExercises)
 
 	response := fmt.Sprintf("📊 آمار جلسات:\n\n"+
 		"📚 تعداد کل جلسات: %d\n"+
@@ -1677,7 +1723,10 @@ func handleSMSBroadcastConfirmation(admin *Admin, confirm bool) string {
 func handleAdminSecurity(admin *Admin, args []string) string {
 	if len(args) == 0 {
 		// Show security overview
-		blockedCount := len(blockedUsers)
+		var blockedCount int64
+		db.Model(&Ban{}).
+			Where("lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now()).
+			Distinct("telegram_id").Count(&blockedCount)
 		suspiciousCount := 0
 		for _, count := range suspiciousActivityCount {
 			if count > 0 {
@@ -1685,32 +1734,67 @@ func handleAdminSecurity(admin *Admin, args []string) string {
 			}
 		}
 
+		openEvents := countOpenSecurityEvents()
+
 		response := fmt.Sprintf("🛡️ **وضعیت امنیت سیستم:**\n\n"+
 			"🚫 کاربران مسدود شده: %d\n"+
-			"⚠️ کاربران مشکوک: %d\n\n"+
+			"⚠️ کاربران مشکوک: %d\n"+
+			"🚨 رویدادهای امنیتی بررسی نشده: %d\n\n"+
 			"**دستورات امنیتی:**\n"+
 			"• `/admin_security list` - نمایش کاربران مسدود شده\n"+
+			"• `/admin_security ban <user_id> <scope> [hours] [reason]` - مسدود کردن کاربر (scope: bot, miniapp, chat, all)\n"+
 			"• `/admin_security unblock <user_id>` - آزادسازی کاربر\n"+
+			"• `/admin_security history <user_id>` - سوابق مسدودیت کاربر\n"+
 			"• `/admin_security clear <user_id>` - پاک کردن سوابق مشکوک\n"+
-			"• `/admin_security logs` - نمایش لاگ‌های امنیتی",
-			blockedCount, suspiciousCount)
+			"• `/admin_security logs` - نمایش رویدادهای امنیتی بررسی نشده\n"+
+			"• `/admin_security resolve <event_id> [note]` - بستن رویداد امنیتی",
+			blockedCount, suspiciousCount, openEvents)
 
 		return response
 	}
 
 	switch args[0] {
 	case "list":
-		if len(blockedUsers) == 0 {
+		bans, err := listActiveBans("")
+		if err != nil {
+			return "❌ خطا در دریافت لیست کاربران مسدود شده"
+		}
+		if len(bans) == 0 {
 			return "✅ هیچ کاربری مسدود نشده است."
 		}
 
 		response := "🚫 **کاربران مسدود شده:**\n\n"
-		for telegramID := range blockedUsers {
-			violationCount := suspiciousActivityCount[telegramID]
-			response += fmt.Sprintf("👤 آیدی: %d\n⚠️ تعداد تخلفات: %d\n\n", telegramID, violationCount)
+		for _, ban := range bans {
+			response += formatBanForAdmin(&ban)
 		}
 		return response
 
+	case "ban":
+		if len(args) < 3 {
+			return "❌ استفاده صحیح: `/admin_security ban <user_id> <scope> [hours] [reason]`"
+		}
+
+		userID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "❌ آیدی کاربر نامعتبر است"
+		}
+
+		scope := strings.ToLower(args[2])
+		if !isValidBanScope(scope) {
+			return "❌ محدوده نامعتبر است. مقادیر مجاز: bot, miniapp, chat, all"
+		}
+
+		duration, reason := parseBanOptions(args[3:])
+		ban, err := issueBan(userID, scope, reason, duration, &admin.ID)
+		if err != nil {
+			return "❌ خطا در مسدود کردن کاربر"
+		}
+
+		var user User
+		db.Select("id").Where("telegram_id = ?", userID).First(&user)
+		logAdminAction(admin, "ban_user", fmt.Sprintf("Banned user %d (%s): %s", userID, scope, reason), "user", user.ID)
+		return fmt.Sprintf("✅ کاربر %d مسدود شد.\n\n%s", userID, formatBanForAdmin(ban))
+
 	case "unblock":
 		if len(args) < 2 {
 			return "❌ لطفا آیدی کاربر را وارد کنید: `/admin_security unblock <user_id>`"
@@ -1721,12 +1805,15 @@ func handleAdminSecurity(admin *Admin, args []string) string {
 			return "❌ آیدی کاربر نامعتبر است"
 		}
 
-		if !blockedUsers[userID] {
+		lifted, err := liftBans(userID, "", &admin.ID)
+		if err != nil {
+			return "❌ خطا در آزادسازی کاربر"
+		}
+		if lifted == 0 {
 			return "❌ این کاربر مسدود نشده است"
 		}
 
 		// Unblock user
-		delete(blockedUsers, userID)
 		suspiciousActivityCount[userID] = 0
 
 		logger.Info("User unblocked by admin",
@@ -1735,6 +1822,31 @@ func handleAdminSecurity(admin *Admin, args []string) string {
 
 		return fmt.Sprintf("✅ کاربر %d آزادسازی شد.", userID)
 
+	case "history":
+		if len(args) < 2 {
+			return "❌ لطفا آیدی کاربر را وارد کنید: `/admin_security history <user_id>`"
+		}
+
+		userID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "❌ آیدی کاربر نامعتبر است"
+		}
+
+		var bans []Ban
+		if err := db.Preload("Admin").Where("telegram_id = ?", userID).
+			Order("created_at DESC").Limit(10).Find(&bans).Error; err != nil {
+			return "❌ خطا در دریافت سوابق مسدودیت"
+		}
+		if len(bans) == 0 {
+			return "✅ این کاربر سابقه مسدودیت ندارد."
+		}
+
+		response := fmt.Sprintf("📋 **سوابق مسدودیت کاربر %d:**\n\n", userID)
+		for _, ban := range bans {
+			response += formatBanForAdmin(&ban)
+		}
+		return response
+
 	case "clear":
 		if len(args) < 2 {
 			return "❌ لطفا آیدی کاربر را وارد کنید: `/admin_security clear <user_id>`"
@@ -1757,14 +1869,93 @@ func handleAdminSecurity(admin *Admin, args []string) string {
 		return fmt.Sprintf("✅ سوابق مشکوک کاربر %d پاک شد.", userID)
 
 	case "logs":
-		// This would show recent security logs
-		return "📋 نمایش لاگ‌های امنیتی در نسخه‌های آینده اضافه خواهد شد."
+		var events []SecurityEvent
+		if err := db.Where("resolved = ?", false).
+			Order("created_at DESC").Limit(15).Find(&events).Error; err != nil {
+			return "❌ خطا در دریافت رویدادهای امنیتی"
+		}
+		if len(events) == 0 {
+			return "✅ رویداد امنیتی بررسی نشده‌ای وجود ندارد."
+		}
+
+		response := "🚨 **رویدادهای امنیتی بررسی نشده:**\n\n"
+		for _, event := range events {
+			response += formatSecurityEventForAdmin(&event)
+		}
+		return response
+
+	case "resolve":
+		if len(args) < 2 {
+			return "❌ استفاده صحیح: `/admin_security resolve <event_id> [note]`"
+		}
+
+		eventID, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return "❌ شناسه رویداد نامعتبر است"
+		}
+
+		note := strings.Join(args[2:], " ")
+		if _, err := resolveSecurityEvent(uint(eventID), &admin.ID, note); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return "❌ رویداد امنیتی یافت نشد"
+			}
+			return "❌ خطا در بستن رویداد امنیتی"
+		}
+
+		logAdminAction(admin, "resolve_security_event", fmt.Sprintf("Resolved security event %d: %s", eventID, note), "security_event", uint(eventID))
+		return fmt.Sprintf("✅ رویداد امنیتی #%d بسته شد.", eventID)
 
 	default:
 		return "❌ دستور نامعتبر. از `/admin_security` برای راهنما استفاده کنید."
 	}
 }
 
+// formatSecurityEventForAdmin renders one security event for the admin bot
+func formatSecurityEventForAdmin(event *SecurityEvent) string {
+	severityIcon := map[string]string{
+		SeverityLow:      "🟢",
+		SeverityMedium:   "🟡",
+		SeverityHigh:     "🟠",
+		SeverityCritical: "🔴",
+	}[event.Severity]
+
+	description := event.Rule
+	if rule, ok := securityRules[event.Rule]; ok {
+		description = rule.Description
+	}
+
+	return fmt.Sprintf("%s #%d - %s\n👤 %s\n📝 %s\n📅 %s\n\n",
+		severityIcon, event.ID, description,
+		event.Subject,
+		event.Details,
+		event.CreatedAt.Format("2006-01-02 15:04"))
+}
+
+// formatBanForAdmin renders a ban for the admin bot
+func formatBanForAdmin(ban *Ban) string {
+	status := "🔴 فعال"
+	if !ban.IsActive() {
+		status = "⚪️ برداشته شده"
+	}
+
+	expiry := "دائمی"
+	if ban.ExpiresAt != nil {
+		expiry = ban.ExpiresAt.Format("2006-01-02 15:04")
+	}
+
+	issuer := "خودکار"
+	if ban.Admin != nil {
+		issuer = ban.Admin.Username
+	}
+
+	response := fmt.Sprintf("👤 آیدی: %d\n🎯 محدوده: %s\n📝 دلیل: %s\n⏰ پایان: %s\n👮 صادرکننده: %s\n📊 وضعیت: %s\n",
+		ban.TelegramID, banScopeLabel(ban.Scope), ban.Reason, expiry, issuer, status)
+	if ban.AppealTicketID != nil {
+		response += fmt.Sprintf("🎫 تیکت درخواست بررسی: #%d\n", *ban.AppealTicketID)
+	}
+	return response + "\n"
+}
+
 // handleMiniAppSecurity handles Mini App security management
 func handleMiniAppSecurity(admin *Admin, args []string) string {
 	if len(args) == 0 {
@@ -1773,24 +1964,27 @@ func handleMiniAppSecurity(admin *Admin, args []string) string {
 			"• `list` - نمایش کاربران مسدود شده\n" +
 			"• `unblock <user_id>` - آزادسازی کاربر\n" +
 			"• `clear <user_id>` - پاک کردن سوابق مشکوک\n" +
-			"• `block <user_id> [reason]` - مسدود کردن کاربر\n\n" +
+			"• `block <user_id> [hours] [reason]` - مسدود کردن کاربر\n\n" +
 			"مثال:\n" +
 			"`/miniapp_security list`\n" +
 			"`/miniapp_security unblock 76599340`\n" +
 			"`/miniapp_security clear 76599340`\n" +
-			"`/miniapp_security block 76599340 دلیل مسدودیت`"
+			"`/miniapp_security block 76599340 24 دلیل مسدودیت`"
 	}
 
 	switch args[0] {
 	case "list":
-		if len(miniAppBlockedUsers) == 0 {
+		bans, err := listActiveBans(BanScopeMiniApp)
+		if err != nil {
+			return "❌ خطا در دریافت لیست کاربران مسدود شده"
+		}
+		if len(bans) == 0 {
 			return "✅ هیچ کاربری در مینی اپ مسدود نشده است."
 		}
 
 		response := "🚫 **کاربران مسدود شده در مینی اپ:**\n\n"
-		for telegramID := range miniAppBlockedUsers {
-			violationCount := miniAppSuspiciousActivityCount[telegramID]
-			response += fmt.Sprintf("👤 آیدی: %d\n⚠️ تعداد تخلفات: %d\n\n", telegramID, violationCount)
+		for _, ban := range bans {
+			response += formatBanForAdmin(&ban)
 		}
 		return response
 
@@ -1804,14 +1998,14 @@ func handleMiniAppSecurity(admin *Admin, args []string) string {
 			return "❌ آیدی کاربر نامعتبر است"
 		}
 
-		if !miniAppBlockedUsers[userID] {
+		lifted, err := liftBans(userID, BanScopeMiniApp, &admin.ID)
+		if err != nil {
+			return "❌ خطا در آزادسازی کاربر"
+		}
+		if lifted == 0 {
 			return "❌ این کاربر در مینی اپ مسدود نشده است"
 		}
 
-		// Unblock user
-		delete(miniAppBlockedUsers, userID)
-		miniAppSuspiciousActivityCount[userID] = 0
-
 		logger.Info("Mini App user unblocked by admin",
 			zap.Int64("admin_id", admin.TelegramID),
 			zap.Int64("user_id", userID))
@@ -1828,10 +2022,11 @@ func handleMiniAppSecurity(admin *Admin, args []string) string {
 			return "❌ آیدی کاربر نامعتبر است"
 		}
 
-		// Clear suspicious activity
-		miniAppSuspiciousActivityCount[userID] = 0
+		// Clear rate limit state
+		rateLimitMutex.Lock()
 		delete(miniAppRateLimits, userID)
 		delete(miniAppCallCounts, userID)
+		rateLimitMutex.Unlock()
 
 		logger.Info("Mini App user suspicious activity cleared by admin",
 			zap.Int64("admin_id", admin.TelegramID),
@@ -1841,7 +2036,7 @@ func handleMiniAppSecurity(admin *Admin, args []string) string {
 
 	case "block":
 		if len(args) < 2 {
-			return "❌ لطفا آیدی کاربر را وارد کنید: `/miniapp_security block <user_id> [reason]`"
+			return "❌ لطفا آیدی کاربر را وارد کنید: `/miniapp_security block <user_id> [hours] [reason]`"
 		}
 
 		userID, err := strconv.ParseInt(args[1], 10, 64)
@@ -1849,13 +2044,12 @@ func handleMiniAppSecurity(admin *Admin, args []string) string {
 			return "❌ آیدی کاربر نامعتبر است"
 		}
 
-		reason := "Manual block by admin"
-		if len(args) > 2 {
-			reason = strings.Join(args[2:], " ")
-		}
+		duration, reason := parseBanOptions(args[2:])
 
 		// Block user
-		blockMiniAppUser(userID, reason)
+		if err := blockMiniAppUser(userID, reason, duration, &admin.ID); err != nil {
+			return "❌ خطا در مسدود کردن کاربر"
+		}
 
 		logger.Info("Mini App user blocked by admin",
 			zap.Int64("admin_id", admin.TelegramID),
@@ -2112,12 +2306,11 @@ func handleChangePlan(admin *Admin, planType string, userIDStr string) {
 		user.FreeTrialDayTwoSMSSent = true
 		user.FreeTrialExpireSMSSent = true
 	}
-	user.IsActive = true
-
 	if err := db.Save(&user).Error; err != nil {
 		sendMessage(admin.TelegramID, "❌ خطا در به‌روزرسانی اشتراک")
 		return
 	}
+	syncUserBanFlags(user.TelegramID)
 
 	// Notify admin
 	sendMessage(admin.TelegramID, fmt.Sprintf("✅ %s\n\n👤 کاربر: %s (%d)", message, user.Username, user.TelegramID))
@@ -105,6 +105,7 @@ type StatsPayload struct {
 	UnusedLicenseKeys int64                `json:"unusedLicenseKeys"` // Unused license keys
 	AverageProgress   float64              `json:"averageProgress"`   // Average progress percentage across 29 stages
 	AITotalRequests   int64                `json:"aiTotalRequests"`   // Total AI requests count
+	AITokensToday     int64                `json:"aiTokensToday"`     // LLM tokens consumed today (AIUsage)
 	RecentUsers       []User               `json:"recentUsers"`
 	RecentPayments    []PaymentTransaction `json:"recentPayments"`
 	RecentErrors      []ErrorLog           `json:"recentErrors"` // Recent error logs
@@ -380,6 +381,9 @@ func getRealtimeStats() StatsPayload {
 	var aiTotalRequests int64
 	db.Model(&ChatMessage{}).Count(&aiTotalRequests)
 
+	var aiTokensToday int64
+	db.Model(&AIUsage{}).Where("created_at >= ?", today).Select("COALESCE(SUM(total_tokens), 0)").Scan(&aiTokensToday)
+
 	// Recent users (last 10)
 	var recentUsers []User
 	db.Order("created_at DESC").Limit(10).Find(&recentUsers)
@@ -415,6 +419,7 @@ func getRealtimeStats() StatsPayload {
 		UnusedLicenseKeys: unusedLicenseKeys,
 		AverageProgress:   avgProgress,
 		AITotalRequests:   aiTotalRequests,
+		AITokensToday:     aiTokensToday,
 		RecentUsers:       recentUsers,
 		RecentPayments:    recentPayments,
 		RecentErrors:      recentErrors,
@@ -453,6 +458,16 @@ func getSystemAlerts() []Alert {
 		})
 	}
 
+	// Check for unresolved serious security events
+	if openEvents := countOpenSecurityEvents(SeverityHigh, SeverityCritical); openEvents > 0 {
+		alerts = append(alerts, Alert{
+			Type:      "security",
+			Severity:  "critical",
+			Message:   fmt.Sprintf("%d رویداد امنیتی مهم بررسی نشده", openEvents),
+			CreatedAt: time.Now(),
+		})
+	}
+
 	// Check for database connectivity (simplified - if we got here, DB is OK)
 
 	return alerts
@@ -489,6 +504,27 @@ func BroadcastStatsToAdmins() {
 	adminHub.broadcast <- data
 }
 
+// BroadcastSecurityEventToAdmins pushes a new security event to all connected admins
+func BroadcastSecurityEventToAdmins(event *SecurityEvent) {
+	msg := WSMessage{
+		Type:    "security_event",
+		Payload: event,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Failed to marshal security event", zap.Error(err))
+		return
+	}
+
+	// Never block the detector on a full hub
+	select {
+	case adminHub.broadcast <- data:
+	default:
+		logger.Warn("Admin broadcast channel full, dropping security event", zap.Uint("event_id", event.ID))
+	}
+}
+
 // Start stats broadcaster (every 5 seconds)
 func startStatsBroadcaster() {
 	ticker := time.NewTicker(5 * time.Second)
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	"go.uber.org/zap"
+)
+
+// AIClient handles all LLM interactions through the configured provider chain
+type AIClient struct {
+	router  *LLMRouter
+	user    *User // Usage of the calls is recorded for this user (see ForUser)
+	noCache bool  // Skip cached answers (see Uncached)
+}
+
+// NewAIClient creates the AI client from the LLM_* environment (see llm_provider.go)
+func NewAIClient() *AIClient {
+	router := newLLMRouterFromEnv()
+	if len(router.Providers()) == 0 {
+		logger.Error("No LLM provider configured")
+		return nil
+	}
+
+	logger.Info("AI client initialized successfully",
+		zap.Strings("providers", router.Providers()))
+
+	return &AIClient{
+		router: router,
+	}
+}
+
+// ForUser returns a client whose calls are recorded in AIUsage for user
+func (g *AIClient) ForUser(user *User) *AIClient {
+	if g == nil {
+		return nil
+	}
+	return &AIClient{router: g.router, user: user, noCache: g.noCache}
+}
+
+// Uncached returns a client whose calls always reach a provider, for when the user asks for
+// a new answer to the same request
+func (g *AIClient) Uncached() *AIClient {
+	if g == nil {
+		return nil
+	}
+	return &AIClient{router: g.router, user: g.user, noCache: true}
+}
+
+// GenerateChatResponse generates a chat response with the model configured for feature
+func (g *AIClient) GenerateChatResponse(feature, systemPrompt, userMessage string, maxTokens int) (*LLMResponse, error) {
+	return g.generate(feature, []LLMMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userMessage},
+	}, maxTokens)
+}
+
+// generate sends a full message list to the provider chain
+func (g *AIClient) generate(feature string, messages []LLMMessage, maxTokens int) (*LLMResponse, error) {
+	return g.generateWithTools(feature, messages, maxTokens, nil)
+}
+
+// generateWithTools is generate with tools offered to the model. Requested calls are run for
+// g.user and the model is asked again with their results, at most maxToolRounds times.
+func (g *AIClient) generateWithTools(feature string, messages []LLMMessage, maxTokens int, tools []ChatTool) (*LLMResponse, error) {
+	if g == nil || g.router == nil {
+		return nil, fmt.Errorf("AI client not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	if g.noCache {
+		ctx = withoutLLMCache(ctx)
+	}
+
+	for round := 0; ; round++ {
+		req := LLMRequest{
+			Messages:    messages,
+			MaxTokens:   maxTokens,
+			Temperature: 0.7,
+		}
+		if round < maxToolRounds {
+			req.Tools = llmTools(tools)
+		}
+
+		start := time.Now()
+		resp, err := g.router.Complete(ctx, feature, req)
+		if err != nil {
+			logger.Error("LLM API error",
+				zap.Error(err),
+				zap.String("feature", feature))
+			return nil, err
+		}
+		if !resp.Cached {
+			recordAIUsage(g.user, feature, messages, resp, time.Since(start))
+		}
+
+		if len(req.Tools) == 0 || len(resp.ToolCalls) == 0 {
+			// 🔒 SECURITY: An answer repeating the system prompt never reaches the user
+			if newPromptLeakGuard(messages).leaks(resp.Content) {
+				reportPromptLeak(g.user, feature, resp.Provider+"/"+resp.Model)
+				resp.Content = promptLeakReply
+			}
+			logger.Info("LLM response received",
+				zap.Int("response_length", len(resp.Content)),
+				zap.String("feature", feature),
+				zap.String("provider", resp.Provider),
+				zap.String("model", resp.Model),
+				zap.Bool("cached", resp.Cached),
+				zap.Int("tool_rounds", round))
+			return resp, nil
+		}
+		messages = appendToolRound(messages, g.user, tools, resp)
+	}
+}
+
+// appendToolRound returns messages followed by the model's tool request and the tool results.
+// messages is copied so the caller's slice is never written to.
+func appendToolRound(messages []LLMMessage, user *User, tools []ChatTool, resp *LLMResponse) []LLMMessage {
+	next := make([]LLMMessage, 0, len(messages)+1+len(resp.ToolCalls))
+	next = append(next, messages...)
+	next = append(next, LLMMessage{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+	return append(next, runToolCalls(user, tools, resp.ToolCalls)...)
+}
+
+// toolsFor returns the chat tools offered for feature: chat only, and only for a known user
+func (g *AIClient) toolsFor(feature string) []ChatTool {
+	if feature != FeatureChat || g == nil || g.user == nil || !chatToolsEnabled() {
+		return nil
+	}
+	return chatTools
+}
+
+// buildMonetizeAIMessages builds the prompt: persona, relevant course content (chat only),
+// running summary, stored turns, then the new message
+func buildMonetizeAIMessages(feature, userMessage string, conv *ConversationContext) []LLMMessage {
+	messages := []LLMMessage{{Role: "system", Content: renderPrompt(PromptChatSystem, nil)}}
+	if feature == FeatureChat {
+		if course := courseContextMessage(userMessage, conv); course != "" {
+			messages = append(messages, LLMMessage{Role: "system", Content: course})
+		}
+	}
+	if conv != nil {
+		if conv.Summary != "" {
+			messages = append(messages, LLMMessage{
+				Role:    "system",
+				Content: "خلاصه گفتگوهای قبلی با این کاربر (برای تداوم گفتگو):\n" + conv.Summary,
+			})
+		}
+		messages = append(messages, conv.Turns...)
+	}
+	return append(messages, LLMMessage{Role: "user", Content: userMessage})
+}
+
+// GenerateMonetizeAIResponse generates response for MonetizeAI bot users
+// feature selects the model (chat or one of the mini app tools)
+// conv: stored conversation memory, nil for one-off prompts such as the mini app tools
+func (g *AIClient) GenerateMonetizeAIResponse(feature, userMessage string, conv *ConversationContext) (*LLMResponse, error) {
+	resp, err := g.generateWithTools(feature, buildMonetizeAIMessages(feature, userMessage, conv), 4000, g.toolsFor(feature))
+	if err != nil {
+		return nil, err
+	}
+	resp.Content = sanitizePersianText(resp.Content)
+	return resp, nil
+}
+
+// StreamMonetizeAIResponse is GenerateMonetizeAIResponse with sanitized chunks sent to onDelta as they arrive.
+// Cancelling ctx (e.g. client disconnect) cancels the upstream request.
+func (g *AIClient) StreamMonetizeAIResponse(ctx context.Context, feature, userMessage string, conv *ConversationContext, onDelta func(string) error) (*LLMResponse, error) {
+	if g == nil || g.router == nil {
+		return nil, fmt.Errorf("AI client not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
+	defer cancel()
+	if g.noCache {
+		ctx = withoutLLMCache(ctx)
+	}
+
+	var sanitizer persianSanitizer
+	var content strings.Builder
+	messages := buildMonetizeAIMessages(feature, userMessage, conv)
+	tools := g.toolsFor(feature)
+	leakGuard := newPromptLeakGuard(messages)
+	for round := 0; ; round++ {
+		req := LLMRequest{
+			Messages:    messages,
+			MaxTokens:   4000,
+			Temperature: 0.7,
+		}
+		if round < maxToolRounds {
+			req.Tools = llmTools(tools)
+		}
+
+		start := time.Now()
+		resp, err := g.router.Stream(ctx, feature, req, func(delta string) error {
+			clean := sanitizer.Write(delta)
+			if clean == "" {
+				return nil
+			}
+			content.WriteString(clean)
+			// 🔒 SECURITY: The stream stops as soon as it repeats a line of the system prompt
+			if leakGuard.leaksTail(content.String(), clean) {
+				return errAIOutputBlocked
+			}
+			return onDelta(clean)
+		})
+		if errors.Is(err, errAIOutputBlocked) {
+			reportPromptLeak(g.user, feature, "stream")
+			return nil, err
+		}
+		if err != nil {
+			logger.Error("LLM stream error",
+				zap.Error(err),
+				zap.String("feature", feature))
+			return nil, err
+		}
+		if !resp.Cached {
+			recordAIUsage(g.user, feature, messages, resp, time.Since(start))
+		}
+
+		if len(req.Tools) == 0 || len(resp.ToolCalls) == 0 {
+			resp.Content = content.String()
+			logger.Info("LLM stream completed",
+				zap.Int("response_length", len(resp.Content)),
+				zap.String("feature", feature),
+				zap.String("provider", resp.Provider),
+				zap.String("model", resp.Model),
+				zap.Bool("cached", resp.Cached),
+				zap.Int("tool_rounds", round))
+			return resp, nil
+		}
+		messages = appendToolRound(messages, g.user, tools, resp)
+	}
+}
+
+// SummarizeConversation folds older turns into the running summary of a user's conversation
+func (g *AIClient) SummarizeConversation(previousSummary string, turns []LLMMessage) (*LLMResponse, error) {
+	systemPrompt := renderPrompt(PromptChatSummarySystem, nil)
+
+	var transcript strings.Builder
+	if previousSummary != "" {
+		transcript.WriteString("خلاصه قبلی:\n")
+		transcript.WriteString(previousSummary)
+		transcript.WriteString("\n\n")
+	}
+	transcript.WriteString("ادامه گفتگو:\n")
+	for _, turn := range turns {
+		if turn.Role == "assistant" {
+			transcript.WriteString("دستیار: ")
+		} else {
+			transcript.WriteString("کاربر: ")
+		}
+		transcript.WriteString(turn.Content)
+		transcript.WriteString("\n")
+	}
+
+	resp, err := g.GenerateChatResponse(FeatureChatSummary, systemPrompt, transcript.String(), 600)
+	if err != nil {
+		return nil, err
+	}
+	resp.Content = strings.TrimSpace(sanitizePersianText(resp.Content))
+	return resp, nil
+}
+
+// TranscribeAudio turns a Persian voice message into text. audioSeconds is the length reported
+// by Telegram, recorded when the provider does not return one.
+func (g *AIClient) TranscribeAudio(audio []byte, fileName string, audioSeconds int) (*TranscriptionResponse, error) {
+	if g == nil || g.router == nil {
+		return nil, fmt.Errorf("AI client not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := g.router.Transcribe(ctx, TranscriptionRequest{
+		Audio:    audio,
+		FileName: fileName,
+		Language: "fa",
+	})
+	if err != nil {
+		logger.Error("Transcription API error", zap.Error(err))
+		return nil, err
+	}
+	recordTranscriptionUsage(g.user, resp, audioSeconds, time.Since(start))
+	return resp, nil
+}
+
+// Helper functions
+func sanitizePersianText(s string) string {
+	var sanitizer persianSanitizer
+	return sanitizer.Write(s) + sanitizer.Flush()
+}
+
+// persianSanitizer applies sanitizePersianText to a stream of chunks.
+// It keeps the space-collapsing state and holds back a rune split across chunks.
+type persianSanitizer struct {
+	lastSpace bool
+	pending   []byte
+}
+
+// Write sanitizes the next chunk and returns the text that is safe to emit
+func (ps *persianSanitizer) Write(chunk string) string {
+	data := append(ps.pending, chunk...)
+	ps.pending = nil
+
+	// Keep an incomplete trailing UTF-8 sequence for the next chunk
+	if cut := incompleteUTF8Suffix(data); cut > 0 {
+		ps.pending = append([]byte(nil), data[len(data)-cut:]...)
+		data = data[:len(data)-cut]
+	}
+
+	out := make([]rune, 0, len(data))
+	for _, r := range string(data) {
+		if isAllowedPersianRune(r) {
+			// collapse consecutive spaces
+			if r == ' ' {
+				if ps.lastSpace {
+					continue
+				}
+				ps.lastSpace = true
+			} else {
+				if r != '\n' && r != '\t' && r != '\r' {
+					ps.lastSpace = false
+				}
+			}
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
+
+// Flush drops whatever is left; an incomplete rune at the end of the stream is invalid text
+func (ps *persianSanitizer) Flush() string {
+	ps.pending = nil
+	return ""
+}
+
+// incompleteUTF8Suffix returns the length of a truncated multi-byte rune at the end of data
+func incompleteUTF8Suffix(data []byte) int {
+	for i := 1; i <= 3 && i <= len(data); i++ {
+		b := data[len(data)-i]
+		if b&0xC0 == 0x80 {
+			continue // continuation byte, keep looking for the lead byte
+		}
+		if b&0xE0 == 0xC0 && i < 2 || b&0xF0 == 0xE0 && i < 3 || b&0xF8 == 0xF0 && i < 4 {
+			return i
+		}
+		return 0
+	}
+	return 0
+}
+
+func isAllowedPersianRune(r rune) bool {
+	// Persian/Arabic letters and marks
+	if (r >= 0x0600 && r <= 0x06FF) || // Arabic block (includes Persian letters and punctuation like ، ؛ ؟)
+		(r >= 0x0750 && r <= 0x077F) || // Arabic Supplement
+		(r >= 0x08A0 && r <= 0x08FF) { // Arabic Extended-A
+		return true
+	}
+	// Arabic Presentation Forms (punctuation variants)
+	if (r >= 0xFB50 && r <= 0xFDFF) || (r >= 0xFE70 && r <= 0xFEFF) {
+		return true
+	}
+	// Persian digits ۰-۹ and Arabic-Indic digits ٠-٩
+	if (r >= 0x06F0 && r <= 0x06F9) || (r >= 0x0660 && r <= 0x0669) {
+		return true
+	}
+	// English digits 0-9 (for numbers and code)
+	if r >= '0' && r <= '9' {
+		return true
+	}
+	// English letters A-Z, a-z (for code, technical terms, URLs)
+	if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') {
+		return true
+	}
+	// ZWNJ
+	if r == 0x200C {
+		return true
+	}
+	// Common whitespace
+	if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+		return true
+	}
+	// Allow extended punctuation and symbols for code and technical content
+	switch r {
+	case '.', ',', '!', '?', ':', ';', '(', ')', '[', ']', '{', '}', '«', '»', '"', '\'', '-', '_', '%', '+', '=', '/', '\\', '…',
+		'<', '>', '|', '&', '*', '^', '~', '`', '@', '#', '$':
+		return true
+	}
+	return false
+}
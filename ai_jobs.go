@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AI job queue: chat questions that failed and tool requests sent with "async": true are
+// stored as jobs and run by a worker pool of AI_JOB_CONCURRENCY, retried with exponential
+// backoff while the providers fail. Answers are sent to the user's Telegram chat or polled
+// by the mini app with the job ID. Jobs survive restarts.
+
+const (
+	aiJobPollInterval       = 5 * time.Second
+	aiJobRetryBase          = 30 * time.Second // Delay after the first failure, doubled after each one
+	aiJobMaxBackoff         = 30 * time.Minute
+	aiJobMaxAttempts        = 8
+	aiJobLease              = 15 * time.Minute // A running job not finished by then is assumed lost with its instance
+	defaultAIJobConcurrency = 2
+)
+
+// AI job kinds
+const (
+	AIJobChat = "chat" // A chat message answered in its thread
+	AIJobTool = "tool" // A tool of the registry run on a stored form
+)
+
+// AI job statuses
+const (
+	AIJobQueued  = "queued"
+	AIJobRunning = "running"
+	AIJobDone    = "done"
+	AIJobFailed  = "failed" // Gave up, or the request is no longer allowed
+)
+
+// Where a job was submitted: bot answers are sent with the chat keyboard and count like bot
+// messages, mini app answers like mini app messages
+const (
+	AIJobSourceBot     = "bot"
+	AIJobSourceMiniApp = "mini_app"
+)
+
+// AIJob is one queued AI request
+type AIJob struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	TelegramID        int64      `gorm:"index" json:"telegram_id"`
+	Kind              string     `gorm:"size:16" json:"kind"`
+	Source            string     `gorm:"size:16" json:"source"`
+	Tool              string     `gorm:"size:64" json:"tool,omitempty"` // Registry name of a tool job
+	ThreadID          *uint      `json:"thread_id,omitempty"`           // Thread of a chat job
+	Input             string     `gorm:"type:text" json:"-"`            // Chat message or tool form (JSON)
+	DeliverToTelegram bool       `json:"deliver_to_telegram"`
+	Status            string     `gorm:"size:16;index" json:"status"`
+	Attempts          int        `json:"attempts"`
+	LastError         string     `gorm:"size:500" json:"-"`
+	NextAttemptAt     *time.Time `gorm:"index" json:"next_attempt_at,omitempty"`
+	ClaimedAt         *time.Time `json:"-"`                                         // When a worker started the running attempt, see aiJobLease
+	Response          string     `gorm:"type:mediumtext" json:"response,omitempty"` // Answer of a chat job
+	MessageID         *uint      `json:"message_id,omitempty"`                      // ChatMessage of the answer
+	ResultID          *uint      `json:"result_id,omitempty"`                       // ToolResult of a tool job
+	Provider          string     `gorm:"size:32" json:"provider,omitempty"`
+	Model             string     `gorm:"size:100" json:"model,omitempty"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// errAIJobRejected fails a job without retrying: the request itself is no longer valid
+var errAIJobRejected = errors.New("job rejected")
+
+// aiJobWake starts a dispatch without waiting for the next tick
+var aiJobWake = make(chan struct{}, 1)
+
+// aiJobConcurrency is AI_JOB_CONCURRENCY, the number of jobs run at once. Keep it within
+// what the provider's rate limits allow next to the live traffic.
+func aiJobConcurrency() int {
+	if n, err := strconv.Atoi(os.Getenv("AI_JOB_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return defaultAIJobConcurrency
+}
+
+// aiJobBackoff is the delay before the next attempt after attempts failed ones
+func aiJobBackoff(attempts int) time.Duration {
+	delay := time.Duration(float64(aiJobRetryBase) * math.Pow(2, float64(attempts-1)))
+	if delay > aiJobMaxBackoff || delay <= 0 {
+		return aiJobMaxBackoff
+	}
+	return delay
+}
+
+// queueAfterFailure schedules the next attempt, or gives up after aiJobMaxAttempts and on
+// rejected requests
+func (j *AIJob) queueAfterFailure(err error) {
+	j.LastError = err.Error()
+	if len([]rune(j.LastError)) > 500 {
+		j.LastError = string([]rune(j.LastError)[:500])
+	}
+	if j.Attempts >= aiJobMaxAttempts || errors.Is(err, errAIJobRejected) {
+		now := time.Now()
+		j.Status, j.NextAttemptAt, j.FinishedAt = AIJobFailed, nil, &now
+		return
+	}
+	next := time.Now().Add(aiJobBackoff(j.Attempts))
+	j.Status, j.NextAttemptAt = AIJobQueued, &next
+}
+
+// enqueueAIJob stores a job to run after delay
+func enqueueAIJob(job *AIJob, delay time.Duration) error {
+	next := time.Now().Add(delay)
+	job.Status, job.NextAttemptAt = AIJobQueued, &next
+	if err := db.Create(job).Error; err != nil {
+		return err
+	}
+	metrics.IncAIJob(job.Kind, "queued")
+	logger.Info("AI job queued",
+		zap.Uint("job_id", job.ID),
+		zap.Int64("user_id", job.TelegramID),
+		zap.String("kind", job.Kind),
+		zap.String("tool", job.Tool),
+		zap.Duration("delay", delay))
+
+	if delay <= 0 {
+		select {
+		case aiJobWake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// requeueStaleAIJobs runs jobs again whose worker stopped mid-attempt (a restart or a crashed
+// instance). Only claims older than aiJobLease are taken back, other instances may still be
+// running the newer ones.
+func requeueStaleAIJobs(now time.Time) {
+	result := db.Model(&AIJob{}).
+		Where("status = ? AND (claimed_at IS NULL OR claimed_at < ?)", AIJobRunning, now.Add(-aiJobLease)).
+		Updates(map[string]interface{}{"status": AIJobQueued, "next_attempt_at": now, "claimed_at": nil})
+	if result.Error != nil {
+		logger.Error("Failed to requeue interrupted AI jobs", zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected > 0 {
+		logger.Warn("Interrupted AI jobs requeued", zap.Int64("count", result.RowsAffected))
+	}
+}
+
+// StartAIJobWorker runs due jobs in the background, at most aiJobConcurrency at once
+func StartAIJobWorker() {
+	requeueStaleAIJobs(time.Now())
+
+	slots := make(chan struct{}, aiJobConcurrency())
+	go func() {
+		ticker := time.NewTicker(aiJobPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-aiJobWake:
+			}
+			requeueStaleAIJobs(time.Now())
+			dispatchAIJobs(slots)
+		}
+	}()
+
+	logger.Info("AI job worker started", zap.Int("concurrency", cap(slots)))
+}
+
+// dispatchAIJobs claims due jobs for the free slots of the pool and runs them
+func dispatchAIJobs(slots chan struct{}) {
+	free := cap(slots) - len(slots)
+	if free <= 0 {
+		return
+	}
+
+	var jobs []AIJob
+	if err := db.Where("status = ? AND next_attempt_at <= ?", AIJobQueued, time.Now()).
+		Order("next_attempt_at ASC").Limit(free).
+		Find(&jobs).Error; err != nil {
+		logger.Error("Failed to load queued AI jobs", zap.Error(err))
+		return
+	}
+
+	for i := range jobs {
+		job := jobs[i]
+		// Claim the job: another instance may have taken it since it was loaded
+		now := time.Now()
+		claim := db.Model(&AIJob{}).Where("id = ? AND status = ?", job.ID, AIJobQueued).
+			Updates(map[string]interface{}{"status": AIJobRunning, "claimed_at": now})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+		job.Status, job.ClaimedAt = AIJobRunning, &now
+
+		slots <- struct{}{}
+		go func() {
+			defer func() { <-slots }()
+			runAIJob(&job)
+		}()
+	}
+}
+
+// runAIJob makes one attempt at a job and delivers it once it is finished
+func runAIJob(job *AIJob) {
+	job.Attempts++
+	var user User
+	err := db.Where("telegram_id = ?", job.TelegramID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = fmt.Errorf("%w: user not found", errAIJobRejected)
+	}
+	if err == nil {
+		switch job.Kind {
+		case AIJobChat:
+			err = runChatJob(job, &user)
+		case AIJobTool:
+			err = runToolJob(job, &user)
+		default:
+			err = fmt.Errorf("%w: unknown kind %q", errAIJobRejected, job.Kind)
+		}
+	}
+
+	if err == nil {
+		now := time.Now()
+		job.Status, job.NextAttemptAt, job.FinishedAt, job.LastError = AIJobDone, nil, &now, ""
+	} else {
+		job.queueAfterFailure(err)
+		logger.Warn("AI job failed",
+			zap.Uint("job_id", job.ID),
+			zap.Int64("user_id", job.TelegramID),
+			zap.String("kind", job.Kind),
+			zap.Int("attempts", job.Attempts),
+			zap.String("status", job.Status),
+			zap.Error(err))
+	}
+	job.ClaimedAt = nil
+	if err := db.Save(job).Error; err != nil {
+		logger.Error("Failed to save AI job", zap.Uint("job_id", job.ID), zap.Error(err))
+		return
+	}
+
+	if job.Status == AIJobQueued {
+		metrics.IncAIJob(job.Kind, "retry")
+		return
+	}
+	metrics.IncAIJob(job.Kind, job.Status)
+	logger.Info("AI job finished",
+		zap.Uint("job_id", job.ID),
+		zap.Int64("user_id", job.TelegramID),
+		zap.String("status", job.Status),
+		zap.Int("attempts", job.Attempts))
+	deliverAIJob(job)
+}
+
+// runChatJob answers a chat message in its thread
+func runChatJob(job *AIJob, user *User) error {
+	// 🔒 SECURITY: A ban issued while the job waited still applies
+	if ban := getActiveBan(user.TelegramID, BanScopeChat); ban != nil {
+		return fmt.Errorf("%w: banned from chat", errAIJobRejected)
+	}
+	if aiClient == nil {
+		return errors.New("AI client not initialized")
+	}
+
+	thread, err := resolveChatThread(user.TelegramID, job.ThreadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: thread not found", errAIJobRejected)
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := aiClient.ForUser(user).GenerateMonetizeAIResponse(FeatureChat, job.Input, loadConversationContext(thread))
+	if err != nil {
+		return err
+	}
+
+	var message *ChatMessage
+	if job.Source == AIJobSourceMiniApp {
+		message = recordChatExchange(user, thread, job.Input, resp.Content, resp)
+	} else {
+		message = storeChatMessage(thread, job.Input, resp.Content, resp)
+	}
+	if message != nil && message.ID != 0 {
+		job.MessageID = &message.ID
+	}
+	job.Response, job.Provider, job.Model = resp.Content, resp.Provider, resp.Model
+	return nil
+}
+
+// runToolJob runs a tool on the stored form and saves the result
+func runToolJob(job *AIJob, user *User) error {
+	tool := findTool(job.Tool)
+	if tool == nil {
+		return fmt.Errorf("%w: unknown tool %q", errAIJobRejected, job.Tool)
+	}
+	if ban := getActiveBan(user.TelegramID, BanScopeMiniApp); ban != nil {
+		return fmt.Errorf("%w: banned from the mini app", errAIJobRejected)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(job.Input), &raw); err != nil {
+		return fmt.Errorf("%w: %v", errAIJobRejected, err)
+	}
+	stored, vars, errs := tool.parseInput(raw)
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: invalid form: %v", errAIJobRejected, errs)
+	}
+
+	run, err := tool.run(user, vars, false)
+	if err != nil {
+		return err
+	}
+	result := saveToolResult(user, tool.Feature, tool.resultTitle(run.Output, vars), stored, run, nil)
+	if result == nil {
+		return errors.New("tool result not saved")
+	}
+	job.ResultID = &result.ID
+	return nil
+}
+
+// deliverAIJob sends a finished job to the user's Telegram chat when asked to
+func deliverAIJob(job *AIJob) {
+	if !job.DeliverToTelegram || bot == nil {
+		return
+	}
+
+	if job.Status == AIJobFailed {
+		text := "❌ متاسفانه پاسخ درخواست شما آماده نشد. لطفا دوباره تلاش کنید."
+		if job.Kind == AIJobChat {
+			text = fmt.Sprintf("❌ متاسفانه پاسخ سوال شما آماده نشد:\n«%s»\n\nلطفا دوباره تلاش کنید.", truncateRunes(job.Input, 200))
+		}
+		sendMessage(job.TelegramID, text)
+		return
+	}
+
+	if job.Kind == AIJobChat {
+		msg := tgbotapi.NewMessage(job.TelegramID, fmt.Sprintf("🔔 پاسخ سوال شما:\n«%s»\n\n%s", truncateRunes(job.Input, 200), job.Response))
+		if job.Source == AIJobSourceBot && job.MessageID != nil {
+			msg.ReplyMarkup = ratingKeyboard(RatingTargetChatMessage, *job.MessageID, 0)
+		} else if job.Source == AIJobSourceBot {
+			msg.ReplyMarkup = getChatKeyboard()
+		}
+		if _, err := bot.Send(msg); err != nil {
+			logger.Error("Failed to deliver AI job", zap.Uint("job_id", job.ID), zap.Error(err))
+		}
+		return
+	}
+
+	var result ToolResult
+	if job.ResultID == nil || db.First(&result, *job.ResultID).Error != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	name, _, data, err := exportToolResult(ctx, &result, "md")
+	if err != nil {
+		logger.Error("Failed to export tool result of AI job", zap.Uint("job_id", job.ID), zap.Error(err))
+		return
+	}
+	doc := tgbotapi.NewDocument(job.TelegramID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = fmt.Sprintf("✅ %s آماده شد\n%s", toolByFeature(result.Tool).Title, result.Title)
+	doc.ReplyMarkup = ratingKeyboard(RatingTargetToolResult, result.ID, 0)
+	if _, err := bot.Send(doc); err != nil {
+		logger.Error("Failed to deliver AI job", zap.Uint("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// ==========================================
+// Mini App API
+// ==========================================
+
+// aiJobView is a job as polled by the mini app, with the saved result of a tool job
+type aiJobView struct {
+	AIJob
+	Result *ToolResultDetail `json:"result,omitempty"`
+}
+
+// getAIJobAPI handles GET /api/v1/user/:telegram_id/jobs/:job_id
+func getAIJobAPI(c *gin.Context) {
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+	jobID, err := strconv.ParseUint(c.Param("job_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid job_id",
+		})
+		return
+	}
+
+	var view aiJobView
+	if err := db.Where("id = ? AND telegram_id = ?", jobID, telegramID).First(&view.AIJob).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "Job not found",
+			})
+			return
+		}
+		logger.Error("Failed to load AI job", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	if view.ResultID != nil {
+		var result ToolResult
+		if err := db.First(&result, *view.ResultID).Error; err == nil {
+			detail := result.detail()
+			view.Result = &detail
+		}
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    view,
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestAIJobRetries covers the exponential backoff of failed jobs, giving up after the last
+// attempt and failing rejected requests at once.
+func TestAIJobRetries(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 7: 30 * time.Minute} {
+		if got := aiJobBackoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts: got %v, want %v", attempts, got, want)
+		}
+	}
+
+	job := &AIJob{Attempts: 3}
+	job.queueAfterFailure(errors.New("all LLM providers failed"))
+	if job.Status != AIJobQueued || job.NextAttemptAt == nil || time.Until(*job.NextAttemptAt) < time.Minute {
+		t.Errorf("job should be retried in 2 minutes, got %+v", job)
+	}
+
+	job.Attempts = aiJobMaxAttempts
+	job.queueAfterFailure(errors.New("still down"))
+	if job.Status != AIJobFailed || job.NextAttemptAt != nil || job.FinishedAt == nil {
+		t.Errorf("job should give up after %d attempts, got %+v", aiJobMaxAttempts, job)
+	}
+
+	job = &AIJob{Attempts: 1}
+	job.queueAfterFailure(fmt.Errorf("%w: banned from chat", errAIJobRejected))
+	if job.Status != AIJobFailed {
+		t.Errorf("rejected jobs must not be retried, got %q", job.Status)
+	}
+
+	t.Setenv("AI_JOB_CONCURRENCY", "5")
+	if n := aiJobConcurrency(); n != 5 {
+		t.Errorf("expected a pool of 5, got %d", n)
+	}
+}
+
+// TestOnlyProviderOutagesAreQueued checks chat messages are only queued as AI jobs for errors
+// that can pass: timeouts, 5xx and 429 from a provider, also behind the router's wrapping.
+func TestOnlyProviderOutagesAreQueued(t *testing.T) {
+	for err, want := range map[error]bool{
+		fmt.Errorf("all LLM providers failed: %w", &LLMError{Provider: "groq", StatusCode: http.StatusTooManyRequests, Err: errors.New("slow down")}): true,
+		&LLMError{Provider: "groq", StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}:                                                true,
+		&LLMError{Provider: "ollama", Err: context.DeadlineExceeded}:                                                                                  true,
+		&LLMError{Provider: "groq", StatusCode: http.StatusBadRequest, Err: errors.New("context too long")}:                                           false,
+		errors.New("AI client not initialized"):                                                                                                       false,
+		nil:                                                                                                                                           false,
+	} {
+		if got := isRetryableLLMError(err); got != want {
+			t.Errorf("isRetryableLLMError(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+// TestRequeueStaleAIJobs checks only running jobs whose claim outlived aiJobLease are taken
+// back, so a restarting instance leaves the jobs of other instances alone
+func TestRequeueStaleAIJobs(t *testing.T) {
+	useTestDB(t, &AIJob{})
+
+	now := time.Now()
+	fresh, stale := now.Add(-time.Minute), now.Add(-aiJobLease-time.Minute)
+	jobs := []AIJob{
+		{Kind: AIJobChat, Status: AIJobRunning, ClaimedAt: &fresh}, // Another instance is running it
+		{Kind: AIJobChat, Status: AIJobRunning, ClaimedAt: &stale}, // Its instance died
+		{Kind: AIJobChat, Status: AIJobRunning},                    // Claimed before leases existed
+		{Kind: AIJobChat, Status: AIJobDone, ClaimedAt: &stale},
+	}
+	for i := range jobs {
+		mustCreate(t, &jobs[i])
+	}
+
+	requeueStaleAIJobs(now)
+
+	want := []string{AIJobRunning, AIJobQueued, AIJobQueued, AIJobDone}
+	for i, job := range jobs {
+		var stored AIJob
+		if err := db.First(&stored, job.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != want[i] {
+			t.Errorf("job %d: status %q, want %q", i, stored.Status, want[i])
+		}
+		if stored.Status == AIJobQueued && (stored.ClaimedAt != nil || stored.NextAttemptAt == nil) {
+			t.Errorf("job %d: requeued job should be due and unclaimed: %+v", i, stored)
+		}
+	}
+}
+
+// TestAsyncToolRequestRequiresAccountOwner asserts an async tool request with bot delivery
+// for another user's telegram_id is refused before a job is queued, so the bot can't be made
+// to message arbitrary users.
+func TestAsyncToolRequestRequiresAccountOwner(t *testing.T) {
+	useTestDB(t, &User{}, &AIJob{})
+	mustCreate(t, &User{TelegramID: 2002, Username: "victim", IsActive: true})
+
+	r := sessionRouter(1001)
+	r.POST("/api/v1/tools/:name", handleToolRequestAPI)
+
+	body := `{"telegram_id": 2002, "product": "دوره", "target_client": "طراحان", "async": true, "deliver_to_telegram": true}`
+	if w := serveJSON(r, http.MethodPost, "/api/v1/tools/clientfinder", body); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another user's telegram_id, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var jobs int64
+	db.Model(&AIJob{}).Count(&jobs)
+	if jobs != 0 {
+		t.Errorf("forged request queued %d AI jobs", jobs)
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AIUsage is one successful LLM call with its token usage
+type AIUsage struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	TelegramID       int64     `gorm:"index:idx_ai_usage_user_time" json:"telegram_id"` // 0 for calls not made for a user (admin previews)
+	Plan             string    `gorm:"size:32;index" json:"plan"`
+	Feature          string    `gorm:"size:32;index" json:"feature"`
+	Provider         string    `gorm:"size:32" json:"provider"`
+	Model            string    `gorm:"size:100" json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	AudioSeconds     int       `json:"audio_seconds"` // Transcriptions: length of the audio
+	Estimated        bool      `json:"estimated"`     // The provider reported no usage, counts are estimates
+	LatencyMs        int64     `json:"latency_ms"`
+	CreatedAt        time.Time `gorm:"index:idx_ai_usage_user_time;index" json:"created_at"`
+}
+
+// TokenQuota is the token allowance of a plan, 0 means unlimited
+type TokenQuota struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// ModelPrice is the price of a model in USD per million tokens, or per audio minute for
+// speech-to-text models
+type ModelPrice struct {
+	Input     float64 `json:"input"`
+	Output    float64 `json:"output"`
+	PerMinute float64 `json:"per_minute,omitempty"`
+}
+
+// Usage plans: User.PlanName, plus "free" for users without an active subscription
+// and "lifetime" for verified users from before subscriptions existed
+const (
+	UsagePlanFree     = "free"
+	UsagePlanLifetime = "lifetime"
+)
+
+// defaultTokenQuotas apply unless AI_TOKEN_QUOTA_<PLAN>=daily/monthly is set
+var defaultTokenQuotas = map[string]TokenQuota{
+	UsagePlanFree:     {Daily: 20000, Monthly: 100000},
+	"free_trial":      {Daily: 50000, Monthly: 300000},
+	"starter":         {Daily: 200000, Monthly: 3000000},
+	"pro":             {Daily: 500000, Monthly: 10000000},
+	"ultimate":        {},
+	UsagePlanLifetime: {},
+}
+
+// defaultModelPrices apply unless AI_MODEL_PRICES=model=input/output,... is set
+var defaultModelPrices = map[string]ModelPrice{
+	"llama-3.3-70b-versatile": {Input: 0.59, Output: 0.79},
+	"llama-3.1-8b-instant":    {Input: 0.05, Output: 0.08},
+	"gpt-4o-mini":             {Input: 0.15, Output: 0.60},
+	"gpt-4o":                  {Input: 2.50, Output: 10.00},
+	"whisper-large-v3-turbo":  {PerMinute: 0.04 / 60},
+	"whisper-large-v3":        {PerMinute: 0.111 / 60},
+	"whisper-1":               {PerMinute: 0.006},
+}
+
+// defaultTranscriptionMinutes are the monthly voice transcription minutes of each plan, 0 means
+// unlimited, unless AI_TRANSCRIPTION_MINUTES_<PLAN> is set
+var defaultTranscriptionMinutes = map[string]int64{
+	UsagePlanFree:     3,
+	"free_trial":      10,
+	"starter":         60,
+	"pro":             180,
+	"ultimate":        0,
+	UsagePlanLifetime: 0,
+}
+
+// usagePlan returns the plan a user's AI usage is counted against
+func usagePlan(user *User) string {
+	if user == nil {
+		return ""
+	}
+	if !user.HasActiveSubscription() {
+		return UsagePlanFree
+	}
+	if user.PlanName == "" {
+		return UsagePlanLifetime
+	}
+	return user.PlanName
+}
+
+// parseTokenQuota parses "daily/monthly"
+func parseTokenQuota(value string) (TokenQuota, bool) {
+	daily, monthly, found := strings.Cut(value, "/")
+	if !found {
+		return TokenQuota{}, false
+	}
+	d, errDaily := strconv.ParseInt(strings.TrimSpace(daily), 10, 64)
+	m, errMonthly := strconv.ParseInt(strings.TrimSpace(monthly), 10, 64)
+	if errDaily != nil || errMonthly != nil || d < 0 || m < 0 {
+		return TokenQuota{}, false
+	}
+	return TokenQuota{Daily: d, Monthly: m}, true
+}
+
+// tokenQuotaFor returns the quota of a plan; unknown plans get the free quota
+func tokenQuotaFor(plan string) TokenQuota {
+	key := "AI_TOKEN_QUOTA_" + strings.ToUpper(plan)
+	if value := os.Getenv(key); value != "" {
+		if quota, ok := parseTokenQuota(value); ok {
+			return quota
+		}
+		logger.Warn("Invalid token quota, using default", zap.String("env", key), zap.String("value", value))
+	}
+	if quota, ok := defaultTokenQuotas[plan]; ok {
+		return quota
+	}
+	return defaultTokenQuotas[UsagePlanFree]
+}
+
+// modelPrices returns the default prices overridden by AI_MODEL_PRICES
+func modelPrices() map[string]ModelPrice {
+	prices := make(map[string]ModelPrice, len(defaultModelPrices))
+	for model, price := range defaultModelPrices {
+		prices[model] = price
+	}
+	for _, entry := range strings.Split(os.Getenv("AI_MODEL_PRICES"), ",") {
+		model, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		input, output, found := strings.Cut(value, "/")
+		if strings.TrimSpace(output) == "min" {
+			perMinute, err := strconv.ParseFloat(strings.TrimSpace(input), 64)
+			if err != nil {
+				logger.Warn("Invalid AI_MODEL_PRICES entry", zap.String("entry", entry))
+				continue
+			}
+			prices[strings.TrimSpace(model)] = ModelPrice{PerMinute: perMinute}
+			continue
+		}
+		in, errIn := strconv.ParseFloat(strings.TrimSpace(input), 64)
+		out, errOut := strconv.ParseFloat(strings.TrimSpace(output), 64)
+		if !found || errIn != nil || errOut != nil {
+			logger.Warn("Invalid AI_MODEL_PRICES entry", zap.String("entry", entry))
+			continue
+		}
+		prices[strings.TrimSpace(model)] = ModelPrice{Input: in, Output: out}
+	}
+	return prices
+}
+
+// usageCost returns the USD cost of a token count and audio length, 0 for models without a price
+func usageCost(prices map[string]ModelPrice, model string, promptTokens, completionTokens, audioSeconds int64) float64 {
+	price, ok := prices[model]
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input+float64(completionTokens)*price.Output)/1e6 +
+		float64(audioSeconds)/60*price.PerMinute
+}
+
+// recordAIUsage stores the token usage of a successful call. Providers that report no
+// usage (e.g. Ollama without eval counts) are estimated from the text.
+func recordAIUsage(user *User, feature string, messages []LLMMessage, resp *LLMResponse, latency time.Duration) {
+	usage := AIUsage{
+		Feature:          feature,
+		Provider:         resp.Provider,
+		Model:            resp.Model,
+		PromptTokens:     resp.PromptTokens,
+		CompletionTokens: resp.CompletionTokens,
+		LatencyMs:        latency.Milliseconds(),
+	}
+	if user != nil {
+		usage.TelegramID = user.TelegramID
+		usage.Plan = usagePlan(user)
+	}
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		usage.Estimated = true
+		for _, msg := range messages {
+			usage.PromptTokens += estimateTokens(msg.Content)
+		}
+		usage.CompletionTokens = estimateTokens(resp.Content)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	metrics.ObserveAITokens(feature, usage.Plan, usage.PromptTokens, usage.CompletionTokens)
+
+	if db == nil {
+		return
+	}
+	if err := db.Create(&usage).Error; err != nil {
+		logger.Error("Failed to record AI usage",
+			zap.Int64("user_id", usage.TelegramID),
+			zap.String("feature", feature),
+			zap.Error(err))
+	}
+}
+
+// recordTranscriptionUsage stores the audio length of a successful transcription.
+// audioSeconds is used when the provider does not report the duration.
+func recordTranscriptionUsage(user *User, resp *TranscriptionResponse, audioSeconds int, latency time.Duration) {
+	if resp.DurationSeconds > 0 {
+		audioSeconds = int(resp.DurationSeconds + 0.5)
+	}
+	usage := AIUsage{
+		Feature:      FeatureTranscription,
+		Provider:     resp.Provider,
+		Model:        resp.Model,
+		AudioSeconds: audioSeconds,
+		LatencyMs:    latency.Milliseconds(),
+	}
+	if user != nil {
+		usage.TelegramID = user.TelegramID
+		usage.Plan = usagePlan(user)
+	}
+
+	metrics.ObserveTranscription(usage.Plan, audioSeconds)
+
+	if db == nil {
+		return
+	}
+	if err := db.Create(&usage).Error; err != nil {
+		logger.Error("Failed to record transcription usage",
+			zap.Int64("user_id", usage.TelegramID),
+			zap.Error(err))
+	}
+}
+
+// transcriptionMinutesFor returns the monthly transcription minutes of a plan, 0 means unlimited
+func transcriptionMinutesFor(plan string) int64 {
+	key := "AI_TRANSCRIPTION_MINUTES_" + strings.ToUpper(plan)
+	if value := os.Getenv(key); value != "" {
+		if minutes, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && minutes >= 0 {
+			return minutes
+		}
+		logger.Warn("Invalid transcription minutes, using default", zap.String("env", key), zap.String("value", value))
+	}
+	if minutes, ok := defaultTranscriptionMinutes[plan]; ok {
+		return minutes
+	}
+	return defaultTranscriptionMinutes[UsagePlanFree]
+}
+
+// transcriptionSecondsLeft returns the audio seconds the user may still transcribe this month.
+// unlimited is true for plans without a limit. Database errors never block the user.
+func transcriptionSecondsLeft(user *User) (left int64, unlimited bool) {
+	if db == nil || user == nil {
+		return 0, true
+	}
+	plan := usagePlan(user)
+	minutes := transcriptionMinutesFor(plan)
+	if minutes == 0 {
+		return 0, true
+	}
+
+	now := time.Now()
+	var used int64
+	if err := db.Model(&AIUsage{}).
+		Where("telegram_id = ? AND feature = ? AND created_at >= ?", user.TelegramID, FeatureTranscription,
+			time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())).
+		Select("COALESCE(SUM(audio_seconds), 0)").Scan(&used).Error; err != nil {
+		logger.Error("Failed to check transcription minutes",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Error(err))
+		return 0, true
+	}
+	if left = minutes*60 - used; left < 0 {
+		left = 0
+	}
+	return left, false
+}
+
+// tokensUsedSince sums the tokens a user consumed since a point in time
+func tokensUsedSince(telegramID int64, since time.Time) (int64, error) {
+	var total int64
+	err := db.Model(&AIUsage{}).
+		Where("telegram_id = ? AND created_at >= ?", telegramID, since).
+		Select("COALESCE(SUM(total_tokens), 0)").Scan(&total).Error
+	return total, err
+}
+
+// tokenQuotaExceeded reports whether the user used up the daily or monthly tokens of their plan.
+// period is "daily" or "monthly" when exceeded. Database errors never block the user.
+func tokenQuotaExceeded(user *User) (period string, exceeded bool) {
+	if db == nil || user == nil {
+		return "", false
+	}
+	plan := usagePlan(user)
+	quota := tokenQuotaFor(plan)
+
+	now := time.Now()
+	checks := []struct {
+		period string
+		limit  int64
+		since  time.Time
+	}{
+		{"daily", quota.Daily, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())},
+		{"monthly", quota.Monthly, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())},
+	}
+	for _, check := range checks {
+		if check.limit <= 0 {
+			continue
+		}
+		used, err := tokensUsedSince(user.TelegramID, check.since)
+		if err != nil {
+			logger.Error("Failed to check token quota",
+				zap.Int64("user_id", user.TelegramID),
+				zap.Error(err))
+			return "", false
+		}
+		if used >= check.limit {
+			metrics.IncAIQuotaRejection(plan, check.period)
+			logger.Info("AI token quota exceeded",
+				zap.Int64("user_id", user.TelegramID),
+				zap.String("plan", plan),
+				zap.String("period", check.period),
+				zap.Int64("used", used),
+				zap.Int64("limit", check.limit))
+			return check.period, true
+		}
+	}
+	return "", false
+}
+
+// tokenQuotaMessage is shown to a user whose token quota is used up
+func tokenQuotaMessage(period string) string {
+	if period == "monthly" {
+		return "⚠️ سهمیه ماهانه هوش مصنوعی پلن شما تمام شده است. برای ادامه، پلن خود را ارتقا دهید یا تا ماه بعد صبر کنید."
+	}
+	return "⚠️ سهمیه روزانه هوش مصنوعی پلن شما تمام شده است. فردا دوباره امتحان کنید یا پلن خود را ارتقا دهید."
+}
+
+// rejectIfTokenQuotaExceeded answers 429 when the user has no tokens left
+func rejectIfTokenQuotaExceeded(c *gin.Context, user *User) bool {
+	period, exceeded := tokenQuotaExceeded(user)
+	if !exceeded {
+		return false
+	}
+	c.JSON(http.StatusTooManyRequests, APIResponse{
+		Success: false,
+		Error:   tokenQuotaMessage(period),
+	})
+	return true
+}
+
+// usageGroupRow is one group of the cost dashboard before prices are applied
+type usageGroupRow struct {
+	Key              string
+	Model            string
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	AudioSeconds     int64
+	LatencyMsSum     int64
+}
+
+// UsageSummary is one line of the cost dashboard
+type UsageSummary struct {
+	Key              string  `json:"key"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	AudioMinutes     float64 `json:"audio_minutes"`
+	CostUSD          float64 `json:"cost_usd"`
+	AvgLatencyMs     int64   `json:"avg_latency_ms"`
+}
+
+// summarizeUsage groups AIUsage rows by column and prices them per model, largest cost first
+func summarizeUsage(column string, since, until time.Time, prices map[string]ModelPrice) ([]UsageSummary, error) {
+	var rows []usageGroupRow
+	err := db.Model(&AIUsage{}).
+		Select(column+" AS `key`, model, COUNT(*) AS requests, "+
+			"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, "+
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, "+
+			"COALESCE(SUM(audio_seconds), 0) AS audio_seconds, "+
+			"COALESCE(SUM(latency_ms), 0) AS latency_ms_sum").
+		Where("created_at >= ? AND created_at < ?", since, until).
+		Group(column + ", model").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]*UsageSummary{}
+	latency := map[string]int64{}
+	for _, row := range rows {
+		summary, ok := groups[row.Key]
+		if !ok {
+			summary = &UsageSummary{Key: row.Key}
+			groups[row.Key] = summary
+		}
+		summary.Requests += row.Requests
+		summary.PromptTokens += row.PromptTokens
+		summary.CompletionTokens += row.CompletionTokens
+		summary.TotalTokens += row.PromptTokens + row.CompletionTokens
+		summary.AudioMinutes += float64(row.AudioSeconds) / 60
+		summary.CostUSD += usageCost(prices, row.Model, row.PromptTokens, row.CompletionTokens, row.AudioSeconds)
+		latency[row.Key] += row.LatencyMsSum
+	}
+
+	result := make([]UsageSummary, 0, len(groups))
+	for key, summary := range groups {
+		if summary.Requests > 0 {
+			summary.AvgLatencyMs = latency[key] / summary.Requests
+		}
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CostUSD != result[j].CostUSD {
+			return result[i].CostUSD > result[j].CostUSD
+		}
+		return result[i].TotalTokens > result[j].TotalTokens
+	})
+	return result, nil
+}
+
+// getAIUsageAPI handles GET /api/v1/admin/ai/usage?days=30, the token and cost dashboard
+func getAIUsageAPI(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if days < 1 || days > 366 {
+		days = 30
+	}
+	until := time.Now()
+	since := until.AddDate(0, 0, -days)
+	prices := modelPrices()
+
+	groups := map[string]string{
+		"by_feature": "feature",
+		"by_plan":    "plan",
+		"by_model":   "model",
+		"by_day":     "DATE(created_at)",
+	}
+	data := gin.H{
+		"since": since,
+		"until": until,
+	}
+	var total UsageSummary
+	for name, column := range groups {
+		summaries, err := summarizeUsage(column, since, until, prices)
+		if err != nil {
+			logger.Error("Failed to summarize AI usage", zap.String("group", name), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+			return
+		}
+		if name == "by_day" {
+			sort.Slice(summaries, func(i, j int) bool { return summaries[i].Key < summaries[j].Key })
+		}
+		if name == "by_feature" {
+			for _, s := range summaries {
+				total.Requests += s.Requests
+				total.PromptTokens += s.PromptTokens
+				total.CompletionTokens += s.CompletionTokens
+				total.TotalTokens += s.TotalTokens
+				total.AudioMinutes += s.AudioMinutes
+				total.CostUSD += s.CostUSD
+				total.AvgLatencyMs += s.AvgLatencyMs * s.Requests
+			}
+		}
+		data[name] = summaries
+	}
+	if total.Requests > 0 {
+		total.AvgLatencyMs /= total.Requests
+	}
+	total.Key = "total"
+	data["total"] = total
+
+	// Heaviest users of the period
+	var topUsers []struct {
+		TelegramID  int64  `json:"telegram_id"`
+		Plan        string `json:"plan"`
+		Requests    int64  `json:"requests"`
+		TotalTokens int64  `json:"total_tokens"`
+	}
+	if err := db.Model(&AIUsage{}).
+		Select("telegram_id, MAX(plan) AS plan, COUNT(*) AS requests, COALESCE(SUM(total_tokens), 0) AS total_tokens").
+		Where("created_at >= ? AND telegram_id <> 0", since).
+		Group("telegram_id").Order("total_tokens DESC").Limit(10).
+		Scan(&topUsers).Error; err != nil {
+		logger.Error("Failed to load top AI users", zap.Error(err))
+	}
+	data["top_users"] = topUsers
+
+	quotas := map[string]TokenQuota{}
+	for plan := range defaultTokenQuotas {
+		quotas[plan] = tokenQuotaFor(plan)
+	}
+	data["quotas"] = quotas
+
+	transcriptionMinutes := map[string]int64{}
+	for plan := range defaultTranscriptionMinutes {
+		transcriptionMinutes[plan] = transcriptionMinutesFor(plan)
+	}
+	data["transcription_minutes"] = transcriptionMinutes
+	data["prices"] = prices
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
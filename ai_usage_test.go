@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTokenQuotaForPlan asserts plan resolution, env overrides and the free fallback for unknown plans.
+func TestTokenQuotaForPlan(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	if plan := usagePlan(&User{SubscriptionType: "paid", PlanName: "pro", SubscriptionExpiry: &expired}); plan != UsagePlanFree {
+		t.Errorf("expired subscription should use the free plan, got %q", plan)
+	}
+	if plan := usagePlan(&User{IsVerified: true}); plan != UsagePlanLifetime {
+		t.Errorf("legacy verified user should use the lifetime plan, got %q", plan)
+	}
+
+	t.Setenv("AI_TOKEN_QUOTA_PRO", "1000/20000")
+	if quota := tokenQuotaFor("pro"); quota != (TokenQuota{Daily: 1000, Monthly: 20000}) {
+		t.Errorf("env override not applied, got %+v", quota)
+	}
+	t.Setenv("AI_TOKEN_QUOTA_STARTER", "lots")
+	if quota := tokenQuotaFor("starter"); quota != defaultTokenQuotas["starter"] {
+		t.Errorf("invalid override should keep the default, got %+v", quota)
+	}
+	if quota := tokenQuotaFor("enterprise"); quota != defaultTokenQuotas[UsagePlanFree] {
+		t.Errorf("unknown plan should get the free quota, got %+v", quota)
+	}
+
+	t.Setenv("AI_MODEL_PRICES", "tiny=1/2")
+	if cost := usageCost(modelPrices(), "tiny", 500000, 250000, 0); cost != 1.0 {
+		t.Errorf("expected $1.00, got %v", cost)
+	}
+
+	t.Setenv("AI_MODEL_PRICES", "whisper-1=0.006/min")
+	if cost := usageCost(modelPrices(), "whisper-1", 0, 0, 150); cost < 0.0149 || cost > 0.0151 {
+		t.Errorf("expected $0.015 for 2.5 minutes, got %v", cost)
+	}
+	t.Setenv("AI_TRANSCRIPTION_MINUTES_PRO", "30")
+	if minutes := transcriptionMinutesFor("pro"); minutes != 30 {
+		t.Errorf("transcription minutes override not applied, got %d", minutes)
+	}
+	if minutes := transcriptionMinutesFor(UsagePlanLifetime); minutes != 0 {
+		t.Errorf("lifetime plan should have unlimited transcription, got %d", minutes)
+	}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Ban scopes - a ban only blocks the surfaces its scope covers
+const (
+	BanScopeBot     = "bot"     // Telegram bot
+	BanScopeMiniApp = "miniapp" // Mini App and web login
+	BanScopeChat    = "chat"    // AI chat in both bot and Mini App
+	BanScopeAll     = "all"     // Everything
+)
+
+const (
+	// 🔒 SECURITY: Automatic bans for suspicious activity are temporary
+	AutoBanDuration = 24 * time.Hour
+
+	// Bot state while we wait for the user's appeal text
+	StateWaitingForBanAppeal = "waiting_for_ban_appeal"
+)
+
+// Ban is the single source of truth for blocked users.
+// Rows are never deleted: lifting a ban (or its expiry) sets LiftedAt so the history stays visible to admins.
+// User.IsBlocked and User.IsActive are kept in sync by syncUserBanFlags for the admin panel and stats.
+type Ban struct {
+	gorm.Model
+	TelegramID     int64      `gorm:"index;not null" json:"telegram_id"`
+	Scope          string     `gorm:"type:varchar(20);index;default:'all'" json:"scope"` // bot, miniapp, chat, all
+	Reason         string     `gorm:"type:text" json:"reason"`
+	ExpiresAt      *time.Time `gorm:"index" json:"expires_at"` // nil = permanent
+	IssuedBy       *uint      `gorm:"index" json:"issued_by"`  // Admin who issued the ban (nil = automatic)
+	Admin          *Admin     `gorm:"foreignKey:IssuedBy;constraint:OnDelete:SET NULL" json:"admin,omitempty"`
+	LiftedAt       *time.Time `gorm:"index" json:"lifted_at"`
+	LiftedBy       *uint      `json:"lifted_by"`                  // Admin who lifted the ban (nil = expired)
+	AppealTicketID *uint      `json:"appeal_ticket_id,omitempty"` // Support ticket opened by the user to appeal
+}
+
+// IsActive reports whether the ban is still in force
+func (b *Ban) IsActive() bool {
+	if b.LiftedAt != nil {
+		return false
+	}
+	return b.ExpiresAt == nil || time.Now().Before(*b.ExpiresAt)
+}
+
+// Covers reports whether the ban blocks the given scope
+func (b *Ban) Covers(scope string) bool {
+	return b.Scope == BanScopeAll || b.Scope == scope
+}
+
+func isValidBanScope(scope string) bool {
+	switch scope {
+	case BanScopeBot, BanScopeMiniApp, BanScopeChat, BanScopeAll:
+		return true
+	}
+	return false
+}
+
+// banScopeLabel returns the Persian name of a scope for user-facing messages
+func banScopeLabel(scope string) string {
+	switch scope {
+	case BanScopeBot:
+		return "ربات"
+	case BanScopeMiniApp:
+		return "مینی اپ"
+	case BanScopeChat:
+		return "چت با دستیار هوشمند"
+	default:
+		return "همه بخش‌ها"
+	}
+}
+
+// getActiveBan returns the user's active ban covering any of the given scopes, or nil
+func getActiveBan(telegramID int64, scopes ...string) *Ban {
+	if db == nil {
+		return nil
+	}
+
+	bans, err := banCache.GetActiveBans(telegramID)
+	if err != nil {
+		logger.Error("Failed to load user bans",
+			zap.Int64("user_id", telegramID),
+			zap.Error(err))
+		return nil
+	}
+
+	for i := range bans {
+		if !bans[i].IsActive() {
+			continue
+		}
+		for _, scope := range scopes {
+			if bans[i].Covers(scope) {
+				ban := bans[i]
+				return &ban
+			}
+		}
+	}
+	return nil
+}
+
+// isBanned reports whether the user has an active ban covering any of the given scopes
+func isBanned(telegramID int64, scopes ...string) bool {
+	return getActiveBan(telegramID, scopes...) != nil
+}
+
+// issueBan creates a ban for the user. A zero duration means permanent; issuedBy is nil for automatic bans.
+func issueBan(telegramID int64, scope, reason string, duration time.Duration, issuedBy *uint) (*Ban, error) {
+	if !isValidBanScope(scope) {
+		return nil, fmt.Errorf("invalid ban scope: %s", scope)
+	}
+
+	ban := Ban{
+		TelegramID: telegramID,
+		Scope:      scope,
+		Reason:     reason,
+		IssuedBy:   issuedBy,
+	}
+	if duration > 0 {
+		expiry := time.Now().Add(duration)
+		ban.ExpiresAt = &expiry
+	}
+
+	if err := db.Create(&ban).Error; err != nil {
+		return nil, err
+	}
+
+	syncUserBanFlags(telegramID)
+
+	logger.Warn("User banned",
+		zap.Int64("user_id", telegramID),
+		zap.String("scope", scope),
+		zap.String("reason", reason),
+		zap.Bool("permanent", ban.ExpiresAt == nil),
+		zap.Bool("automatic", issuedBy == nil))
+
+	return &ban, nil
+}
+
+// liftBans lifts the user's active bans. An empty scope lifts all of them,
+// otherwise only bans issued with exactly that scope are lifted.
+func liftBans(telegramID int64, scope string, liftedBy *uint) (int64, error) {
+	query := db.Model(&Ban{}).Where("telegram_id = ? AND lifted_at IS NULL", telegramID)
+	if scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+
+	result := query.Updates(map[string]interface{}{
+		"lifted_at": time.Now(),
+		"lifted_by": liftedBy,
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		syncUserBanFlags(telegramID)
+		logger.Info("User bans lifted",
+			zap.Int64("user_id", telegramID),
+			zap.String("scope", scope),
+			zap.Int64("count", result.RowsAffected))
+	}
+
+	return result.RowsAffected, nil
+}
+
+// listActiveBans returns all active bans, optionally filtered to one scope
+func listActiveBans(scope string) ([]Ban, error) {
+	query := db.Preload("Admin").
+		Where("lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+	if scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+
+	var bans []Ban
+	if err := query.Order("created_at DESC").Find(&bans).Error; err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// countBans returns how many times the user has been banned (violation history)
+func countBans(telegramID int64) int64 {
+	var count int64
+	db.Model(&Ban{}).Where("telegram_id = ?", telegramID).Count(&count)
+	return count
+}
+
+// countBansByUser returns countBans for several users with a single grouped query
+func countBansByUser(telegramIDs []int64) (map[int64]int64, error) {
+	counts := make(map[int64]int64, len(telegramIDs))
+	if len(telegramIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		TelegramID int64
+		Count      int64
+	}
+	if err := db.Model(&Ban{}).
+		Select("telegram_id, COUNT(*) AS count").
+		Where("telegram_id IN ?", telegramIDs).
+		Group("telegram_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.TelegramID] = row.Count
+	}
+	return counts, nil
+}
+
+// syncUserBanFlags mirrors the user's active bans onto User.IsBlocked (any ban)
+// and User.IsActive (no bot-wide ban), and drops the cached copies
+func syncUserBanFlags(telegramID int64) {
+	banCache.InvalidateBans(telegramID)
+
+	bans, err := banCache.GetActiveBans(telegramID)
+	if err != nil {
+		logger.Error("Failed to sync user ban flags",
+			zap.Int64("user_id", telegramID),
+			zap.Error(err))
+		return
+	}
+
+	botBlocked := false
+	for i := range bans {
+		if bans[i].Covers(BanScopeBot) {
+			botBlocked = true
+			break
+		}
+	}
+
+	if err := db.Model(&User{}).Where("telegram_id = ?", telegramID).Updates(map[string]interface{}{
+		"is_blocked": len(bans) > 0,
+		"is_active":  !botBlocked,
+	}).Error; err != nil {
+		logger.Error("Failed to update user ban flags",
+			zap.Int64("user_id", telegramID),
+			zap.Error(err))
+	}
+
+	// ⚡ CRITICAL: Invalidate user cache so mini app gets updated data immediately
+	userCache.InvalidateUser(telegramID)
+}
+
+// migrateLegacyBlocks turns users blocked through the old flags into permanent bans:
+// IsBlocked becomes an all-scope ban and IsActive = false (how the admin panel and bot banned
+// users before bans existed) a bot-scope ban, so nobody is unbanned by the upgrade.
+// Users that already have any Ban row are skipped, so this only runs once per user.
+func migrateLegacyBlocks() {
+	var users []User
+	if err := db.Where("(is_blocked = ? OR is_active = ?) AND telegram_id NOT IN (?)",
+		true, false, db.Model(&Ban{}).Select("telegram_id")).Find(&users).Error; err != nil {
+		logger.Error("Failed to load legacy blocked users", zap.Error(err))
+		return
+	}
+
+	for _, user := range users {
+		ban := Ban{
+			TelegramID: user.TelegramID,
+			Scope:      BanScopeAll,
+			Reason:     "مسدودیت قبلی (منتقل شده از سیستم قدیم)",
+		}
+		if !user.IsBlocked {
+			ban.Scope = BanScopeBot
+		}
+		if err := db.Create(&ban).Error; err != nil {
+			logger.Error("Failed to migrate legacy block",
+				zap.Int64("user_id", user.TelegramID),
+				zap.Error(err))
+			continue
+		}
+		syncUserBanFlags(user.TelegramID)
+	}
+
+	if len(users) > 0 {
+		logger.Info("Legacy user blocks migrated to bans", zap.Int("count", len(users)))
+	}
+}
+
+// startBanExpiryWatcher lifts temporary bans once they expire and tells the user
+func startBanExpiryWatcher() {
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expireBans()
+		}
+	}()
+
+	logger.Info("Ban expiry watcher started")
+}
+
+// expireBans marks expired bans as lifted and restores the user's access flags
+func expireBans() {
+	var bans []Ban
+	if err := db.Where("lifted_at IS NULL AND expires_at IS NOT NULL AND expires_at <= ?", time.Now()).
+		Find(&bans).Error; err != nil {
+		logger.Error("Failed to query expired bans", zap.Error(err))
+		return
+	}
+
+	for _, ban := range bans {
+		if err := db.Model(&Ban{}).Where("id = ?", ban.ID).Update("lifted_at", *ban.ExpiresAt).Error; err != nil {
+			logger.Error("Failed to expire ban", zap.Uint("ban_id", ban.ID), zap.Error(err))
+			continue
+		}
+		syncUserBanFlags(ban.TelegramID)
+
+		if bot != nil {
+			sendMessage(ban.TelegramID, fmt.Sprintf("✅ مسدودیت موقت شما در بخش %s به پایان رسید.", banScopeLabel(ban.Scope)))
+		}
+	}
+}
+
+// banNoticeText builds the message shown to a banned user
+func banNoticeText(ban *Ban) string {
+	text := fmt.Sprintf("⚠️ دسترسی شما به %s مسدود شده است.", banScopeLabel(ban.Scope))
+	if ban.Reason != "" {
+		text += "\n\n📝 دلیل: " + ban.Reason
+	}
+	if ban.ExpiresAt != nil {
+		text += "\n⏰ پایان مسدودیت: " + ban.ExpiresAt.Format("2006-01-02 15:04")
+	} else {
+		text += "\n⏰ نوع مسدودیت: دائمی"
+	}
+	text += "\n\n📞 برای رفع مسدودیت با پشتیبانی تماس بگیرید:\n\n" + SUPPORT_NUMBER +
+		"\n\nیا با دکمه زیر درخواست بررسی مجدد ثبت کنید."
+	return text
+}
+
+// sendBanNotice sends the ban message with an appeal button
+func sendBanNotice(chatID int64, ban *Ban) {
+	msg := tgbotapi.NewMessage(chatID, banNoticeText(ban))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📝 درخواست بررسی مجدد", "ban_appeal"),
+		),
+	)
+	bot.Send(msg)
+}
+
+// createBanAppealTicket opens a support ticket for the ban, or adds the message
+// to the appeal ticket already open for it
+func createBanAppealTicket(ban *Ban, message string) (*Ticket, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return nil, errors.New("appeal message is empty")
+	}
+
+	if ban.AppealTicketID != nil {
+		var ticket Ticket
+		if err := db.First(&ticket, *ban.AppealTicketID).Error; err == nil && ticket.Status != "closed" {
+			ticketMessage := TicketMessage{
+				TicketID:   ticket.ID,
+				SenderType: "user",
+				Message:    message,
+				TelegramID: ban.TelegramID,
+			}
+			if err := db.Create(&ticketMessage).Error; err != nil {
+				return nil, err
+			}
+			db.Model(&ticket).Update("status", "open")
+			return &ticket, nil
+		}
+	}
+
+	ticket := Ticket{
+		TelegramID: ban.TelegramID,
+		Subject:    fmt.Sprintf("درخواست رفع مسدودیت - %s", banScopeLabel(ban.Scope)),
+		Priority:   "high",
+		Status:     "open",
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		ticketMessage := TicketMessage{
+			TicketID:   ticket.ID,
+			SenderType: "user",
+			Message:    message,
+			TelegramID: ban.TelegramID,
+		}
+		if err := tx.Create(&ticketMessage).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Ban{}).Where("id = ?", ban.ID).Update("appeal_ticket_id", ticket.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	banCache.InvalidateBans(ban.TelegramID)
+
+	logger.Info("Ban appeal ticket created",
+		zap.Int64("user_id", ban.TelegramID),
+		zap.Uint("ban_id", ban.ID),
+		zap.Uint("ticket_id", ticket.ID))
+
+	return &ticket, nil
+}
+
+// handleBanAppealCallback asks a banned user to write their appeal
+func handleBanAppealCallback(callback *tgbotapi.CallbackQuery) {
+	userID := callback.From.ID
+
+	if getActiveBan(userID, BanScopeBot, BanScopeMiniApp, BanScopeChat) == nil {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "✅ حساب شما مسدود نیست"))
+		return
+	}
+
+	userStates[userID] = StateWaitingForBanAppeal
+	bot.Send(tgbotapi.NewCallback(callback.ID, "📝 منتظر توضیحات شما هستیم"))
+	sendMessage(userID, "📝 لطفا توضیحات خود برای بررسی مجدد مسدودیت را در قالب یک پیام ارسال کنید:")
+}
+
+// handleBanAppealMessage turns the user's appeal text into a support ticket
+func handleBanAppealMessage(user *User, text string) {
+	userStates[user.TelegramID] = ""
+
+	ban := getActiveBan(user.TelegramID, BanScopeBot, BanScopeMiniApp, BanScopeChat)
+	if ban == nil {
+		sendMessage(user.TelegramID, "✅ حساب شما در حال حاضر مسدود نیست.")
+		return
+	}
+
+	ticket, err := createBanAppealTicket(ban, text)
+	if err != nil {
+		logger.Error("Failed to create ban appeal ticket",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Error(err))
+		sendMessage(user.TelegramID, "❌ خطا در ثبت درخواست. لطفا دوباره تلاش کنید.")
+		return
+	}
+
+	sendMessage(user.TelegramID, fmt.Sprintf("✅ درخواست بررسی مجدد شما با شماره تیکت #%d ثبت شد.\n\nنتیجه از طریق پشتیبانی به شما اطلاع داده می‌شود.", ticket.ID))
+}
+
+// ==========================================
+// Mini App ban handlers
+// ==========================================
+
+// banStatusPayload is the user-facing view of a ban (no admin details)
+func banStatusPayload(ban *Ban) map[string]interface{} {
+	return map[string]interface{}{
+		"scope":            ban.Scope,
+		"reason":           ban.Reason,
+		"expires_at":       ban.ExpiresAt,
+		"permanent":        ban.ExpiresAt == nil,
+		"appeal_ticket_id": ban.AppealTicketID,
+		"created_at":       ban.CreatedAt,
+	}
+}
+
+// 🔒 SECURITY: rejectIfBanned responds 403 when the user has an active ban covering any of the scopes
+func rejectIfBanned(c *gin.Context, telegramID int64, scopes ...string) bool {
+	ban := getActiveBan(telegramID, scopes...)
+	if ban == nil {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, APIResponse{
+		Success: false,
+		Data:    map[string]interface{}{"ban": banStatusPayload(ban)},
+		Error:   "User account is suspended.",
+	})
+	return true
+}
+
+// getUserBanStatus returns the user's active bans so the Mini App can show the reason and appeal option
+func getUserBanStatus(c *gin.Context) {
+	// 🔒 SECURITY: Ban details and appeals are only for the account owner
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	bans, err := banCache.GetActiveBans(telegramID)
+	if err != nil {
+		logger.Error("Failed to load user bans", zap.Int64("user_id", telegramID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	activeBans := make([]map[string]interface{}, 0, len(bans))
+	for i := range bans {
+		if bans[i].IsActive() {
+			activeBans = append(activeBans, banStatusPayload(&bans[i]))
+		}
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"banned": len(activeBans) > 0,
+			"bans":   activeBans,
+		},
+	})
+}
+
+// handleBanAppealAPI opens an appeal ticket from the Mini App (allowed while banned)
+func handleBanAppealAPI(c *gin.Context) {
+	// 🔒 SECURITY: Ban details and appeals are only for the account owner
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var requestData struct {
+		Message string `json:"message" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid request data",
+		})
+		return
+	}
+
+	if !isValidMiniAppInput(requestData.Message, 2000) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Message is too long",
+		})
+		return
+	}
+
+	ban := getActiveBan(telegramID, BanScopeBot, BanScopeMiniApp, BanScopeChat)
+	if ban == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "User is not banned",
+		})
+		return
+	}
+
+	ticket, err := createBanAppealTicket(ban, requestData.Message)
+	if err != nil {
+		logger.Error("Failed to create ban appeal ticket",
+			zap.Int64("user_id", telegramID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Failed to create appeal",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    ticket,
+	})
+}
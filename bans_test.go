@@ -0,0 +1,200 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// loadUser reads the user row straight from the database
+func loadUser(t *testing.T, telegramID int64) User {
+	t.Helper()
+	var user User
+	if err := db.Where("telegram_id = ?", telegramID).First(&user).Error; err != nil {
+		t.Fatalf("load user %d: %v", telegramID, err)
+	}
+	return user
+}
+
+// TestIssueAndLiftBans covers scope matching, the ban cache, lifting a single scope and the
+// is_blocked / is_active flags kept on the user.
+func TestIssueAndLiftBans(t *testing.T) {
+	useTestDB(t, &User{}, &Ban{})
+
+	const telegramID = int64(3001)
+	mustCreate(t, &User{TelegramID: telegramID, Username: "banned", IsActive: true})
+	t.Cleanup(func() { banCache.InvalidateBans(telegramID) })
+
+	if _, err := issueBan(telegramID, "everywhere", "spam", 0, nil); err == nil {
+		t.Error("unknown scope should be rejected")
+	}
+
+	chat, err := issueBan(telegramID, BanScopeChat, "spam", time.Hour, nil)
+	if err != nil {
+		t.Fatalf("issue chat ban: %v", err)
+	}
+	if chat.ExpiresAt == nil || time.Until(*chat.ExpiresAt) < 59*time.Minute {
+		t.Errorf("temporary ban should expire in an hour, got %v", chat.ExpiresAt)
+	}
+	if ban := getActiveBan(telegramID, BanScopeMiniApp, BanScopeChat); ban == nil || ban.ID != chat.ID {
+		t.Errorf("chat ban should cover the chat scope, got %+v", ban)
+	}
+	if isBanned(telegramID, BanScopeBot) {
+		t.Error("chat ban must not block the bot")
+	}
+	if user := loadUser(t, telegramID); !user.IsBlocked || !user.IsActive {
+		t.Errorf("chat ban: expected is_blocked and is_active, got %v %v", user.IsBlocked, user.IsActive)
+	}
+
+	// The cached bans are served until syncUserBanFlags drops them
+	mustCreate(t, &Ban{TelegramID: telegramID, Scope: BanScopeBot, Reason: "direct insert"})
+	if isBanned(telegramID, BanScopeBot) {
+		t.Error("expected the cached bans without the row inserted behind the cache")
+	}
+	syncUserBanFlags(telegramID)
+	if !isBanned(telegramID, BanScopeBot) {
+		t.Error("syncing the flags should refresh the cache")
+	}
+	if user := loadUser(t, telegramID); !user.IsBlocked || user.IsActive {
+		t.Errorf("bot ban: expected is_blocked and not is_active, got %v %v", user.IsBlocked, user.IsActive)
+	}
+
+	// Lifting one scope leaves the others in place
+	adminID := uint(9)
+	if n, err := liftBans(telegramID, BanScopeBot, &adminID); err != nil || n != 1 {
+		t.Fatalf("lift bot ban: %d %v", n, err)
+	}
+	if isBanned(telegramID, BanScopeBot) || !isBanned(telegramID, BanScopeChat) {
+		t.Error("lifting the bot ban should keep the chat ban")
+	}
+	if user := loadUser(t, telegramID); !user.IsBlocked || !user.IsActive {
+		t.Errorf("after lifting the bot ban: expected is_blocked and is_active, got %v %v", user.IsBlocked, user.IsActive)
+	}
+	var lifted Ban
+	db.Where("scope = ?", BanScopeBot).First(&lifted)
+	if lifted.LiftedAt == nil || lifted.LiftedBy == nil || *lifted.LiftedBy != adminID {
+		t.Errorf("lifted ban should keep who lifted it, got %+v", lifted)
+	}
+
+	// An all-scope ban covers every surface; lifting everything clears the flags
+	if _, err := issueBan(telegramID, BanScopeAll, "fraud", 0, &adminID); err != nil {
+		t.Fatalf("issue permanent ban: %v", err)
+	}
+	if !isBanned(telegramID, BanScopeBot) || !isBanned(telegramID, BanScopeMiniApp) {
+		t.Error("all-scope ban should cover every scope")
+	}
+	if n, err := liftBans(telegramID, "", nil); err != nil || n != 2 {
+		t.Fatalf("lift all bans: %d %v", n, err)
+	}
+	if isBanned(telegramID, BanScopeAll, BanScopeBot, BanScopeMiniApp, BanScopeChat) {
+		t.Error("no ban should remain after lifting all of them")
+	}
+	if user := loadUser(t, telegramID); user.IsBlocked || !user.IsActive {
+		t.Errorf("after lifting all bans: expected neither blocked nor inactive, got %v %v", user.IsBlocked, user.IsActive)
+	}
+	if countBans(telegramID) != 3 {
+		t.Errorf("lifted bans stay in the history, got %d", countBans(telegramID))
+	}
+}
+
+// TestExpireBans checks expired bans are lifted at their expiry and the user is unblocked,
+// while permanent and still running bans stay.
+func TestExpireBans(t *testing.T) {
+	useTestDB(t, &User{}, &Ban{})
+
+	const expiredID, activeID = int64(3101), int64(3102)
+	mustCreate(t, &User{TelegramID: expiredID, Username: "expired", IsActive: true})
+	mustCreate(t, &User{TelegramID: activeID, Username: "active", IsActive: true})
+	t.Cleanup(func() {
+		banCache.InvalidateBans(expiredID)
+		banCache.InvalidateBans(activeID)
+	})
+
+	expiredBan, err := issueBan(expiredID, BanScopeBot, "flood", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().Add(-time.Minute)
+	db.Model(&Ban{}).Where("id = ?", expiredBan.ID).Update("expires_at", expiry)
+	if _, err := issueBan(activeID, BanScopeBot, "flood", time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issueBan(activeID, BanScopeChat, "abuse", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expireBans()
+
+	var ban Ban
+	db.First(&ban, expiredBan.ID)
+	if ban.LiftedAt == nil || !ban.LiftedAt.Equal(expiry) || ban.LiftedBy != nil {
+		t.Errorf("expired ban should be lifted at its expiry without an admin, got %+v", ban)
+	}
+	if isBanned(expiredID, BanScopeBot) {
+		t.Error("expired ban is still active")
+	}
+	if user := loadUser(t, expiredID); user.IsBlocked || !user.IsActive {
+		t.Errorf("expired user: expected neither blocked nor inactive, got %v %v", user.IsBlocked, user.IsActive)
+	}
+
+	var running int64
+	db.Model(&Ban{}).Where("telegram_id = ? AND lifted_at IS NULL", activeID).Count(&running)
+	if running != 2 || !isBanned(activeID, BanScopeBot) {
+		t.Errorf("running and permanent bans must stay, %d active", running)
+	}
+}
+
+// TestMigrateLegacyBlocks migrates is_blocked users into all-scope bans and users banned the
+// baseline way (is_active = false) into bot bans, once, and skips users that already have a ban.
+func TestMigrateLegacyBlocks(t *testing.T) {
+	useTestDB(t, &User{}, &Ban{})
+
+	const blockedID, inactiveID, bannedID, activeID = int64(3201), int64(3202), int64(3203), int64(3204)
+	mustCreate(t, &User{TelegramID: blockedID, Username: "blocked", IsActive: true, IsBlocked: true})
+	mustCreate(t, &User{TelegramID: inactiveID, Username: "inactive", IsActive: true})
+	mustCreate(t, &User{TelegramID: bannedID, Username: "banned", IsActive: true, IsBlocked: true})
+	mustCreate(t, &User{TelegramID: activeID, Username: "active", IsActive: true})
+	// IsActive has a database default of true, so false has to be written explicitly
+	db.Model(&User{}).Where("telegram_id = ?", inactiveID).Update("is_active", false)
+	mustCreate(t, &Ban{TelegramID: bannedID, Scope: BanScopeChat, Reason: "already migrated"})
+	t.Cleanup(func() {
+		for _, id := range []int64{blockedID, inactiveID, bannedID, activeID} {
+			banCache.InvalidateBans(id)
+		}
+	})
+
+	for run := 1; run <= 2; run++ {
+		migrateLegacyBlocks()
+
+		var bans []Ban
+		db.Order("telegram_id").Find(&bans)
+		if len(bans) != 3 {
+			t.Fatalf("run %d: expected 3 bans, got %d", run, len(bans))
+		}
+		if migrated := bans[0]; migrated.TelegramID != blockedID || migrated.Scope != BanScopeAll || migrated.ExpiresAt != nil {
+			t.Errorf("run %d: expected a permanent all-scope ban for the blocked user, got %+v", run, migrated)
+		}
+		if migrated := bans[1]; migrated.TelegramID != inactiveID || migrated.Scope != BanScopeBot || migrated.ExpiresAt != nil {
+			t.Errorf("run %d: expected a permanent bot ban for the inactive user, got %+v", run, migrated)
+		}
+		if bans[2].TelegramID != bannedID || bans[2].Scope != BanScopeChat {
+			t.Errorf("run %d: the existing ban should be left alone, got %+v", run, bans[2])
+		}
+	}
+
+	if !isBanned(blockedID, BanScopeBot) {
+		t.Error("migrated user should be banned from the bot")
+	}
+	if user := loadUser(t, blockedID); !user.IsBlocked || user.IsActive {
+		t.Errorf("migrated user: expected is_blocked and not is_active, got %v %v", user.IsBlocked, user.IsActive)
+	}
+	// A user banned before the upgrade stays blocked in the bot
+	if !isBanned(inactiveID, BanScopeBot) || isBanned(inactiveID, BanScopeMiniApp) {
+		t.Error("a user banned through is_active should keep a bot-only ban")
+	}
+	if user := loadUser(t, inactiveID); !user.IsBlocked || user.IsActive {
+		t.Errorf("inactive user: expected is_blocked and not is_active, got %v %v", user.IsBlocked, user.IsActive)
+	}
+	if isBanned(activeID, BanScopeAll, BanScopeBot) {
+		t.Error("an active user must not be banned")
+	}
+}
@@ -152,3 +152,54 @@ func (sc *SessionCache) InvalidateSessions() {
 	sc.expiresAt = time.Time{}
 	sc.mu.Unlock()
 }
+
+// BanCache stores the active bans of a user for a short time so block checks
+// on every bot message and Mini App request don't hit the database
+type BanCache struct {
+	bans map[int64]*CachedBans
+	mu   sync.RWMutex
+}
+
+type CachedBans struct {
+	Bans      []Ban
+	ExpiresAt time.Time
+}
+
+var banCache = &BanCache{
+	bans: make(map[int64]*CachedBans),
+}
+
+// GetActiveBans retrieves the user's active bans from cache or database
+func (bc *BanCache) GetActiveBans(telegramID int64) ([]Ban, error) {
+	bc.mu.RLock()
+	cached, exists := bc.bans[telegramID]
+	bc.mu.RUnlock()
+
+	if exists && time.Now().Before(cached.ExpiresAt) {
+		return cached.Bans, nil
+	}
+
+	var bans []Ban
+	if err := db.Where("telegram_id = ? AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", telegramID, time.Now()).
+		Order("created_at DESC").Find(&bans).Error; err != nil {
+		return nil, err
+	}
+
+	// Cache for 30 seconds - bans are invalidated explicitly on change,
+	// the short TTL only bounds how late an expiry is noticed
+	bc.mu.Lock()
+	bc.bans[telegramID] = &CachedBans{
+		Bans:      bans,
+		ExpiresAt: time.Now().Add(30 * time.Second),
+	}
+	bc.mu.Unlock()
+
+	return bans, nil
+}
+
+// InvalidateBans removes user's bans from cache (call after issuing or lifting a ban)
+func (bc *BanCache) InvalidateBans(telegramID int64) {
+	bc.mu.Lock()
+	delete(bc.bans, telegramID)
+	bc.mu.Unlock()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Server-Sent Events emitted by /api/v1/chat/stream
+const (
+	ChatStreamEventDelta = "delta" // {"text": "..."} sanitized chunk of the answer
+	ChatStreamEventDone  = "done"  // {"thread_id", "message_id", "provider", "model"} answer saved
+	ChatStreamEventError = "error" // {"error": "..."} nothing was saved
+)
+
+// errChatStreamClientGone is returned by the delta callback when the client has disconnected
+var errChatStreamClientGone = errors.New("chat stream client disconnected")
+
+// handleChatStreamRequest is the streaming variant of handleChatRequest.
+// It runs the same checks, sends the answer as SSE "delta" events while it is generated,
+// then counts the message against the quota and saves it. A client disconnect cancels
+// the upstream LLM request and nothing is saved or counted.
+func handleChatStreamRequest(c *gin.Context) {
+	requestData, user, thread, ok := prepareChatRequest(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx proxy buffering
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	if aiClient == nil {
+		logger.Error("AI client not initialized",
+			zap.Int64("user_id", user.TelegramID))
+		c.SSEvent(ChatStreamEventError, gin.H{"error": "❌ سرویس هوش مصنوعی در حال حاضر در دسترس نیست. لطفا بعداً تلاش کنید."})
+		c.Writer.Flush()
+		return
+	}
+
+	conv := loadConversationContext(thread)
+
+	// The request context is cancelled when the client goes away, which aborts the upstream call
+	ctx := c.Request.Context()
+	served, err := aiClient.ForUser(user).StreamMonetizeAIResponse(ctx, FeatureChat, requestData.Message, conv, func(delta string) error {
+		if ctx.Err() != nil {
+			return errChatStreamClientGone
+		}
+		c.SSEvent(ChatStreamEventDelta, gin.H{"text": delta})
+		c.Writer.Flush()
+		return nil
+	})
+
+	if ctx.Err() != nil {
+		logger.Info("Chat stream cancelled by client",
+			zap.Int64("user_id", user.TelegramID))
+		return
+	}
+	if errors.Is(err, errAIOutputBlocked) {
+		c.SSEvent(ChatStreamEventError, gin.H{"error": promptLeakReply})
+		c.Writer.Flush()
+		return
+	}
+	if err != nil {
+		logger.Error("AI stream error in web_api",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Error(err))
+		c.SSEvent(ChatStreamEventError, gin.H{"error": "❌ خطا در دریافت پاسخ. لطفا دوباره تلاش کنید."})
+		c.Writer.Flush()
+		return
+	}
+
+	chatMessage := recordChatExchange(user, thread, requestData.Message, served.Content, served)
+
+	c.SSEvent(ChatStreamEventDone, gin.H{
+		"thread_id":  thread.ID,
+		"message_id": chatMessage.ID,
+		"provider":   served.Provider,
+		"model":      served.Model,
+	})
+	c.Writer.Flush()
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Chat thread limits
+const (
+	ChatThreadTitleMaxRunes = 60
+	DefaultChatPageSize     = 20
+	MaxChatPageSize         = 100
+)
+
+// ChatThread is a named conversation of a user. The bot chat and the mini app both write to
+// the user's active thread (most recent non-archived one) unless the mini app picks a thread.
+// Each thread has its own conversation memory (Summary / SummarizedUntilID).
+type ChatThread struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	TelegramID        int64      `gorm:"index" json:"telegram_id"`
+	Title             string     `gorm:"size:120" json:"title"` // Generated from the first message when empty
+	Pinned            bool       `gorm:"default:false" json:"pinned"`
+	Archived          bool       `gorm:"default:false" json:"archived"`
+	MessageCount      int        `gorm:"default:0" json:"message_count"`
+	LastMessageAt     time.Time  `gorm:"index" json:"last_message_at"`
+	Summary           string     `gorm:"type:text" json:"summary,omitempty"` // Running summary of turns outside the context budget
+	SummarizedUntilID uint       `json:"-"`                                  // Messages with ID <= this are summarized or were reset
+	MemoryResetAt     *time.Time `json:"memory_reset_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// chatThreadTitle builds a thread title from its first message
+func chatThreadTitle(message string) string {
+	title := strings.TrimSpace(message)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = strings.TrimSpace(title[:i])
+	}
+	if utf8.RuneCountInString(title) <= ChatThreadTitleMaxRunes {
+		return title
+	}
+
+	runes := []rune(title)[:ChatThreadTitleMaxRunes]
+	// Cut at the last word boundary when there is one in the second half
+	if i := strings.LastIndex(string(runes), " "); i > len(string(runes))/2 {
+		return string(runes)[:i] + "…"
+	}
+	return string(runes) + "…"
+}
+
+// createChatThread starts a new thread; an empty title is filled in from the first message
+func createChatThread(telegramID int64, title string) (*ChatThread, error) {
+	thread := &ChatThread{
+		TelegramID:    telegramID,
+		Title:         chatThreadTitle(title),
+		LastMessageAt: time.Now(),
+	}
+	if err := db.Create(thread).Error; err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+// activeChatThread returns the most recently used non-archived thread, creating one if asked to
+func activeChatThread(telegramID int64, create bool) (*ChatThread, error) {
+	var thread ChatThread
+	err := db.Where("telegram_id = ? AND archived = ?", telegramID, false).
+		Order("last_message_at DESC, id DESC").First(&thread).Error
+	if err == gorm.ErrRecordNotFound && create {
+		return createChatThread(telegramID, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// resolveChatThread returns the requested thread of a user, or the active one when threadID is nil
+func resolveChatThread(telegramID int64, threadID *uint) (*ChatThread, error) {
+	if threadID == nil || *threadID == 0 {
+		return activeChatThread(telegramID, true)
+	}
+
+	var thread ChatThread
+	if err := db.Where("id = ? AND telegram_id = ?", *threadID, telegramID).First(&thread).Error; err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// touchChatThread records a new message: bumps the thread, names it if needed and brings it back from the archive
+func touchChatThread(thread *ChatThread, message string) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"last_message_at": now,
+		"message_count":   gorm.Expr("message_count + 1"),
+		"archived":        false,
+	}
+	if thread.Title == "" {
+		thread.Title = chatThreadTitle(message)
+		updates["title"] = thread.Title
+	}
+
+	if err := db.Model(&ChatThread{}).Where("id = ?", thread.ID).Updates(updates).Error; err != nil {
+		logger.Error("Failed to update chat thread",
+			zap.Uint("thread_id", thread.ID),
+			zap.Error(err))
+		return
+	}
+	thread.LastMessageAt = now
+	thread.MessageCount++
+	thread.Archived = false
+}
+
+// deleteChatThread removes a thread with all its messages, their ratings and its AI jobs
+func deleteChatThread(thread *ChatThread) (int64, error) {
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("target = ? AND target_id IN (?)", RatingTargetChatMessage,
+			tx.Model(&ChatMessage{}).Select("id").Where("thread_id = ?", thread.ID)).Delete(&AIRating{}).Error; err != nil {
+			return err
+		}
+		// A queued answer would otherwise land in the deleted thread
+		if err := tx.Where("thread_id = ?", thread.ID).Delete(&AIJob{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("thread_id = ?", thread.ID).Delete(&ChatMessage{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Delete(&ChatThread{}, thread.ID).Error
+	})
+	return deleted, err
+}
+
+// migrateLegacyChatThreads moves messages saved before threads existed into one thread per user.
+// The thread starts without a summary, older turns are summarized again as the chat goes on.
+func migrateLegacyChatThreads() {
+	var owners []int64
+	if err := db.Model(&ChatMessage{}).Where("thread_id IS NULL").Distinct().Pluck("telegram_id", &owners).Error; err != nil {
+		logger.Error("Failed to find chat messages without thread", zap.Error(err))
+		return
+	}
+
+	for _, telegramID := range owners {
+		var first, last ChatMessage
+		var count int64
+		scope := db.Model(&ChatMessage{}).Where("telegram_id = ? AND thread_id IS NULL", telegramID)
+		if err := scope.Session(&gorm.Session{}).Order("id ASC").First(&first).Error; err != nil {
+			continue
+		}
+		scope.Session(&gorm.Session{}).Order("id DESC").First(&last)
+		scope.Session(&gorm.Session{}).Count(&count)
+
+		thread := ChatThread{
+			TelegramID:    telegramID,
+			Title:         chatThreadTitle(first.Message),
+			MessageCount:  int(count),
+			LastMessageAt: last.CreatedAt,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&thread).Error; err != nil {
+				return err
+			}
+			return tx.Model(&ChatMessage{}).Where("telegram_id = ? AND thread_id IS NULL", telegramID).
+				Update("thread_id", thread.ID).Error
+		})
+		if err != nil {
+			logger.Error("Failed to migrate chat messages into a thread",
+				zap.Int64("user_id", telegramID),
+				zap.Error(err))
+			return
+		}
+	}
+
+	if len(owners) > 0 {
+		logger.Info("Migrated legacy chat messages into threads", zap.Int("users", len(owners)))
+	}
+}
+
+// ==========================================
+// Cursor pagination
+// ==========================================
+
+// errInvalidCursor is returned for a cursor that was not made by encodeCursor
+var errInvalidCursor = errors.New("invalid cursor")
+
+// threadCursor is the position after the last thread of a page (pinned DESC, last_message_at DESC, id DESC)
+type threadCursor struct {
+	Pinned        bool  `json:"p"`
+	LastMessageAt int64 `json:"t"` // Unix nanoseconds
+	ID            uint  `json:"id"`
+}
+
+// encodeCursor returns an opaque cursor for v
+func encodeCursor(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor made by encodeCursor
+func decodeCursor(cursor string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// pageSize reads ?limit= within [1, MaxChatPageSize]
+func pageSize(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return DefaultChatPageSize
+	}
+	if limit > MaxChatPageSize {
+		return MaxChatPageSize
+	}
+	return limit
+}
+
+// ==========================================
+// Mini App API
+// ==========================================
+
+// ChatThreadPage is a page of threads; NextCursor is empty on the last page
+type ChatThreadPage struct {
+	Threads    []ChatThread `json:"threads"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// ChatMessagePage is a page of messages, oldest first; NextCursor loads older messages
+type ChatMessagePage struct {
+	ThreadID   uint          `json:"thread_id"`
+	Messages   []ChatMessage `json:"messages"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// ownerFromRequest parses :telegram_id and checks the caller owns the account
+func ownerFromRequest(c *gin.Context) (int64, bool) {
+	telegramID, err := strconv.ParseInt(c.Param("telegram_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid telegram_id",
+		})
+		return 0, false
+	}
+	if !requireAccountOwner(c, telegramID) {
+		return 0, false
+	}
+	return telegramID, true
+}
+
+// ownedThreadFromRequest loads :thread_id of the account owner
+func ownedThreadFromRequest(c *gin.Context) (*ChatThread, bool) {
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return nil, false
+	}
+
+	threadID, err := strconv.ParseUint(c.Param("thread_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid thread_id",
+		})
+		return nil, false
+	}
+
+	id := uint(threadID)
+	thread, err := resolveChatThread(telegramID, &id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "Thread not found",
+			})
+			return nil, false
+		}
+		logger.Error("Failed to load chat thread", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return nil, false
+	}
+	return thread, true
+}
+
+// listChatThreadsAPI handles GET /api/v1/user/:telegram_id/threads?archived=&cursor=&limit=
+// Pinned threads come first, then the most recently used ones.
+func listChatThreadsAPI(c *gin.Context) {
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	page, err := chatThreadPage(telegramID, c.Query("archived") == "true", c.Query("cursor"), pageSize(c))
+	if err != nil {
+		if err == errInvalidCursor {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Error:   "Invalid cursor",
+			})
+			return
+		}
+		logger.Error("Failed to list chat threads", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// chatThreadPage loads up to limit threads of a user after cursor, pinned first and then the
+// most recently used
+func chatThreadPage(telegramID int64, archived bool, cursor string, limit int) (*ChatThreadPage, error) {
+	query := db.Where("telegram_id = ? AND archived = ?", telegramID, archived)
+	if cursor != "" {
+		var after threadCursor
+		if err := decodeCursor(cursor, &after); err != nil {
+			return nil, errInvalidCursor
+		}
+		lastMessageAt := time.Unix(0, after.LastMessageAt)
+		query = query.Where("(pinned < ?) OR (pinned = ? AND last_message_at < ?) OR (pinned = ? AND last_message_at = ? AND id < ?)",
+			after.Pinned, after.Pinned, lastMessageAt, after.Pinned, lastMessageAt, after.ID)
+	}
+
+	var threads []ChatThread
+	if err := query.Order("pinned DESC, last_message_at DESC, id DESC").Limit(limit + 1).Find(&threads).Error; err != nil {
+		return nil, err
+	}
+
+	page := &ChatThreadPage{Threads: threads}
+	if len(threads) > limit {
+		page.Threads = threads[:limit]
+		last := page.Threads[limit-1]
+		page.NextCursor = encodeCursor(threadCursor{Pinned: last.Pinned, LastMessageAt: last.LastMessageAt.UnixNano(), ID: last.ID})
+	}
+	return page, nil
+}
+
+// createChatThreadAPI handles POST /api/v1/user/:telegram_id/threads
+func createChatThreadAPI(c *gin.Context) {
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title string `json:"title"`
+	}
+	// The body is optional, an untitled thread is named after its first message
+	_ = c.ShouldBindJSON(&req)
+
+	thread, err := createChatThread(telegramID, req.Title)
+	if err != nil {
+		logger.Error("Failed to create chat thread", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Data:    thread,
+	})
+}
+
+// updateChatThreadAPI handles PUT /api/v1/user/:telegram_id/threads/:thread_id (rename, pin, archive)
+func updateChatThreadAPI(c *gin.Context) {
+	thread, ok := ownedThreadFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title    *string `json:"title"`
+		Pinned   *bool   `json:"pinned"`
+		Archived *bool   `json:"archived"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid request data",
+		})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		title := chatThreadTitle(*req.Title)
+		if title == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Error:   "Title cannot be empty",
+			})
+			return
+		}
+		updates["title"] = title
+	}
+	if req.Pinned != nil {
+		updates["pinned"] = *req.Pinned
+	}
+	if req.Archived != nil {
+		updates["archived"] = *req.Archived
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&ChatThread{}).Where("id = ?", thread.ID).Updates(updates).Error; err != nil {
+			logger.Error("Failed to update chat thread", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Error:   "Database error",
+			})
+			return
+		}
+		db.First(thread, thread.ID)
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    thread,
+	})
+}
+
+// deleteChatThreadAPI handles DELETE /api/v1/user/:telegram_id/threads/:thread_id
+func deleteChatThreadAPI(c *gin.Context) {
+	thread, ok := ownedThreadFromRequest(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := deleteChatThread(thread)
+	if err != nil {
+		logger.Error("Failed to delete chat thread",
+			zap.Uint("thread_id", thread.ID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	logger.Info("Chat thread deleted",
+		zap.Int64("user_id", thread.TelegramID),
+		zap.Uint("thread_id", thread.ID),
+		zap.Int64("deleted_messages", deleted))
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    gin.H{"deleted_messages": deleted},
+	})
+}
+
+// listChatThreadMessagesAPI handles GET /api/v1/user/:telegram_id/threads/:thread_id/messages?cursor=&limit=
+// The first page holds the newest messages; next_cursor loads older ones.
+func listChatThreadMessagesAPI(c *gin.Context) {
+	thread, ok := ownedThreadFromRequest(c)
+	if !ok {
+		return
+	}
+
+	page, err := chatMessagePage(thread.ID, c.Query("cursor"), pageSize(c))
+	if err != nil {
+		if err == errInvalidCursor {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Error:   "Invalid cursor",
+			})
+			return
+		}
+		logger.Error("Failed to list chat messages", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// chatMessagePage loads up to limit messages of a thread older than cursor, returned oldest first
+func chatMessagePage(threadID uint, cursor string, limit int) (*ChatMessagePage, error) {
+	query := db.Where("thread_id = ?", threadID)
+	if cursor != "" {
+		var beforeID uint
+		if err := decodeCursor(cursor, &beforeID); err != nil {
+			return nil, errInvalidCursor
+		}
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var messages []ChatMessage
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	page := &ChatMessagePage{ThreadID: threadID}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		page.NextCursor = encodeCursor(messages[limit-1].ID)
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	page.Messages = messages
+	return page, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// TestChatThreadTitle covers titles from the first message: first line only, and long text
+// cut at a word boundary
+func TestChatThreadTitle(t *testing.T) {
+	long := strings.Repeat("کلمه ", 20)
+	noSpaces := strings.Repeat("ب", ChatThreadTitleMaxRunes+10)
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"empty", "   ", ""},
+		{"short", "  ایده کسب و کار  ", "ایده کسب و کار"},
+		{"first line only", "عنوان\nمتن طولانی سوال", "عنوان"},
+		{"exactly the limit", strings.Repeat("ا", ChatThreadTitleMaxRunes), strings.Repeat("ا", ChatThreadTitleMaxRunes)},
+		{"cut at a word", long, strings.TrimSpace(strings.Repeat("کلمه ", 12)) + "…"},
+		{"cut inside a word", noSpaces, strings.Repeat("ب", ChatThreadTitleMaxRunes) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chatThreadTitle(tt.message)
+			if got != tt.want {
+				t.Fatalf("chatThreadTitle = %q, want %q", got, tt.want)
+			}
+			if utf8.RuneCountInString(got) > ChatThreadTitleMaxRunes+1 || !utf8.ValidString(got) {
+				t.Fatalf("title %q is too long or not valid UTF-8", got)
+			}
+		})
+	}
+}
+
+// TestChatThreadPagination pages through threads with equal timestamps and pinned threads
+// and checks every thread is returned once in order
+func TestChatThreadPagination(t *testing.T) {
+	useTestDB(t, &ChatThread{}, &ChatMessage{})
+
+	const telegramID = int64(1001)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	// Threads 1-7; 2 and 5 are pinned, 3 and 4 share a timestamp, 8 is archived, 9 is another user's
+	threads := []ChatThread{
+		{TelegramID: telegramID, LastMessageAt: base},
+		{TelegramID: telegramID, LastMessageAt: base.Add(time.Minute), Pinned: true},
+		{TelegramID: telegramID, LastMessageAt: base.Add(2 * time.Minute)},
+		{TelegramID: telegramID, LastMessageAt: base.Add(2 * time.Minute)},
+		{TelegramID: telegramID, LastMessageAt: base.Add(3 * time.Minute), Pinned: true},
+		{TelegramID: telegramID, LastMessageAt: base.Add(4 * time.Minute)},
+		{TelegramID: telegramID, LastMessageAt: base.Add(4*time.Minute + time.Millisecond)},
+		{TelegramID: telegramID, LastMessageAt: base.Add(5 * time.Minute), Archived: true},
+		{TelegramID: 2002, LastMessageAt: base.Add(5 * time.Minute)},
+	}
+	for i := range threads {
+		mustCreate(t, &threads[i])
+	}
+	// Pinned newest first, then by last message, ties by the newer ID
+	want := []uint{5, 2, 7, 6, 4, 3, 1}
+
+	for _, limit := range []int{1, 2, 3, 7, 10} {
+		var got []uint
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(want) {
+				t.Fatalf("limit %d: pagination does not end", limit)
+			}
+			page, err := chatThreadPage(telegramID, false, cursor, limit)
+			if err != nil {
+				t.Fatalf("limit %d: %v", limit, err)
+			}
+			if len(page.Threads) > limit {
+				t.Fatalf("limit %d: page of %d threads", limit, len(page.Threads))
+			}
+			for _, thread := range page.Threads {
+				got = append(got, thread.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if !equalIDs(got, want) {
+			t.Fatalf("limit %d: got threads %v, want %v", limit, got, want)
+		}
+	}
+
+	archived, err := chatThreadPage(telegramID, true, "", 10)
+	if err != nil || len(archived.Threads) != 1 || archived.Threads[0].ID != 8 {
+		t.Fatalf("unexpected archived page: %+v %v", archived, err)
+	}
+	if _, err := chatThreadPage(telegramID, false, "not-a-cursor", 10); err != errInvalidCursor {
+		t.Fatalf("expected errInvalidCursor, got %v", err)
+	}
+}
+
+// TestChatMessagePagination checks message pages go from the newest back to the oldest,
+// each page oldest first
+func TestChatMessagePagination(t *testing.T) {
+	useTestDB(t, &ChatThread{}, &ChatMessage{})
+
+	thread := ChatThread{TelegramID: 1001, LastMessageAt: time.Now()}
+	mustCreate(t, &thread)
+	for i := 0; i < 5; i++ {
+		mustCreate(t, &ChatMessage{TelegramID: 1001, ThreadID: &thread.ID, Message: "سوال", Response: "پاسخ"})
+	}
+
+	var pages [][]uint
+	cursor := ""
+	for {
+		page, err := chatMessagePage(thread.ID, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, chatMessageIDs(page.Messages))
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(pages) != 3 || !equalIDs(pages[0], []uint{4, 5}) || !equalIDs(pages[1], []uint{2, 3}) || !equalIDs(pages[2], []uint{1}) {
+		t.Fatalf("unexpected pages %v", pages)
+	}
+}
+
+// TestDeleteChatThread checks ratings and jobs of the thread go with it and other threads stay
+func TestDeleteChatThread(t *testing.T) {
+	useTestDB(t, &ChatThread{}, &ChatMessage{}, &AIRating{}, &AIJob{})
+
+	var threads [2]ChatThread
+	for i := range threads {
+		threads[i] = ChatThread{TelegramID: 1001, LastMessageAt: time.Now()}
+		mustCreate(t, &threads[i])
+		message := ChatMessage{TelegramID: 1001, ThreadID: &threads[i].ID, Message: "سوال", Response: "پاسخ"}
+		mustCreate(t, &message)
+		mustCreate(t, &AIRating{TelegramID: 1001, Target: RatingTargetChatMessage, TargetID: message.ID, Score: 1})
+		mustCreate(t, &AIJob{TelegramID: 1001, Kind: AIJobChat, ThreadID: &threads[i].ID, Status: AIJobQueued})
+	}
+	// A tool result rating with the same target ID must not be touched
+	mustCreate(t, &AIRating{TelegramID: 1001, Target: RatingTargetToolResult, TargetID: 1, Score: -1})
+
+	deleted, err := deleteChatThread(&threads[0])
+	if err != nil || deleted != 1 {
+		t.Fatalf("deleteChatThread = %d, %v", deleted, err)
+	}
+
+	var ratings []AIRating
+	db.Order("id").Find(&ratings)
+	if len(ratings) != 2 || ratings[0].TargetID != 2 || ratings[1].Target != RatingTargetToolResult {
+		t.Fatalf("unexpected ratings left: %+v", ratings)
+	}
+	var jobs []AIJob
+	db.Find(&jobs)
+	if len(jobs) != 1 || *jobs[0].ThreadID != threads[1].ID {
+		t.Fatalf("unexpected jobs left: %+v", jobs)
+	}
+}
+
+// TestChatHistoryRequiresAccountOwner asserts the legacy chat history routes refuse another
+// user's telegram_id, like the thread endpoints.
+func TestChatHistoryRequiresAccountOwner(t *testing.T) {
+	useTestDB(t, &ChatThread{}, &ChatMessage{})
+
+	thread := ChatThread{TelegramID: 2002, LastMessageAt: time.Now()}
+	mustCreate(t, &thread)
+	mustCreate(t, &ChatMessage{TelegramID: 2002, ThreadID: &thread.ID, Message: "سوال خصوصی", Response: "پاسخ"})
+
+	r := sessionRouter(1001)
+	r.GET("/api/v1/user/:telegram_id/chat-history", getChatHistory)
+	r.POST("/api/v1/user/:telegram_id/chat-history", saveChatMessage)
+
+	path := fmt.Sprintf("/api/v1/user/2002/chat-history?thread_id=%d", thread.ID)
+	if w := serveJSON(r, http.MethodGet, path, ""); w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "سوال خصوصی") {
+		t.Errorf("GET: expected 403 without the messages, got %d: %s", w.Code, w.Body.String())
+	}
+	body := fmt.Sprintf(`{"message": "x", "response": "y", "thread_id": %d}`, thread.ID)
+	if w := serveJSON(r, http.MethodPost, "/api/v1/user/2002/chat-history", body); w.Code != http.StatusForbidden {
+		t.Errorf("POST: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var messages int64
+	db.Model(&ChatMessage{}).Count(&messages)
+	if messages != 1 {
+		t.Errorf("forged request wrote into the thread, %d messages", messages)
+	}
+
+	// The owner still reads their own history
+	owner := sessionRouter(2002)
+	owner.GET("/api/v1/user/:telegram_id/chat-history", getChatHistory)
+	if w := serveJSON(owner, http.MethodGet, path, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "سوال خصوصی") {
+		t.Errorf("owner: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
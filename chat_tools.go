@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Chat tools: read-only functions the assistant can call to answer questions about the
+// user's own progress, subscription, exercises and tickets.
+// 🔒 SECURITY: tools take no arguments. They always run for the user the chat request was
+// authenticated as (prepareChatRequest checks the caller owns telegram_id, AIClient.ForUser
+// binds that user), so the model can never read another user's data.
+
+// maxToolRounds is how many times one answer may go back to the model with tool results
+const maxToolRounds = 3
+
+// maxToolCallsPerRound caps the calls executed from a single model turn
+const maxToolCallsPerRound = 4
+
+// ChatTool is a read-only function exposed to the assistant
+type ChatTool struct {
+	Name        string
+	Description string
+	Run         func(user *User) (interface{}, error)
+}
+
+// errToolUnavailable is returned when the data behind a tool cannot be read
+var errToolUnavailable = errors.New("data is not available right now")
+
+// chatTools are offered to the model in the chat feature
+var chatTools = []ChatTool{
+	{
+		Name:        "get_current_session",
+		Description: "جلسه فعلی دوره که کاربر در آن است، تعداد جلسات تکمیل‌شده و سطح کاربر را برمی‌گرداند.",
+		Run:         toolCurrentSession,
+	},
+	{
+		Name:        "get_subscription_status",
+		Description: "وضعیت اشتراک کاربر، نام پلن و تاریخ پایان اشتراک را برمی‌گرداند.",
+		Run:         toolSubscriptionStatus,
+	},
+	{
+		Name:        "get_latest_exercise_feedback",
+		Description: "آخرین تمرین ارسال‌شده کاربر، وضعیت بررسی و بازخورد آن را برمی‌گرداند.",
+		Run:         toolLatestExerciseFeedback,
+	},
+	{
+		Name:        "get_open_tickets",
+		Description: "تیکت‌های پشتیبانی باز کاربر و وضعیت هر کدام را برمی‌گرداند.",
+		Run:         toolOpenTickets,
+	},
+}
+
+// chatToolsEnabled reports whether function calling is on for chat (AI_CHAT_TOOLS, default on)
+func chatToolsEnabled() bool {
+	return !strings.EqualFold(os.Getenv("AI_CHAT_TOOLS"), "false")
+}
+
+// llmTools returns the definitions sent to the provider
+func llmTools(tools []ChatTool) []LLMTool {
+	result := make([]LLMTool, 0, len(tools))
+	for _, tool := range tools {
+		result = append(result, LLMTool{Name: tool.Name, Description: tool.Description, Parameters: objectSchema()})
+	}
+	return result
+}
+
+// runToolCalls executes the calls of one model turn for user and returns the tool messages
+// to send back. Failures are reported to the model as an error field, never to the user.
+func runToolCalls(user *User, tools []ChatTool, calls []LLMToolCall) []LLMMessage {
+	byName := make(map[string]ChatTool, len(tools))
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+	}
+
+	messages := make([]LLMMessage, 0, len(calls))
+	for i, call := range calls {
+		var output interface{}
+		result := "ok"
+		tool, ok := byName[call.Name]
+		switch {
+		case i >= maxToolCallsPerRound:
+			result = "limit"
+			output = map[string]string{"error": "too many tool calls"}
+		case !ok:
+			result = "unknown"
+			output = map[string]string{"error": "unknown tool"}
+		default:
+			value, err := tool.Run(user)
+			if err != nil {
+				result = "error"
+				logger.Warn("Chat tool failed",
+					zap.String("tool", call.Name),
+					zap.Int64("user_id", user.TelegramID),
+					zap.Error(err))
+				value = map[string]string{"error": errToolUnavailable.Error()}
+			}
+			output = value
+		}
+		metrics.IncChatToolCall(call.Name, result)
+
+		content, err := json.Marshal(output)
+		if err != nil {
+			content = []byte(`{"error":"invalid tool output"}`)
+		}
+		messages = append(messages, LLMMessage{Role: "tool", Content: string(content), ToolCallID: call.ID})
+	}
+	return messages
+}
+
+// toolCurrentSession describes the session the user is on
+func toolCurrentSession(user *User) (interface{}, error) {
+	completed := user.CurrentSession - 1
+	if completed < 0 {
+		completed = 0
+	}
+	level := GetUserLevel(completed)
+	result := map[string]interface{}{
+		"current_session_number": user.CurrentSession,
+		"completed_sessions":     completed,
+		"progress_percent":       GetUserProgress(completed),
+		"level":                  level.Level,
+		"level_name":             level.Name,
+	}
+
+	if db == nil {
+		return result, nil
+	}
+	session, err := sessionCache.GetSessionByNumber(user.CurrentSession)
+	if err != nil {
+		return result, nil // Past the last session or not created yet; progress alone still answers
+	}
+	result["current_session_title"] = session.Title
+	result["current_session_description"] = session.Description
+	return result, nil
+}
+
+// toolSubscriptionStatus describes the user's plan and its expiry
+func toolSubscriptionStatus(user *User) (interface{}, error) {
+	result := map[string]interface{}{
+		"active": user.HasActiveSubscription(),
+		"status": user.GetSubscriptionStatusText(),
+		"plan":   user.PlanName,
+	}
+	if user.SubscriptionExpiry != nil {
+		result["expires_at"] = user.SubscriptionExpiry.Format("2006-01-02 15:04")
+		if days := int(time.Until(*user.SubscriptionExpiry).Hours() / 24); days >= 0 {
+			result["days_left"] = days
+		}
+	}
+	return result, nil
+}
+
+// toolLatestExerciseFeedback returns the user's most recent exercise submission
+func toolLatestExerciseFeedback(user *User) (interface{}, error) {
+	if db == nil {
+		return nil, errToolUnavailable
+	}
+
+	var exercises []ExerciseSubmission
+	if err := db.Where("telegram_id = ?", user.TelegramID).
+		Preload("Session").
+		Order("submitted_at DESC").Limit(1).
+		Find(&exercises).Error; err != nil {
+		return nil, err
+	}
+	if len(exercises) == 0 {
+		return map[string]interface{}{"has_exercise": false}, nil
+	}
+
+	exercise := exercises[0]
+	return map[string]interface{}{
+		"has_exercise":   true,
+		"session_number": exercise.Session.Number,
+		"session_title":  exercise.Session.Title,
+		"attempt":        exercise.Attempt,
+		"status":         exercise.Status,
+		"feedback":       exercise.Feedback,
+		"submitted_at":   exercise.SubmittedAt.Format("2006-01-02 15:04"),
+	}, nil
+}
+
+// toolOpenTickets lists the user's support tickets that are not closed
+func toolOpenTickets(user *User) (interface{}, error) {
+	if db == nil {
+		return nil, errToolUnavailable
+	}
+
+	var tickets []Ticket
+	if err := db.Where("telegram_id = ? AND status <> ?", user.TelegramID, "closed").
+		Order("updated_at DESC").Limit(5).
+		Find(&tickets).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]map[string]interface{}, 0, len(tickets))
+	for _, ticket := range tickets {
+		items = append(items, map[string]interface{}{
+			"id":         ticket.ID,
+			"subject":    ticket.Subject,
+			"status":     ticket.Status,
+			"priority":   ticket.Priority,
+			"updated_at": ticket.UpdatedAt.Format("2006-01-02 15:04"),
+		})
+	}
+	return map[string]interface{}{"open_tickets": items}, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChatToolCallsRunForRequestingUser asserts tool calls are answered with the requesting
+// user's data, fed back to the model, and that unknown tools get an error instead of data.
+func TestChatToolCallsRunForRequestingUser(t *testing.T) {
+	expiry := time.Now().Add(10 * 24 * time.Hour)
+	user := &User{TelegramID: 42, SubscriptionType: "paid", PlanName: "pro", SubscriptionExpiry: &expiry}
+
+	fake := NewFakeLLMProvider("fake").
+		CallTools(
+			LLMToolCall{ID: "call_1", Name: "get_subscription_status", Arguments: `{"telegram_id": 7}`},
+			LLMToolCall{ID: "call_2", Name: "delete_account", Arguments: "{}"},
+		).
+		Respond("اشتراک پرو شما فعال است.")
+	client := (&AIClient{router: NewLLMRouter([]LLMProvider{fake}, nil)}).ForUser(user)
+
+	resp, err := client.GenerateMonetizeAIResponse(FeatureChat, "اشتراکم کی تموم میشه؟", nil)
+	if err != nil {
+		t.Fatalf("GenerateMonetizeAIResponse: %v", err)
+	}
+	if resp.Content != "اشتراک پرو شما فعال است." {
+		t.Errorf("unexpected answer %q", resp.Content)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected the model to be asked again after the tool round, got %d calls", len(calls))
+	}
+	if len(calls[0].Tools) != len(chatTools) {
+		t.Errorf("expected %d tools offered, got %d", len(chatTools), len(calls[0].Tools))
+	}
+
+	results := map[string]string{}
+	for _, msg := range calls[1].Messages {
+		if msg.Role == "tool" {
+			results[msg.ToolCallID] = msg.Content
+		}
+	}
+	if got := results["call_1"]; !strings.Contains(got, `"plan":"pro"`) || !strings.Contains(got, `"active":true`) {
+		t.Errorf("subscription tool should describe the requesting user, got %s", got)
+	}
+	if got := results["call_2"]; got != `{"error":"unknown tool"}` {
+		t.Errorf("unknown tool should return an error, got %s", got)
+	}
+
+	// Without a user (one-off prompts) no tools are offered
+	fake = NewFakeLLMProvider("fake", "پاسخ")
+	client = &AIClient{router: NewLLMRouter([]LLMProvider{fake}, nil)}
+	if _, err := client.StreamMonetizeAIResponse(context.Background(), FeatureChat, "سلام", nil, func(string) error { return nil }); err != nil {
+		t.Fatalf("StreamMonetizeAIResponse: %v", err)
+	}
+	if tools := fake.Calls()[0].Tools; len(tools) != 0 {
+		t.Errorf("expected no tools without a user, got %d", len(tools))
+	}
+}
+
+// TestChatRequestRequiresAccountOwner asserts the chat endpoints refuse a telegram_id that
+// isn't the caller's, so tools can't be run for another user.
+func TestChatRequestRequiresAccountOwner(t *testing.T) {
+	r := sessionRouter(1001)
+	r.POST("/api/v1/chat", handleChatRequest)
+	r.POST("/api/v1/chat/stream", handleChatStreamRequest)
+
+	for _, path := range []string{"/api/v1/chat", "/api/v1/chat/stream"} {
+		w := serveJSON(r, http.MethodPost, path, `{"telegram_id": 2002, "message": "برنامه من چیه؟"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403 for another user's telegram_id, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"MonetizeeAI_bot/fieldcrypt"
+
+	"github.com/joho/godotenv"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// userContactRow reads the raw (possibly encrypted) contact columns of the users table
+type userContactRow struct {
+	ID          uint
+	Phone       string
+	PhoneNumber string
+	Email       string
+	PhoneHash   string `gorm:"size:64;index"`
+	EmailHash   string `gorm:"size:64;index"`
+}
+
+func (userContactRow) TableName() string {
+	return "users"
+}
+
+// Encrypts plaintext phone numbers and emails, re-encrypts values written with an old key
+// and rebuilds the blind indexes.
+//
+// Usage: go run ./cmd/encrypt-user-fields [-dry-run] [-batch 500]
+//
+// Key rotation: put the new key first in FIELD_ENCRYPTION_KEYS and keep the old one after it
+// ("k2:<new>,k1:<old>"), run this command, then remove the old key.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only count the rows that would change")
+	batchSize := flag.Int("batch", 500, "rows per batch")
+	flag.Parse()
+
+	// .env is optional, the keys may come from the environment
+	_ = godotenv.Load()
+
+	if err := fieldcrypt.Init(); err != nil {
+		fmt.Printf("❌ Invalid encryption keys: %v\n", err)
+		os.Exit(1)
+	}
+	if !fieldcrypt.Enabled() {
+		fmt.Printf("❌ %s is not set, nothing to encrypt with\n", fieldcrypt.EncryptionKeysEnv)
+		os.Exit(1)
+	}
+
+	dsn := os.Getenv("MYSQL_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_URL")
+	}
+	if dsn == "" {
+		fmt.Println("❌ MYSQL_DSN (or DATABASE_URL) is not set")
+		os.Exit(1)
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		fmt.Printf("❌ Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Adds the blind index columns if the bot has not been started since they were introduced
+	if err := db.AutoMigrate(&userContactRow{}); err != nil {
+		fmt.Printf("❌ Failed to migrate database: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔄 Encrypting user contact fields with key %q...\n", fieldcrypt.ActiveKeyID())
+
+	var scanned, updated, failed int
+	var rows []userContactRow
+	result := db.Model(&userContactRow{}).FindInBatches(&rows, *batchSize, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			scanned++
+
+			changes, err := contactChanges(row)
+			if err != nil {
+				failed++
+				fmt.Printf("⚠️  User %d: %v\n", row.ID, err)
+				continue
+			}
+			if len(changes) == 0 {
+				continue
+			}
+
+			updated++
+			if *dryRun {
+				continue
+			}
+			if err := db.Model(&userContactRow{}).Where("id = ?", row.ID).Updates(changes).Error; err != nil {
+				return fmt.Errorf("update user %d: %w", row.ID, err)
+			}
+		}
+
+		fmt.Printf("   batch %d done (%d users scanned)\n", batch, scanned)
+		return nil
+	})
+	if result.Error != nil {
+		fmt.Printf("❌ Migration stopped: %v\n", result.Error)
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		fmt.Printf("✅ Dry run: %d of %d users would be updated, %d failed\n", updated, scanned, failed)
+	} else {
+		fmt.Printf("✅ Updated %d of %d users, %d failed\n", updated, scanned, failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// contactChanges returns the columns of a row that need to be rewritten
+func contactChanges(row userContactRow) (map[string]interface{}, error) {
+	changes := make(map[string]interface{})
+
+	phone, err := rewrite("phone", row.Phone, changes)
+	if err != nil {
+		return nil, err
+	}
+	phoneNumber, err := rewrite("phone_number", row.PhoneNumber, changes)
+	if err != nil {
+		return nil, err
+	}
+	email, err := rewrite("email", row.Email, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Same rule as User.BeforeSave
+	if phone == "" {
+		phone = phoneNumber
+	}
+	if hash := fieldcrypt.PhoneIndex(phone); hash != row.PhoneHash {
+		changes["phone_hash"] = hash
+	}
+	if hash := fieldcrypt.EmailIndex(email); hash != row.EmailHash {
+		changes["email_hash"] = hash
+	}
+
+	return changes, nil
+}
+
+// rewrite decrypts a stored value, re-encrypts it with the active key when needed and returns the plaintext
+func rewrite(column, stored string, changes map[string]interface{}) (string, error) {
+	plaintext, err := fieldcrypt.Decrypt(stored)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", column, err)
+	}
+
+	if fieldcrypt.NeedsRotation(stored) {
+		encrypted, err := fieldcrypt.Encrypt(plaintext)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", column, err)
+		}
+		changes[column] = encrypted
+	}
+
+	return plaintext, nil
+}
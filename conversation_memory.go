@@ -0,0 +1,274 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Conversation memory limits
+const (
+	DefaultMemoryTokenBudget = 2000 // Tokens of stored turns sent with each message (CHAT_MEMORY_TOKEN_BUDGET)
+	memoryMaxLoadedMessages  = 50   // Newest messages considered for the context
+	memoryMaxTurnRunes       = 1500 // Long answers are cut before they go into the context
+	memorySummarizeMin       = 4    // Messages outside the budget before a summary round runs
+	memorySummarizeBatch     = 20   // Messages folded into the summary per round
+)
+
+// ConversationContext is the stored history sent with a chat message
+type ConversationContext struct {
+	Summary string
+	Turns   []LLMMessage // Oldest first, alternating user/assistant
+}
+
+// summarizingThreads prevents two summary rounds for the same thread at once
+var summarizingThreads sync.Map
+
+// memoryTokenBudget returns the token budget of stored turns per request
+func memoryTokenBudget() int {
+	if value, err := strconv.Atoi(os.Getenv("CHAT_MEMORY_TOKEN_BUDGET")); err == nil && value > 0 {
+		return value
+	}
+	return DefaultMemoryTokenBudget
+}
+
+// estimateTokens is a rough token count; Persian text averages about 2 runes per token
+func estimateTokens(s string) int {
+	return utf8.RuneCountInString(s)/2 + 4
+}
+
+// isChatNonAnswer reports a reply that is not an AI answer: an error or status notice
+// such as "❌ خطا..." or "⏳ ...". Those are never sent back to the model as assistant turns.
+func isChatNonAnswer(response string) bool {
+	response = strings.TrimSpace(response)
+	return response == "" || strings.HasPrefix(response, "❌") || strings.HasPrefix(response, "⏳")
+}
+
+// chatMessageTurns converts a stored exchange into a user and an assistant turn
+func chatMessageTurns(msg ChatMessage) []LLMMessage {
+	response := msg.Response
+	if runes := []rune(response); len(runes) > memoryMaxTurnRunes {
+		response = string(runes[:memoryMaxTurnRunes]) + "…"
+	}
+	return []LLMMessage{
+		{Role: "user", Content: msg.Message},
+		{Role: "assistant", Content: response},
+	}
+}
+
+// splitByBudget splits messages (oldest first) into the older ones that do not fit
+// and the newest ones whose turns fit into budget tokens
+func splitByBudget(messages []ChatMessage, budget int) (overflow, fit []ChatMessage) {
+	used := 0
+	start := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		cost := 0
+		for _, turn := range chatMessageTurns(messages[i]) {
+			cost += estimateTokens(turn.Content)
+		}
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start = i
+	}
+	return messages[:start], messages[start:]
+}
+
+// loadConversationContext builds the context of the next message of a thread from its stored ChatMessage rows
+func loadConversationContext(thread *ChatThread) *ConversationContext {
+	if db == nil || thread == nil {
+		return nil
+	}
+
+	var messages []ChatMessage
+	if err := db.Where("thread_id = ? AND id > ?", thread.ID, thread.SummarizedUntilID).
+		Order("id DESC").Limit(memoryMaxLoadedMessages).Find(&messages).Error; err != nil {
+		logger.Error("Failed to load chat messages for context",
+			zap.Int64("user_id", thread.TelegramID),
+			zap.Uint("thread_id", thread.ID),
+			zap.Error(err))
+		return &ConversationContext{Summary: thread.Summary}
+	}
+
+	// Oldest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	// Error replies stored before non-answers were skipped stay out of the context
+	answered := messages[:0]
+	for _, msg := range messages {
+		if !isChatNonAnswer(msg.Response) {
+			answered = append(answered, msg)
+		}
+	}
+
+	_, fit := splitByBudget(answered, memoryTokenBudget())
+
+	conv := &ConversationContext{Summary: thread.Summary}
+	for _, msg := range fit {
+		conv.Turns = append(conv.Turns, chatMessageTurns(msg)...)
+	}
+	return conv
+}
+
+// storeChatMessage saves an exchange to a thread and rolls old turns into the thread summary.
+// A reply no provider served (an error notice) is not saved; the returned message then has no ID.
+func storeChatMessage(thread *ChatThread, message, response string, served *LLMResponse) *ChatMessage {
+	chatMessage := ChatMessage{
+		TelegramID: thread.TelegramID,
+		ThreadID:   &thread.ID,
+		Message:    message,
+		Response:   response,
+	}
+	if served == nil || isChatNonAnswer(response) {
+		return &chatMessage
+	}
+	chatMessage.Provider, chatMessage.Model = served.Provider, served.Model
+	chatMessage.PromptVersion = promptVersion(PromptChatSystem)
+
+	if err := db.Create(&chatMessage).Error; err != nil {
+		logger.Error("Failed to save chat message", zap.Error(err))
+		// Continue anyway - don't fail the request just because we couldn't save
+		return &chatMessage
+	}
+
+	touchChatThread(thread, message)
+
+	go summarizeConversation(thread.ID)
+
+	return &chatMessage
+}
+
+// summarizeConversation folds messages that no longer fit the token budget into the thread summary
+func summarizeConversation(threadID uint) {
+	if aiClient == nil {
+		return
+	}
+	if _, running := summarizingThreads.LoadOrStore(threadID, true); running {
+		return
+	}
+	defer summarizingThreads.Delete(threadID)
+
+	var thread ChatThread
+	if err := db.First(&thread, threadID).Error; err != nil {
+		return
+	}
+
+	var messages []ChatMessage
+	if err := db.Where("thread_id = ? AND id > ?", thread.ID, thread.SummarizedUntilID).
+		Order("id ASC").Find(&messages).Error; err != nil {
+		logger.Error("Failed to load chat messages for summary",
+			zap.Uint("thread_id", thread.ID),
+			zap.Error(err))
+		return
+	}
+
+	overflow, _ := splitByBudget(messages, memoryTokenBudget())
+	if len(overflow) < memorySummarizeMin {
+		return
+	}
+	if len(overflow) > memorySummarizeBatch {
+		overflow = overflow[:memorySummarizeBatch]
+	}
+
+	var turns []LLMMessage
+	for _, msg := range overflow {
+		turns = append(turns, chatMessageTurns(msg)...)
+	}
+
+	// Summaries count towards the user's usage but are never blocked by the quota
+	user, err := userCache.GetUser(thread.TelegramID)
+	if err != nil {
+		user = &User{TelegramID: thread.TelegramID}
+	}
+
+	resp, err := aiClient.ForUser(user).SummarizeConversation(thread.Summary, turns)
+	if err != nil || resp.Content == "" {
+		logger.Warn("Conversation summary failed, keeping previous summary",
+			zap.Uint("thread_id", thread.ID),
+			zap.Error(err))
+		return
+	}
+
+	// Only move forward from the state the summary was built on, a reset in between wins
+	summarizedUntil := overflow[len(overflow)-1].ID
+	if err := db.Model(&ChatThread{}).
+		Where("id = ? AND summarized_until_id = ?", thread.ID, thread.SummarizedUntilID).
+		Updates(map[string]interface{}{
+			"summary":             resp.Content,
+			"summarized_until_id": summarizedUntil,
+		}).Error; err != nil {
+		logger.Error("Failed to save conversation summary",
+			zap.Uint("thread_id", thread.ID),
+			zap.Error(err))
+		return
+	}
+
+	logger.Info("Conversation summary updated",
+		zap.Int64("user_id", thread.TelegramID),
+		zap.Uint("thread_id", thread.ID),
+		zap.Int("summarized_messages", len(overflow)),
+		zap.Uint("summarized_until_id", summarizedUntil),
+		zap.String("provider", resp.Provider),
+		zap.String("model", resp.Model))
+}
+
+// resetConversationMemory clears the memory of a thread: the summary is dropped and earlier
+// messages stay in the thread but are no longer sent to the AI
+func resetConversationMemory(thread *ChatThread) error {
+	var lastID uint
+	if err := db.Model(&ChatMessage{}).Where("thread_id = ?", thread.ID).
+		Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := db.Model(&ChatThread{}).Where("id = ?", thread.ID).Updates(map[string]interface{}{
+		"summary":             "",
+		"summarized_until_id": lastID,
+		"memory_reset_at":     &now,
+	}).Error; err != nil {
+		return err
+	}
+
+	logger.Info("Conversation memory reset",
+		zap.Int64("user_id", thread.TelegramID),
+		zap.Uint("thread_id", thread.ID),
+		zap.Uint("last_message_id", lastID))
+	return nil
+}
+
+// resetConversationAPI handles POST /api/v1/user/:telegram_id/threads/:thread_id/reset
+func resetConversationAPI(c *gin.Context) {
+	thread, ok := ownedThreadFromRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := resetConversationMemory(thread); err != nil {
+		logger.Error("Failed to reset conversation memory",
+			zap.Uint("thread_id", thread.ID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    gin.H{"message": "حافظه این گفتگو پاک شد"},
+	})
+}
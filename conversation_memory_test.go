@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSplitByBudget checks the newest turns that fit the token budget are kept, in order,
+// and that the split never skips a message to fit an older one.
+func TestSplitByBudget(t *testing.T) {
+	// 4 + 4 runes: each turn is 4/2+4 = 6 tokens, 12 per message
+	small := func(id uint) ChatMessage { return ChatMessage{ID: id, Message: "سلام", Response: "درود"} }
+	// A long answer is cut to memoryMaxTurnRunes before it is counted
+	long := ChatMessage{ID: 9, Message: "سلام", Response: strings.Repeat("ب", memoryMaxTurnRunes*3)}
+	longCost := 6 + (memoryMaxTurnRunes+1)/2 + 4
+
+	tests := []struct {
+		name     string
+		messages []ChatMessage
+		budget   int
+		overflow []uint
+		fit      []uint
+	}{
+		{"empty", nil, 100, nil, nil},
+		{"all fit", []ChatMessage{small(1), small(2), small(3)}, 36, nil, []uint{1, 2, 3}},
+		{"oldest overflow", []ChatMessage{small(1), small(2), small(3)}, 35, []uint{1}, []uint{2, 3}},
+		{"one message exactly", []ChatMessage{small(1), small(2)}, 12, []uint{1}, []uint{2}},
+		{"newest does not fit", []ChatMessage{small(1), small(2)}, 11, []uint{1, 2}, nil},
+		{"no skipping past a large message", []ChatMessage{small(1), long, small(2)}, 12 + 12, []uint{1, 9}, []uint{2}},
+		{"long answer is truncated", []ChatMessage{small(1), long}, longCost, []uint{1}, []uint{9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overflow, fit := splitByBudget(tt.messages, tt.budget)
+			if got := chatMessageIDs(overflow); !equalIDs(got, tt.overflow) {
+				t.Errorf("overflow %v, want %v", got, tt.overflow)
+			}
+			if got := chatMessageIDs(fit); !equalIDs(got, tt.fit) {
+				t.Errorf("fit %v, want %v", got, tt.fit)
+			}
+		})
+	}
+}
+
+// TestChatNonAnswers checks error and status notices are not treated as AI answers
+func TestChatNonAnswers(t *testing.T) {
+	for response, want := range map[string]bool{
+		"❌ خطا در دریافت پاسخ. لطفا دوباره تلاش کنید.": true,
+		"⏳ سرویس هوش مصنوعی در حال حاضر شلوغ است.":     true,
+		"  ": true,
+		"برای شروع کسب‌وکار آنلاین ❌ اشتباه رایج این است که...": false,
+		"سلام! چطور می‌تونم کمکت کنم؟":                          false,
+	} {
+		if got := isChatNonAnswer(response); got != want {
+			t.Errorf("isChatNonAnswer(%q) = %v, want %v", response, got, want)
+		}
+	}
+
+	thread := &ChatThread{ID: 1, TelegramID: 1}
+	if stored := storeChatMessage(thread, "سلام", "❌ خطا در دریافت پاسخ.", nil); stored == nil || stored.ID != 0 {
+		t.Fatalf("an error reply must not be stored: %+v", stored)
+	}
+}
+
+func chatMessageIDs(messages []ChatMessage) []uint {
+	var ids []uint
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestChatMemoryRequiresAccountOwner asserts a forged telegram_id can neither read nor extend
+// another user's stored conversation, with or without the victim's thread_id.
+func TestChatMemoryRequiresAccountOwner(t *testing.T) {
+	useTestDB(t, &User{}, &ChatThread{}, &ChatMessage{}, &AIUsage{})
+
+	const victimID = int64(2002)
+	mustCreate(t, &User{TelegramID: victimID, Username: "victim", IsActive: true})
+	thread := ChatThread{TelegramID: victimID, Title: "برنامه فروش"}
+	mustCreate(t, &thread)
+	mustCreate(t, &ChatMessage{TelegramID: victimID, ThreadID: &thread.ID, Message: "قیمت محصولم", Response: "۵۰۰ هزار تومان"})
+
+	r := sessionRouter(1001)
+	r.POST("/api/v1/chat", handleChatRequest)
+	r.POST("/api/v1/chat/stream", handleChatStreamRequest)
+
+	for _, body := range []string{
+		fmt.Sprintf(`{"telegram_id": %d, "message": "قبلا چی گفتم؟"}`, victimID),
+		fmt.Sprintf(`{"telegram_id": %d, "thread_id": %d, "message": "قبلا چی گفتم؟"}`, victimID, thread.ID),
+	} {
+		for _, path := range []string{"/api/v1/chat", "/api/v1/chat/stream"} {
+			w := serveJSON(r, http.MethodPost, path, body)
+			if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "۵۰۰") {
+				t.Errorf("%s %s: expected 403 without the victim's memory, got %d: %s", path, body, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	var messages, threads, usage int64
+	db.Model(&ChatMessage{}).Count(&messages)
+	db.Model(&ChatThread{}).Count(&threads)
+	db.Model(&AIUsage{}).Count(&usage)
+	if messages != 1 || threads != 1 || usage != 0 {
+		t.Errorf("forged requests changed the victim's data: %d messages, %d threads, %d usage rows", messages, threads, usage)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"MonetizeeAI_bot/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Course retrieval: a local BM25 index over sessions, videos and the admin FAQ.
+// Relevant snippets are added to chat prompts so answers can point users to the right session.
+// Exercises (assignments and student submissions) are never indexed.
+
+// Retrieval tuning
+const (
+	bm25K1                = 1.2
+	bm25B                 = 0.75
+	retrievalTopK         = 3
+	retrievalMinScore     = 0.5 // Best match must reach this score, otherwise nothing is injected
+	retrievalMinRatio     = 0.4 // Further matches must score at least this share of the best one
+	retrievalSnippetRunes = 400 // Runes of a document shown to the model
+	retrievalTitleBoost   = 2   // Title terms are counted this many times
+)
+
+// Kinds of indexed documents
+const (
+	CourseDocSession = "session"
+	CourseDocVideo   = "video"
+	CourseDocFAQ     = "faq"
+)
+
+// CourseDocument is one indexed piece of course content
+type CourseDocument struct {
+	Kind          string `json:"kind"`
+	RefID         uint   `json:"ref_id"`
+	SessionNumber int    `json:"session_number"` // 0 when not tied to a session
+	SessionTitle  string `json:"session_title"`
+	Title         string `json:"title"`
+	Text          string `json:"text"`
+}
+
+// CourseSnippet is a search hit
+type CourseSnippet struct {
+	CourseDocument
+	Score float64 `json:"score"`
+}
+
+// CourseIndex is an in-memory BM25 index, rebuilt lazily after content changes
+type CourseIndex struct {
+	mu        sync.RWMutex
+	dirty     bool
+	docs      []CourseDocument
+	termFreqs []map[string]int
+	docLens   []int
+	avgDocLen float64
+	docFreq   map[string]int
+}
+
+// courseIndex is rebuilt from the database on the first search after Invalidate
+var courseIndex = &CourseIndex{dirty: true}
+
+// persianStopwords are frequent words that carry no topic
+var persianStopwords = map[string]bool{
+	"از": true, "به": true, "با": true, "در": true, "که": true, "این": true, "آن": true, "را": true,
+	"و": true, "یا": true, "هم": true, "تا": true, "برای": true, "است": true, "هست": true, "بود": true,
+	"می": true, "چی": true, "چه": true, "چطور": true, "چگونه": true, "کنم": true, "کنیم": true, "کن": true,
+	"یک": true, "یه": true, "رو": true, "های": true, "ها": true, "من": true, "تو": true, "ما": true,
+	"شما": true, "باید": true, "کجا": true, "کدوم": true, "کدام": true, "دارم": true, "داره": true,
+	"the": true, "and": true, "for": true, "how": true, "what": true, "with": true, "is": true, "to": true,
+}
+
+// normalizeRune maps Arabic letter variants and Persian/Arabic digits to one form
+func normalizeRune(r rune) rune {
+	switch {
+	case r == 'ي' || r == 'ى':
+		return 'ی'
+	case r == 'ك':
+		return 'ک'
+	case r == 'ة':
+		return 'ه'
+	case r >= '۰' && r <= '۹':
+		return '0' + (r - '۰')
+	case r >= '٠' && r <= '٩':
+		return '0' + (r - '٠')
+	}
+	return unicode.ToLower(r)
+}
+
+// tokenize splits text into normalized search terms. ZWNJ splits words, so "کسب‌وکار" matches "کسب و کار".
+func tokenize(text string) []string {
+	var terms []string
+	var current []rune
+	flush := func() {
+		if len(current) > 1 {
+			term := string(current)
+			if !persianStopwords[term] {
+				terms = append(terms, term)
+			}
+		}
+		current = current[:0]
+	}
+	for _, r := range text {
+		r = normalizeRune(r)
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			current = append(current, r)
+			continue
+		}
+		if unicode.Is(unicode.Mn, r) {
+			continue // Diacritics
+		}
+		flush()
+	}
+	flush()
+	return terms
+}
+
+// Invalidate marks the index stale; the next search rebuilds it
+func (idx *CourseIndex) Invalidate() {
+	idx.mu.Lock()
+	idx.dirty = true
+	idx.mu.Unlock()
+}
+
+// setDocuments replaces the indexed documents
+func (idx *CourseIndex) setDocuments(docs []CourseDocument) {
+	termFreqs := make([]map[string]int, len(docs))
+	docLens := make([]int, len(docs))
+	docFreq := map[string]int{}
+	total := 0
+	for i, doc := range docs {
+		tf := map[string]int{}
+		for _, term := range tokenize(doc.Title) {
+			tf[term] += retrievalTitleBoost
+			docLens[i] += retrievalTitleBoost
+		}
+		for _, term := range tokenize(doc.SessionTitle + " " + doc.Text) {
+			tf[term]++
+			docLens[i]++
+		}
+		for term := range tf {
+			docFreq[term]++
+		}
+		termFreqs[i] = tf
+		total += docLens[i]
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs, idx.termFreqs, idx.docLens, idx.docFreq = docs, termFreqs, docLens, docFreq
+	idx.avgDocLen = 0
+	if len(docs) > 0 {
+		idx.avgDocLen = float64(total) / float64(len(docs))
+	}
+}
+
+// Rebuild loads all active sessions, their videos and active FAQ entries into the index.
+// A change made while it runs marks the index stale again.
+func (idx *CourseIndex) Rebuild() (err error) {
+	idx.mu.Lock()
+	idx.dirty = false
+	idx.mu.Unlock()
+	defer func() {
+		if err != nil {
+			idx.Invalidate()
+		}
+	}()
+
+	if db == nil {
+		idx.setDocuments(nil)
+		return nil
+	}
+
+	var sessions []Session
+	if err := db.Where("is_active = ?", true).Order("number ASC").Find(&sessions).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]Session, len(sessions))
+	var docs []CourseDocument
+	for _, s := range sessions {
+		byID[s.ID] = s
+		docs = append(docs, CourseDocument{
+			Kind:          CourseDocSession,
+			RefID:         s.ID,
+			SessionNumber: s.Number,
+			Title:         s.Title,
+			Text:          s.Description,
+		})
+	}
+
+	var videos []Video
+	if err := db.Find(&videos).Error; err != nil {
+		return err
+	}
+	for _, v := range videos {
+		s, ok := byID[v.SessionID]
+		if !ok {
+			continue // Video of an inactive or deleted session
+		}
+		docs = append(docs, CourseDocument{
+			Kind:          CourseDocVideo,
+			RefID:         v.ID,
+			SessionNumber: s.Number,
+			SessionTitle:  s.Title,
+			Title:         v.Title,
+			Text:          v.Description,
+		})
+	}
+
+	var faqs []FAQEntry
+	if err := db.Where("is_active = ?", true).Find(&faqs).Error; err != nil {
+		return err
+	}
+	for _, f := range faqs {
+		doc := CourseDocument{
+			Kind:  CourseDocFAQ,
+			RefID: f.ID,
+			Title: f.Question,
+			Text:  f.Answer + " " + f.Tags,
+		}
+		if f.SessionID != nil {
+			if s, ok := byID[*f.SessionID]; ok {
+				doc.SessionNumber, doc.SessionTitle = s.Number, s.Title
+			}
+		}
+		docs = append(docs, doc)
+	}
+
+	idx.setDocuments(docs)
+	logger.Info("Course retrieval index rebuilt",
+		zap.Int("sessions", len(sessions)),
+		zap.Int("documents", len(docs)))
+	return nil
+}
+
+// Search returns the best matching documents for query, rebuilding the index first when stale
+func (idx *CourseIndex) Search(query string, k int) []CourseSnippet {
+	idx.mu.RLock()
+	dirty := idx.dirty
+	idx.mu.RUnlock()
+	if dirty {
+		if err := idx.Rebuild(); err != nil {
+			logger.Error("Failed to rebuild course retrieval index", zap.Error(err))
+		}
+	}
+
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.docs))
+	var hits []CourseSnippet
+	for i, tf := range idx.termFreqs {
+		score := 0.0
+		for _, term := range terms {
+			freq := float64(tf[term])
+			if freq == 0 {
+				continue
+			}
+			df := float64(idx.docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := 1 - bm25B + bm25B*float64(idx.docLens[i])/idx.avgDocLen
+			score += idf * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+		}
+		if score > 0 {
+			hits = append(hits, CourseSnippet{CourseDocument: idx.docs[i], Score: score})
+		}
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if hits[0].Score < retrievalMinScore {
+		return nil
+	}
+	cut := len(hits)
+	for i, hit := range hits {
+		if i >= k || hit.Score < hits[0].Score*retrievalMinRatio {
+			cut = i
+			break
+		}
+	}
+	return hits[:cut]
+}
+
+// formatCourseSnippets renders hits for the prompt, each with its session reference
+func formatCourseSnippets(hits []CourseSnippet) string {
+	var b strings.Builder
+	for _, hit := range hits {
+		text := strings.TrimSpace(hit.Text)
+		if runes := []rune(text); len(runes) > retrievalSnippetRunes {
+			text = string(runes[:retrievalSnippetRunes]) + "…"
+		}
+
+		ref := "سوال متداول"
+		if hit.SessionNumber > 0 {
+			ref = fmt.Sprintf("جلسه %d", hit.SessionNumber)
+		}
+		switch hit.Kind {
+		case CourseDocSession:
+			fmt.Fprintf(&b, "- [%s] %s: %s\n", ref, hit.Title, text)
+		case CourseDocVideo:
+			fmt.Fprintf(&b, "- [%s - %s، ویدیو] %s: %s\n", ref, hit.SessionTitle, hit.Title, text)
+		default:
+			fmt.Fprintf(&b, "- [%s] سوال: %s\nپاسخ: %s\n", ref, hit.Title, text)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// courseContextMessage returns the system message with course content relevant to the
+// user's message (and their previous one, for follow-up questions); empty when nothing matches
+func courseContextMessage(userMessage string, conv *ConversationContext) string {
+	query := userMessage
+	if conv != nil {
+		for i := len(conv.Turns) - 1; i >= 0; i-- {
+			if conv.Turns[i].Role == "user" {
+				query += " " + conv.Turns[i].Content
+				break
+			}
+		}
+	}
+
+	hits := courseIndex.Search(query, retrievalTopK)
+	if len(hits) == 0 {
+		return ""
+	}
+	return renderPrompt(PromptCourseContext, map[string]string{"snippets": formatCourseSnippets(hits)})
+}
+
+// Content changes invalidate the index, whichever path (admin API, bot admin panel) made them
+
+func (s *Session) AfterSave(tx *gorm.DB) error {
+	courseIndex.Invalidate()
+	return nil
+}
+
+func (s *Session) AfterDelete(tx *gorm.DB) error {
+	courseIndex.Invalidate()
+	return nil
+}
+
+func (v *Video) AfterSave(tx *gorm.DB) error {
+	courseIndex.Invalidate()
+	return nil
+}
+
+func (v *Video) AfterDelete(tx *gorm.DB) error {
+	courseIndex.Invalidate()
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCourseIndexSearch asserts BM25 ranking, Persian normalization and that unrelated questions get no context.
+func TestCourseIndexSearch(t *testing.T) {
+	idx := &CourseIndex{}
+	idx.setDocuments([]CourseDocument{
+		{Kind: CourseDocSession, RefID: 1, SessionNumber: 1, Title: "شروع مسیر درآمد دلاری", Text: "آشنایی با دوره و تعیین هدف درآمدی"},
+		{Kind: CourseDocSession, RefID: 2, SessionNumber: 4, Title: "ساخت صفحه فرود", Text: "طراحی لندینگ پیج و نوشتن متن فروش با هوش مصنوعی"},
+		{Kind: CourseDocVideo, RefID: 7, SessionNumber: 4, SessionTitle: "ساخت صفحه فرود", Title: "ابزارهای ساخت لندینگ", Text: "معرفی ابزارهای بدون کد"},
+		{Kind: CourseDocFAQ, RefID: 3, Title: "چطور پول دلاری دریافت کنم؟", Text: "از پی‌پال یا ارز دیجیتال استفاده کن"},
+	})
+
+	// Arabic yeh/kaf and digits are normalized, ZWNJ splits words
+	hits := idx.Search("لنديگ پیج رو با چه ابزاري بسازم؟ لندینگ", retrievalTopK)
+	if len(hits) == 0 || hits[0].SessionNumber != 4 {
+		t.Fatalf("expected session 4 content first, got %+v", hits)
+	}
+	for _, hit := range hits {
+		if hit.SessionNumber != 4 {
+			t.Errorf("weak match %q should have been cut", hit.Title)
+		}
+	}
+
+	if hits := idx.Search("پی‌پال", retrievalTopK); len(hits) != 1 || hits[0].Kind != CourseDocFAQ {
+		t.Errorf("expected the FAQ entry, got %+v", hits)
+	}
+
+	if hits := idx.Search("هوا امروز چطوره", retrievalTopK); len(hits) != 0 {
+		t.Errorf("unrelated question should get no context, got %+v", hits)
+	}
+
+	context := formatCourseSnippets(idx.Search("لندینگ", retrievalTopK))
+	if !strings.Contains(context, "جلسه 4") {
+		t.Errorf("snippets should carry the session reference, got %q", context)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Text extraction from submitted documents, so the AI can evaluate them. Extraction is best
+// effort: scanned PDFs, images and fonts without a Unicode map give errNoDocumentText and the
+// submission goes to a mentor instead.
+
+// maxDocumentTextRunes caps the extracted text sent to the model
+const maxDocumentTextRunes = 12000
+
+// errNoDocumentText means no readable text could be taken from the file
+var errNoDocumentText = errors.New("no readable text in document")
+
+// extractDocumentText returns the text of a PDF or DOCX file
+func extractDocumentText(kind string, data []byte) (string, error) {
+	var text string
+	var err error
+	switch kind {
+	case SubmissionFilePDF:
+		text, err = extractPDFText(data)
+	case SubmissionFileDOCX:
+		text, err = extractDOCXText(data)
+	default:
+		return "", errNoDocumentText
+	}
+	if err != nil {
+		return "", err
+	}
+
+	text = strings.TrimSpace(text)
+	if !readableText(text) {
+		return "", errNoDocumentText
+	}
+	if runes := []rune(text); len(runes) > maxDocumentTextRunes {
+		text = string(runes[:maxDocumentTextRunes]) + "\n…"
+	}
+	return text, nil
+}
+
+// readableText rejects empty output and the mojibake left by fonts without a Unicode map
+func readableText(text string) bool {
+	var letters, total int
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			letters++
+		}
+	}
+	return letters >= 10 && letters*2 >= total
+}
+
+// extractDOCXText reads the paragraphs of word/document.xml
+func extractDOCXText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+
+		var text strings.Builder
+		decoder := xml.NewDecoder(io.LimitReader(reader, 50<<20))
+		inText := false
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			switch element := token.(type) {
+			case xml.StartElement:
+				switch element.Name.Local {
+				case "t":
+					inText = true
+				case "tab":
+					text.WriteString("\t")
+				case "br", "cr":
+					text.WriteString("\n")
+				}
+			case xml.EndElement:
+				switch element.Name.Local {
+				case "t":
+					inText = false
+				case "p":
+					text.WriteString("\n")
+				}
+			case xml.CharData:
+				if inText {
+					text.Write(element)
+				}
+			}
+		}
+		return text.String(), nil
+	}
+	return "", errNoDocumentText
+}
+
+var (
+	pdfStreamPattern  = regexp.MustCompile(`>>\s*stream\r?\n`)
+	pdfOtherFilters   = regexp.MustCompile(`/(DCT|JPX|CCITTFax|JBIG2|LZW|ASCII85|ASCIIHex|RunLength)Decode`)
+	pdfBFCharPattern  = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	pdfBFRangePattern = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	pdfHexPattern     = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>`)
+)
+
+// extractPDFText reads the text drawn by the content streams of a PDF. Streams must be
+// uncompressed or FlateDecode. Two-byte font codes are mapped with the ToUnicode CMaps of
+// the file; if fonts map the same code differently the text cannot be trusted.
+func extractPDFText(data []byte) (string, error) {
+	var contents [][]byte
+	cmap := make(map[string]string)
+	conflict := false
+
+	for _, match := range pdfStreamPattern.FindAllIndex(data, -1) {
+		// The stream dictionary runs from the "N 0 obj" header to the stream keyword
+		dictStart := bytes.LastIndex(data[:match[0]], []byte("obj"))
+		if dictStart < 0 {
+			continue
+		}
+		dict := string(data[dictStart:match[0]])
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		raw := data[start : start+end]
+
+		stream := raw
+		if strings.Contains(dict, "/Filter") {
+			if !strings.Contains(dict, "/FlateDecode") || pdfOtherFilters.MatchString(dict) {
+				continue // Images and other encodings carry no text
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			stream, err = io.ReadAll(io.LimitReader(reader, 20<<20))
+			reader.Close()
+			if err != nil && len(stream) == 0 {
+				continue
+			}
+		}
+
+		if bytes.Contains(stream, []byte("begincmap")) {
+			for code, text := range parsePDFCMap(stream) {
+				if previous, ok := cmap[code]; ok && previous != text {
+					conflict = true
+				}
+				cmap[code] = text
+			}
+			continue
+		}
+		if bytes.Contains(stream, []byte("BT")) {
+			contents = append(contents, stream)
+		}
+	}
+
+	var text strings.Builder
+	usedCMap := false
+	for _, content := range contents {
+		usedCMap = pdfContentText(content, cmap, &text) || usedCMap
+	}
+	if usedCMap && conflict {
+		return "", errNoDocumentText
+	}
+	return text.String(), nil
+}
+
+// parsePDFCMap returns the bfchar and bfrange entries of a ToUnicode CMap
+func parsePDFCMap(stream []byte) map[string]string {
+	result := make(map[string]string)
+	for _, block := range pdfBFCharPattern.FindAllSubmatch(stream, -1) {
+		values := pdfHexPattern.FindAllSubmatch(block[1], -1)
+		for i := 0; i+1 < len(values); i += 2 {
+			result[normalizePDFHex(values[i][1])] = decodeUTF16Hex(normalizePDFHex(values[i+1][1]))
+		}
+	}
+	for _, block := range pdfBFRangePattern.FindAllSubmatch(stream, -1) {
+		values := pdfHexPattern.FindAllSubmatch(block[1], -1)
+		for i := 0; i+2 < len(values); i += 3 {
+			low, errLow := strconv.ParseUint(normalizePDFHex(values[i][1]), 16, 32)
+			high, errHigh := strconv.ParseUint(normalizePDFHex(values[i+1][1]), 16, 32)
+			first := decodeUTF16Hex(normalizePDFHex(values[i+2][1]))
+			if errLow != nil || errHigh != nil || high < low || high-low > 0xFFFF || first == "" {
+				continue
+			}
+			width := len(normalizePDFHex(values[i][1]))
+			base := []rune(first)
+			for code := low; code <= high; code++ {
+				mapped := append([]rune(nil), base...)
+				mapped[len(mapped)-1] += rune(code - low)
+				result[strings.ToUpper(leftPadHex(strconv.FormatUint(code, 16), width))] = string(mapped)
+			}
+		}
+	}
+	return result
+}
+
+// pdfContentText appends the text shown by Tj, TJ, ' and " operators and reports whether
+// a CMap was needed to decode it
+func pdfContentText(content []byte, cmap map[string]string, out *strings.Builder) bool {
+	usedCMap := false
+	inText := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '(' && inText:
+			literal, next := readPDFLiteral(content, i)
+			out.WriteString(literal)
+			i = next
+		case c == '<' && inText && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return usedCMap
+			}
+			code := normalizePDFHex(content[i+1 : i+end])
+			if len(code) >= 4 && len(cmap) > 0 {
+				usedCMap = true
+				for j := 0; j+4 <= len(code); j += 4 {
+					out.WriteString(cmap[code[j:j+4]])
+				}
+			} else if decoded, err := hex.DecodeString(code); err == nil {
+				out.WriteString(string(decoded))
+			}
+			i += end
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFOperatorStart(content, i):
+			op := readPDFOperator(content, i)
+			switch op {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				out.WriteString("\n")
+			case "Td", "TD", "T*", "'", "\"":
+				out.WriteString("\n")
+			case "TJ", "Tj":
+				out.WriteString(" ")
+			}
+			i += len(op) - 1
+		}
+	}
+	return usedCMap
+}
+
+// readPDFLiteral decodes the literal string starting at content[start] == '(' and returns
+// it with the index of the closing parenthesis
+func readPDFLiteral(content []byte, start int) (string, int) {
+	var out []byte
+	depth := 0
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(content) {
+				return string(out), i
+			}
+			i++
+			switch next := content[i]; next {
+			case 'n':
+				out = append(out, '\n')
+			case 'r', 't', 'b', 'f':
+				out = append(out, ' ')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if next >= '0' && next <= '7' {
+					end := i + 1
+					for end < len(content) && end < i+3 && content[end] >= '0' && content[end] <= '7' {
+						end++
+					}
+					value, _ := strconv.ParseUint(string(content[i:end]), 8, 8)
+					out = append(out, byte(value))
+					i = end - 1
+				} else {
+					out = append(out, next)
+				}
+			}
+		case '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(out), i
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out), len(content)
+}
+
+// isPDFOperatorStart reports whether an operator token starts at content[i]
+func isPDFOperatorStart(content []byte, i int) bool {
+	c := content[i]
+	if c != '\'' && c != '"' && !(c >= 'A' && c <= 'Z') && !(c >= 'a' && c <= 'z') {
+		return false
+	}
+	return i == 0 || isPDFDelimiter(content[i-1])
+}
+
+func readPDFOperator(content []byte, i int) string {
+	if content[i] == '\'' || content[i] == '"' {
+		return string(content[i])
+	}
+	end := i
+	for end < len(content) && !isPDFDelimiter(content[end]) {
+		end++
+	}
+	return string(content[i:end])
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f\x00()<>[]{}/%", c) >= 0
+}
+
+func normalizePDFHex(value []byte) string {
+	return strings.ToUpper(strings.Join(strings.Fields(string(value)), ""))
+}
+
+func leftPadHex(value string, width int) string {
+	for len(value) < width {
+		value = "0" + value
+	}
+	return value
+}
+
+// decodeUTF16Hex decodes the UTF-16BE hex used by CMap destinations
+func decodeUTF16Hex(value string) string {
+	raw, err := hex.DecodeString(value)
+	if err != nil || len(raw)%2 != 0 {
+		return ""
+	}
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
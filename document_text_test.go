@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestExtractDocumentText covers DOCX paragraphs, PDF literal strings, PDF glyph codes mapped
+// through a compressed ToUnicode CMap, and a PDF without text going to a mentor.
+func TestExtractDocumentText(t *testing.T) {
+	var docx bytes.Buffer
+	archive := zip.NewWriter(&docx)
+	part, _ := archive.Create("word/document.xml")
+	part.Write([]byte(`<w:document xmlns:w="w"><w:body>` +
+		`<w:p><w:r><w:t>ایده کسب و کار من</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>فروش دوره آنلاین</w:t></w:r><w:r><w:t xml:space="preserve"> با هوش مصنوعی</w:t></w:r></w:p>` +
+		`</w:body></w:document>`))
+	archive.Close()
+
+	text, err := extractDocumentText(SubmissionFileDOCX, docx.Bytes())
+	if err != nil {
+		t.Fatalf("docx: %v", err)
+	}
+	if text != "ایده کسب و کار من\nفروش دوره آنلاین با هوش مصنوعی" {
+		t.Errorf("unexpected docx text %q", text)
+	}
+
+	plain := buildTestPDF(t, "BT /F1 12 Tf 72 720 Td (My business idea) Tj T* [(is an online) -250 (course)] TJ ET", "")
+	if text, err := extractDocumentText(SubmissionFilePDF, plain); err != nil || !strings.Contains(text, "My business idea") || !strings.Contains(text, "is an onlinecourse") {
+		t.Errorf("unexpected pdf text %q (%v)", text, err)
+	}
+
+	// Glyphs 0001-0004 map to "سلمن" and 0005 to a space
+	cmap := "/CIDInit /ProcSet findresource begin\nbegincmap\n2 beginbfchar\n<0001> <0633>\n<0005> <0020>\nendbfchar\n" +
+		"1 beginbfrange\n<0002> <0004> <0644>\nendbfrange\nendcmap\n"
+	mapped := buildTestPDF(t, "BT /F1 12 Tf <0001000200030004> Tj <00050001000200030004> Tj T* <00010002 00030004> Tj ET", cmap)
+	text, err = extractDocumentText(SubmissionFilePDF, mapped)
+	if err != nil {
+		t.Fatalf("pdf with cmap: %v", err)
+	}
+	if !strings.Contains(text, "سلمن  سلمن") || !strings.HasSuffix(text, "سلمن") {
+		t.Errorf("unexpected mapped pdf text %q", text)
+	}
+
+	scanned := buildTestPDF(t, "q 595 0 0 842 0 0 cm /Im1 Do Q", "")
+	if _, err := extractDocumentText(SubmissionFilePDF, scanned); err != errNoDocumentText {
+		t.Errorf("a PDF without text should give errNoDocumentText, got %v", err)
+	}
+}
+
+// buildTestPDF writes a one-page PDF with a compressed content stream and an optional CMap
+func buildTestPDF(t *testing.T, content, cmap string) []byte {
+	t.Helper()
+	compress := func(data string) []byte {
+		var out bytes.Buffer
+		writer := zlib.NewWriter(&out)
+		writer.Write([]byte(data))
+		writer.Close()
+		return out.Bytes()
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	pdf.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	pdf.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>\nendobj\n")
+	stream := compress(content)
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(stream))
+	pdf.Write(stream)
+	pdf.WriteString("\nendstream\nendobj\n")
+	if cmap != "" {
+		stream := compress(cmap)
+		fmt.Fprintf(&pdf, "5 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(stream))
+		pdf.Write(stream)
+		pdf.WriteString("\nendstream\nendobj\n")
+	}
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Exercises: admins publish ExerciseAssignment rows per session, students answer them with
+// ExerciseSubmission rows. Both used to share the exercises table, told apart by user_id.
+
+// legacyExercisesTable is where the shared table is kept after its rows have been split
+const legacyExercisesTable = "exercises_legacy"
+
+// sessionAssignments returns the active assignments of a session in the order they are sent
+func sessionAssignments(sessionID uint) ([]ExerciseAssignment, error) {
+	var assignments []ExerciseAssignment
+	err := db.Where("session_id = ? AND is_active = ?", sessionID, true).
+		Order("position ASC, id ASC").
+		Find(&assignments).Error
+	return assignments, err
+}
+
+// nextSubmissionAttempt returns the attempt number of a new submission for the session
+func nextSubmissionAttempt(telegramID int64, sessionID uint) int {
+	var previous int64
+	db.Model(&ExerciseSubmission{}).
+		Where("telegram_id = ? AND session_id = ?", telegramID, sessionID).
+		Count(&previous)
+	return int(previous) + 1
+}
+
+// linkSessionAssignment links a submission to its session's first exercise: answers are
+// given for the session as a whole
+func linkSessionAssignment(submission *ExerciseSubmission) {
+	if assignments, err := sessionAssignments(submission.SessionID); err == nil && len(assignments) > 0 {
+		submission.AssignmentID = &assignments[0].ID
+	}
+}
+
+// legacyExercise is a row of the old shared exercises table
+type legacyExercise struct {
+	ID          uint
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uint
+	SessionID   uint
+	Content     string
+	PDFFile     string
+	Status      string
+	Feedback    string
+	SubmittedAt *time.Time
+}
+
+// migrateLegacyExercises splits the old exercises table: rows without a user become the
+// session's assignments, the rest become submissions numbered by submission time. IDs are
+// kept so exercise reviews still point at their submission. The old table is renamed
+// afterwards, so this runs once.
+func migrateLegacyExercises() {
+	if !db.Migrator().HasTable("exercises") {
+		return
+	}
+
+	var rows []legacyExercise
+	if err := db.Table("exercises").Where("deleted_at IS NULL").
+		Order("session_id ASC, user_id ASC, submitted_at ASC, id ASC").
+		Find(&rows).Error; err != nil {
+		logger.Error("Failed to read legacy exercises", zap.Error(err))
+		return
+	}
+
+	var owners []struct {
+		ID         uint
+		TelegramID int64
+	}
+	db.Model(&User{}).Select("id, telegram_id").Scan(&owners)
+	telegramIDs := make(map[uint]int64, len(owners))
+	for _, owner := range owners {
+		telegramIDs[owner.ID] = owner.TelegramID
+	}
+
+	assignments, submissions := splitLegacyExercises(rows, telegramIDs)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(assignments) > 0 {
+			if err := tx.CreateInBatches(&assignments, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(submissions) > 0 {
+			return tx.CreateInBatches(&submissions, 100).Error
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to migrate legacy exercises", zap.Error(err))
+		return
+	}
+	// Renamed outside the transaction: MySQL commits implicitly on DDL. If the rename fails the
+	// next run stops at the duplicate IDs instead of copying the rows twice.
+	if err := db.Migrator().RenameTable("exercises", legacyExercisesTable); err != nil {
+		logger.Error("Failed to rename legacy exercises table", zap.Error(err))
+		return
+	}
+
+	logger.Info("Migrated legacy exercises",
+		zap.Int("assignments", len(assignments)),
+		zap.Int("submissions", len(submissions)))
+}
+
+// splitLegacyExercises turns old exercises rows, ordered by session, user and submission
+// time, into assignments and numbered submissions. telegramIDs maps user IDs to Telegram IDs.
+func splitLegacyExercises(rows []legacyExercise, telegramIDs map[uint]int64) ([]ExerciseAssignment, []ExerciseSubmission) {
+	var assignments []ExerciseAssignment
+	var submissions []ExerciseSubmission
+	firstAssignment := make(map[uint]uint)
+	positions := make(map[uint]int)
+	for _, row := range rows {
+		if row.UserID != 0 {
+			continue
+		}
+		positions[row.SessionID]++
+		assignment := ExerciseAssignment{
+			SessionID: row.SessionID,
+			Position:  positions[row.SessionID],
+			Content:   row.Content,
+			PDFFile:   row.PDFFile,
+			IsActive:  true,
+		}
+		assignment.ID, assignment.CreatedAt, assignment.UpdatedAt = row.ID, row.CreatedAt, row.UpdatedAt
+		if _, ok := firstAssignment[row.SessionID]; !ok {
+			firstAssignment[row.SessionID] = row.ID
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	attempts := make(map[[2]uint]int)
+	for _, row := range rows {
+		if row.UserID == 0 {
+			continue
+		}
+		key := [2]uint{row.UserID, row.SessionID}
+		attempts[key]++
+		submission := ExerciseSubmission{
+			UserID:     row.UserID,
+			TelegramID: telegramIDs[row.UserID],
+			SessionID:  row.SessionID,
+			Attempt:    attempts[key],
+			Content:    row.Content,
+			PDFFile:    row.PDFFile,
+			Status:     row.Status,
+			Feedback:   row.Feedback,
+		}
+		submission.ID, submission.CreatedAt, submission.UpdatedAt = row.ID, row.CreatedAt, row.UpdatedAt
+		if assignmentID, ok := firstAssignment[row.SessionID]; ok {
+			submission.AssignmentID = &assignmentID
+		}
+		submission.SubmittedAt = row.CreatedAt
+		if row.SubmittedAt != nil {
+			submission.SubmittedAt = *row.SubmittedAt
+		}
+		submissions = append(submissions, submission)
+	}
+
+	return assignments, submissions
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSplitLegacyExercises asserts rows without a user become ordered assignments and user
+// rows become submissions numbered per user and session, linked to the first assignment.
+func TestSplitLegacyExercises(t *testing.T) {
+	day := func(d int) *time.Time {
+		at := time.Date(2025, 1, d, 12, 0, 0, 0, time.UTC)
+		return &at
+	}
+	rows := []legacyExercise{
+		{ID: 1, SessionID: 1, Content: "تمرین اول"},
+		{ID: 4, SessionID: 1, Content: "تمرین دوم"},
+		{ID: 2, SessionID: 1, UserID: 7, Content: "پاسخ ۱", Status: "needs_revision", SubmittedAt: day(1)},
+		{ID: 5, SessionID: 1, UserID: 7, Content: "پاسخ ۲", Status: "approved", SubmittedAt: day(2)},
+		{ID: 3, SessionID: 2, UserID: 7, Content: "پاسخ جلسه ۲", Status: "pending", SubmittedAt: day(3)},
+	}
+
+	assignments, submissions := splitLegacyExercises(rows, map[uint]int64{7: 4242})
+
+	if len(assignments) != 2 || assignments[0].ID != 1 || assignments[0].Position != 1 || assignments[1].Position != 2 {
+		t.Fatalf("unexpected assignments %+v", assignments)
+	}
+	if len(submissions) != 3 {
+		t.Fatalf("expected 3 submissions, got %d", len(submissions))
+	}
+
+	first, second, other := submissions[0], submissions[1], submissions[2]
+	if first.ID != 2 || first.Attempt != 1 || second.ID != 5 || second.Attempt != 2 {
+		t.Errorf("submissions should keep their IDs and be numbered by time, got %+v and %+v", first, second)
+	}
+	if first.TelegramID != 4242 || !first.SubmittedAt.Equal(*day(1)) || second.Status != "approved" {
+		t.Errorf("unexpected submission fields %+v", first)
+	}
+	if first.AssignmentID == nil || *first.AssignmentID != 1 {
+		t.Errorf("submission should be linked to the session's first assignment, got %v", first.AssignmentID)
+	}
+	if other.Attempt != 1 || other.AssignmentID != nil {
+		t.Errorf("a session without assignments starts its own attempts, got %+v", other)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FAQEntry is an admin-managed question and answer used by the course retrieval index
+type FAQEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Question  string    `gorm:"size:500;not null" json:"question"`
+	Answer    string    `gorm:"type:text;not null" json:"answer"`
+	Tags      string    `gorm:"size:255" json:"tags"`    // Extra search terms, space or comma separated
+	SessionID *uint     `gorm:"index" json:"session_id"` // Session the answer refers to, optional
+	IsActive  bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (f *FAQEntry) AfterSave(tx *gorm.DB) error {
+	courseIndex.Invalidate()
+	return nil
+}
+
+func (f *FAQEntry) AfterDelete(tx *gorm.DB) error {
+	courseIndex.Invalidate()
+	return nil
+}
+
+// faqRequest is the body of the FAQ create and update endpoints
+type faqRequest struct {
+	Question  string `json:"question"`
+	Answer    string `json:"answer"`
+	Tags      string `json:"tags"`
+	SessionID *uint  `json:"session_id"`
+	IsActive  *bool  `json:"is_active"`
+}
+
+// apply validates the request and copies it onto entry
+func (req *faqRequest) apply(entry *FAQEntry) string {
+	req.Question = strings.TrimSpace(req.Question)
+	req.Answer = strings.TrimSpace(req.Answer)
+	if req.Question == "" || req.Answer == "" {
+		return "Question and answer are required"
+	}
+	if req.SessionID != nil {
+		var count int64
+		db.Model(&Session{}).Where("id = ?", *req.SessionID).Count(&count)
+		if count == 0 {
+			return "Session not found"
+		}
+	}
+
+	entry.Question, entry.Answer, entry.Tags, entry.SessionID = req.Question, req.Answer, strings.TrimSpace(req.Tags), req.SessionID
+	if req.IsActive != nil {
+		entry.IsActive = *req.IsActive
+	}
+	return ""
+}
+
+// getFAQEntriesAPI handles GET /api/v1/admin/faq
+func getFAQEntriesAPI(c *gin.Context) {
+	var entries []FAQEntry
+	if err := db.Order("id DESC").Find(&entries).Error; err != nil {
+		logger.Error("Failed to list FAQ entries", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries})
+}
+
+// createFAQEntryAPI handles POST /api/v1/admin/faq
+func createFAQEntryAPI(c *gin.Context) {
+	var req faqRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	entry := FAQEntry{IsActive: true}
+	if errMsg := req.apply(&entry); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": errMsg})
+		return
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		logger.Error("Failed to create FAQ entry", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	logger.Info("FAQ entry created by admin",
+		zap.Uint("faq_id", entry.ID),
+		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entry})
+}
+
+// updateFAQEntryAPI handles PUT /api/v1/admin/faq/:id
+func updateFAQEntryAPI(c *gin.Context) {
+	var entry FAQEntry
+	if err := db.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "FAQ entry not found"})
+		return
+	}
+
+	var req faqRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+	if errMsg := req.apply(&entry); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": errMsg})
+		return
+	}
+	if err := db.Save(&entry).Error; err != nil {
+		logger.Error("Failed to update FAQ entry", zap.Uint("faq_id", entry.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	logger.Info("FAQ entry updated by admin",
+		zap.Uint("faq_id", entry.ID),
+		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entry})
+}
+
+// deleteFAQEntryAPI handles DELETE /api/v1/admin/faq/:id
+func deleteFAQEntryAPI(c *gin.Context) {
+	var entry FAQEntry
+	if err := db.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "FAQ entry not found"})
+		return
+	}
+	if err := db.Delete(&entry).Error; err != nil {
+		logger.Error("Failed to delete FAQ entry", zap.Uint("faq_id", entry.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	logger.Warn("FAQ entry deleted by admin",
+		zap.Uint("faq_id", entry.ID),
+		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "FAQ entry deleted successfully"})
+}
+
+// searchCourseIndexAPI handles GET /api/v1/admin/retrieval/search?q=, showing what the assistant would be given
+func searchCourseIndexAPI(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "q is required"})
+		return
+	}
+
+	hits := courseIndex.Search(query, retrievalTopK)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"terms":   tokenize(query),
+			"results": hits,
+			"context": formatCourseSnippets(hits),
+		},
+	})
+}
+
+// rebuildCourseIndexAPI handles POST /api/v1/admin/retrieval/rebuild
+func rebuildCourseIndexAPI(c *gin.Context) {
+	if err := courseIndex.Rebuild(); err != nil {
+		logger.Error("Failed to rebuild course retrieval index", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to rebuild index"})
+		return
+	}
+
+	courseIndex.mu.RLock()
+	documents := len(courseIndex.docs)
+	courseIndex.mu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"documents": documents}})
+}
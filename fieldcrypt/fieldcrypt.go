@@ -0,0 +1,267 @@
+// Package fieldcrypt provides application-level encryption for sensitive database fields
+// and deterministic blind indexes so encrypted values can still be searched by exact match.
+//
+// Keys come from the environment:
+//
+//	FIELD_ENCRYPTION_KEYS   comma separated "<key_id>:<base64 32 byte key>", the first key encrypts,
+//	                        the others are only used to decrypt values written before a rotation
+//	FIELD_BLIND_INDEX_KEY   base64 key for the HMAC blind index (never rotated without a reindex)
+//
+// Without FIELD_ENCRYPTION_KEYS values are stored as plaintext, which keeps local development and tests working.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Prefix marks encrypted values: "enc:<key_id>:<base64(nonce|ciphertext)>"
+const Prefix = "enc:"
+
+const (
+	EncryptionKeysEnv = "FIELD_ENCRYPTION_KEYS"
+	BlindIndexKeyEnv  = "FIELD_BLIND_INDEX_KEY"
+)
+
+// ErrUnknownKey is returned when a value was encrypted with a key that is no longer configured
+var ErrUnknownKey = errors.New("fieldcrypt: unknown encryption key")
+
+type keyring struct {
+	activeID   string
+	ciphers    map[string]cipher.AEAD
+	blindIndex []byte
+}
+
+var (
+	current *keyring
+	mu      sync.RWMutex
+)
+
+// Init loads keys from the environment. It must be called after the environment (.env) is loaded.
+func Init() error {
+	ring, err := parseKeys(os.Getenv(EncryptionKeysEnv), os.Getenv(BlindIndexKeyEnv))
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	current = ring
+	mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether an encryption key is configured
+func Enabled() bool {
+	ring := getKeyring()
+	return ring != nil && ring.activeID != ""
+}
+
+// ActiveKeyID returns the ID of the key used for new values
+func ActiveKeyID() string {
+	if ring := getKeyring(); ring != nil {
+		return ring.activeID
+	}
+	return ""
+}
+
+func getKeyring() *keyring {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+func parseKeys(encryptionKeys, blindIndexKey string) (*keyring, error) {
+	ring := &keyring{ciphers: make(map[string]cipher.AEAD)}
+
+	for _, entry := range strings.Split(encryptionKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("fieldcrypt: %s entries must look like <key_id>:<base64 key>", EncryptionKeysEnv)
+		}
+		if _, exists := ring.ciphers[id]; exists {
+			return nil, fmt.Errorf("fieldcrypt: duplicate key id %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("fieldcrypt: key %q is not valid base64: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("fieldcrypt: key %q must be 32 bytes, got %d", id, len(key))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		ring.ciphers[id] = aead
+		if ring.activeID == "" {
+			ring.activeID = id
+		}
+	}
+
+	if blindIndexKey != "" {
+		key, err := base64.StdEncoding.DecodeString(blindIndexKey)
+		if err != nil {
+			return nil, fmt.Errorf("fieldcrypt: %s is not valid base64: %w", BlindIndexKeyEnv, err)
+		}
+		if len(key) < 32 {
+			return nil, fmt.Errorf("fieldcrypt: %s must be at least 32 bytes", BlindIndexKeyEnv)
+		}
+		ring.blindIndex = key
+	} else if ring.activeID != "" {
+		return nil, fmt.Errorf("fieldcrypt: %s is required when %s is set", BlindIndexKeyEnv, EncryptionKeysEnv)
+	}
+
+	return ring, nil
+}
+
+// IsEncrypted reports whether a stored value carries the encryption prefix
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt encrypts plaintext with the active key. Empty values and a missing key return the input unchanged.
+func Encrypt(plaintext string) (string, error) {
+	ring := getKeyring()
+	if plaintext == "" || ring == nil || ring.activeID == "" {
+		return plaintext, nil
+	}
+
+	aead := ring.ciphers[ring.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(ring.activeID))
+	return Prefix + ring.activeID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Values without the prefix are legacy plaintext and returned unchanged.
+func Decrypt(stored string) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(stored, Prefix), ":")
+	if !ok {
+		return "", errors.New("fieldcrypt: malformed encrypted value")
+	}
+
+	ring := getKeyring()
+	if ring == nil {
+		return "", ErrUnknownKey
+	}
+	aead, ok := ring.ciphers[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("fieldcrypt: malformed encrypted value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("fieldcrypt: malformed encrypted value")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("fieldcrypt: decrypt with key %q: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether a stored value should be rewritten:
+// plaintext while a key is configured, or encrypted with a key other than the active one.
+func NeedsRotation(stored string) bool {
+	ring := getKeyring()
+	if stored == "" || ring == nil || ring.activeID == "" {
+		return false
+	}
+	if !IsEncrypted(stored) {
+		return true
+	}
+	return !strings.HasPrefix(stored, Prefix+ring.activeID+":")
+}
+
+// BlindIndex returns a deterministic HMAC of a normalized value, scoped by kind (e.g. "phone", "email").
+// Empty values return an empty index.
+func BlindIndex(kind, normalized string) string {
+	if normalized == "" {
+		return ""
+	}
+
+	var key []byte
+	if ring := getKeyring(); ring != nil {
+		key = ring.blindIndex
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(kind + ":" + normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NormalizePhone converts Persian/Arabic digits, strips formatting and uses the 09xxxxxxxxx form when possible
+func NormalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= '۰' && r <= '۹':
+			digits.WriteRune('0' + (r - '۰'))
+		case r >= '٠' && r <= '٩':
+			digits.WriteRune('0' + (r - '٠'))
+		}
+	}
+
+	result := digits.String()
+	switch {
+	case strings.HasPrefix(result, "0098") && len(result) == 14:
+		result = "0" + result[4:]
+	case strings.HasPrefix(result, "98") && len(result) == 12:
+		result = "0" + result[2:]
+	case strings.HasPrefix(result, "9") && len(result) == 10:
+		result = "0" + result
+	}
+	return result
+}
+
+// NormalizeEmail lowercases and trims an email address
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// PhoneIndex is the blind index of a phone number
+func PhoneIndex(phone string) string {
+	return BlindIndex("phone", NormalizePhone(phone))
+}
+
+// EmailIndex is the blind index of an email address
+func EmailIndex(email string) string {
+	return BlindIndex("email", NormalizeEmail(email))
+}
@@ -0,0 +1,68 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func useKeys(t *testing.T, encryptionKeys, blindIndexKey string) {
+	t.Helper()
+	ring, err := parseKeys(encryptionKeys, blindIndexKey)
+	if err != nil {
+		t.Fatalf("parseKeys: %v", err)
+	}
+	mu.Lock()
+	current = ring
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		current = nil
+		mu.Unlock()
+	})
+}
+
+// TestEncryptRotateAndBlindIndex asserts round trips, decryption after a key rotation and stable blind indexes.
+func TestEncryptRotateAndBlindIndex(t *testing.T) {
+	useKeys(t, "k1:"+testKey('a'), testKey('i'))
+
+	old, err := Encrypt("09123456789")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(old, "enc:k1:") || strings.Contains(old, "09123456789") {
+		t.Fatalf("unexpected ciphertext %q", old)
+	}
+	indexBefore := PhoneIndex("09123456789")
+
+	// Rotate: k2 encrypts, k1 still decrypts
+	useKeys(t, "k2:"+testKey('b')+",k1:"+testKey('a'), testKey('i'))
+
+	if plain, err := Decrypt(old); err != nil || plain != "09123456789" {
+		t.Fatalf("Decrypt after rotation: %q, %v", plain, err)
+	}
+	if !NeedsRotation(old) || !NeedsRotation("09123456789") {
+		t.Error("old ciphertext and plaintext should need rotation")
+	}
+	rotated, _ := Encrypt("09123456789")
+	if NeedsRotation(rotated) {
+		t.Error("value encrypted with the active key should not need rotation")
+	}
+
+	if got := PhoneIndex("+98 912 345 6789"); got != indexBefore {
+		t.Error("blind index should survive rotation and normalize phone formats")
+	}
+	if PhoneIndex("") != "" {
+		t.Error("empty phone should have an empty index")
+	}
+
+	// Removing the old key makes old values unreadable
+	useKeys(t, "k2:"+testKey('b'), testKey('i'))
+	if _, err := Decrypt(old); err == nil {
+		t.Error("expected an error for a removed key")
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Quiz grading: Mini App quizzes are graded against weighted rubric criteria stored per session.
+// The AI scores each criterion; the overall score and pass/fail are computed here from the weights
+// and the passing score. When the AI cannot grade, the evaluation is queued and retried, never passed.
+
+const (
+	defaultPassingScore         = 70
+	quizEvaluationRetryInterval = time.Minute
+	quizEvaluationMaxBackoff    = 30 * time.Minute
+	quizEvaluationMaxAttempts   = 10 // Queued evaluations give up after this many grading attempts
+	quizEvaluationBatchSize     = 20
+)
+
+// Quiz evaluation statuses
+const (
+	QuizEvaluationGraded = "graded"
+	QuizEvaluationQueued = "queued" // Waiting for the AI, retried by the quiz evaluation worker
+	QuizEvaluationFailed = "failed" // Gave up after quizEvaluationMaxAttempts
+)
+
+// SessionRubric is the grading rubric of a session
+type SessionRubric struct {
+	ID           uint              `gorm:"primaryKey" json:"id"`
+	SessionID    uint              `gorm:"uniqueIndex;not null" json:"session_id"`
+	PassingScore int               `gorm:"not null" json:"passing_score"` // 0-100, weighted score needed to pass
+	Criteria     []RubricCriterion `gorm:"foreignKey:RubricID;constraint:OnDelete:CASCADE" json:"criteria"`
+	UpdatedBy    *uint             `json:"updated_by"` // Admin ID
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// RubricCriterion is one weighted criterion of a rubric
+type RubricCriterion struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	RubricID    uint   `gorm:"index;not null" json:"-"`
+	Position    int    `gorm:"not null" json:"position"`
+	Title       string `gorm:"size:200;not null" json:"title"`
+	Description string `gorm:"type:text" json:"description"`
+	Weight      int    `gorm:"not null" json:"weight"`
+}
+
+// defaultRubricCriteria grade sessions that have no rubric of their own
+var defaultRubricCriteria = []RubricCriterion{
+	{Position: 1, Title: "درک مفاهیم جلسه", Description: "پاسخ نشان می‌دهد مفاهیم اصلی جلسه درست فهمیده شده‌اند.", Weight: 40},
+	{Position: 2, Title: "کاربرد عملی", Description: "پاسخ مفاهیم را به کسب‌وکار یا ایده خود دانشجو ربط می‌دهد و اقدام مشخصی دارد.", Weight: 40},
+	{Position: 3, Title: "کامل بودن", Description: "به همه سوال‌ها و بخش‌های تمرین پاسخ داده شده است.", Weight: 20},
+}
+
+// CriterionScore is the AI score of one criterion, stored with the evaluation
+type CriterionScore struct {
+	Title   string `json:"title"`
+	Weight  int    `json:"weight"`
+	Score   int    `json:"score"`
+	Comment string `json:"comment"`
+}
+
+// QuizEvaluation is one graded (or queued) quiz submission, kept as the user's score history
+type QuizEvaluation struct {
+	ID            uint             `gorm:"primaryKey" json:"id"`
+	TelegramID    int64            `gorm:"index" json:"telegram_id"`
+	SessionID     uint             `gorm:"index" json:"session_id"`
+	SessionNumber int              `json:"session_number"`
+	Answers       string           `gorm:"type:text" json:"answers"`
+	Status        string           `gorm:"size:16;index" json:"status"`
+	Score         int              `json:"score"`
+	PassingScore  int              `json:"passing_score"`
+	Passed        bool             `json:"passed"`
+	Criteria      []CriterionScore `gorm:"type:text;serializer:json" json:"criteria"`
+	Feedback      string           `gorm:"type:text" json:"feedback"`
+	Attempts      int              `json:"attempts"`
+	LastError     string           `gorm:"size:500" json:"last_error,omitempty"`
+	NextAttemptAt *time.Time       `gorm:"index" json:"next_attempt_at,omitempty"`
+	GradedAt      *time.Time       `json:"graded_at"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+// loadSessionRubric returns the rubric of a session, the default one when none is stored
+func loadSessionRubric(sessionID uint) (*SessionRubric, error) {
+	rubric := SessionRubric{SessionID: sessionID, PassingScore: defaultPassingScore}
+	if db != nil {
+		err := db.Preload("Criteria", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("position ASC")
+		}).Where("session_id = ?", sessionID).First(&rubric).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if len(rubric.Criteria) == 0 {
+		rubric.Criteria = append([]RubricCriterion(nil), defaultRubricCriteria...)
+	}
+	return &rubric, nil
+}
+
+// criterionKey is how the model refers to the i-th criterion
+func criterionKey(i int) string {
+	return fmt.Sprintf("c%d", i+1)
+}
+
+// quizGradingSchema asks for a score and comment per criterion plus overall feedback
+func quizGradingSchema(rubric *SessionRubric) *JSONSchema {
+	criteria := make([]SchemaProperty, 0, len(rubric.Criteria))
+	for i := range rubric.Criteria {
+		criteria = append(criteria, prop(criterionKey(i), objectSchema(
+			prop("score", numberSchema()),
+			prop("comment", stringSchema()),
+		)))
+	}
+	return objectSchema(
+		prop("criteria", objectSchema(criteria...)),
+		prop("feedback", stringSchema()),
+	)
+}
+
+// quizGradingOutput is the structured answer of the grader
+type quizGradingOutput struct {
+	Criteria map[string]struct {
+		Score   float64 `json:"score"`
+		Comment string  `json:"comment"`
+	} `json:"criteria"`
+	Feedback string `json:"feedback"`
+}
+
+// quizGrade is the result of grading one submission
+type quizGrade struct {
+	Score    int
+	Passed   bool
+	Criteria []CriterionScore
+	Feedback string
+}
+
+// scoreQuiz computes the weighted score from the per-criterion scores. Scores outside 0-100 are clamped.
+func scoreQuiz(rubric *SessionRubric, output *quizGradingOutput) *quizGrade {
+	grade := &quizGrade{Feedback: strings.TrimSpace(output.Feedback)}
+	var weighted, totalWeight float64
+	for i, criterion := range rubric.Criteria {
+		result := output.Criteria[criterionKey(i)]
+		score := int(math.Round(math.Max(0, math.Min(100, result.Score))))
+		grade.Criteria = append(grade.Criteria, CriterionScore{
+			Title:   criterion.Title,
+			Weight:  criterion.Weight,
+			Score:   score,
+			Comment: strings.TrimSpace(result.Comment),
+		})
+		weighted += float64(criterion.Weight * score)
+		totalWeight += float64(criterion.Weight)
+	}
+	if totalWeight > 0 {
+		grade.Score = int(math.Round(weighted / totalWeight))
+	}
+	grade.Passed = grade.Score >= rubric.PassingScore
+	return grade
+}
+
+// gradeQuiz asks the AI to score answers against the session rubric
+func gradeQuiz(user *User, session *Session, rubric *SessionRubric, answers string) (*quizGrade, error) {
+	var criteria strings.Builder
+	for i, criterion := range rubric.Criteria {
+		fmt.Fprintf(&criteria, "%s: %s - %s\n", criterionKey(i), criterion.Title, criterion.Description)
+	}
+
+	schema := quizGradingSchema(rubric)
+	schemaJSON, _ := schema.MarshalJSON()
+	prompt := renderPrompt(PromptQuizGrading, map[string]string{
+		"session_title":       session.Title,
+		"session_description": session.Description,
+		"rubric":              strings.TrimSpace(criteria.String()),
+		"answers":             answers,
+		"schema":              string(schemaJSON),
+	})
+
+	output, err := generateToolOutput[quizGradingOutput](user, FeatureExerciseEvaluation, prompt, schema)
+	if err != nil {
+		return nil, err
+	}
+	return scoreQuiz(rubric, output), nil
+}
+
+// applyGrade stores a grade on the evaluation
+func (e *QuizEvaluation) applyGrade(grade *quizGrade, passingScore int) {
+	now := time.Now()
+	e.Status = QuizEvaluationGraded
+	e.Score, e.Passed, e.PassingScore = grade.Score, grade.Passed, passingScore
+	e.Criteria, e.Feedback = grade.Criteria, grade.Feedback
+	e.GradedAt, e.NextAttemptAt, e.LastError = &now, nil, ""
+}
+
+// queueAfterFailure schedules the next grading attempt with a growing delay, or gives up
+func (e *QuizEvaluation) queueAfterFailure(err error) {
+	e.LastError = err.Error()
+	if len([]rune(e.LastError)) > 500 {
+		e.LastError = string([]rune(e.LastError)[:500])
+	}
+	if e.Attempts >= quizEvaluationMaxAttempts {
+		e.Status, e.NextAttemptAt = QuizEvaluationFailed, nil
+		return
+	}
+	delay := time.Duration(e.Attempts) * quizEvaluationRetryInterval
+	if delay > quizEvaluationMaxBackoff {
+		delay = quizEvaluationMaxBackoff
+	}
+	next := time.Now().Add(delay)
+	e.Status, e.NextAttemptAt = QuizEvaluationQueued, &next
+}
+
+// advanceUserSession moves a user who is still on fromSession to the next session and adds
+// score to their points. It reports whether the next session was unlocked.
+func advanceUserSession(telegramID int64, fromSession, score int) bool {
+	result := db.Model(&User{}).
+		Where("telegram_id = ? AND current_session = ?", telegramID, fromSession).
+		Updates(map[string]interface{}{
+			"current_session": fromSession + 1,
+			"points":          gorm.Expr("points + ?", score),
+		})
+	if result.Error != nil {
+		logger.Error("Failed to update user session and points after quiz",
+			zap.Int64("user_id", telegramID),
+			zap.Int("new_session", fromSession+1),
+			zap.Int("score", score),
+			zap.Error(result.Error))
+		return false
+	}
+
+	// ⚡ PERFORMANCE: Invalidate cache to force refresh on next request
+	userCache.InvalidateUser(telegramID)
+
+	if result.RowsAffected == 0 {
+		logger.Warn("User was no longer on the graded session, progress not changed",
+			zap.Int64("user_id", telegramID),
+			zap.Int("from_session", fromSession))
+		return false
+	}
+
+	logger.Info("✅ User session updated successfully - next stage unlocked",
+		zap.Int64("user_id", telegramID),
+		zap.Int("old_session", fromSession),
+		zap.Int("new_session", fromSession+1),
+		zap.Int("score", score))
+	return true
+}
+
+// StartQuizEvaluationWorker retries queued quiz evaluations in the background
+func StartQuizEvaluationWorker() {
+	go func() {
+		ticker := time.NewTicker(quizEvaluationRetryInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			processQueuedQuizEvaluations()
+		}
+	}()
+
+	logger.Info("Quiz evaluation worker started")
+}
+
+// processQueuedQuizEvaluations grades the queued evaluations that are due
+func processQueuedQuizEvaluations() {
+	var evaluations []QuizEvaluation
+	if err := db.Where("status = ? AND next_attempt_at <= ?", QuizEvaluationQueued, time.Now()).
+		Order("next_attempt_at ASC").Limit(quizEvaluationBatchSize).
+		Find(&evaluations).Error; err != nil {
+		logger.Error("Failed to load queued quiz evaluations", zap.Error(err))
+		return
+	}
+
+	for i := range evaluations {
+		retryQuizEvaluation(&evaluations[i])
+	}
+}
+
+// retryQuizEvaluation makes one grading attempt for a queued evaluation
+func retryQuizEvaluation(evaluation *QuizEvaluation) {
+	var user User
+	if err := db.Where("telegram_id = ?", evaluation.TelegramID).First(&user).Error; err != nil {
+		logger.Warn("User of queued quiz evaluation not found",
+			zap.Uint("evaluation_id", evaluation.ID),
+			zap.Error(err))
+		evaluation.Attempts = quizEvaluationMaxAttempts
+		evaluation.queueAfterFailure(err)
+		db.Save(evaluation)
+		return
+	}
+
+	var session Session
+	if err := db.First(&session, evaluation.SessionID).Error; err != nil {
+		evaluation.Attempts = quizEvaluationMaxAttempts
+		evaluation.queueAfterFailure(err)
+		db.Save(evaluation)
+		return
+	}
+
+	rubric, err := loadSessionRubric(session.ID)
+	if err == nil {
+		var grade *quizGrade
+		evaluation.Attempts++
+		if grade, err = gradeQuiz(&user, &session, rubric, evaluation.Answers); err == nil {
+			evaluation.applyGrade(grade, rubric.PassingScore)
+		}
+	}
+	if err != nil {
+		evaluation.queueAfterFailure(err)
+		logger.Warn("Queued quiz evaluation failed again",
+			zap.Uint("evaluation_id", evaluation.ID),
+			zap.Int("attempts", evaluation.Attempts),
+			zap.String("status", evaluation.Status),
+			zap.Error(err))
+	}
+	if err := db.Save(evaluation).Error; err != nil {
+		logger.Error("Failed to save quiz evaluation", zap.Uint("evaluation_id", evaluation.ID), zap.Error(err))
+		return
+	}
+	if evaluation.Status == QuizEvaluationFailed {
+		flagQuizEvaluationForReview(evaluation) // A mentor grades what the AI could not
+	}
+	if evaluation.Status != QuizEvaluationGraded {
+		return
+	}
+	flagQuizEvaluationForReview(evaluation)
+
+	unlocked := evaluation.Passed && advanceUserSession(user.TelegramID, evaluation.SessionNumber, evaluation.Score)
+	logger.Info("Queued quiz evaluation graded",
+		zap.Uint("evaluation_id", evaluation.ID),
+		zap.Int64("user_id", user.TelegramID),
+		zap.Int("score", evaluation.Score),
+		zap.Bool("passed", evaluation.Passed),
+		zap.Bool("next_stage_unlocked", unlocked))
+
+	if bot != nil {
+		text := fmt.Sprintf("📝 ارزیابی تمرین جلسه %d انجام شد.\n\nنمره: %d از 100 (حد قبولی %d)\n\n%s",
+			evaluation.SessionNumber, evaluation.Score, evaluation.PassingScore, evaluation.Feedback)
+		if unlocked {
+			text += "\n\n✅ مرحله بعد برات باز شد!"
+		}
+		bot.Send(tgbotapi.NewMessage(user.TelegramID, text))
+	}
+}
+
+// getUserQuizEvaluationsAPI handles GET /api/v1/user/:telegram_id/quiz-evaluations, the user's own score history
+func getUserQuizEvaluationsAPI(c *gin.Context) {
+	// 🔒 SECURITY: Answers, scores and feedback are only for the account owner
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var evaluations []QuizEvaluation
+	if err := db.Where("telegram_id = ?", telegramID).Order("created_at DESC").Limit(50).
+		Find(&evaluations).Error; err != nil {
+		logger.Error("Failed to load quiz evaluations", zap.Int64("user_id", telegramID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{Success: false, Error: "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: evaluations})
+}
+
+// getQuizEvaluationsAPI handles GET /api/v1/admin/quiz-evaluations?telegram_id=&session=&status=&page=&limit=
+func getQuizEvaluationsAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := db.Model(&QuizEvaluation{})
+	if telegramID := c.Query("telegram_id"); telegramID != "" {
+		query = query.Where("telegram_id = ?", telegramID)
+	}
+	if session := c.Query("session"); session != "" {
+		query = query.Where("session_number = ?", session)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var evaluations []QuizEvaluation
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&evaluations).Error; err != nil {
+		logger.Error("Failed to list quiz evaluations", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"evaluations": evaluations,
+			"total":       total,
+			"page":        page,
+			"limit":       limit,
+		},
+	})
+}
+
+// getSessionRubricAPI handles GET /api/v1/admin/sessions/:id/rubric
+func getSessionRubricAPI(c *gin.Context) {
+	var session Session
+	if err := db.First(&session, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Session not found"})
+		return
+	}
+
+	rubric, err := loadSessionRubric(session.ID)
+	if err != nil {
+		logger.Error("Failed to load session rubric", zap.Uint("session_id", session.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"rubric":     rubric,
+			"is_default": rubric.ID == 0,
+		},
+	})
+}
+
+// rubricRequest is the body of PUT /api/v1/admin/sessions/:id/rubric
+type rubricRequest struct {
+	PassingScore int `json:"passing_score"`
+	Criteria     []struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Weight      int    `json:"weight"`
+	} `json:"criteria"`
+}
+
+// updateSessionRubricAPI handles PUT /api/v1/admin/sessions/:id/rubric, replacing all criteria
+func updateSessionRubricAPI(c *gin.Context) {
+	var session Session
+	if err := db.First(&session, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Session not found"})
+		return
+	}
+
+	var req rubricRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+	if req.PassingScore < 1 || req.PassingScore > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "passing_score must be between 1 and 100"})
+		return
+	}
+	if len(req.Criteria) == 0 || len(req.Criteria) > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "A rubric needs between 1 and 10 criteria"})
+		return
+	}
+
+	criteria := make([]RubricCriterion, 0, len(req.Criteria))
+	for i, item := range req.Criteria {
+		title := strings.TrimSpace(item.Title)
+		if title == "" || item.Weight < 1 || item.Weight > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": fmt.Sprintf("Criterion %d needs a title and a weight between 1 and 100", i+1)})
+			return
+		}
+		criteria = append(criteria, RubricCriterion{
+			Position:    i + 1,
+			Title:       title,
+			Description: strings.TrimSpace(item.Description),
+			Weight:      item.Weight,
+		})
+	}
+
+	rubric := SessionRubric{SessionID: session.ID}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", session.ID).FirstOrCreate(&rubric).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("rubric_id = ?", rubric.ID).Delete(&RubricCriterion{}).Error; err != nil {
+			return err
+		}
+		for i := range criteria {
+			criteria[i].RubricID = rubric.ID
+		}
+		if err := tx.Create(&criteria).Error; err != nil {
+			return err
+		}
+		rubric.PassingScore = req.PassingScore
+		rubric.UpdatedBy = getAdminIDFromContext(c)
+		return tx.Omit("Criteria").Save(&rubric).Error
+	})
+	if err != nil {
+		logger.Error("Failed to save session rubric", zap.Uint("session_id", session.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+	rubric.Criteria = criteria
+
+	if adminID := getAdminIDFromContext(c); adminID != nil {
+		var admin Admin
+		admin.ID = *adminID
+		details, _ := json.Marshal(gin.H{"passing_score": rubric.PassingScore, "criteria": len(criteria)})
+		logAdminAction(&admin, "update_rubric", string(details), "session", session.ID)
+	}
+
+	logger.Info("Session rubric updated by admin",
+		zap.Uint("session_id", session.ID),
+		zap.Int("passing_score", rubric.PassingScore),
+		zap.Int("criteria", len(criteria)))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rubric})
+}
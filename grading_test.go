@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestGradeQuizUsesRubricWeights asserts the score comes from the weighted criterion scores,
+// not from the feedback wording, and that a failing AI returns an error instead of a pass.
+func TestGradeQuizUsesRubricWeights(t *testing.T) {
+	previous := aiClient
+	defer func() { aiClient = previous }()
+
+	rubric := &SessionRubric{
+		PassingScore: 70,
+		Criteria: []RubricCriterion{
+			{Title: "درک مفاهیم", Weight: 3},
+			{Title: "کاربرد عملی", Weight: 1},
+		},
+	}
+	session := &Session{Number: 2, Title: "پیدا کردن ایده"}
+	user := &User{TelegramID: 42}
+
+	fake := NewFakeLLMProvider("fake", `{"criteria": {"c1": {"score": 60, "comment": "ناقص"}, "c2": {"score": 140, "comment": "عالی"}}, "feedback": "عالیه! کامل بود."}`)
+	aiClient = &AIClient{router: NewLLMRouter([]LLMProvider{fake}, nil)}
+
+	grade, err := gradeQuiz(user, session, rubric, `{"q1":"جواب"}`)
+	if err != nil {
+		t.Fatalf("gradeQuiz: %v", err)
+	}
+	// (3*60 + 1*100) / 4 = 70, the out of range 140 is clamped to 100
+	if grade.Score != 70 || !grade.Passed {
+		t.Errorf("expected a passing score of 70, got %d (passed %v)", grade.Score, grade.Passed)
+	}
+	if len(grade.Criteria) != 2 || grade.Criteria[1].Score != 100 || grade.Criteria[0].Title != "درک مفاهیم" {
+		t.Errorf("unexpected criteria %+v", grade.Criteria)
+	}
+	prompt := fake.Calls()[0].Messages[len(fake.Calls()[0].Messages)-1].Content
+	if !strings.Contains(prompt, "c2: کاربرد عملی") || !strings.Contains(prompt, `{"q1":"جواب"}`) {
+		t.Errorf("prompt should list the rubric and the answers, got:\n%s", prompt)
+	}
+
+	rubric.PassingScore = 71
+	if grade := scoreQuiz(rubric, &quizGradingOutput{}); grade.Passed || grade.Score != 0 {
+		t.Errorf("missing criterion scores must not pass, got %+v", grade)
+	}
+
+	fake = NewFakeLLMProvider("fake").FailWith(errors.New("provider down"))
+	aiClient = &AIClient{router: NewLLMRouter([]LLMProvider{fake}, nil)}
+	if _, err := gradeQuiz(user, session, rubric, "یک پاسخ خیلی طولانی و مفصل که قبلاً خودکار قبول می‌شد"); err == nil {
+		t.Fatal("expected an error when the AI is down")
+	}
+
+	evaluation := QuizEvaluation{Attempts: 1}
+	evaluation.queueAfterFailure(errors.New("provider down"))
+	if evaluation.Status != QuizEvaluationQueued || evaluation.Passed || evaluation.NextAttemptAt == nil {
+		t.Errorf("failed grading should be queued for retry, got %+v", evaluation)
+	}
+	evaluation.Attempts = quizEvaluationMaxAttempts
+	evaluation.queueAfterFailure(errors.New("provider down"))
+	if evaluation.Status != QuizEvaluationFailed {
+		t.Errorf("expected the evaluation to fail after %d attempts, got %s", quizEvaluationMaxAttempts, evaluation.Status)
+	}
+}
+
+// TestBotExerciseEvaluationUsesItsFeature asserts bot submissions are graded with the exercise
+// evaluation model, without chat tools or course content, and that a failing AI returns no
+// evaluation so the submission goes to a mentor.
+func TestBotExerciseEvaluationUsesItsFeature(t *testing.T) {
+	previous := aiClient
+	defer func() { aiClient = previous }()
+
+	user := &User{TelegramID: 42, SubscriptionType: "paid", PlanName: "pro"}
+	fake := NewFakeLLMProvider("fake", "APPROVED: Yes\nFEEDBACK: عالی بود")
+	aiClient = &AIClient{router: NewLLMRouter([]LLMProvider{fake}, map[string]map[string]string{
+		FeatureChat:               {"*": "chat-model"},
+		FeatureExerciseEvaluation: {"*": "grader-model"},
+	})}
+
+	if got := requestExerciseEvaluation(user, "Student's Exercise Submission:\nقیمت گذاری محصول"); !strings.HasPrefix(got, "APPROVED: Yes") {
+		t.Errorf("unexpected evaluation %q", got)
+	}
+	call := fake.Calls()[0]
+	if call.Model != "grader-model" {
+		t.Errorf("expected the exercise evaluation model, got %q", call.Model)
+	}
+	if len(call.Tools) != 0 || len(call.Messages) != 2 {
+		t.Errorf("expected only the system prompt and the submission without tools, got %d messages and %d tools", len(call.Messages), len(call.Tools))
+	}
+
+	aiClient = &AIClient{router: NewLLMRouter([]LLMProvider{NewFakeLLMProvider("fake").FailWith(errors.New("provider down"))}, nil)}
+	if got := requestExerciseEvaluation(user, "پاسخ"); got != "" {
+		t.Errorf("a failing AI must not produce an evaluation, got %q", got)
+	}
+}
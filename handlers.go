@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"MonetizeeAI_bot/fieldcrypt"
 	"MonetizeeAI_bot/logger"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -46,6 +47,9 @@ type UserState struct {
 // completePhoneStep finalizes the phone step after we've saved user.Phone
 // It sends the signup SMS (once), prompts the user for license choice, and advances state
 func completePhoneStep(user *User) {
+	// 🔒 SECURITY: Flag phone numbers shared by many accounts
+	go checkSharedPhone(user.TelegramID, user.Phone)
+
 	// Remove custom keyboards
 	removeKb := tgbotapi.NewRemoveKeyboard(true)
 
@@ -61,7 +65,7 @@ func completePhoneStep(user *User) {
 			smsConfig := GetSMSConfig()
 			// Check if SMS was already sent to this phone number (to prevent duplicates)
 			var existingUser User
-			if err := db.Where("phone = ? AND sign_up_sms_sent = ?", phoneNum, true).First(&existingUser).Error; err == nil {
+			if err := db.Where("phone_hash = ? AND sign_up_sms_sent = ?", fieldcrypt.PhoneIndex(phoneNum), true).First(&existingUser).Error; err == nil {
 				logger.Info("Sign-up SMS already sent to this phone number, skipping",
 					zap.String("phone", phoneNum))
 				return
@@ -183,6 +187,9 @@ func isValidChatMessage(message string) bool {
 func checkChatRateLimit(telegramID int64) bool {
 	now := time.Now()
 
+	// 🔒 SECURITY: Every attempt counts towards burst detection, including rejected ones
+	reportSecuritySignal(SecurityRuleAIBurst, telegramID, "", "Burst of AI chat requests from the bot")
+
 	// Check if user has exceeded rate limit
 	if lastMessageTime, exists := chatRateLimits[telegramID]; exists {
 		if now.Sub(lastMessageTime) < ChatRateLimitWindow {
@@ -654,6 +661,8 @@ func processUserInput(input string, user *User) string {
 			// License key found in pre-generated licenses
 			if license.IsUsed {
 				// License already used
+				reportSecuritySignal(SecurityRuleLicenseGuessing, user.TelegramID, "", "Repeated attempts with already used licenses")
+
 				var usedByUser User
 				if license.UsedBy != nil {
 					db.First(&usedByUser, *license.UsedBy)
@@ -762,6 +771,8 @@ func processUserInput(input string, user *User) string {
 		}
 
 		// Invalid license - show buy subscription option
+		reportSecuritySignal(SecurityRuleLicenseGuessing, user.TelegramID, "", "Repeated invalid license attempts")
+
 		msg := tgbotapi.NewMessage(user.TelegramID,
 			"❌ لایسنس وارد شده معتبر نیست.\n\n"+
 				"لطفا فقط کد لایسنس معتبر را کپی کنید و وارد کنید.\n\n"+
@@ -1028,7 +1039,7 @@ func processUserInput(input string, user *User) string {
 		return ""
 	case "✅ ارسال تمرین":
 		userStates[user.TelegramID] = "submitting_exercise"
-		msg := tgbotapi.NewMessage(user.TelegramID, "لطفا تمرین خود را برای مرحله فعلی ارسال کنید. پاسخ خود را در پیام بعدی بنویسید.")
+		msg := tgbotapi.NewMessage(user.TelegramID, "لطفا تمرین خود را برای مرحله فعلی ارسال کنید. پاسخ خود را در پیام بعدی بنویسید یا به صورت فایل PDF، Word (DOCX)، عکس یا پیام صوتی بفرستید.")
 		msg.ReplyMarkup = getExerciseSubmissionKeyboard()
 		bot.Send(msg)
 		return ""
@@ -1049,38 +1060,51 @@ func processUserInput(input string, user *User) string {
 			return "❌ خطا در دریافت اطلاعات مرحله. لطفا دوباره تلاش کنید."
 		}
 
-		// Get exercise files for the current session
-		var exercise Exercise
-		if err := db.Where("session_id = ?", session.ID).First(&exercise).Error; err != nil {
-			logger.Error("Failed to get exercise",
+		// Get the exercises of the current session in order
+		assignments, err := sessionAssignments(session.ID)
+		if err != nil {
+			logger.Error("Failed to get exercise assignments",
 				zap.Int64("user_id", user.TelegramID),
 				zap.Uint("session_id", session.ID),
 				zap.Error(err))
 			return "❌ خطا در دریافت تمرین. لطفا دوباره تلاش کنید."
 		}
+		if len(assignments) == 0 {
+			return "📭 برای این مرحله هنوز تمرینی ثبت نشده است."
+		}
 
-		// Send PDF file if available
-		if exercise.PDFFile != "" {
-			// Check if the PDFFile is a URL
-			if strings.HasPrefix(exercise.PDFFile, "http://") || strings.HasPrefix(exercise.PDFFile, "https://") {
-				// Send PDF file using URL
-				file := tgbotapi.NewDocument(user.TelegramID, tgbotapi.FileURL(exercise.PDFFile))
-				file.Caption = fmt.Sprintf("📄 تمرین مرحله %d: %s", session.Number, session.Title)
-				bot.Send(file)
-			} else {
-				// Try sending as FileID (for backward compatibility)
-				file := tgbotapi.NewDocument(user.TelegramID, tgbotapi.FileID(exercise.PDFFile))
-				file.Caption = fmt.Sprintf("📄 تمرین مرحله %d: %s", session.Number, session.Title)
+		for i, assignment := range assignments {
+			title := session.Title
+			if assignment.Title != "" {
+				title = assignment.Title
+			}
+			if len(assignments) > 1 {
+				title = fmt.Sprintf("%s (%d از %d)", title, i+1, len(assignments))
+			}
+
+			// Send PDF file if available
+			if assignment.PDFFile != "" {
+				var file tgbotapi.DocumentConfig
+				// Check if the PDFFile is a URL
+				if strings.HasPrefix(assignment.PDFFile, "http://") || strings.HasPrefix(assignment.PDFFile, "https://") {
+					file = tgbotapi.NewDocument(user.TelegramID, tgbotapi.FileURL(assignment.PDFFile))
+				} else {
+					// Try sending as FileID (for backward compatibility)
+					file = tgbotapi.NewDocument(user.TelegramID, tgbotapi.FileID(assignment.PDFFile))
+				}
+				file.Caption = fmt.Sprintf("📄 تمرین مرحله %d: %s", session.Number, title)
 				bot.Send(file)
 			}
-		}
 
-		// Send exercise text
-		exerciseMsg := fmt.Sprintf("📝 تمرین مرحله %d: %s\n\n%s",
-			session.Number,
-			session.Title,
-			exercise.Content)
-		bot.Send(tgbotapi.NewMessage(user.TelegramID, exerciseMsg))
+			// Send exercise text
+			if assignment.Content != "" {
+				exerciseMsg := fmt.Sprintf("📝 تمرین مرحله %d: %s\n\n%s",
+					session.Number,
+					title,
+					assignment.Content)
+				bot.Send(tgbotapi.NewMessage(user.TelegramID, exerciseMsg))
+			}
+		}
 		return ""
 	case "🧩 پشتیبانی", "🆘 پشتیبانی":
 		// Send support contact with direct link
@@ -1128,6 +1152,20 @@ func processUserInput(input string, user *User) string {
 			}
 		}
 		return "مینی اپ در حال حاضر در دسترس نیست."
+	case "🧹 شروع مکالمه جدید":
+		msgText := "🧹 گفتگوی جدید شروع شد. گفتگوهای قبلی در بخش چت مینی اپ در دسترس هستند."
+		if _, err := createChatThread(user.TelegramID, ""); err != nil {
+			logger.Error("Failed to create chat thread",
+				zap.Int64("user_id", user.TelegramID),
+				zap.Error(err))
+			msgText = "❌ خطا در شروع مکالمه جدید. لطفا دوباره تلاش کنید."
+		}
+		msg := tgbotapi.NewMessage(user.TelegramID, msgText)
+		if userStates[user.TelegramID] == "chat_mode" {
+			msg.ReplyMarkup = getChatKeyboard()
+		}
+		bot.Send(msg)
+		return ""
 	case "🔚 اتمام مکالمه با دستیار هوشمند":
 		userStates[user.TelegramID] = ""
 		msg := tgbotapi.NewMessage(user.TelegramID, "مکالمه با دستیار هوشمند به پایان رسید. به منوی اصلی بازگشتید.")
@@ -1149,18 +1187,33 @@ func processUserInput(input string, user *User) string {
 		}
 		return ""
 	default:
+		// Comment on a rated answer after the "add a comment" button
+		if pending, ok := takePendingRatingComment(user.TelegramID); ok {
+			return saveRatingComment(user.TelegramID, pending, input)
+		}
+
 		if state == "submitting_exercise" {
 			userStates[user.TelegramID] = ""
-			msg := tgbotapi.NewMessage(user.TelegramID, handleExerciseSubmission(user, input))
+			msg := tgbotapi.NewMessage(user.TelegramID, handleExerciseSubmission(user, input, nil))
 			msg.ReplyMarkup = getMainMenuKeyboard(user)
 			bot.Send(msg)
 			return ""
 		}
 
 		if state == "chat_mode" {
-			response := handleChatGPTMessage(user, input)
+			// 🔒 SECURITY: Banned users get the ban notice with the appeal button
+			if ban := getActiveBan(user.TelegramID, BanScopeChat); ban != nil {
+				sendBanNotice(user.TelegramID, ban)
+				return ""
+			}
+
+			response, message := handleChatGPTMessage(user, input)
 			msg := tgbotapi.NewMessage(user.TelegramID, response)
-			msg.ReplyMarkup = getChatKeyboard()
+			if message != nil && message.ID != 0 {
+				msg.ReplyMarkup = ratingKeyboard(RatingTargetChatMessage, message.ID, 0)
+			} else {
+				msg.ReplyMarkup = getChatKeyboard()
+			}
 			bot.Send(msg)
 			return ""
 		}
@@ -1232,7 +1285,22 @@ func getSupportMessage(user *User) string {
 `
 }
 
-func handleExerciseSubmission(user *User, content string) string {
+// requestExerciseEvaluation asks the exercise evaluation model (and its fallback chain) to
+// grade a bot submission, like the Mini App quiz grading: no chat memory, course content or
+// tools. It returns "" when no provider answers.
+func requestExerciseEvaluation(user *User, prompt string) string {
+	resp, err := aiClient.ForUser(user).GenerateMonetizeAIResponse(FeatureExerciseEvaluation, prompt, nil)
+	if err != nil {
+		logger.Error("Exercise evaluation failed",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Error(err))
+		return ""
+	}
+	return resp.Content
+}
+
+// handleExerciseSubmission evaluates an exercise answer. file is the attached file, nil for text answers.
+func handleExerciseSubmission(user *User, content string, file *submissionFile) string {
 	// Get current session info
 	var session Session
 	if err := db.Where("number = ?", user.CurrentSession).First(&session).Error; err != nil {
@@ -1243,6 +1311,17 @@ func handleExerciseSubmission(user *User, content string) string {
 		return "❌ خطا در دریافت اطلاعات مرحله. لطفا دوباره تلاش کنید."
 	}
 
+	// Images, voice notes and scanned documents have no text for the AI: a mentor grades them
+	if file != nil && file.Text == "" {
+		return submitFileForMentorReview(user, &session, content, file)
+	}
+
+	// 🔒 SECURITY: The submission is graded by the AI, it must not carry instructions for it.
+	// content already holds the text extracted from a file.
+	if verdict := moderateAIInput(user, FeatureExerciseEvaluation, content); verdict != nil {
+		return verdict.Message
+	}
+
 	var video Video
 	if err := db.Where("session_id = ?", session.ID).First(&video).Error; err != nil {
 		logger.Error("Failed to get video",
@@ -1253,40 +1332,19 @@ func handleExerciseSubmission(user *User, content string) string {
 	}
 
 	// Prepare context for ChatGPT
-	context := fmt.Sprintf(`Session Title: %s
-Session Description: %s
-Video Title: %s
-Video Description: %s
-
-Student's Exercise Submission:
-%s
-
-Please evaluate this exercise submission according to these criteria:
-1. Check if the answer aligns with the session's learning objectives
-2. If the answer is incomplete or incorrect:
-   - Provide specific feedback on what's missing
-   - Give helpful hints and examples
-   - Guide them to improve their answer
-3. If the answer is good:
-   - Provide positive reinforcement
-   - Give permission to move to next session
-4. Keep the tone friendly and encouraging
-5. Respond in Persian
-
-Format your response as:
-APPROVED: [yes/no]
-FEEDBACK: [your detailed feedback]`,
-		session.Title,
-		session.Description,
-		video.Title,
-		video.Description,
-		content)
-
-	// Get evaluation from ChatGPT
-	evaluation := handleChatGPTMessage(user, context)
+	context := renderPrompt(PromptBotExerciseEvaluation, map[string]string{
+		"session_title":       session.Title,
+		"session_description": session.Description,
+		"video_title":         video.Title,
+		"video_description":   video.Description,
+		"submission":          content,
+	})
+
+	// Get evaluation from the AI; a failure leaves it empty and the submission goes to a mentor
+	evaluation := requestExerciseEvaluation(user, context)
 
 	// Parse the response
-	var approved bool
+	var approved, parsed bool
 	var feedback string
 
 	// Split the response into lines
@@ -1294,6 +1352,7 @@ FEEDBACK: [your detailed feedback]`,
 	for _, line := range lines {
 		if strings.HasPrefix(line, "APPROVED:") {
 			approved = strings.Contains(strings.ToLower(line), "yes")
+			parsed = true
 		} else if strings.HasPrefix(line, "FEEDBACK:") {
 			feedback = strings.TrimSpace(strings.TrimPrefix(line, "FEEDBACK:"))
 		}
@@ -1312,24 +1371,36 @@ FEEDBACK: [your detailed feedback]`,
 		}
 	}
 
-	// Create exercise record
-	exercise := Exercise{
+	// Create the submission record. It stays pending while a mentor reviews it (see reviews.go).
+	status := "needs_revision"
+	if approved {
+		status = "approved"
+	}
+	submission := ExerciseSubmission{
 		UserID:      user.ID,
-		SessionID:   uint(user.CurrentSession),
+		TelegramID:  user.TelegramID,
+		SessionID:   session.ID,
+		Attempt:     nextSubmissionAttempt(user.TelegramID, session.ID),
 		Content:     content,
-		Status:      "pending",
+		Status:      status,
+		AIFeedback:  feedback,
 		Feedback:    feedback,
 		SubmittedAt: time.Now(),
 	}
+	linkSessionAssignment(&submission)
+	file.attachTo(&submission)
 
-	// Save exercise
-	if err := db.Create(&exercise).Error; err != nil {
-		logger.Error("Failed to save exercise",
+	// Save submission
+	if err := db.Create(&submission).Error; err != nil {
+		logger.Error("Failed to save exercise submission",
 			zap.Int64("user_id", user.TelegramID),
 			zap.Uint("session_id", session.ID),
 			zap.Error(err))
 		return "❌ خطا در ثبت تمرین. لطفا دوباره تلاش کنید."
 	}
+	if flagExerciseForReview(&submission, session.Number, approved, parsed) {
+		db.Model(&submission).Update("status", "pending")
+	}
 
 	if approved {
 		// Use the same completedSessions logic as profile
@@ -1522,6 +1593,9 @@ func getExerciseSubmissionKeyboard() tgbotapi.ReplyKeyboardMarkup {
 
 func getChatKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	keyboard := tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("🧹 شروع مکالمه جدید"),
+		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("🔚 اتمام مکالمه با دستیار هوشمند"),
 		),
@@ -1532,9 +1606,9 @@ func getChatKeyboard() tgbotapi.ReplyKeyboardMarkup {
 
 // 📦 BACKUP: Old OpenAI implementation - kept for reference
 func handleChatGPTMessage_OLD(user *User, message string) string {
-	// 🔒 SECURITY: Check if user is blocked
-	if isUserBlocked(user.TelegramID) {
-		return "🚫 دسترسی شما به چت مسدود شده است. لطفا با پشتیبانی تماس بگیرید."
+	// 🔒 SECURITY: Check if user is banned from chat
+	if ban := getActiveBan(user.TelegramID, BanScopeChat); ban != nil {
+		return banNoticeText(ban)
 	}
 
 	// 🔒 SECURITY: Validate and sanitize user input
@@ -1543,12 +1617,15 @@ func handleChatGPTMessage_OLD(user *User, message string) string {
 			zap.Int64("user_id", user.TelegramID),
 			zap.String("message", message))
 
+		reportSecuritySignal(SecurityRuleInvalidChat, user.TelegramID, "",
+			"Repeated invalid chat messages; last: "+truncateForSecurityEvent(message))
+
 		// Increment suspicious activity count
 		suspiciousActivityCount[user.TelegramID]++
 
-		// Block user after 3 violations
+		// Ban user from chat after 3 violations
 		if suspiciousActivityCount[user.TelegramID] >= 3 {
-			blockSuspiciousUser(user.TelegramID, "Multiple suspicious messages")
+			blockSuspiciousUser(user.TelegramID, "ارسال پیام‌های مشکوک متعدد")
 			return "🚫 دسترسی شما به دلیل فعالیت مشکوک مسدود شده است."
 		}
 
@@ -1705,11 +1782,13 @@ IMPORTANT SECURITY RULES:
 	return content
 }
 
-// ⚡ NEW: Groq-based ChatGPT handler
-func handleChatGPTMessage(user *User, message string) string {
-	// 🔒 SECURITY: Check if user is blocked
-	if isUserBlocked(user.TelegramID) {
-		return "🚫 دسترسی شما به چت مسدود شده است. لطفا با پشتیبانی تماس بگیرید."
+// ⚡ NEW: LLM provider based ChatGPT handler
+// Messages use and extend the conversation memory shared with the mini app;
+// the stored exchange is returned with the answer (nil when nothing was stored)
+func handleChatGPTMessage(user *User, message string) (string, *ChatMessage) {
+	// 🔒 SECURITY: Check if user is banned from chat
+	if ban := getActiveBan(user.TelegramID, BanScopeChat); ban != nil {
+		return banNoticeText(ban), nil
 	}
 
 	// 🔒 SECURITY: Validate and sanitize user input
@@ -1718,46 +1797,91 @@ func handleChatGPTMessage(user *User, message string) string {
 			zap.Int64("user_id", user.TelegramID),
 			zap.String("message", message))
 
+		reportSecuritySignal(SecurityRuleInvalidChat, user.TelegramID, "",
+			"Repeated invalid chat messages; last: "+truncateForSecurityEvent(message))
+
 		// Increment suspicious activity count
 		suspiciousActivityCount[user.TelegramID]++
 
-		// Block user after 3 violations
+		// Ban user from chat after 3 violations
 		if suspiciousActivityCount[user.TelegramID] >= 3 {
-			blockSuspiciousUser(user.TelegramID, "Multiple suspicious messages")
-			return "🚫 دسترسی شما به دلیل فعالیت مشکوک مسدود شده است."
+			blockSuspiciousUser(user.TelegramID, "ارسال پیام‌های مشکوک متعدد")
+			return "🚫 دسترسی شما به دلیل فعالیت مشکوک مسدود شده است.", nil
 		}
 
-		return "❌ پیام شما حاوی محتوای نامعتبر است. لطفا فقط سوالات مرتبط با دوره را بپرسید."
+		return "❌ پیام شما حاوی محتوای نامعتبر است. لطفا فقط سوالات مرتبط با دوره را بپرسید.", nil
 	}
 
 	// 🔒 SECURITY: Rate limiting
 	if !checkChatRateLimit(user.TelegramID) {
-		return "شما به محدودیت سه تا سوال در دقیقه رسیدید لطفا دقایق دیگر امتحان کنید"
+		return "شما به محدودیت سه تا سوال در دقیقه رسیدید لطفا دقایق دیگر امتحان کنید", nil
+	}
+
+	// 🔒 SECURITY: Prompt-injection and content moderation
+	if verdict := moderateAIInput(user, FeatureChat, message); verdict != nil {
+		return verdict.Message, nil
 	}
 
-	// Check if Groq client is initialized
-	if groqClient == nil {
-		logger.Error("Groq client not initialized",
+	// Check if AI client is initialized
+	if aiClient == nil {
+		logger.Error("AI client not initialized",
 			zap.Int64("user_id", user.TelegramID))
-		return "❌ سرویس هوش مصنوعی در حال حاضر در دسترس نیست. لطفا بعداً تلاش کنید."
+		return "❌ سرویس هوش مصنوعی در حال حاضر در دسترس نیست. لطفا بعداً تلاش کنید.", nil
 	}
 
-	// Generate response using Groq (Telegram bot doesn't have recent messages context - pass empty)
-	response, err := groqClient.GenerateMonetizeAIResponse(message, []string{})
+	// Generate response with the conversation memory of the active thread (shared with the mini app)
+	// Daily and monthly token quota of the plan
+	if period, exceeded := tokenQuotaExceeded(user); exceeded {
+		return tokenQuotaMessage(period), nil
+	}
+
+	thread, err := activeChatThread(user.TelegramID, true)
 	if err != nil {
-		logger.Error("Groq API error",
+		logger.Error("Failed to load active chat thread",
 			zap.Int64("user_id", user.TelegramID),
 			zap.Error(err))
-		return "❌ خطا در دریافت پاسخ. لطفا دوباره تلاش کنید."
+	}
+	conv := loadConversationContext(thread)
+	resp, err := aiClient.ForUser(user).GenerateMonetizeAIResponse(FeatureChat, message, conv)
+	if err != nil {
+		logger.Error("AI API error",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Error(err))
+		if thread == nil || !isRetryableLLMError(err) {
+			return "❌ خطا در دریافت پاسخ. لطفا دوباره تلاش کنید.", nil
+		}
+		// During a provider outage the question is kept and answered by the AI job worker once
+		// the providers recover
+		job := &AIJob{
+			TelegramID:        user.TelegramID,
+			Kind:              AIJobChat,
+			Source:            AIJobSourceBot,
+			ThreadID:          &thread.ID,
+			Input:             message,
+			DeliverToTelegram: true,
+		}
+		if qerr := enqueueAIJob(job, aiJobRetryBase); qerr != nil {
+			// Neither answered nor queued: the error is only shown, never stored in the thread
+			logger.Error("Failed to queue chat message", zap.Int64("user_id", user.TelegramID), zap.Error(qerr))
+			return "❌ سرویس هوش مصنوعی در حال حاضر در دسترس نیست. لطفا بعداً تلاش کنید.", nil
+		}
+		return "⏳ سرویس هوش مصنوعی در حال حاضر شلوغ است. سوال شما ذخیره شد و پاسخ آن به محض آماده شدن همین‌جا برایتان ارسال می‌شود.", nil
 	}
 
 	// 🔒 SECURITY: Log successful chat message for monitoring
-	logger.Info("Chat message processed successfully via Groq",
+	logger.Info("Chat message processed successfully",
 		zap.Int64("user_id", user.TelegramID),
 		zap.String("message", message),
-		zap.Int("response_length", len(response)))
+		zap.Int("response_length", len(resp.Content)),
+		zap.String("provider", resp.Provider),
+		zap.String("model", resp.Model))
+
+	var stored *ChatMessage
+	if thread != nil {
+		stored = storeChatMessage(thread, message, resp.Content, resp)
+	}
 
-	return response
+	return resp.Content, stored
 }
 
 // 🔒 SECURITY: Clean up rate limit cache periodically
@@ -1776,22 +1900,25 @@ func cleanupRateLimitCache() {
 	}()
 }
 
-// 🔒 SECURITY: Block suspicious users
-var blockedUsers = make(map[int64]bool)
+// 🔒 SECURITY: Strike counter for suspicious chat messages.
+// Strikes are short-lived; the ban they lead to is persisted in the bans table.
 var suspiciousActivityCount = make(map[int64]int)
 
+// blockSuspiciousUser issues a temporary chat ban and resets the user's strikes
 func blockSuspiciousUser(telegramID int64, reason string) {
-	blockedUsers[telegramID] = true
-	suspiciousActivityCount[telegramID]++
+	suspiciousActivityCount[telegramID] = 0
+
+	if _, err := issueBan(telegramID, BanScopeChat, reason, AutoBanDuration, nil); err != nil {
+		logger.Error("Failed to ban suspicious user",
+			zap.Int64("user_id", telegramID),
+			zap.Error(err))
+		return
+	}
 
 	logger.Warn("User blocked for suspicious activity",
 		zap.Int64("user_id", telegramID),
 		zap.String("reason", reason),
-		zap.Int("violation_count", suspiciousActivityCount[telegramID]))
-}
-
-func isUserBlocked(telegramID int64) bool {
-	return blockedUsers[telegramID]
+		zap.Int64("violation_count", countBans(telegramID)))
 }
 
 // getAdminKeyboard returns the admin keyboard layout
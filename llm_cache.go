@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Response cache in front of the provider chain. Identical requests of an opted-in feature
+// (same normalized messages, models and parameters) within the TTL are answered from memory,
+// and identical requests that arrive while the first one is still running wait for it
+// instead of calling the provider again. Cached answers use no tokens and are not recorded
+// in AIUsage.
+
+// Defaults of LLM_CACHE_TTL and LLM_CACHE_MAX_ENTRIES
+const (
+	defaultLLMCacheTTL        = 10 * time.Minute
+	defaultLLMCacheMaxEntries = 1000
+)
+
+// LLMCache stores successful responses by request key
+type LLMCache struct {
+	features   map[string]bool // Opted-in features
+	ttl        time.Duration
+	maxEntries int
+
+	entries  map[string]llmCacheEntry
+	inflight map[string]*llmFlight
+	mu       sync.Mutex
+}
+
+type llmCacheEntry struct {
+	resp      LLMResponse
+	expiresAt time.Time
+}
+
+// llmFlight is a provider call other identical requests are waiting for
+type llmFlight struct {
+	done chan struct{}
+	resp *LLMResponse
+	err  error
+}
+
+// NewLLMCache creates a cache for features; maxEntries <= 0 means the default
+func NewLLMCache(features []string, ttl time.Duration, maxEntries int) *LLMCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultLLMCacheMaxEntries
+	}
+	enabled := make(map[string]bool, len(features))
+	for _, feature := range features {
+		if feature = strings.ToLower(strings.TrimSpace(feature)); feature != "" {
+			enabled[feature] = true
+		}
+	}
+	return &LLMCache{
+		features:   enabled,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]llmCacheEntry),
+		inflight:   make(map[string]*llmFlight),
+	}
+}
+
+// newLLMCacheFromEnv builds the cache from:
+//
+//	LLM_CACHE_FEATURES     features to cache, e.g. "business_builder,sellkit" (default none)
+//	LLM_CACHE_TTL          how long answers are kept, e.g. "30m" (default 10m)
+//	LLM_CACHE_MAX_ENTRIES  default 1000
+//
+// It returns nil when no feature opted in.
+func newLLMCacheFromEnv() *LLMCache {
+	features := os.Getenv("LLM_CACHE_FEATURES")
+	if strings.TrimSpace(features) == "" {
+		return nil
+	}
+
+	ttl := defaultLLMCacheTTL
+	if value := os.Getenv("LLM_CACHE_TTL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			ttl = parsed
+		} else {
+			logger.Warn("Invalid LLM_CACHE_TTL, using default", zap.String("value", value))
+		}
+	}
+	maxEntries, _ := strconv.Atoi(os.Getenv("LLM_CACHE_MAX_ENTRIES"))
+
+	return NewLLMCache(strings.Split(features, ","), ttl, maxEntries)
+}
+
+// enabled reports whether responses of feature are cached
+func (c *LLMCache) enabled(feature string) bool {
+	return c != nil && c.features[feature]
+}
+
+type llmCacheBypassKey struct{}
+
+// withoutLLMCache returns a context whose requests always go to a provider, e.g. when the
+// user explicitly asks for a new answer. The fresh answer still replaces the cached one.
+func withoutLLMCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, llmCacheBypassKey{}, true)
+}
+
+func llmCacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(llmCacheBypassKey{}).(bool)
+	return bypass
+}
+
+// llmCacheKey identifies a request: the feature, the model of every provider in the chain,
+// the parameters and the messages with whitespace collapsed
+func llmCacheKey(feature string, models []string, req LLMRequest) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%g\x00", feature, strings.Join(models, ","), req.MaxTokens, req.Temperature)
+	for _, tool := range req.Tools {
+		fmt.Fprintf(hash, "tool\x00%s\x00", tool.Name)
+	}
+	for _, msg := range req.Messages {
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\x00", msg.Role, strings.Join(strings.Fields(msg.Content), " "), msg.ToolCallID)
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(hash, "call\x00%s\x00%s\x00%s\x00", call.ID, call.Name, call.Arguments)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// get returns a copy of the cached response for key
+func (c *LLMCache) get(key string, now time.Time) (*LLMResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if now.After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return cachedCopy(&entry.resp), true
+}
+
+// put stores resp under key, evicting expired entries and then the oldest ones when full
+func (c *LLMCache) put(key string, resp *LLMResponse, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		for len(c.entries) >= c.maxEntries {
+			oldest := ""
+			for k, entry := range c.entries {
+				if oldest == "" || entry.expiresAt.Before(c.entries[oldest].expiresAt) {
+					oldest = k
+				}
+			}
+			delete(c.entries, oldest)
+		}
+	}
+	entry := llmCacheEntry{resp: *resp, expiresAt: now.Add(c.ttl)}
+	entry.resp.ToolCalls = append([]LLMToolCall(nil), resp.ToolCalls...)
+	c.entries[key] = entry
+}
+
+// cachedCopy returns a copy of resp marked as served from the cache. Callers modify
+// responses (e.g. sanitizing Content), so they never share one.
+func cachedCopy(resp *LLMResponse) *LLMResponse {
+	out := *resp
+	out.ToolCalls = append([]LLMToolCall(nil), resp.ToolCalls...)
+	out.Cached = true
+	return &out
+}
+
+// do answers from the cache, joins an identical request in flight or runs call and caches
+// its result
+func (c *LLMCache) do(ctx context.Context, feature, key string, call func(context.Context) (*LLMResponse, error)) (*LLMResponse, error) {
+	bypass := llmCacheBypassed(ctx)
+	if !bypass {
+		if resp, ok := c.get(key, time.Now()); ok {
+			metrics.IncLLMCache(feature, "hit")
+			return resp, nil
+		}
+	}
+
+	c.mu.Lock()
+	if flight, ok := c.inflight[key]; ok && !bypass {
+		c.mu.Unlock()
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if flight.err == nil {
+			metrics.IncLLMCache(feature, "coalesced")
+			return cachedCopy(flight.resp), nil
+		}
+		// The first request failed, possibly only because its caller went away: try again
+		logger.Warn("Coalesced LLM request failed, calling the provider", zap.String("feature", feature), zap.Error(flight.err))
+		return c.call(ctx, feature, key, nil, call)
+	}
+	var flight *llmFlight
+	if !bypass {
+		flight = &llmFlight{done: make(chan struct{})}
+		c.inflight[key] = flight
+	}
+	c.mu.Unlock()
+
+	return c.call(ctx, feature, key, flight, call)
+}
+
+// call runs the provider call, caches a success and releases the requests waiting on flight
+func (c *LLMCache) call(ctx context.Context, feature, key string, flight *llmFlight, call func(context.Context) (*LLMResponse, error)) (*LLMResponse, error) {
+	metrics.IncLLMCache(feature, "miss")
+	resp, err := call(ctx)
+	if err == nil {
+		c.put(key, resp, time.Now())
+	}
+
+	if flight != nil {
+		flight.resp, flight.err = resp, err
+		if err == nil {
+			// Waiters get their own copy, the caller may modify resp
+			flight.resp = cachedCopy(resp)
+		}
+		c.mu.Lock()
+		if c.inflight[key] == flight {
+			delete(c.inflight, key)
+		}
+		c.mu.Unlock()
+		close(flight.done)
+	}
+	return resp, err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedLLMProvider holds every call until gate is closed
+type gatedLLMProvider struct {
+	*FakeLLMProvider
+	gate chan struct{}
+}
+
+func (p *gatedLLMProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	<-p.gate
+	return p.FakeLLMProvider.Complete(ctx, req)
+}
+
+// TestLLMCache covers cache hits on normalized prompts, misses on other parameters or
+// features, the bypass for fresh answers and coalescing of identical requests in flight.
+func TestLLMCache(t *testing.T) {
+	fake := NewFakeLLMProvider("groq", "طرح اول", "طرح دوم", "پاسخ چت", "طرح تازه")
+	router := NewLLMRouter([]LLMProvider{fake}, nil)
+	router.SetCache(NewLLMCache([]string{FeatureBusinessBuilder}, time.Minute, 0))
+
+	request := func(content string, temperature float32) LLMRequest {
+		return LLMRequest{Messages: []LLMMessage{{Role: "user", Content: content}}, MaxTokens: 100, Temperature: temperature}
+	}
+	ctx := context.Background()
+
+	first, _ := router.Complete(ctx, FeatureBusinessBuilder, request("طرح  بساز\n", 0.7))
+	again, _ := router.Complete(ctx, FeatureBusinessBuilder, request(" طرح بساز", 0.7))
+	if first.Cached || !again.Cached || again.Content != "طرح اول" {
+		t.Fatalf("the normalized prompt should be served from the cache: %+v %+v", first, again)
+	}
+	again.Content = "changed by the caller"
+	if hit, _ := router.Complete(ctx, FeatureBusinessBuilder, request("طرح بساز", 0.7)); hit.Content != "طرح اول" {
+		t.Fatalf("callers must not change the cached answer, got %q", hit.Content)
+	}
+
+	other, _ := router.Complete(ctx, FeatureBusinessBuilder, request("طرح بساز", 0.2))
+	chat, _ := router.Complete(ctx, FeatureChat, request("طرح بساز", 0.7))
+	if other.Content != "طرح دوم" || chat.Content != "پاسخ چت" || chat.Cached {
+		t.Fatalf("other parameters and features must not hit the cache: %+v %+v", other, chat)
+	}
+
+	fresh, _ := router.Complete(withoutLLMCache(ctx), FeatureBusinessBuilder, request("طرح بساز", 0.7))
+	cached, _ := router.Complete(ctx, FeatureBusinessBuilder, request("طرح بساز", 0.7))
+	if fresh.Content != "طرح تازه" || fresh.Cached || cached.Content != "طرح تازه" {
+		t.Fatalf("a fresh answer should replace the cached one: %+v %+v", fresh, cached)
+	}
+	if calls := len(fake.Calls()); calls != 4 {
+		t.Fatalf("expected 4 provider calls, got %d", calls)
+	}
+
+	gated := &gatedLLMProvider{FakeLLMProvider: NewFakeLLMProvider("groq", "یک پاسخ"), gate: make(chan struct{})}
+	router = NewLLMRouter([]LLMProvider{gated}, nil)
+	router.SetCache(NewLLMCache([]string{FeatureSellKit}, time.Minute, 0))
+
+	var wg sync.WaitGroup
+	answers := make([]string, 5)
+	for i := range answers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := router.Complete(ctx, FeatureSellKit, request("کیت فروش", 0.7))
+			if err == nil {
+				answers[i] = resp.Content
+			}
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(gated.gate)
+	wg.Wait()
+
+	if calls := len(gated.Calls()); calls != 1 {
+		t.Fatalf("identical requests should share one provider call, got %d", calls)
+	}
+	for _, answer := range answers {
+		if answer != "یک پاسخ" {
+			t.Fatalf("every request should get the shared answer, got %q", answers)
+		}
+	}
+}
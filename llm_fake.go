@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeLLMProvider is a scripted provider for tests and offline development (LLM_PROVIDERS=fake).
+// Each call pops the next scripted result; when the script is empty it echoes the last user message.
+// Transcriptions pop the same script, a scripted response is the transcript.
+type FakeLLMProvider struct {
+	name           string
+	model          string
+	script         []fakeLLMResult
+	calls          []LLMRequest
+	transcriptions []TranscriptionRequest
+	callsMu        sync.Mutex
+}
+
+type fakeLLMResult struct {
+	content   string
+	toolCalls []LLMToolCall
+	err       error
+}
+
+// NewFakeLLMProvider creates a fake provider that answers with responses in order
+func NewFakeLLMProvider(name string, responses ...string) *FakeLLMProvider {
+	fake := &FakeLLMProvider{name: name, model: "fake-model"}
+	for _, response := range responses {
+		fake.script = append(fake.script, fakeLLMResult{content: response})
+	}
+	return fake
+}
+
+// FailWith queues an error as the next result
+func (f *FakeLLMProvider) FailWith(err error) *FakeLLMProvider {
+	f.callsMu.Lock()
+	defer f.callsMu.Unlock()
+	f.script = append(f.script, fakeLLMResult{err: err})
+	return f
+}
+
+// Respond queues a response as the next result
+func (f *FakeLLMProvider) Respond(content string) *FakeLLMProvider {
+	f.callsMu.Lock()
+	defer f.callsMu.Unlock()
+	f.script = append(f.script, fakeLLMResult{content: content})
+	return f
+}
+
+// CallTools queues a turn in which the model asks for tools as the next result
+func (f *FakeLLMProvider) CallTools(calls ...LLMToolCall) *FakeLLMProvider {
+	f.callsMu.Lock()
+	defer f.callsMu.Unlock()
+	f.script = append(f.script, fakeLLMResult{toolCalls: calls})
+	return f
+}
+
+// Calls returns the requests received so far
+func (f *FakeLLMProvider) Calls() []LLMRequest {
+	f.callsMu.Lock()
+	defer f.callsMu.Unlock()
+	return append([]LLMRequest(nil), f.calls...)
+}
+
+// Transcriptions returns the transcription requests received so far
+func (f *FakeLLMProvider) Transcriptions() []TranscriptionRequest {
+	f.callsMu.Lock()
+	defer f.callsMu.Unlock()
+	return append([]TranscriptionRequest(nil), f.transcriptions...)
+}
+
+func (f *FakeLLMProvider) Name() string {
+	return f.name
+}
+
+func (f *FakeLLMProvider) DefaultModel() string {
+	return f.model
+}
+
+// Stream delivers the scripted response a few runes at a time
+func (f *FakeLLMProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string) error) (*LLMResponse, error) {
+	resp, err := f.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	runes := []rune(resp.Content)
+	for start := 0; start < len(runes); start += 4 {
+		end := start + 4
+		if end > len(runes) {
+			end = len(runes)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := onDelta(string(runes[start:end])); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (f *FakeLLMProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	f.callsMu.Lock()
+	defer f.callsMu.Unlock()
+
+	f.calls = append(f.calls, req)
+
+	model := req.Model
+	if model == "" {
+		model = f.model
+	}
+
+	if len(f.script) == 0 {
+		content := ""
+		for i := len(req.Messages) - 1; i >= 0; i-- {
+			if req.Messages[i].Role == "user" {
+				content = req.Messages[i].Content
+				break
+			}
+		}
+		return &LLMResponse{Content: content, Provider: f.name, Model: model}, nil
+	}
+
+	next := f.script[0]
+	f.script = f.script[1:]
+	if next.err != nil {
+		return nil, next.err
+	}
+	return &LLMResponse{Content: next.content, ToolCalls: next.toolCalls, Provider: f.name, Model: model}, nil
+}
+
+// Transcribe returns the next scripted response as the transcript, or an empty one
+func (f *FakeLLMProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	f.callsMu.Lock()
+	defer f.callsMu.Unlock()
+
+	f.transcriptions = append(f.transcriptions, req)
+
+	model := req.Model
+	if model == "" {
+		model = "fake-whisper"
+	}
+	resp := &TranscriptionResponse{Provider: f.name, Model: model}
+	if len(f.script) == 0 {
+		return resp, nil
+	}
+
+	next := f.script[0]
+	f.script = f.script[1:]
+	if next.err != nil {
+		return nil, next.err
+	}
+	resp.Text = next.content
+	return resp, nil
+}
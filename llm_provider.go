@@ -0,0 +1,943 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// AI features, each can use its own model (LLM_MODEL_<FEATURE>)
+const (
+	FeatureChat               = "chat"
+	FeatureExerciseEvaluation = "exercise_evaluation"
+	FeatureBusinessBuilder    = "business_builder"
+	FeatureSellKit            = "sellkit"
+	FeatureClientFinder       = "clientfinder"
+	FeatureSalesPath          = "salespath"
+	FeatureChatSummary        = "chat_summary"
+	FeatureTranscription      = "transcription"
+	FeatureModeration         = "moderation"
+)
+
+// Provider names used in LLM_PROVIDERS
+const (
+	ProviderGroq   = "groq"
+	ProviderOpenAI = "openai" // Any OpenAI-compatible API
+	ProviderOllama = "ollama"
+	ProviderFake   = "fake"
+)
+
+// RateLimitCooldown is how long a provider is skipped after it answers 429
+const RateLimitCooldown = 30 * time.Second
+
+// LLMMessage is one chat message sent to a provider
+type LLMMessage struct {
+	Role       string // system, user, assistant, tool
+	Content    string
+	ToolCalls  []LLMToolCall // Assistant turn that asked for tools
+	ToolCallID string        // Tool turn: the call it answers
+}
+
+// LLMTool is a function the model may call
+type LLMTool struct {
+	Name        string
+	Description string
+	Parameters  *JSONSchema
+}
+
+// LLMToolCall is one function call requested by the model; Arguments is a JSON object
+type LLMToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// LLMRequest is a provider independent chat completion request
+type LLMRequest struct {
+	Model       string // Empty means the provider default
+	Messages    []LLMMessage
+	Tools       []LLMTool // Empty disables function calling
+	MaxTokens   int
+	Temperature float32
+}
+
+// LLMResponse is the completion plus who served it
+type LLMResponse struct {
+	Content          string
+	ToolCalls        []LLMToolCall // Set when the model asks for tools instead of answering
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Cached           bool // Served by the response cache (see llm_cache.go), no tokens were used
+}
+
+// LLMProvider is a chat completion backend
+type LLMProvider interface {
+	Name() string
+	DefaultModel() string
+	Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+}
+
+// TranscriptionRequest is audio to turn into text
+type TranscriptionRequest struct {
+	Model    string // Empty means the provider default speech model
+	Audio    []byte
+	FileName string // Tells the endpoint the audio format, e.g. voice.ogg
+	Language string // ISO-639-1 hint, e.g. "fa"
+}
+
+// TranscriptionResponse is the transcript plus who served it
+type TranscriptionResponse struct {
+	Text            string
+	DurationSeconds float64 // 0 when the provider does not report it
+	Provider        string
+	Model           string
+}
+
+// Transcriber is implemented by providers with a Whisper-compatible speech-to-text endpoint
+type Transcriber interface {
+	Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error)
+}
+
+// LLMStreamer is implemented by providers that can stream tokens as they are generated.
+// onDelta is called for every chunk; returning an error from it aborts the stream.
+type LLMStreamer interface {
+	Stream(ctx context.Context, req LLMRequest, onDelta func(string) error) (*LLMResponse, error)
+}
+
+// LLMError is a provider failure with the HTTP status when there was one
+type LLMError struct {
+	Provider   string
+	StatusCode int
+	Err        error
+}
+
+func (e *LLMError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: status %d: %v", e.Provider, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *LLMError) Unwrap() error {
+	return e.Err
+}
+
+// isRateLimited reports whether err is a 429 from a provider
+func isRateLimited(err error) bool {
+	var llmErr *LLMError
+	return errors.As(err, &llmErr) && llmErr.StatusCode == http.StatusTooManyRequests
+}
+
+// isRetryableLLMError reports whether a request that failed with err may succeed later: a
+// timeout, a 5xx or a 429 from a provider. Anything else would fail the same way again.
+func isRetryableLLMError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var llmErr *LLMError
+	return errors.As(err, &llmErr) && (llmErr.StatusCode == http.StatusTooManyRequests || llmErr.StatusCode >= 500)
+}
+
+// ==========================================
+// OpenAI-compatible provider (Groq, OpenAI, vLLM, ...)
+// ==========================================
+
+type openAICompatibleProvider struct {
+	name               string
+	client             *openai.Client
+	defaultModel       string
+	transcriptionModel string // Empty when the API has no audio endpoint
+}
+
+// newOpenAICompatibleProvider creates a provider for any API that speaks the OpenAI chat completions protocol
+func newOpenAICompatibleProvider(name, baseURL, apiKey, defaultModel string) *openAICompatibleProvider {
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+
+	return &openAICompatibleProvider{
+		name:         name,
+		client:       openai.NewClientWithConfig(config),
+		defaultModel: defaultModel,
+	}
+}
+
+// newGroqProvider creates the Groq provider
+func newGroqProvider(apiKey string) *openAICompatibleProvider {
+	provider := newOpenAICompatibleProvider(ProviderGroq, "https://api.groq.com/openai/v1", apiKey, "llama-3.3-70b-versatile")
+	provider.transcriptionModel = "whisper-large-v3-turbo"
+	return provider
+}
+
+func (p *openAICompatibleProvider) Name() string {
+	return p.name
+}
+
+func (p *openAICompatibleProvider) DefaultModel() string {
+	return p.defaultModel
+}
+
+// openAIMessages converts messages to the go-openai format
+func openAIMessages(msgs []LLMMessage) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		message := openai.ChatCompletionMessage{Role: msg.Role, Content: msg.Content, ToolCallID: msg.ToolCallID}
+		for _, call := range msg.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:       call.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// openAITools converts tools to the go-openai format, nil when there are none
+func openAITools(tools []LLMTool) []openai.Tool {
+	var result []openai.Tool
+	for _, tool := range tools {
+		result = append(result, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return result
+}
+
+func (p *openAICompatibleProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       model,
+		Messages:    openAIMessages(req.Messages),
+		Tools:       openAITools(req.Tools),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	})
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, &LLMError{Provider: p.name, Err: errors.New("no choices in response")}
+	}
+
+	result := &LLMResponse{
+		Content:          resp.Choices[0].Message.Content,
+		Provider:         p.name,
+		Model:            model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}
+	for _, call := range resp.Choices[0].Message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, LLMToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return result, nil
+}
+
+func (p *openAICompatibleProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string) error) (*LLMResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+		Model:         model,
+		Messages:      openAIMessages(req.Messages),
+		Tools:         openAITools(req.Tools),
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	})
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	defer stream.Close()
+
+	result := &LLMResponse{Provider: p.name, Model: model}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, p.wrapError(err)
+		}
+
+		if chunk.Usage != nil {
+			result.PromptTokens = chunk.Usage.PromptTokens
+			result.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		for _, call := range chunk.Choices[0].Delta.ToolCalls {
+			result.ToolCalls = appendToolCallDelta(result.ToolCalls, call)
+		}
+		if chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+// appendToolCallDelta merges one streamed tool call fragment: the first fragment of a call
+// carries its id and name, later ones append arguments. Some providers leave out the index,
+// then a fragment with a new id starts a call and any other continues the last one.
+func appendToolCallDelta(calls []LLMToolCall, delta openai.ToolCall) []LLMToolCall {
+	index := len(calls) - 1
+	switch {
+	case delta.Index != nil:
+		index = *delta.Index
+	case index < 0 || (delta.ID != "" && calls[index].ID != "" && calls[index].ID != delta.ID):
+		index = len(calls)
+	}
+	if index < 0 {
+		return calls
+	}
+
+	for index >= len(calls) {
+		calls = append(calls, LLMToolCall{})
+	}
+	if delta.ID != "" {
+		calls[index].ID = delta.ID
+	}
+	calls[index].Name += delta.Function.Name
+	calls[index].Arguments += delta.Function.Arguments
+	return calls
+}
+
+// Transcribe sends audio to the /audio/transcriptions endpoint
+func (p *openAICompatibleProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.transcriptionModel
+	}
+	if model == "" {
+		return nil, &LLMError{Provider: p.name, Err: errors.New("no transcription model configured")}
+	}
+
+	resp, err := p.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    model,
+		FilePath: req.FileName,
+		Reader:   bytes.NewReader(req.Audio),
+		Language: req.Language,
+		Format:   openai.AudioResponseFormatVerboseJSON,
+	})
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	return &TranscriptionResponse{
+		Text:            strings.TrimSpace(resp.Text),
+		DurationSeconds: resp.Duration,
+		Provider:        p.name,
+		Model:           model,
+	}, nil
+}
+
+// wrapError converts go-openai errors into LLMError keeping the HTTP status
+func (p *openAICompatibleProvider) wrapError(err error) error {
+	llmErr := &LLMError{Provider: p.name, Err: err}
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	if errors.As(err, &apiErr) {
+		llmErr.StatusCode = apiErr.HTTPStatusCode
+	} else if errors.As(err, &reqErr) {
+		llmErr.StatusCode = reqErr.HTTPStatusCode
+	}
+	return llmErr
+}
+
+// ==========================================
+// Ollama provider (local models)
+// ==========================================
+
+type ollamaProvider struct {
+	baseURL      string
+	defaultModel string
+	httpClient   *http.Client
+}
+
+// newOllamaProvider creates a provider for a local Ollama server (native /api/chat)
+func newOllamaProvider(baseURL, defaultModel string) *ollamaProvider {
+	return &ollamaProvider{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		defaultModel: defaultModel,
+		httpClient:   &http.Client{Timeout: 300 * time.Second}, // Local models on CPU are slow
+	}
+}
+
+func (p *ollamaProvider) Name() string {
+	return ProviderOllama
+}
+
+func (p *ollamaProvider) DefaultModel() string {
+	return p.defaultModel
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// ollamaToolCall is a function call; Ollama sends arguments as an object and no call id
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// toolCalls converts the calls of a response, numbering them from first since Ollama has no ids
+func (m ollamaMessage) toolCalls(first int) []LLMToolCall {
+	var calls []LLMToolCall
+	for i, call := range m.ToolCalls {
+		args := string(call.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		calls = append(calls, LLMToolCall{ID: fmt.Sprintf("call_%d", first+i), Name: call.Function.Name, Arguments: args})
+	}
+	return calls
+}
+
+// ollamaChunk is the /api/chat response (one per line when streaming)
+type ollamaChunk struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// post sends req to /api/chat and returns the response when the status is 200
+func (p *ollamaProvider) post(ctx context.Context, req LLMRequest, model string, stream bool) (*http.Response, error) {
+	messages := make([]ollamaMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		message := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		for _, call := range msg.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = json.RawMessage(call.Arguments)
+			if !json.Valid(tc.Function.Arguments) {
+				tc.Function.Arguments = json.RawMessage("{}")
+			}
+			message.ToolCalls = append(message.ToolCalls, tc)
+		}
+		messages = append(messages, message)
+	}
+
+	payload := map[string]interface{}{
+		"model":    model,
+		"messages": messages,
+		"stream":   stream,
+		"options": map[string]interface{}{
+			"num_predict": req.MaxTokens,
+			"temperature": req.Temperature,
+		},
+	}
+	if tools := openAITools(req.Tools); len(tools) > 0 {
+		payload["tools"] = tools // Ollama accepts the OpenAI tool format
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, &LLMError{Provider: ProviderOllama, Err: err}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, &LLMError{Provider: ProviderOllama, Err: err}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, &LLMError{Provider: ProviderOllama, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &LLMError{Provider: ProviderOllama, StatusCode: resp.StatusCode, Err: errors.New(strings.TrimSpace(string(respBody)))}
+	}
+	return resp, nil
+}
+
+func (p *ollamaProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	resp, err := p.post(ctx, req, model, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ollamaChunk
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, &LLMError{Provider: ProviderOllama, StatusCode: resp.StatusCode, Err: err}
+	}
+
+	return &LLMResponse{
+		Content:          result.Message.Content,
+		ToolCalls:        result.Message.toolCalls(0),
+		Provider:         ProviderOllama,
+		Model:            model,
+		PromptTokens:     result.PromptEvalCount,
+		CompletionTokens: result.EvalCount,
+	}, nil
+}
+
+func (p *ollamaProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string) error) (*LLMResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	resp, err := p.post(ctx, req, model, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &LLMResponse{Provider: ProviderOllama, Model: model}
+	var content strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaChunk
+		if err := decoder.Decode(&chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, &LLMError{Provider: ProviderOllama, StatusCode: resp.StatusCode, Err: err}
+		}
+
+		result.ToolCalls = append(result.ToolCalls, chunk.Message.toolCalls(len(result.ToolCalls))...)
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if err := onDelta(chunk.Message.Content); err != nil {
+				return nil, err
+			}
+		}
+		if chunk.Done {
+			result.PromptTokens = chunk.PromptEvalCount
+			result.CompletionTokens = chunk.EvalCount
+			break
+		}
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+// ==========================================
+// Router: per-feature models and fallback chain
+// ==========================================
+
+// LLMRouter sends each request to the first healthy provider of an ordered chain
+type LLMRouter struct {
+	providers []LLMProvider
+	// models[feature][provider] overrides the provider default model
+	models        map[string]map[string]string
+	cooldownUntil map[string]time.Time
+	mu            sync.Mutex
+	cache         *LLMCache // nil disables caching
+}
+
+// NewLLMRouter creates a router over providers in fallback order
+func NewLLMRouter(providers []LLMProvider, models map[string]map[string]string) *LLMRouter {
+	if models == nil {
+		models = make(map[string]map[string]string)
+	}
+	return &LLMRouter{
+		providers:     providers,
+		models:        models,
+		cooldownUntil: make(map[string]time.Time),
+	}
+}
+
+// Providers returns the provider names in fallback order
+func (r *LLMRouter) Providers() []string {
+	names := make([]string, 0, len(r.providers))
+	for _, provider := range r.providers {
+		names = append(names, provider.Name())
+	}
+	return names
+}
+
+// modelFor returns the configured model of a feature on a provider ("" = provider default)
+func (r *LLMRouter) modelFor(feature, provider string) string {
+	byProvider := r.models[feature]
+	if model, ok := byProvider[provider]; ok {
+		return model
+	}
+	return byProvider["*"]
+}
+
+// chain returns the providers to try, skipping rate-limited ones unless nothing else is left
+func (r *LLMRouter) chain(now time.Time) []LLMProvider {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	available := make([]LLMProvider, 0, len(r.providers))
+	for _, provider := range r.providers {
+		if now.Before(r.cooldownUntil[provider.Name()]) {
+			continue
+		}
+		available = append(available, provider)
+	}
+	if len(available) == 0 {
+		return r.providers
+	}
+	return available
+}
+
+// SetCache puts cache in front of the providers for the features it is enabled for
+func (r *LLMRouter) SetCache(cache *LLMCache) {
+	r.cache = cache
+}
+
+// cacheKey returns the response cache key of req for feature
+func (r *LLMRouter) cacheKey(feature string, req LLMRequest) string {
+	models := make([]string, 0, len(r.providers))
+	for _, provider := range r.providers {
+		model := r.modelFor(feature, provider.Name())
+		if model == "" {
+			model = provider.DefaultModel()
+		}
+		models = append(models, provider.Name()+"="+model)
+	}
+	return llmCacheKey(feature, models, req)
+}
+
+// Complete runs req for a feature, falling back to the next provider on any error.
+// Features with caching enabled are answered from the cache when possible.
+func (r *LLMRouter) Complete(ctx context.Context, feature string, req LLMRequest) (*LLMResponse, error) {
+	if r.cache.enabled(feature) {
+		return r.cache.do(ctx, feature, r.cacheKey(feature, req), func(ctx context.Context) (*LLMResponse, error) {
+			return r.complete(ctx, feature, req)
+		})
+	}
+	return r.complete(ctx, feature, req)
+}
+
+// complete runs req on the provider chain
+func (r *LLMRouter) complete(ctx context.Context, feature string, req LLMRequest) (*LLMResponse, error) {
+	if len(r.providers) == 0 {
+		return nil, errors.New("no LLM provider configured")
+	}
+
+	var lastErr error
+	for i, provider := range r.chain(time.Now()) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		attempt := req
+		attempt.Model = r.modelFor(feature, provider.Name())
+
+		start := time.Now()
+		resp, err := provider.Complete(ctx, attempt)
+		if err == nil {
+			metrics.ObserveLLMRequest(provider.Name(), resp.Model, feature, "success", time.Since(start))
+			if i > 0 {
+				metrics.IncLLMFallback(feature)
+			}
+			return resp, nil
+		}
+
+		lastErr = err
+		result := "error"
+		if isRateLimited(err) {
+			result = "rate_limited"
+			r.mu.Lock()
+			r.cooldownUntil[provider.Name()] = time.Now().Add(RateLimitCooldown)
+			r.mu.Unlock()
+		}
+		metrics.ObserveLLMRequest(provider.Name(), attempt.Model, feature, result, time.Since(start))
+
+		logger.Warn("LLM provider failed, trying next provider",
+			zap.String("provider", provider.Name()),
+			zap.String("model", attempt.Model),
+			zap.String("feature", feature),
+			zap.String("outcome", result),
+			zap.Error(err))
+	}
+
+	if lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	return nil, fmt.Errorf("all LLM providers failed: %w", lastErr)
+}
+
+// Stream runs req for a feature and forwards chunks to onDelta. It falls back to the next
+// provider only while nothing has been sent, a failure mid-stream is returned as is.
+// Providers without streaming support answer in a single chunk. A cached answer is sent as
+// one chunk; streams are cached but not coalesced.
+func (r *LLMRouter) Stream(ctx context.Context, feature string, req LLMRequest, onDelta func(string) error) (*LLMResponse, error) {
+	if !r.cache.enabled(feature) {
+		return r.stream(ctx, feature, req, onDelta)
+	}
+
+	key := r.cacheKey(feature, req)
+	if !llmCacheBypassed(ctx) {
+		if resp, ok := r.cache.get(key, time.Now()); ok {
+			metrics.IncLLMCache(feature, "hit")
+			if err := onDelta(resp.Content); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+	metrics.IncLLMCache(feature, "miss")
+	resp, err := r.stream(ctx, feature, req, onDelta)
+	if err == nil {
+		r.cache.put(key, resp, time.Now())
+	}
+	return resp, err
+}
+
+// stream runs req on the provider chain
+func (r *LLMRouter) stream(ctx context.Context, feature string, req LLMRequest, onDelta func(string) error) (*LLMResponse, error) {
+	if len(r.providers) == 0 {
+		return nil, errors.New("no LLM provider configured")
+	}
+
+	var lastErr error
+	for i, provider := range r.chain(time.Now()) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		attempt := req
+		attempt.Model = r.modelFor(feature, provider.Name())
+
+		started := false
+		forward := func(delta string) error {
+			started = true
+			return onDelta(delta)
+		}
+
+		start := time.Now()
+		var resp *LLMResponse
+		var err error
+		if streamer, ok := provider.(LLMStreamer); ok {
+			resp, err = streamer.Stream(ctx, attempt, forward)
+		} else if resp, err = provider.Complete(ctx, attempt); err == nil {
+			err = forward(resp.Content)
+		}
+		if err == nil {
+			metrics.ObserveLLMRequest(provider.Name(), resp.Model, feature, "success", time.Since(start))
+			if i > 0 {
+				metrics.IncLLMFallback(feature)
+			}
+			return resp, nil
+		}
+
+		lastErr = err
+		result := "error"
+		if ctx.Err() != nil {
+			result = "cancelled"
+		} else if isRateLimited(err) {
+			result = "rate_limited"
+			r.mu.Lock()
+			r.cooldownUntil[provider.Name()] = time.Now().Add(RateLimitCooldown)
+			r.mu.Unlock()
+		}
+		metrics.ObserveLLMRequest(provider.Name(), attempt.Model, feature, result, time.Since(start))
+
+		if started || ctx.Err() != nil {
+			return nil, err
+		}
+
+		logger.Warn("LLM provider failed to stream, trying next provider",
+			zap.String("provider", provider.Name()),
+			zap.String("model", attempt.Model),
+			zap.String("feature", feature),
+			zap.String("outcome", result),
+			zap.Error(err))
+	}
+
+	if lastErr == nil {
+		lastErr = ctx.Err()
+	}
+	return nil, fmt.Errorf("all LLM providers failed: %w", lastErr)
+}
+
+// Transcribe runs req on the first provider that supports speech-to-text, falling back to
+// the next one on any error
+func (r *LLMRouter) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	var lastErr error
+	for _, provider := range r.chain(time.Now()) {
+		transcriber, ok := provider.(Transcriber)
+		if !ok || ctx.Err() != nil {
+			continue
+		}
+
+		attempt := req
+		attempt.Model = r.modelFor(FeatureTranscription, provider.Name())
+
+		start := time.Now()
+		resp, err := transcriber.Transcribe(ctx, attempt)
+		if err == nil {
+			metrics.ObserveLLMRequest(provider.Name(), resp.Model, FeatureTranscription, "success", time.Since(start))
+			return resp, nil
+		}
+
+		lastErr = err
+		result := "error"
+		if isRateLimited(err) {
+			result = "rate_limited"
+			r.mu.Lock()
+			r.cooldownUntil[provider.Name()] = time.Now().Add(RateLimitCooldown)
+			r.mu.Unlock()
+		}
+		metrics.ObserveLLMRequest(provider.Name(), attempt.Model, FeatureTranscription, result, time.Since(start))
+
+		logger.Warn("Transcription provider failed, trying next provider",
+			zap.String("provider", provider.Name()),
+			zap.String("model", attempt.Model),
+			zap.String("outcome", result),
+			zap.Error(err))
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no transcription provider configured")
+	}
+	return nil, fmt.Errorf("all transcription providers failed: %w", lastErr)
+}
+
+// ==========================================
+// Configuration
+// ==========================================
+
+// newLLMRouterFromEnv builds the router from:
+//
+//	LLM_PROVIDERS              fallback chain, e.g. "groq,openai,ollama" (default "groq")
+//	GROQ_API_KEY               Groq
+//	LLM_OPENAI_BASE_URL        OpenAI-compatible API (default https://api.openai.com/v1)
+//	LLM_OPENAI_API_KEY, LLM_OPENAI_MODEL
+//	LLM_OPENAI_TRANSCRIPTION_MODEL  speech-to-text model of the OpenAI-compatible API (default whisper-1)
+//	OLLAMA_BASE_URL            default http://localhost:11434
+//	OLLAMA_MODEL               default llama3.1
+//	LLM_MODEL_<FEATURE>        per-feature models: "groq=llama-3.1-8b-instant,ollama=qwen2.5:7b" or a bare model for all providers
+//	LLM_CACHE_*                response cache, see newLLMCacheFromEnv
+func newLLMRouterFromEnv() *LLMRouter {
+	chain := os.Getenv("LLM_PROVIDERS")
+	if chain == "" {
+		chain = ProviderGroq
+	}
+
+	var providers []LLMProvider
+	for _, name := range strings.Split(chain, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case ProviderGroq:
+			apiKey := os.Getenv("GROQ_API_KEY")
+			if apiKey == "" {
+				logger.Error("GROQ_API_KEY environment variable not set, skipping Groq provider")
+				continue
+			}
+			providers = append(providers, newGroqProvider(apiKey))
+		case ProviderOpenAI:
+			apiKey := os.Getenv("LLM_OPENAI_API_KEY")
+			if apiKey == "" {
+				logger.Error("LLM_OPENAI_API_KEY environment variable not set, skipping OpenAI-compatible provider")
+				continue
+			}
+			provider := newOpenAICompatibleProvider(ProviderOpenAI,
+				envOrDefault("LLM_OPENAI_BASE_URL", "https://api.openai.com/v1"),
+				apiKey,
+				envOrDefault("LLM_OPENAI_MODEL", "gpt-4o-mini"))
+			provider.transcriptionModel = envOrDefault("LLM_OPENAI_TRANSCRIPTION_MODEL", openai.Whisper1)
+			providers = append(providers, provider)
+		case ProviderOllama:
+			providers = append(providers, newOllamaProvider(
+				envOrDefault("OLLAMA_BASE_URL", "http://localhost:11434"),
+				envOrDefault("OLLAMA_MODEL", "llama3.1")))
+		case ProviderFake:
+			providers = append(providers, NewFakeLLMProvider(ProviderFake))
+		default:
+			logger.Error("Unknown LLM provider in LLM_PROVIDERS", zap.String("provider", name))
+		}
+	}
+
+	models := make(map[string]map[string]string)
+	features := append([]string{FeatureChat, FeatureExerciseEvaluation, FeatureChatSummary, FeatureTranscription, FeatureModeration}, toolFeatures()...)
+	for _, feature := range features {
+		if value := os.Getenv("LLM_MODEL_" + strings.ToUpper(feature)); value != "" {
+			models[feature] = parseFeatureModels(value)
+		}
+	}
+
+	router := NewLLMRouter(providers, models)
+	router.SetCache(newLLMCacheFromEnv())
+	return router
+}
+
+// parseFeatureModels parses "provider=model,..." where a bare model applies to every provider ("*")
+func parseFeatureModels(value string) map[string]string {
+	byProvider := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if provider, model, ok := strings.Cut(entry, "="); ok {
+			byProvider[strings.ToLower(strings.TrimSpace(provider))] = strings.TrimSpace(model)
+		} else {
+			byProvider["*"] = entry
+		}
+	}
+	return byProvider
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
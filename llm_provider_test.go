@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MonetizeeAI_bot/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestLLMRouterFallsBackAndRecordsProvider asserts a 429 moves the request to the next provider,
+// cools the limited provider down and that per-feature models reach the provider.
+func TestLLMRouterFallsBackAndRecordsProvider(t *testing.T) {
+	primary := NewFakeLLMProvider("primary").
+		FailWith(&LLMError{Provider: "primary", StatusCode: http.StatusTooManyRequests, Err: errors.New("rate limited")})
+	backup := NewFakeLLMProvider("backup", "first answer", "second answer")
+
+	router := NewLLMRouter([]LLMProvider{primary, backup}, map[string]map[string]string{
+		FeatureChat: parseFeatureModels("primary=big-model,small-model"),
+	})
+
+	req := LLMRequest{Messages: []LLMMessage{{Role: "user", Content: "سلام"}}}
+
+	resp, err := router.Complete(context.Background(), FeatureChat, req)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Content != "first answer" || resp.Provider != "backup" || resp.Model != "small-model" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if calls := primary.Calls(); len(calls) != 1 || calls[0].Model != "big-model" {
+		t.Fatalf("primary should have been called once with big-model, got %+v", calls)
+	}
+
+	// The rate-limited provider is skipped while cooling down
+	if _, err := router.Complete(context.Background(), FeatureChat, req); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if len(primary.Calls()) != 1 {
+		t.Error("rate-limited provider should be skipped during cooldown")
+	}
+
+	// Features without a configured model use the provider default
+	resp, err = router.Complete(context.Background(), FeatureSalesPath, req)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Model != "fake-model" {
+		t.Errorf("expected provider default model, got %q", resp.Model)
+	}
+}
+
+// TestLLMRouterFallbackLogSurvivesRedaction asserts the fallback log line keeps its provider,
+// model, feature and outcome through the PII redaction of the production logger.
+func TestLLMRouterFallbackLogSurvivesRedaction(t *testing.T) {
+	observed, logs := observer.New(zapcore.WarnLevel)
+	previous := logger.Log
+	logger.Log = zap.New(logger.NewRedactingCore(observed))
+	defer func() { logger.Log = previous }()
+
+	router := NewLLMRouter([]LLMProvider{
+		NewFakeLLMProvider("primary").FailWith(&LLMError{Provider: "primary", StatusCode: http.StatusTooManyRequests, Err: errors.New("rate limited")}),
+		NewFakeLLMProvider("backup", "answer"),
+	}, map[string]map[string]string{FeatureChat: {"*": "chat-model"}})
+	if _, err := router.Complete(context.Background(), FeatureChat, LLMRequest{}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	entries := logs.FilterMessage("LLM provider failed, trying next provider").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one fallback log line, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	for key, want := range map[string]string{"provider": "primary", "model": "chat-model", "feature": FeatureChat, "outcome": "rate_limited"} {
+		if got := fields[key]; got != want {
+			t.Errorf("%s: expected %q, got %v", key, want, got)
+		}
+	}
+}
+
+// TestLLMRouterAllProvidersFail asserts the last provider error is returned when the chain is exhausted.
+func TestLLMRouterAllProvidersFail(t *testing.T) {
+	router := NewLLMRouter([]LLMProvider{
+		NewFakeLLMProvider("a").FailWith(errors.New("down")),
+		NewFakeLLMProvider("b").FailWith(&LLMError{Provider: "b", StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}),
+	}, nil)
+
+	_, err := router.Complete(context.Background(), FeatureExerciseEvaluation, LLMRequest{})
+	var llmErr *LLMError
+	if !errors.As(err, &llmErr) || llmErr.Provider != "b" {
+		t.Fatalf("expected the error of provider b, got %v", err)
+	}
+}
+
+// TestLLMRouterStreamSanitizesAcrossChunks asserts streaming falls back before the first chunk
+// and that incremental sanitizing matches sanitizePersianText even when a rune is split.
+func TestLLMRouterStreamSanitizesAcrossChunks(t *testing.T) {
+	answer := "سلام  مانیتایزر 你好 عزیز!"
+	router := NewLLMRouter([]LLMProvider{
+		NewFakeLLMProvider("down").FailWith(errors.New("connection refused")),
+		NewFakeLLMProvider("up", answer),
+	}, nil)
+
+	var sanitizer persianSanitizer
+	var streamed string
+	resp, err := router.Stream(context.Background(), FeatureChat, LLMRequest{}, func(delta string) error {
+		// Split every chunk inside its first multi-byte rune
+		raw := []byte(delta)
+		streamed += sanitizer.Write(string(raw[:1]))
+		streamed += sanitizer.Write(string(raw[1:]))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if resp.Provider != "up" {
+		t.Errorf("expected fallback provider, got %q", resp.Provider)
+	}
+	if want := sanitizePersianText(answer); streamed != want {
+		t.Errorf("streamed %q, want %q", streamed, want)
+	}
+}
+
+// TestLLMRouterTranscribe asserts transcription falls back like completions and uses the
+// per-feature model.
+func TestLLMRouterTranscribe(t *testing.T) {
+	primary := NewFakeLLMProvider("primary").
+		FailWith(&LLMError{Provider: "primary", StatusCode: http.StatusTooManyRequests, Err: errors.New("rate limited")})
+	backup := NewFakeLLMProvider("backup", "سلام، تمرین من آماده است")
+
+	router := NewLLMRouter([]LLMProvider{primary, backup}, map[string]map[string]string{
+		FeatureTranscription: parseFeatureModels("backup=whisper-large-v3"),
+	})
+
+	resp, err := router.Transcribe(context.Background(), TranscriptionRequest{Audio: []byte("ogg"), FileName: "voice.ogg", Language: "fa"})
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if resp.Text != "سلام، تمرین من آماده است" || resp.Provider != "backup" || resp.Model != "whisper-large-v3" {
+		t.Fatalf("unexpected transcription %+v", resp)
+	}
+	if got := backup.Transcriptions(); len(got) != 1 || got[0].Language != "fa" || string(got[0].Audio) != "ogg" {
+		t.Errorf("backup should receive the audio once, got %+v", got)
+	}
+	if len(primary.Calls()) != 0 {
+		t.Error("transcription should not be sent as a completion")
+	}
+}
+
+// TestOpenAIStreamAssemblesToolCalls streams tool call fragments without an index, as some
+// OpenAI-compatible providers send them, and with one, and checks no call is dropped.
+func TestOpenAIStreamAssemblesToolCalls(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []LLMToolCall
+	}{
+		{
+			name: "without index",
+			chunks: []string{
+				`{"id":"call_1","type":"function","function":{"name":"search_course","arguments":""}}`,
+				`{"function":{"arguments":"{\"query\":"}}`,
+				`{"function":{"arguments":"\"seo\"}"}}`,
+				`{"id":"call_2","type":"function","function":{"name":"get_progress","arguments":"{}"}}`,
+			},
+			want: []LLMToolCall{
+				{ID: "call_1", Name: "search_course", Arguments: `{"query":"seo"}`},
+				{ID: "call_2", Name: "get_progress", Arguments: "{}"},
+			},
+		},
+		{
+			name: "with index",
+			chunks: []string{
+				`{"index":0,"id":"call_1","type":"function","function":{"name":"search_course","arguments":"{\"query\""}}`,
+				`{"index":1,"id":"call_2","type":"function","function":{"name":"get_progress","arguments":"{}"}}`,
+				`{"index":0,"function":{"arguments":":\"seo\"}"}}`,
+			},
+			want: []LLMToolCall{
+				{ID: "call_1", Name: "search_course", Arguments: `{"query":"seo"}`},
+				{ID: "call_2", Name: "get_progress", Arguments: "{}"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, call := range tt.chunks {
+					fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[%s]}}]}\n\n", call)
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+
+			provider := newOpenAICompatibleProvider("test", server.URL, "key", "model")
+			resp, err := provider.Stream(context.Background(), LLMRequest{}, func(string) error { return nil })
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			if len(resp.ToolCalls) != len(tt.want) {
+				t.Fatalf("got %d tool calls, want %d: %+v", len(resp.ToolCalls), len(tt.want), resp.ToolCalls)
+			}
+			for i, call := range tt.want {
+				if resp.ToolCalls[i] != call {
+					t.Errorf("tool call %d is %+v, want %+v", i, resp.ToolCalls[i], call)
+				}
+			}
+		})
+	}
+}
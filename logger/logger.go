@@ -49,7 +49,23 @@ func InitLogger() {
 
 	// Create the logger with both cores
 	core := zapcore.NewTee(fileCore, consoleCore)
+
+	// Mask PII (phones, cards, secrets, message bodies) unless debug mode is explicitly enabled
+	redact := redactionEnabled()
+	if redact {
+		core = NewRedactingCore(core)
+	}
+
 	Log = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+
+	if !redact {
+		Log.Warn("PII redaction is disabled, logs contain sensitive data", zap.String("env", DebugPIIEnv))
+	}
+}
+
+// InitNopLogger initializes a logger that discards everything, for tests
+func InitNopLogger() {
+	Log = zap.NewNop()
 }
 
 // Sync flushes any buffered log entries
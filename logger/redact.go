@@ -0,0 +1,256 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DebugPIIEnv disables redaction when set to "true". Only for local debugging, never in production.
+const DebugPIIEnv = "LOG_DEBUG_PII"
+
+// redactionPolicy decides how the value of a field is masked
+type redactionPolicy int
+
+const (
+	policyPhone    redactionPolicy = iota // Keep the last 4 digits
+	policyCard                            // Keep the first 6 and last 4 digits
+	policySecret                          // Keep the first 4 characters
+	policyBody                            // Drop the content, keep the length
+	policyUsername                        // Keep the first 2 characters
+)
+
+// fieldPolicies maps field keys to their redaction policy.
+// Fields not listed here are still scanned for phone numbers and card numbers.
+var fieldPolicies = map[string]redactionPolicy{
+	// Phone numbers
+	"phone":        policyPhone,
+	"phone_number": policyPhone,
+	"mobile":       policyPhone,
+	"recipient":    policyPhone,
+	"to":           policyPhone,
+
+	// Card data
+	"card":        policyCard,
+	"card_pan":    policyCard,
+	"card_number": policyCard,
+
+	// Secrets
+	"license":       policySecret,
+	"license_key":   policySecret,
+	"token":         policySecret,
+	"cookie_token":  policySecret,
+	"session_token": policySecret,
+	"password":      policySecret,
+	"api_key":       policySecret,
+	"authorization": policySecret,
+
+	// Message bodies and upstream payloads
+	"message":          policyBody,
+	"text":             policyBody,
+	"body":             policyBody,
+	"request_body":     policyBody,
+	"response":         policyBody,
+	"raw_response":     policyBody,
+	"clean_response":   policyBody,
+	"fixed_response":   policyBody,
+	"response_preview": policyBody,
+	"error_response":   policyBody,
+	"matched_text":     policyBody,
+	"original":         policyBody,
+	"feedback":         policyBody,
+	"line":             policyBody,
+	"prompt":           policyBody,
+	"content":          policyBody,
+	"result":           policyBody,
+	"choice":           policyBody,
+
+	// Usernames
+	"username":       policyUsername,
+	"admin_username": policyUsername,
+}
+
+var (
+	// Iranian mobile numbers with a 0, 98, +98 or 0098 prefix
+	phonePattern = regexp.MustCompile(`(?:\+98|\b0098|\b98|\b0)9\d{9}\b`)
+	// 16 digit card numbers, optionally grouped by spaces or dashes
+	cardPattern = regexp.MustCompile(`\b\d{4}[- ]?\d{4}[- ]?\d{4}[- ]?\d{4}\b`)
+)
+
+// redactionEnabled reports whether PII must be masked (true unless debug mode is explicitly on)
+func redactionEnabled() bool {
+	return strings.ToLower(os.Getenv(DebugPIIEnv)) != "true"
+}
+
+// redactingCore wraps a zapcore.Core and masks sensitive fields before they are encoded
+type redactingCore struct {
+	zapcore.Core
+}
+
+// NewRedactingCore wraps core with the redaction layer (used by InitLogger and tests)
+func NewRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = redactText(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
+
+// redactFields returns a copy of fields with sensitive values masked
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = redactField(field)
+	}
+	return redacted
+}
+
+func redactField(field zapcore.Field) zapcore.Field {
+	policy, hasPolicy := fieldPolicies[strings.ToLower(field.Key)]
+
+	switch field.Type {
+	case zapcore.StringType:
+		if hasPolicy {
+			return zap.String(field.Key, applyPolicy(policy, field.String))
+		}
+		return zap.String(field.Key, redactText(field.String))
+
+	case zapcore.ByteStringType:
+		if value, ok := field.Interface.([]byte); ok {
+			if hasPolicy {
+				return zap.String(field.Key, applyPolicy(policy, string(value)))
+			}
+			return zap.String(field.Key, redactText(string(value)))
+		}
+
+	case zapcore.ErrorType:
+		// Errors often wrap upstream responses, so their text is scanned too
+		if err, ok := field.Interface.(error); ok && err != nil {
+			if text := err.Error(); redactText(text) != text {
+				return zap.String(field.Key, redactText(text))
+			}
+		}
+
+	case zapcore.ReflectType, zapcore.StringerType, zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		if !hasPolicy {
+			return field
+		}
+		// Phone lists (e.g. SMS recipients) stay readable, anything else is dropped
+		if policy == policyPhone {
+			if masked, ok := maskPhoneList(field); ok {
+				return zap.Strings(field.Key, masked)
+			}
+		}
+		return zap.String(field.Key, "[redacted]")
+	}
+
+	return field
+}
+
+// maskPhoneList masks a list of phone numbers logged with zap.Strings or zap.Any
+func maskPhoneList(field zapcore.Field) ([]string, bool) {
+	if field.Type != zapcore.ArrayMarshalerType {
+		return nil, false
+	}
+	array, ok := field.Interface.(zapcore.ArrayMarshaler)
+	if !ok {
+		return nil, false
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	if err := enc.AddArray("values", array); err != nil {
+		return nil, false
+	}
+	values, _ := enc.Fields["values"].([]interface{})
+
+	masked := make([]string, 0, len(values))
+	for _, value := range values {
+		text, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		masked = append(masked, maskPhone(text))
+	}
+	return masked, true
+}
+
+// applyPolicy masks a value according to its field policy
+func applyPolicy(policy redactionPolicy, value string) string {
+	if value == "" {
+		return value
+	}
+
+	switch policy {
+	case policyPhone:
+		return maskPhone(value)
+	case policyCard:
+		return maskCard(value)
+	case policySecret:
+		return keepPrefix(value, 4)
+	case policyBody:
+		return fmt.Sprintf("[redacted %d chars]", utf8.RuneCountInString(value))
+	case policyUsername:
+		return keepPrefix(value, 2)
+	}
+	return value
+}
+
+// redactText masks phone numbers and card numbers found anywhere in free text
+func redactText(text string) string {
+	text = cardPattern.ReplaceAllStringFunc(text, maskCard)
+	return phonePattern.ReplaceAllStringFunc(text, maskPhone)
+}
+
+// maskPhone keeps the last 4 digits of a phone number
+func maskPhone(phone string) string {
+	digits := onlyDigits(phone)
+	if len(digits) <= 4 {
+		return strings.Repeat("*", len(digits))
+	}
+	return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+}
+
+// maskCard keeps the first 6 and last 4 digits of a card number
+func maskCard(card string) string {
+	digits := onlyDigits(card)
+	if len(digits) < 12 {
+		return strings.Repeat("*", len(digits))
+	}
+	return digits[:6] + strings.Repeat("*", len(digits)-10) + digits[len(digits)-4:]
+}
+
+// keepPrefix keeps the first n characters and hides the rest
+func keepPrefix(value string, n int) string {
+	runes := []rune(value)
+	if len(runes) <= n {
+		return "***"
+	}
+	return string(runes[:n]) + "***"
+}
+
+func onlyDigits(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestRedactingCoreMasksPII asserts policy fields and free text are masked before encoding.
+func TestRedactingCoreMasksPII(t *testing.T) {
+	observed, logs := observer.New(zapcore.InfoLevel)
+	log := zap.New(NewRedactingCore(observed)).With(zap.String("phone", "09123456789"))
+
+	log.Info("payment from 6037991234567890",
+		zap.String("message", "my card is 6037-9912-3456-7890"),
+		zap.String("license_key", "abcdef123456"),
+		zap.Strings("to", []string{"09121112222"}),
+		zap.String("query", "mobile=+989121112222"),
+		zap.Error(errors.New("upstream said 09121112222")),
+		zap.Int64("user_id", 76599340))
+
+	entry := logs.All()[0]
+	if strings.Contains(entry.Message, "1234567890") {
+		t.Errorf("card number not masked in message: %q", entry.Message)
+	}
+
+	fields := entry.ContextMap()
+	expected := map[string]interface{}{
+		"phone":       "*******6789",
+		"message":     "[redacted 30 chars]",
+		"license_key": "abcd***",
+		"query":       "mobile=********2222",
+		"error":       "upstream said *******2222",
+		"user_id":     int64(76599340),
+	}
+	for key, want := range expected {
+		if got := fields[key]; got != want {
+			t.Errorf("%s: expected %v, got %v", key, want, got)
+		}
+	}
+	if to, ok := fields["to"].([]interface{}); !ok || len(to) != 1 || to[0] != "*******2222" {
+		t.Errorf("to: expected masked phone list, got %v", fields["to"])
+	}
+}
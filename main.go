@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"MonetizeeAI_bot/fieldcrypt"
 	"MonetizeeAI_bot/logger"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -39,15 +40,15 @@ func shouldLoadDotEnvStrict() bool {
 	return true
 }
 
-// isTestMode returns true when running under go test (skip DB/Groq init).
+// isTestMode returns true when running under go test (skip DB/AI init).
 func isTestMode() bool {
 	return !shouldLoadDotEnvStrict()
 }
 
 var (
-	bot        *tgbotapi.BotAPI
-	db         *gorm.DB
-	groqClient *GroqClient
+	bot      *tgbotapi.BotAPI
+	db       *gorm.DB
+	aiClient *AIClient
 )
 
 func initDB() {
@@ -81,7 +82,8 @@ func initDB() {
 		&User{},
 		&Video{},
 		&Session{},
-		&Exercise{},
+		&ExerciseAssignment{},
+		&ExerciseSubmission{},
 		&UserSession{},
 		&Admin{},
 		&AdminAction{},
@@ -89,16 +91,48 @@ func initDB() {
 		&LicenseVerification{},
 		&License{},
 		&ChatMessage{},
+		&ChatThread{},
 		&PaymentTransaction{},
 		&Ticket{},
 		&TicketMessage{},
+		&Ban{},
+		&SecurityEvent{},
+		&DataErasure{},
+		&PromptTemplate{},
+		&PromptTemplateVersion{},
+		&AIUsage{},
+		&FAQEntry{},
+		&SessionRubric{},
+		&RubricCriterion{},
+		&QuizEvaluation{},
+		&ExerciseReview{},
+		&ToolResult{},
+		&AIJob{},
+		&AIRating{},
+		&ModerationRule{},
 	)
 	if err != nil {
 		logger.Fatal("Failed to migrate database", zap.Error(err))
 	} else {
-		logger.Info("Database migration completed successfully", zap.String("tables", "users, videos, sessions, exercises, admins, payment_transactions"))
+		logger.Info("Database migration completed successfully", zap.String("tables", "users, videos, sessions, exercise_assignments, exercise_submissions, admins, payment_transactions, bans, security_events, data_erasures"))
 	}
 
+	// 🔒 SECURITY: Move users blocked via the old IsBlocked flag into the bans table
+	migrateLegacyBlocks()
+
+	// 🔒 SECURITY: Index phones and emails of users saved before the blind indexes existed
+	backfillContactHashes()
+
+	// Put chat messages saved before threads existed into one thread per user
+	migrateLegacyChatThreads()
+
+	// Split the old exercises table into assignments and student submissions
+	migrateLegacyExercises()
+
+	// Store the built-in prompt templates as version 1 so they can be edited from the admin panel
+	seedPromptTemplates()
+	seedModerationRules()
+
 	// Verify database connection
 	if err := db.Raw("SELECT 1").Error; err != nil {
 		log.Fatal("Failed to verify database connection:", err)
@@ -117,6 +151,13 @@ func init() {
 		}
 	}
 
+	if isTestMode() {
+		// Skip DB and AI init so go test can run without .env or MySQL, and log nowhere so
+		// tests never write logs/bot.log into the working tree
+		logger.InitNopLogger()
+		return
+	}
+
 	// Create logs directory if it doesn't exist
 	if err := os.MkdirAll("logs", 0755); err != nil {
 		log.Fatalf("Failed to create logs directory: %v", err)
@@ -126,20 +167,22 @@ func init() {
 	logger.InitLogger()
 	defer logger.Sync()
 
-	if isTestMode() {
-		// Skip DB and Groq init so go test can run without .env or MySQL
-		return
+	// 🔒 SECURITY: Load field encryption keys before any user is read or written
+	if err := fieldcrypt.Init(); err != nil {
+		logger.Fatal("Failed to load field encryption keys", zap.Error(err))
+	}
+	if !fieldcrypt.Enabled() {
+		logger.Warn("Field encryption disabled, phone numbers and emails are stored as plaintext",
+			zap.String("env", fieldcrypt.EncryptionKeysEnv))
 	}
 
 	// Initialize database
 	initDB()
 
-	// Initialize Groq AI client
-	groqClient = NewGroqClient()
-	if groqClient == nil {
-		logger.Warn("Groq client initialization failed - AI features may not work")
-	} else {
-		logger.Info("Groq AI client initialized successfully")
+	// Initialize AI client (LLM provider chain)
+	aiClient = NewAIClient()
+	if aiClient == nil {
+		logger.Warn("AI client initialization failed - AI features may not work")
 	}
 }
 
@@ -159,6 +202,12 @@ func main() {
 	// Start payment checker background job
 	StartPaymentChecker()
 
+	// Retry quiz evaluations queued while the AI was unavailable
+	StartQuizEvaluationWorker()
+
+	// Run queued AI requests (failed chat questions, async tools) and deliver the answers
+	StartAIJobWorker()
+
 	// Start SMS scheduler for timed SMS (free trial day 2/3 and expiry)
 	startSMSScheduler()
 
@@ -193,6 +242,12 @@ func main() {
 	// 🔒 SECURITY: Start rate limit cache cleanup
 	cleanupRateLimitCache()
 
+	// 🔒 SECURITY: Lift temporary bans when they expire
+	startBanExpiryWatcher()
+
+	// 🔒 SECURITY: Free suspicious-activity detector windows
+	startSecurityDetectorCleanup()
+
 	// Process updates
 	for update := range updates {
 		if update.Message != nil {
@@ -443,11 +498,13 @@ func handleMessage(update tgbotapi.Update) {
 	// If not admin, check if user is blocked
 	var user *User
 	if err := db.Where("telegram_id = ?", update.Message.From.ID).First(&user).Error; err == nil {
-		if !user.IsActive {
-			// User is blocked, send block message and remove keyboard
-			blockMsg := tgbotapi.NewMessage(update.Message.Chat.ID, "⚠️ دسترسی شما به ربات مسدود شده است.\n\n📞 برای رفع مسدودیت با پشتیبانی تماس بگیرید:\n\n"+SUPPORT_NUMBER)
-			blockMsg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-			bot.Send(blockMsg)
+		// 🔒 SECURITY: Banned users can only send their appeal text
+		if userStates[user.TelegramID] == StateWaitingForBanAppeal && update.Message.Text != "" {
+			handleBanAppealMessage(user, update.Message.Text)
+			return
+		}
+		if ban := getActiveBan(user.TelegramID, BanScopeBot); ban != nil {
+			sendBanNotice(update.Message.Chat.ID, ban)
 			return
 		}
 	} else {
@@ -465,6 +522,18 @@ func handleMessage(update tgbotapi.Update) {
 		}
 	}
 
+	// 🔒 PRIVACY: Data export and account erasure are available to every registered user
+	if update.Message.IsCommand() {
+		switch update.Message.Command() {
+		case "export_data":
+			handleExportDataCommand(user)
+			return
+		case "delete_account":
+			handleDeleteAccountCommand(user)
+			return
+		}
+	}
+
 	// Block access until user is verified OR has active subscription (free trial)
 	// Only process license input for users who are NOT verified AND have NO active subscription
 	if !user.IsVerified && !user.HasActiveSubscription() {
@@ -520,6 +589,20 @@ func handleMessage(update tgbotapi.Update) {
 		user = &freshUser
 	}
 
+	// Voice messages are transcribed in chat and exercise mode (see voice.go)
+	if isVoiceMessage(update.Message) && user.HasActiveSubscription() && handleVoiceMessage(user, update.Message) {
+		return
+	}
+
+	// Exercises can be submitted as files (see submission_files.go)
+	if userStates[user.TelegramID] == "submitting_exercise" && user.HasActiveSubscription() && hasSubmissionAttachment(update.Message) {
+		userStates[user.TelegramID] = ""
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, handleExerciseFileSubmission(user, update.Message))
+		msg.ReplyMarkup = getMainMenuKeyboard(user)
+		bot.Send(msg)
+		return
+	}
+
 	// Handle regular messages
 	response := processUserInput(update.Message.Text, user)
 	sendMessage(update.Message.Chat.ID, response)
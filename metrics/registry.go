@@ -57,6 +57,144 @@ var (
 			Help: "Current number of pending payments",
 		},
 	)
+
+	securityEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "security_events_total",
+			Help: "Total number of security events raised by the suspicious-activity detector",
+		},
+		[]string{"rule", "severity"},
+	)
+
+	llmRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_requests_total",
+			Help: "Total number of LLM provider calls",
+		},
+		[]string{"provider", "model", "feature", "result"},
+	)
+
+	llmRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_request_duration_seconds",
+			Help:    "LLM provider call duration in seconds",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+		},
+		[]string{"provider", "feature"},
+	)
+
+	llmFallbacksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_fallbacks_total",
+			Help: "Total number of LLM requests served by a fallback provider",
+		},
+		[]string{"feature"},
+	)
+
+	llmCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cache_requests_total",
+			Help: "Total number of cacheable LLM requests by result (hit, miss, coalesced)",
+		},
+		[]string{"feature", "result"},
+	)
+
+	aiJobsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ai_jobs_total",
+			Help: "Total number of queued AI job events by kind and outcome (queued, retry, done, failed)",
+		},
+		[]string{"kind", "result"},
+	)
+
+	aiRatingsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ai_ratings_total",
+			Help: "Total number of user ratings of AI answers by target and result (up, down, comment)",
+		},
+		[]string{"target", "result"},
+	)
+
+	aiModerationTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ai_moderation_total",
+			Help: "Total number of AI inputs and answers stopped or flagged by moderation, by category and action",
+		},
+		[]string{"category", "action"},
+	)
+
+	toolOutputsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tool_outputs_total",
+			Help: "Total number of AI tool requests by outcome (ok, reask, failed)",
+		},
+		[]string{"tool", "result"},
+	)
+
+	toolOutputFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tool_output_failures_total",
+			Help: "Total number of unusable AI tool outputs by category (llm_error, no_json, invalid_json, schema)",
+		},
+		[]string{"tool", "category"},
+	)
+
+	aiTokensTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ai_tokens_total",
+			Help: "Total number of LLM tokens consumed by type (prompt, completion)",
+		},
+		[]string{"feature", "plan", "type"},
+	)
+
+	aiTokensPerRequest = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ai_tokens_per_request",
+			Help:    "Tokens (prompt + completion) consumed by one LLM call",
+			Buckets: []float64{100, 250, 500, 1000, 2000, 4000, 8000, 16000},
+		},
+		[]string{"feature"},
+	)
+
+	aiQuotaRejectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ai_quota_rejections_total",
+			Help: "Total number of AI requests rejected because the plan token quota was used up",
+		},
+		[]string{"plan", "period"},
+	)
+
+	aiTranscriptionSecondsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ai_transcription_seconds_total",
+			Help: "Total seconds of voice audio transcribed",
+		},
+		[]string{"plan"},
+	)
+
+	chatToolCallsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_tool_calls_total",
+			Help: "Total number of assistant tool calls by outcome (ok, error, unknown, limit)",
+		},
+		[]string{"tool", "result"},
+	)
+
+	exerciseReviewsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "exercise_reviews_total",
+			Help: "Total number of AI-graded submissions queued for mentor review by reason",
+		},
+		[]string{"reason"},
+	)
+
+	exerciseReviewsResolvedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "exercise_reviews_resolved_total",
+			Help: "Total number of mentor reviews by outcome (confirmed, overridden)",
+		},
+		[]string{"outcome"},
+	)
 )
 
 func init() {
@@ -67,6 +205,23 @@ func init() {
 		verifyRequestsTotal,
 		paymentChecksTotal,
 		paymentsPendingCount,
+		securityEventsTotal,
+		llmRequestsTotal,
+		llmRequestDuration,
+		llmFallbacksTotal,
+		llmCacheRequestsTotal,
+		aiJobsTotal,
+		aiRatingsTotal,
+		aiModerationTotal,
+		toolOutputsTotal,
+		toolOutputFailuresTotal,
+		aiTokensTotal,
+		aiTokensPerRequest,
+		aiQuotaRejectionsTotal,
+		aiTranscriptionSecondsTotal,
+		chatToolCallsTotal,
+		exerciseReviewsTotal,
+		exerciseReviewsResolvedTotal,
 	)
 }
 
@@ -101,3 +256,81 @@ func IncPaymentCheck(result string) {
 func SetPaymentsPendingCount(n int) {
 	paymentsPendingCount.Set(float64(n))
 }
+
+// IncSecurityEvent increments security_events_total with the given rule and severity.
+func IncSecurityEvent(rule, severity string) {
+	securityEventsTotal.WithLabelValues(rule, severity).Inc()
+}
+
+// ObserveLLMRequest records one LLM provider call with its result (success, error, rate_limited).
+func ObserveLLMRequest(provider, model, feature, result string, duration time.Duration) {
+	llmRequestsTotal.WithLabelValues(provider, model, feature, result).Inc()
+	llmRequestDuration.WithLabelValues(provider, feature).Observe(duration.Seconds())
+}
+
+// IncLLMFallback increments llm_fallbacks_total for the given feature.
+func IncLLMFallback(feature string) {
+	llmFallbacksTotal.WithLabelValues(feature).Inc()
+}
+
+// IncLLMCache increments llm_cache_requests_total for one request of a cached feature.
+func IncLLMCache(feature, result string) {
+	llmCacheRequestsTotal.WithLabelValues(feature, result).Inc()
+}
+
+// IncAIJob increments ai_jobs_total for one event of a queued AI job.
+func IncAIJob(kind, result string) {
+	aiJobsTotal.WithLabelValues(kind, result).Inc()
+}
+
+// IncAIRating increments ai_ratings_total for one rating or comment on an AI answer.
+func IncAIRating(target, result string) {
+	aiRatingsTotal.WithLabelValues(target, result).Inc()
+}
+
+// IncModeration increments ai_moderation_total for one moderation finding.
+func IncModeration(category, action string) {
+	aiModerationTotal.WithLabelValues(category, action).Inc()
+}
+
+// IncToolOutput increments tool_outputs_total with the outcome of a structured tool request.
+func IncToolOutput(tool, result string) {
+	toolOutputsTotal.WithLabelValues(tool, result).Inc()
+}
+
+// IncToolOutputFailure increments tool_output_failures_total for one unusable model answer.
+func IncToolOutputFailure(tool, category string) {
+	toolOutputFailuresTotal.WithLabelValues(tool, category).Inc()
+}
+
+// ObserveAITokens records the token usage of one LLM call.
+func ObserveAITokens(feature, plan string, promptTokens, completionTokens int) {
+	aiTokensTotal.WithLabelValues(feature, plan, "prompt").Add(float64(promptTokens))
+	aiTokensTotal.WithLabelValues(feature, plan, "completion").Add(float64(completionTokens))
+	aiTokensPerRequest.WithLabelValues(feature).Observe(float64(promptTokens + completionTokens))
+}
+
+// IncAIQuotaRejection increments ai_quota_rejections_total for the plan and period (daily, monthly).
+func IncAIQuotaRejection(plan, period string) {
+	aiQuotaRejectionsTotal.WithLabelValues(plan, period).Inc()
+}
+
+// ObserveTranscription adds the length of one transcribed voice message.
+func ObserveTranscription(plan string, seconds int) {
+	aiTranscriptionSecondsTotal.WithLabelValues(plan).Add(float64(seconds))
+}
+
+// IncChatToolCall increments chat_tool_calls_total for one tool call requested by the assistant.
+func IncChatToolCall(tool, result string) {
+	chatToolCallsTotal.WithLabelValues(tool, result).Inc()
+}
+
+// IncExerciseReview increments exercise_reviews_total for a submission queued for review.
+func IncExerciseReview(reason string) {
+	exerciseReviewsTotal.WithLabelValues(reason).Inc()
+}
+
+// IncExerciseReviewResolved increments exercise_reviews_resolved_total with the mentor outcome.
+func IncExerciseReviewResolved(outcome string) {
+	exerciseReviewsResolvedTotal.WithLabelValues(outcome).Inc()
+}
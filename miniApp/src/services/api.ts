@@ -9,6 +9,16 @@ export interface APIResponse<T = unknown> {
   message?: string;
 }
 
+export interface ChatThread {
+  id: number;
+  title: string;
+  pinned: boolean;
+  archived: boolean;
+  message_count: number;
+  last_message_at: string;
+  created_at: string;
+}
+
 // Telegram WebApp types
 interface TelegramWebApp {
   initData: string;
@@ -158,6 +168,42 @@ class APIService {
     });
   }
 
+  // Request headers with Telegram WebApp or web session authentication
+  private buildHeaders(): Record<string, string> {
+    const headers: Record<string, string> = {
+      'Content-Type': 'application/json',
+    };
+
+    // Add Telegram WebApp authentication headers (if in Telegram)
+    // ⚠️ SECURITY: Only send X-Telegram-WebApp header if we have valid initData
+    // Don't trust just the presence of window.Telegram.WebApp (it can exist in web browsers too)
+    const isInTelegram = this.isInTelegram();
+    const hasInitData = typeof window !== 'undefined' && 
+                       window.Telegram?.WebApp?.initData && 
+                       window.Telegram.WebApp.initData.length > 0;
+    
+    if (isInTelegram && hasInitData && window.Telegram?.WebApp) {
+      // Only send Telegram headers if we're actually in Telegram with valid initData
+      headers['X-Telegram-Init-Data'] = window.Telegram.WebApp.initData;
+      
+      // ⚠️ REMOVED: X-Telegram-WebApp header - backend doesn't trust it anymore
+      // Backend now only trusts: startapp query parameter, validated initData, User-Agent, and Referer
+      
+      // Add start param if available
+      if (window.Telegram.WebApp.initDataUnsafe?.start_param) {
+        headers['X-Telegram-Start-Param'] = window.Telegram.WebApp.initDataUnsafe.start_param;
+      }
+    } else {
+      // If not in Telegram, check for web session token
+      const webToken = localStorage.getItem('web_session_token');
+      if (webToken) {
+        headers['Authorization'] = `Bearer ${webToken}`;
+      }
+    }
+
+    return headers;
+  }
+
   async makeRequest<T = unknown>(method: string, endpoint: string, data?: Record<string, unknown>, useCache: boolean = false): Promise<APIResponse<T>> {
     try {
       const url = endpoint.startsWith('http')
@@ -174,36 +220,7 @@ class APIService {
 
       // ⚡ PERFORMANCE: Removed verbose debug logging
 
-      const headers: Record<string, string> = {
-        'Content-Type': 'application/json',
-      };
-
-      // Add Telegram WebApp authentication headers (if in Telegram)
-      // ⚠️ SECURITY: Only send X-Telegram-WebApp header if we have valid initData
-      // Don't trust just the presence of window.Telegram.WebApp (it can exist in web browsers too)
-      const isInTelegram = this.isInTelegram();
-      const hasInitData = typeof window !== 'undefined' && 
-                         window.Telegram?.WebApp?.initData && 
-                         window.Telegram.WebApp.initData.length > 0;
-      
-      if (isInTelegram && hasInitData && window.Telegram?.WebApp) {
-        // Only send Telegram headers if we're actually in Telegram with valid initData
-        headers['X-Telegram-Init-Data'] = window.Telegram.WebApp.initData;
-        
-        // ⚠️ REMOVED: X-Telegram-WebApp header - backend doesn't trust it anymore
-        // Backend now only trusts: startapp query parameter, validated initData, User-Agent, and Referer
-        
-        // Add start param if available
-        if (window.Telegram.WebApp.initDataUnsafe?.start_param) {
-          headers['X-Telegram-Start-Param'] = window.Telegram.WebApp.initDataUnsafe.start_param;
-        }
-      } else {
-        // If not in Telegram, check for web session token
-        const webToken = localStorage.getItem('web_session_token');
-        if (webToken) {
-          headers['Authorization'] = `Bearer ${webToken}`;
-        }
-      }
+      const headers = this.buildHeaders();
 
       const config: RequestInit = {
         method,
@@ -356,9 +373,11 @@ class APIService {
   }
 
   // Send chat message to AI Coach
-  // recentMessages: last 5 user messages for short-term memory (oldest first) - optional
-  async sendChatMessage(message: string, recentMessages?: string[]): Promise<APIResponse<{
+  // recentMessages: ignored by the server, context comes from the stored thread - kept for older callers
+  // threadId: chat thread, the active thread when omitted
+  async sendChatMessage(message: string, recentMessages?: string[], threadId?: number): Promise<APIResponse<{
     response: string;
+    thread_id?: number;
     message_id?: number;
   }>> {
     const telegramId = this.getTelegramId();
@@ -366,20 +385,173 @@ class APIService {
       return { success: false, error: 'No user ID available' };
     }
 
-    const body: { telegram_id: number; message: string; recent_messages?: string[] } = {
+    const body: { telegram_id: number; message: string; recent_messages?: string[]; thread_id?: number } = {
       telegram_id: telegramId,
       message: message
     };
     if (recentMessages && recentMessages.length > 0) {
       body.recent_messages = recentMessages;
     }
+    if (threadId) {
+      body.thread_id = threadId;
+    }
 
     return this.makeRequest<{
       response: string;
+      thread_id?: number;
       message_id?: number;
     }>('POST', '/chat', body);
   }
 
+  // Stream an AI Coach answer over Server-Sent Events
+  // onDelta receives sanitized chunks as they are generated; resolves with the final message info
+  // threadId: chat thread, the active thread when omitted
+  async streamChatMessage(
+    message: string,
+    onDelta: (text: string) => void,
+    threadId?: number,
+    signal?: AbortSignal
+  ): Promise<APIResponse<{ thread_id: number; message_id: number; provider?: string; model?: string }>> {
+    const telegramId = this.getTelegramId();
+    if (!telegramId) {
+      return { success: false, error: 'No user ID available' };
+    }
+
+    const body: { telegram_id: number; message: string; thread_id?: number } = {
+      telegram_id: telegramId,
+      message: message
+    };
+    if (threadId) {
+      body.thread_id = threadId;
+    }
+
+    try {
+      const response = await fetch(`${this.baseURL}/chat/stream`, {
+        method: 'POST',
+        headers: this.buildHeaders(),
+        body: JSON.stringify(body),
+        signal,
+      });
+
+      // Checks failed before streaming started: regular JSON error
+      if (!response.ok || !response.body) {
+        const result = await response.json().catch(() => ({}));
+        return { success: false, error: result.error || `HTTP error! status: ${response.status}` };
+      }
+
+      const reader = response.body.getReader();
+      const decoder = new TextDecoder();
+      let buffer = '';
+
+      for (;;) {
+        const { done, value } = await reader.read();
+        if (done) break;
+        buffer += decoder.decode(value, { stream: true });
+
+        // Events are separated by a blank line
+        let boundary = buffer.indexOf('\n\n');
+        while (boundary !== -1) {
+          const rawEvent = buffer.slice(0, boundary);
+          buffer = buffer.slice(boundary + 2);
+          boundary = buffer.indexOf('\n\n');
+
+          let event = 'message';
+          let data = '';
+          for (const line of rawEvent.split('\n')) {
+            if (line.startsWith('event:')) event = line.slice(6).trim();
+            else if (line.startsWith('data:')) data += line.slice(5);
+          }
+          if (!data) continue;
+
+          const payload = JSON.parse(data);
+          if (event === 'delta') {
+            onDelta(payload.text);
+          } else if (event === 'done') {
+            return { success: true, data: payload };
+          } else if (event === 'error') {
+            return { success: false, error: payload.error };
+          }
+        }
+      }
+
+      return { success: false, error: 'Stream ended unexpectedly' };
+    } catch (error) {
+      if (error instanceof Error && error.name === 'AbortError') {
+        return { success: false, error: 'Request cancelled' };
+      }
+      logger.error('Chat stream failed', error);
+      return { success: false, error: error instanceof Error ? error.message : 'Unknown error' };
+    }
+  }
+
+  // Chat threads: separate AI conversations, e.g. one per business idea
+  async getChatThreads(archived: boolean = false, cursor?: string): Promise<APIResponse<{
+    threads: ChatThread[];
+    next_cursor?: string;
+  }>> {
+    const telegramId = this.getTelegramId();
+    if (!telegramId) {
+      return { success: false, error: 'No user ID available' };
+    }
+
+    const params = new URLSearchParams({ archived: String(archived) });
+    if (cursor) params.set('cursor', cursor);
+    return this.makeRequest('GET', `/user/${telegramId}/threads?${params.toString()}`);
+  }
+
+  async createChatThread(title?: string): Promise<APIResponse<ChatThread>> {
+    const telegramId = this.getTelegramId();
+    if (!telegramId) {
+      return { success: false, error: 'No user ID available' };
+    }
+
+    return this.makeRequest<ChatThread>('POST', `/user/${telegramId}/threads`, title ? { title } : {});
+  }
+
+  // Rename, pin or archive a thread
+  async updateChatThread(threadId: number, changes: { title?: string; pinned?: boolean; archived?: boolean }): Promise<APIResponse<ChatThread>> {
+    const telegramId = this.getTelegramId();
+    if (!telegramId) {
+      return { success: false, error: 'No user ID available' };
+    }
+
+    return this.makeRequest<ChatThread>('PUT', `/user/${telegramId}/threads/${threadId}`, changes);
+  }
+
+  async deleteChatThread(threadId: number): Promise<APIResponse<{ deleted_messages: number }>> {
+    const telegramId = this.getTelegramId();
+    if (!telegramId) {
+      return { success: false, error: 'No user ID available' };
+    }
+
+    return this.makeRequest('DELETE', `/user/${telegramId}/threads/${threadId}`);
+  }
+
+  // Messages of a thread, oldest first; pass next_cursor to load older messages
+  async getChatThreadMessages(threadId: number, cursor?: string): Promise<APIResponse<{
+    thread_id: number;
+    messages: Array<{ id: number; message: string; response: string; created_at: string }>;
+    next_cursor?: string;
+  }>> {
+    const telegramId = this.getTelegramId();
+    if (!telegramId) {
+      return { success: false, error: 'No user ID available' };
+    }
+
+    const query = cursor ? `?cursor=${encodeURIComponent(cursor)}` : '';
+    return this.makeRequest('GET', `/user/${telegramId}/threads/${threadId}/messages${query}`);
+  }
+
+  // Make the assistant forget earlier messages of a thread (they stay visible)
+  async resetConversation(threadId: number): Promise<APIResponse<{ message: string }>> {
+    const telegramId = this.getTelegramId();
+    if (!telegramId) {
+      return { success: false, error: 'No user ID available' };
+    }
+
+    return this.makeRequest<{ message: string }>('POST', `/user/${telegramId}/threads/${threadId}/reset`);
+  }
+
   // Get chat history
   async getChatHistory(): Promise<APIResponse<Array<{
     id: number;
@@ -5,6 +5,10 @@ import (
 	"strings"
 	"time"
 
+	"MonetizeeAI_bot/fieldcrypt"
+	"MonetizeeAI_bot/logger"
+
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
@@ -29,7 +33,7 @@ type User struct {
 	gorm.Model
 	TelegramID     int64 `gorm:"uniqueIndex"`
 	Username       string
-	Email          string
+	Email          string `gorm:"serializer:encrypted"` // 🔒 Encrypted at rest, search with EmailHash
 	FirstName      string
 	LastName       string
 	CurrentSession int  `gorm:"default:1"`
@@ -37,10 +41,12 @@ type User struct {
 	IsAdmin        bool `gorm:"default:false"`
 	IsBlocked      bool `gorm:"default:false"` // For blocking suspicious users
 	License        string
-	IsVerified     bool `gorm:"default:false"`
-	Phone          string
-	PhoneNumber    string `gorm:"default:''"` // Duplicate field for compatibility
-	Exercises      []Exercise
+	IsVerified     bool   `gorm:"default:false"`
+	Phone          string `gorm:"serializer:encrypted"`            // 🔒 Encrypted at rest, search with PhoneHash
+	PhoneNumber    string `gorm:"serializer:encrypted;default:''"` // Duplicate field for compatibility
+	PhoneHash      string `gorm:"size:64;index" json:"-"`          // Blind index of Phone (or PhoneNumber)
+	EmailHash      string `gorm:"size:64;index" json:"-"`          // Blind index of Email
+	Submissions    []ExerciseSubmission
 
 	// Profile fields for miniApp
 	MonthlyIncome int64 `json:"monthly_income" gorm:"default:0"` // در تومان
@@ -104,22 +110,50 @@ type Session struct {
 	IsActive     bool `gorm:"default:true"`
 	IsCompleted  bool `gorm:"default:false"`
 	Videos       []Video
-	Exercises    []Exercise
+	Assignments  []ExerciseAssignment
 	Users        []User `gorm:"many2many:user_sessions;"`
 }
 
-// Exercise represents a user's exercise submission
-type Exercise struct {
+// ExerciseAssignment is an exercise given to students in a session. A session can have
+// several, sent in Position order.
+type ExerciseAssignment struct {
 	gorm.Model
-	UserID      uint
-	User        User `gorm:"foreignKey:UserID"`
-	SessionID   uint
-	Session     Session `gorm:"foreignKey:SessionID"`
-	Content     string
-	PDFFile     string // File ID or path to the PDF file
-	Status      string `gorm:"default:'pending'"` // pending, approved, needs_revision
-	Feedback    string
-	SubmittedAt time.Time
+	SessionID uint    `gorm:"index" json:"session_id"`
+	Session   Session `gorm:"foreignKey:SessionID" json:"-"`
+	Position  int     `gorm:"default:0" json:"position"`
+	Title     string  `json:"title"`
+	Content   string  `gorm:"type:text" json:"content"`
+	PDFFile   string  `json:"pdf_file"` // URL or Telegram file ID of the PDF file
+	IsActive  bool    `gorm:"default:true" json:"is_active"`
+}
+
+// ExerciseSubmission is a student's answer to a session's exercises. Every resubmission is
+// a new row with the next attempt number.
+type ExerciseSubmission struct {
+	gorm.Model
+	UserID         uint               `gorm:"index" json:"user_id"`
+	User           User               `gorm:"foreignKey:UserID" json:"-"`
+	TelegramID     int64              `gorm:"index" json:"telegram_id"`
+	SessionID      uint               `gorm:"index" json:"session_id"`
+	Session        Session            `gorm:"foreignKey:SessionID" json:"-"`
+	AssignmentID   *uint              `gorm:"index" json:"assignment_id"`
+	Assignment     ExerciseAssignment `gorm:"foreignKey:AssignmentID" json:"-"`
+	Attempt        int                `gorm:"default:1" json:"attempt"`
+	Content        string             `gorm:"type:text" json:"content"`
+	PDFFile        string             `json:"pdf_file"`                 // Legacy: file ID of submissions migrated from exercises
+	FileKind       string             `gorm:"size:16" json:"file_kind"` // pdf, docx, image, voice; empty for text answers
+	FileName       string             `json:"file_name"`
+	FileMime       string             `json:"file_mime"`
+	FileSize       int64              `json:"file_size"`
+	FileKey        string             `json:"file_key"`                        // Key in the file storage
+	TelegramFileID string             `json:"telegram_file_id"`                // File ID of the original Telegram upload
+	Status         string             `gorm:"default:'pending'" json:"status"` // pending (mentor review), approved, needs_revision
+	Score          int                `json:"score"`
+	AIFeedback     string             `gorm:"type:text" json:"ai_feedback"`
+	Feedback       string             `gorm:"type:text" json:"feedback"` // Shown to the student: the AI feedback or the mentor's
+	ReviewedBy     *uint              `json:"reviewed_by"`
+	ReviewedAt     *time.Time         `json:"reviewed_at"`
+	SubmittedAt    time.Time          `json:"submitted_at"`
 }
 
 // UserSession represents the many-to-many relationship between users and sessions
@@ -140,12 +174,17 @@ type UserLevel struct {
 
 // ChatMessage represents a chat message between user and AI
 type ChatMessage struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	TelegramID int64     `gorm:"index" json:"telegram_id"`
-	Message    string    `gorm:"type:text" json:"message"`
-	Response   string    `gorm:"type:text" json:"response"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	TelegramID int64  `gorm:"index" json:"telegram_id"`
+	ThreadID   *uint  `gorm:"index" json:"thread_id"` // ChatThread, nil only for rows saved before threads existed
+	Message    string `gorm:"type:text" json:"message"`
+	Response   string `gorm:"type:text" json:"response"`
+	Provider   string `gorm:"size:32" json:"provider,omitempty"` // LLM provider that served the response
+	Model      string `gorm:"size:100" json:"model,omitempty"`   // LLM model that served the response
+	// Version of the chat system prompt the response was generated with, 0 for the built-in copy
+	PromptVersion int       `json:"prompt_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // Ticket represents a support ticket
@@ -268,6 +307,77 @@ type License struct {
 	Admin      *Admin     `gorm:"foreignKey:CreatedBy;constraint:OnDelete:SET NULL" json:"admin,omitempty"`
 }
 
+// BeforeSave keeps the blind indexes in sync with the encrypted contact fields
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	phone := u.Phone
+	if phone == "" {
+		phone = u.PhoneNumber
+	}
+	u.PhoneHash = fieldcrypt.PhoneIndex(phone)
+	u.EmailHash = fieldcrypt.EmailIndex(u.Email)
+	return nil
+}
+
+// setEncryptedContactUpdates adds encrypted phone/email and their blind indexes to a map update.
+// gorm does not run serializers or BeforeSave changes for Updates(map[string]interface{}).
+// Like BeforeSave, the phone index falls back to phoneNumber (the bot contact, not updated
+// here) when phone is blank; a blanked field clears its index.
+func setEncryptedContactUpdates(updates map[string]interface{}, phone, phoneNumber, email string) error {
+	encryptedPhone, err := fieldcrypt.Encrypt(phone)
+	if err != nil {
+		return err
+	}
+	encryptedEmail, err := fieldcrypt.Encrypt(email)
+	if err != nil {
+		return err
+	}
+
+	indexedPhone := phone
+	if indexedPhone == "" {
+		indexedPhone = phoneNumber
+	}
+
+	updates["phone"] = encryptedPhone
+	updates["phone_hash"] = fieldcrypt.PhoneIndex(indexedPhone)
+	updates["email"] = encryptedEmail
+	updates["email_hash"] = fieldcrypt.EmailIndex(email)
+	return nil
+}
+
+// backfillContactHashes fills the blind indexes of users saved before they existed, so phone
+// and email lookups by hash find them without running cmd/encrypt-user-fields first
+func backfillContactHashes() {
+	var users []User
+	var updated int
+	result := db.Select("id", "phone", "phone_number", "email", "phone_hash", "email_hash").
+		Where("((phone_hash = '' OR phone_hash IS NULL) AND (phone <> '' OR phone_number <> '')) OR "+
+			"((email_hash = '' OR email_hash IS NULL) AND email <> '')").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				phone := user.Phone
+				if phone == "" {
+					phone = user.PhoneNumber
+				}
+				if err := db.Model(&User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+					"phone_hash": fieldcrypt.PhoneIndex(phone),
+					"email_hash": fieldcrypt.EmailIndex(user.Email),
+				}).Error; err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		})
+	if result.Error != nil {
+		logger.Error("Failed to backfill contact hashes", zap.Int("updated", updated), zap.Error(result.Error))
+		return
+	}
+
+	if updated > 0 {
+		logger.Info("Contact hashes backfilled", zap.Int("count", updated))
+	}
+}
+
 // Subscription helper functions
 func (u *User) HasActiveSubscription() bool {
 	// Legacy users: If IsVerified is true and no subscription type is set, treat as lifetime license
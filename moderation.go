@@ -0,0 +1,700 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AI moderation: every user text sent to the AI (chat, tools, exercise and quiz answers) first
+// passes the moderation rules and, when MODERATION_CLASSIFIER is on, a classifier call through
+// the provider chain. Violations are recorded as security events and graded per user: a
+// warning, blocked messages with the strikes left, then a temporary chat ban after
+// MODERATION_BAN_STRIKES strikes within moderationStrikeWindow. Answers are checked for leaked
+// system prompt text before they reach the user; a leak is replaced and reported, but it is
+// the model's output and never counts as a strike.
+
+// Moderation categories
+const (
+	ModerationPromptInjection = "prompt_injection"
+	ModerationDisallowed      = "disallowed_content"
+	ModerationPromptLeak      = "prompt_leak"
+)
+
+// Actions of a moderation rule
+const (
+	ModerationActionFlag  = "flag"  // Recorded, the text still reaches the AI
+	ModerationActionBlock = "block" // Refused and counted as a strike
+	ModerationActionBan   = "ban"   // Refused and the user is banned from the chat at once
+)
+
+// Grades of the response to a refused text
+const (
+	ModerationGradeWarn  = "warn"  // First strike
+	ModerationGradeBlock = "block" // Later strikes, the user is told how many are left
+	ModerationGradeBan   = "ban"   // Strike limit reached or a ban rule matched
+)
+
+const (
+	moderationRulesCacheTTL     = time.Minute
+	moderationStrikeWindow      = 24 * time.Hour
+	defaultModerationBanStrikes = 3
+	minLeakFragmentRunes        = 40 // Shorter system prompt lines are too generic to count as a leak
+)
+
+// ModerationRule is an admin-managed pattern checked against user text before it reaches the AI
+type ModerationRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:64;uniqueIndex" json:"name"`
+	Category    string    `gorm:"size:32" json:"category"` // prompt_injection or disallowed_content
+	Pattern     string    `gorm:"size:500" json:"pattern"` // Go regular expression, matched case-insensitively
+	Action      string    `gorm:"size:16" json:"action"`   // flag, block or ban
+	Description string    `gorm:"size:255" json:"description"`
+	Builtin     bool      `gorm:"default:false" json:"builtin"` // Seeded from the code, can be disabled but not deleted
+	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (r *ModerationRule) AfterSave(tx *gorm.DB) error {
+	invalidateModerationRules()
+	return nil
+}
+
+func (r *ModerationRule) AfterDelete(tx *gorm.DB) error {
+	invalidateModerationRules()
+	return nil
+}
+
+// builtinModerationRules are seeded into the database and used whenever it is unavailable
+var builtinModerationRules = []ModerationRule{
+	{
+		Name:        "ignore_instructions",
+		Category:    ModerationPromptInjection,
+		Pattern:     `\b(ignore|disregard|forget|override)\b.{0,30}\b(previous|prior|above|earlier|system|your)\b.{0,20}\b(instructions?|prompts?|rules|messages)\b`,
+		Action:      ModerationActionBlock,
+		Description: "Asks the assistant to drop its instructions",
+	},
+	{
+		Name:        "ignore_instructions_fa",
+		Category:    ModerationPromptInjection,
+		Pattern:     `(نادیده|فراموش|بی[\s\x{200c}]*خیال)[\s\x{200c}]*(بگیر|کن|شو).{0,40}(دستور|قوانین|قانون)|(دستور|قوانین|قانون).{0,40}(قبلی|سیستمی|بالا).{0,30}(نادیده|فراموش|بی[\s\x{200c}]*خیال)`,
+		Action:      ModerationActionBlock,
+		Description: "درخواست نادیده گرفتن دستورالعمل‌ها",
+	},
+	{
+		Name:        "reveal_system_prompt",
+		Category:    ModerationPromptInjection,
+		Pattern:     `\b(reveal|show|print|repeat|output|display|leak|tell)\b.{0,40}\b(system\s*prompt|initial\s+prompt|hidden\s+instructions|your\s+instructions)\b|(پرامپت|دستورالعمل|دستورات)[\s\x{200c}]*(های)?[\s\x{200c}]*(سیستمی|سیستم|اولیه|مخفی)`,
+		Action:      ModerationActionBlock,
+		Description: "Asks for the system prompt",
+	},
+	{
+		Name:        "role_override",
+		Category:    ModerationPromptInjection,
+		Pattern:     `\b(you\s+are\s+now|from\s+now\s+on\s+you\s+are|pretend\s+(to\s+be|you\s+are))\b|\b(developer|god|jailbreak|unrestricted)\s+mode\b|\bjailbreak|(^|\n)\s*(system|assistant|developer)\s*:`,
+		Action:      ModerationActionBlock,
+		Description: "Tries to change the assistant's role or inject messages",
+	},
+	{
+		Name:        "weapons",
+		Category:    ModerationDisallowed,
+		Pattern:     `\b(how\s+to\s+(make|build)\s+(a\s+)?(bomb|explosive|weapon))\b|(ساخت|درست[\s\x{200c}]*کردن)[\s\x{200c}]*(بمب|مواد[\s\x{200c}]*منفجره|اسلحه|سلاح)`,
+		Action:      ModerationActionBlock,
+		Description: "ساخت سلاح و مواد منفجره",
+	},
+	{
+		Name:        "account_hacking",
+		Category:    ModerationDisallowed,
+		Pattern:     `\b(phishing|carding)\b|فیشینگ|کارتینگ|هک[\s\x{200c}]*(کردن)?[\s\x{200c}]*(حساب|اکانت|پیج|ایمیل|اینستاگرام|تلگرام)|(حساب|اکانت|پیج|ایمیل|اینستاگرام|تلگرام).{0,30}هک[\s\x{200c}]*(کنم|کنیم|کنید|کن)([\s؟?!.]|$)`,
+		Action:      ModerationActionBlock,
+		Description: "هک حساب دیگران و کلاهبرداری",
+	},
+	{
+		Name:        "card_number",
+		Category:    ModerationDisallowed,
+		Pattern:     `\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{4}\b`,
+		Action:      ModerationActionFlag,
+		Description: "Bank card number in the text",
+	},
+}
+
+// compiledModerationRule is a rule with its parsed pattern
+type compiledModerationRule struct {
+	ModerationRule
+	re *regexp.Regexp
+}
+
+var (
+	builtinModerationCompiled []compiledModerationRule
+
+	moderationRulesCache    []compiledModerationRule
+	moderationRulesLoadedAt time.Time
+	moderationRulesMutex    sync.RWMutex
+
+	// moderationStrikes counts refused texts per user within moderationStrikeWindow
+	moderationStrikes = NewSecurityDetector()
+)
+
+func init() {
+	for _, rule := range builtinModerationRules {
+		re, err := compileModerationPattern(rule.Pattern)
+		if err != nil {
+			panic(fmt.Sprintf("built-in moderation rule %s: %v", rule.Name, err))
+		}
+		rule.Builtin, rule.IsActive = true, true
+		builtinModerationCompiled = append(builtinModerationCompiled, compiledModerationRule{ModerationRule: rule, re: re})
+	}
+}
+
+func compileModerationPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?is)" + pattern)
+}
+
+func moderationEnabled() bool {
+	return !strings.EqualFold(os.Getenv("MODERATION_ENABLED"), "false")
+}
+
+func moderationClassifierEnabled() bool {
+	return strings.EqualFold(os.Getenv("MODERATION_CLASSIFIER"), "true")
+}
+
+func moderationBanStrikes() int {
+	if n, err := strconv.Atoi(os.Getenv("MODERATION_BAN_STRIKES")); err == nil && n > 0 {
+		return n
+	}
+	return defaultModerationBanStrikes
+}
+
+// activeModerationRules returns the enabled rules, loading them from the database at most once
+// per moderationRulesCacheTTL
+func activeModerationRules() []compiledModerationRule {
+	moderationRulesMutex.RLock()
+	rules, loadedAt := moderationRulesCache, moderationRulesLoadedAt
+	moderationRulesMutex.RUnlock()
+	if !loadedAt.IsZero() && time.Since(loadedAt) < moderationRulesCacheTTL {
+		return rules
+	}
+
+	rules = builtinModerationCompiled
+	if db != nil {
+		var stored []ModerationRule
+		if err := db.Where("is_active = ?", true).Order("id").Find(&stored).Error; err == nil {
+			rules = make([]compiledModerationRule, 0, len(stored))
+			for _, rule := range stored {
+				re, err := compileModerationPattern(rule.Pattern)
+				if err != nil {
+					logger.Error("Skipping invalid moderation rule", zap.String("rule", rule.Name), zap.Error(err))
+					continue
+				}
+				rules = append(rules, compiledModerationRule{ModerationRule: rule, re: re})
+			}
+		} else {
+			logger.Warn("Using built-in moderation rules", zap.Error(err))
+		}
+	}
+
+	moderationRulesMutex.Lock()
+	moderationRulesCache, moderationRulesLoadedAt = rules, time.Now()
+	moderationRulesMutex.Unlock()
+	return rules
+}
+
+// invalidateModerationRules drops the cached rules after an admin change
+func invalidateModerationRules() {
+	moderationRulesMutex.Lock()
+	moderationRulesLoadedAt = time.Time{}
+	moderationRulesMutex.Unlock()
+}
+
+// seedModerationRules stores the built-in rules that are not in the database yet
+func seedModerationRules() {
+	for _, rule := range builtinModerationRules {
+		var count int64
+		if err := db.Model(&ModerationRule{}).Where("name = ?", rule.Name).Count(&count).Error; err != nil {
+			logger.Error("Failed to load moderation rule", zap.String("rule", rule.Name), zap.Error(err))
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+		rule.Builtin, rule.IsActive = true, true
+		if err := db.Create(&rule).Error; err != nil {
+			logger.Error("Failed to seed moderation rule", zap.String("rule", rule.Name), zap.Error(err))
+			continue
+		}
+		logger.Info("Moderation rule seeded", zap.String("rule", rule.Name))
+	}
+}
+
+// ModerationViolation is what a moderation check found in a text
+type ModerationViolation struct {
+	Category string `json:"category"`
+	Rule     string `json:"rule"` // Rule name, "classifier" or "output_check"
+	Action   string `json:"action"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// moderationActionRank orders actions from the mildest
+var moderationActionRank = map[string]int{ModerationActionFlag: 1, ModerationActionBlock: 2, ModerationActionBan: 3}
+
+// checkModerationRules returns the strictest rule matching text, nil when none matches
+func checkModerationRules(rules []compiledModerationRule, text string) *ModerationViolation {
+	var found *ModerationViolation
+	for _, rule := range rules {
+		match := rule.re.FindString(text)
+		if match == "" || (found != nil && moderationActionRank[rule.Action] <= moderationActionRank[found.Action]) {
+			continue
+		}
+		found = &ModerationViolation{Category: rule.Category, Rule: rule.Name, Action: rule.Action, Detail: match}
+	}
+	return found
+}
+
+// moderationClassification is the classifier answer
+type moderationClassification struct {
+	Category string `json:"category"` // safe, prompt_injection or disallowed_content
+	Reason   string `json:"reason"`
+}
+
+var moderationClassifierSchema = objectSchema(
+	prop("category", stringSchema()),
+	prop("reason", &JSONSchema{Type: "string"}), // Empty for safe texts
+)
+
+// classifyAIInput asks the moderation model about text; nil means the text is safe
+func classifyAIInput(client *AIClient, text string) (*ModerationViolation, error) {
+	resp, err := client.GenerateChatResponse(FeatureModeration, renderPrompt(PromptModerationClassifier, nil), text, 200)
+	if err != nil {
+		return nil, err
+	}
+	out, perr := parseToolOutput[moderationClassification](resp.Content, moderationClassifierSchema)
+	if perr != nil {
+		return nil, perr
+	}
+
+	switch out.Category {
+	case "safe":
+		return nil, nil
+	case ModerationPromptInjection, ModerationDisallowed:
+		return &ModerationViolation{Category: out.Category, Rule: "classifier", Action: ModerationActionBlock, Detail: out.Reason}, nil
+	default:
+		return nil, fmt.Errorf("unknown moderation category %q", out.Category)
+	}
+}
+
+// ModerationVerdict is the response to a refused text
+type ModerationVerdict struct {
+	ModerationViolation
+	Grade   string `json:"grade"`
+	Strikes int    `json:"strikes"`
+	Message string `json:"message"` // Persian, shown to the user
+}
+
+// moderateAIInput checks a user's text before it is sent to the AI for feature. It returns nil
+// when the text may be sent, otherwise the verdict whose message is shown instead of an answer.
+func moderateAIInput(user *User, feature, text string) *ModerationVerdict {
+	if !moderationEnabled() || strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	violation := checkModerationRules(activeModerationRules(), text)
+	if (violation == nil || violation.Action == ModerationActionFlag) && moderationClassifierEnabled() && aiClient != nil {
+		classified, err := classifyAIInput(aiClient.ForUser(user), text)
+		if err != nil {
+			// The rules already passed; a classifier outage must not stop the assistant
+			logger.Warn("Moderation classifier failed",
+				zap.Int64("user_id", user.TelegramID),
+				zap.String("feature", feature),
+				zap.Error(err))
+			metrics.IncModeration("classifier", "error")
+		} else if classified != nil {
+			violation = classified
+		}
+	}
+	if violation == nil {
+		return nil
+	}
+	return enforceModeration(user.TelegramID, feature, text, violation)
+}
+
+// moderationSecurityRules maps the categories of user input to security rules
+var moderationSecurityRules = map[string]string{
+	ModerationPromptInjection: SecurityRulePromptInjection,
+	ModerationDisallowed:      SecurityRuleDisallowedContent,
+}
+
+// enforceModeration applies the graded response policy to a violation and records it. Flagged
+// texts are only reported to the security detector and nil is returned.
+func enforceModeration(telegramID int64, feature, text string, v *ModerationViolation) *ModerationVerdict {
+	metrics.IncModeration(v.Category, v.Action)
+	rule := securityRules[moderationSecurityRules[v.Category]]
+	details := fmt.Sprintf("%s matched %s on %s", v.Category, v.Rule, feature)
+	if text != "" {
+		details += ": " + truncateForSecurityEvent(text)
+	}
+
+	logger.Warn("AI input refused by moderation",
+		zap.Int64("user_id", telegramID),
+		zap.String("feature", feature),
+		zap.String("category", v.Category),
+		zap.String("rule", v.Rule),
+		zap.String("action", v.Action))
+
+	if v.Action == ModerationActionFlag {
+		reportSecuritySignal(rule.Name, telegramID, "", "Flagged AI input: "+details)
+		return nil
+	}
+
+	verdict := &ModerationVerdict{ModerationViolation: *v, Grade: ModerationGradeBlock}
+	if telegramID != 0 {
+		verdict.Grade, verdict.Strikes = nextModerationGrade(telegramID, v.Action, time.Now())
+	}
+
+	severity := rule.Severity
+	if verdict.Grade == ModerationGradeBan {
+		severity = SeverityHigh
+		blockSuspiciousUser(telegramID, "تخلف مکرر از قوانین استفاده از دستیار هوش مصنوعی")
+	}
+	recordSecurityEvent(&SecurityEvent{
+		TelegramID:  telegramID,
+		Rule:        rule.Name,
+		Severity:    severity,
+		Subject:     strconv.FormatInt(telegramID, 10),
+		Details:     fmt.Sprintf("%s (strike %d, %s)", details, verdict.Strikes, verdict.Grade),
+		SignalCount: verdict.Strikes,
+	})
+
+	verdict.Message = moderationMessage(verdict.Grade, moderationBanStrikes()-verdict.Strikes)
+	return verdict
+}
+
+// nextModerationGrade counts a strike for the user and grades the response
+func nextModerationGrade(telegramID int64, action string, now time.Time) (string, int) {
+	limit := moderationBanStrikes()
+	strikes, fired := moderationStrikes.Record(SecurityRule{
+		Name:      "moderation_strikes",
+		Threshold: limit,
+		Window:    moderationStrikeWindow,
+	}, strconv.FormatInt(telegramID, 10), now)
+
+	switch {
+	case fired:
+		return ModerationGradeBan, strikes
+	case action == ModerationActionBan:
+		return ModerationGradeBan, limit
+	case strikes <= 1:
+		return ModerationGradeWarn, strikes
+	default:
+		return ModerationGradeBlock, strikes
+	}
+}
+
+func moderationMessage(grade string, strikesLeft int) string {
+	switch grade {
+	case ModerationGradeBan:
+		return "🚫 به دلیل ارسال مکرر پیام‌های مغایر با قوانین، دسترسی شما به دستیار هوش مصنوعی موقتاً مسدود شد."
+	case ModerationGradeBlock:
+		return fmt.Sprintf("⚠️ پیام شما با قوانین استفاده از دستیار هوش مصنوعی سازگار نیست و ارسال نشد.\n\nبا %d تخلف دیگر، دسترسی شما به دستیار موقتاً مسدود می‌شود.", strikesLeft)
+	default:
+		return "⚠️ پیام شما با قوانین استفاده از دستیار هوش مصنوعی سازگار نیست و ارسال نشد. لطفا سوال خود را درباره کسب‌وکار و مطالب دوره بپرسید."
+	}
+}
+
+// rejectIfModerated answers the request with the moderation verdict when text is refused
+func rejectIfModerated(c *gin.Context, user *User, feature, text string) bool {
+	verdict := moderateAIInput(user, feature, text)
+	if verdict == nil {
+		return false
+	}
+	status := http.StatusBadRequest
+	if verdict.Grade == ModerationGradeBan {
+		status = http.StatusForbidden
+	}
+	c.JSON(status, APIResponse{
+		Success: false,
+		Error:   verdict.Message,
+	})
+	return true
+}
+
+// ==========================================
+// Output check
+// ==========================================
+
+// errAIOutputBlocked is returned when an answer was stopped by the output check
+var errAIOutputBlocked = errors.New("AI answer blocked by the output check")
+
+// promptLeakReply replaces an answer that repeats the system prompt
+const promptLeakReply = "متاسفانه نمی‌توانم به این درخواست پاسخ بدهم. لطفا سوال خود را درباره کسب‌وکار و مطالب دوره بپرسید."
+
+// promptLeakGuard finds lines of the system prompt repeated in an answer
+type promptLeakGuard struct {
+	fragments []string
+	longest   int // Runes of the longest fragment
+}
+
+// newPromptLeakGuard prepares the check for the system prompt of a request (the first message)
+func newPromptLeakGuard(messages []LLMMessage) *promptLeakGuard {
+	guard := &promptLeakGuard{}
+	if len(messages) == 0 || messages[0].Role != "system" {
+		return guard
+	}
+	for _, line := range strings.FieldsFunc(messages[0].Content, func(r rune) bool {
+		return r == '\n' || r == '.' || r == '؟' || r == '?' || r == '!'
+	}) {
+		fragment := normalizeLeakText(line)
+		if n := utf8.RuneCountInString(fragment); n >= minLeakFragmentRunes {
+			guard.fragments = append(guard.fragments, fragment)
+			if n > guard.longest {
+				guard.longest = n
+			}
+		}
+	}
+	return guard
+}
+
+// normalizeLeakText lowercases text and collapses whitespace and list markers
+func normalizeLeakText(text string) string {
+	fields := strings.Fields(strings.ToLower(text))
+	for len(fields) > 0 && strings.Trim(fields[0], "-*•0123456789)") == "" {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
+
+// leaks reports whether answer contains a line of the system prompt
+func (g *promptLeakGuard) leaks(answer string) bool {
+	if len(g.fragments) == 0 {
+		return false
+	}
+	normalized := normalizeLeakText(answer)
+	for _, fragment := range g.fragments {
+		if strings.Contains(normalized, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// leaksTail is leaks on the end of a growing answer, enough to catch a fragment completed by
+// the latest chunk of a stream
+func (g *promptLeakGuard) leaksTail(answer string, chunk string) bool {
+	if len(g.fragments) == 0 {
+		return false
+	}
+	runes := []rune(answer)
+	if keep := 2*g.longest + utf8.RuneCountInString(chunk); len(runes) > keep {
+		runes = runes[len(runes)-keep:]
+	}
+	return g.leaks(string(runes))
+}
+
+// reportPromptLeak records an answer that repeated the system prompt; served names the
+// provider and model when known. The model wrote the leak, not the user: it is a security
+// event for the admins but never a moderation strike.
+func reportPromptLeak(user *User, feature, served string) {
+	var telegramID int64
+	if user != nil {
+		telegramID = user.TelegramID
+	}
+	metrics.IncModeration(ModerationPromptLeak, "replaced")
+	logger.Warn("AI answer replaced by the output check",
+		zap.Int64("user_id", telegramID),
+		zap.String("feature", feature),
+		zap.String("served", served))
+
+	rule := securityRules[SecurityRulePromptLeak]
+	subject := feature
+	if telegramID != 0 {
+		subject = strconv.FormatInt(telegramID, 10)
+	}
+	recordSecurityEvent(&SecurityEvent{
+		TelegramID:  telegramID,
+		Rule:        rule.Name,
+		Severity:    rule.Severity,
+		Subject:     subject,
+		Details:     fmt.Sprintf("The answer on %s repeated the system prompt (%s) and was replaced", feature, served),
+		SignalCount: 1,
+	})
+}
+
+// ==========================================
+// Admin API
+// ==========================================
+
+// moderationRuleRequest is the body of the rule create and update endpoints
+type moderationRuleRequest struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Pattern     string `json:"pattern"`
+	Action      string `json:"action"`
+	Description string `json:"description"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+// apply validates the request and copies it onto rule. Built-in rules keep their name.
+func (req *moderationRuleRequest) apply(rule *ModerationRule) string {
+	req.Name, req.Pattern = strings.TrimSpace(req.Name), strings.TrimSpace(req.Pattern)
+	if rule.Builtin {
+		req.Name = rule.Name
+	}
+	if req.Name == "" || req.Pattern == "" {
+		return "Name and pattern are required"
+	}
+	if req.Category != ModerationPromptInjection && req.Category != ModerationDisallowed {
+		return "category must be prompt_injection or disallowed_content"
+	}
+	if _, ok := moderationActionRank[req.Action]; !ok {
+		return "action must be flag, block or ban"
+	}
+	if _, err := compileModerationPattern(req.Pattern); err != nil {
+		return "Invalid pattern: " + err.Error()
+	}
+
+	rule.Name, rule.Category, rule.Pattern, rule.Action = req.Name, req.Category, req.Pattern, req.Action
+	rule.Description = strings.TrimSpace(req.Description)
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+	return ""
+}
+
+// getModerationRulesAPI handles GET /api/v1/admin/moderation/rules
+func getModerationRulesAPI(c *gin.Context) {
+	var rules []ModerationRule
+	if err := db.Order("id").Find(&rules).Error; err != nil {
+		logger.Error("Failed to list moderation rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"rules":       rules,
+			"classifier":  moderationClassifierEnabled(),
+			"enabled":     moderationEnabled(),
+			"ban_strikes": moderationBanStrikes(),
+		},
+	})
+}
+
+// createModerationRuleAPI handles POST /api/v1/admin/moderation/rules
+func createModerationRuleAPI(c *gin.Context) {
+	var req moderationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	rule := ModerationRule{IsActive: true}
+	if errMsg := req.apply(&rule); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": errMsg})
+		return
+	}
+	if err := db.Create(&rule).Error; err != nil {
+		logger.Error("Failed to create moderation rule", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	logger.Info("Moderation rule created by admin",
+		zap.Uint("rule_id", rule.ID),
+		zap.String("rule", rule.Name),
+		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rule})
+}
+
+// updateModerationRuleAPI handles PUT /api/v1/admin/moderation/rules/:id
+func updateModerationRuleAPI(c *gin.Context) {
+	var rule ModerationRule
+	if err := db.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Moderation rule not found"})
+		return
+	}
+
+	var req moderationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+	if errMsg := req.apply(&rule); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": errMsg})
+		return
+	}
+	if err := db.Save(&rule).Error; err != nil {
+		logger.Error("Failed to update moderation rule", zap.Uint("rule_id", rule.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	logger.Info("Moderation rule updated by admin",
+		zap.Uint("rule_id", rule.ID),
+		zap.String("rule", rule.Name),
+		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rule})
+}
+
+// deleteModerationRuleAPI handles DELETE /api/v1/admin/moderation/rules/:id
+func deleteModerationRuleAPI(c *gin.Context) {
+	var rule ModerationRule
+	if err := db.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Moderation rule not found"})
+		return
+	}
+	if rule.Builtin {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Built-in rules can only be disabled"})
+		return
+	}
+	if err := db.Delete(&rule).Error; err != nil {
+		logger.Error("Failed to delete moderation rule", zap.Uint("rule_id", rule.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	logger.Warn("Moderation rule deleted by admin",
+		zap.Uint("rule_id", rule.ID),
+		zap.String("rule", rule.Name),
+		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Moderation rule deleted successfully"})
+}
+
+// checkModerationAPI handles POST /api/v1/admin/moderation/check with {"text": "..."}, showing
+// what the rules and the classifier find without counting a strike
+func checkModerationAPI(c *gin.Context) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "text is required"})
+		return
+	}
+
+	data := gin.H{"rules": checkModerationRules(activeModerationRules(), req.Text)}
+	if moderationClassifierEnabled() && aiClient != nil {
+		classified, err := classifyAIInput(aiClient, req.Text)
+		if err != nil {
+			data["classifier_error"] = err.Error()
+		} else {
+			data["classifier"] = classified
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 
@@ -59,6 +60,8 @@ func (h *PaymentHandler) HandleCallback(w http.ResponseWriter, r *http.Request)
 		logger.Error("Transaction not found",
 			zap.String("authority", authority),
 			zap.Error(err))
+		reportSecuritySignal(SecurityRulePaymentAnomaly, 0, callbackClientIP(r),
+			"Payment callbacks with unknown authorities; last: "+authority)
 
 		// نمایش صفحه HTML ناموفق
 		h.renderPaymentResultPage(w, r, "failed", "", "", "")
@@ -742,3 +745,11 @@ func getPlanTypeName(planType string) string {
 		return planType
 	}
 }
+
+// callbackClientIP returns the caller IP of a payment callback without the port
+func callbackClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -173,6 +173,10 @@ func (s *PaymentService) CreatePaymentRequest(
 
 	description := s.GetPlanDescription(planType)
 
+	// 🔒 SECURITY: Many payment requests in a short time are reported as an anomaly
+	reportSecuritySignal(SecurityRulePaymentAnomaly, telegramIDForUser(userID), "",
+		"Many payment requests in a short time; last plan: "+planType)
+
 	// 2. ایجاد رکورد تراکنش در دیتابیس
 	transaction := PaymentTransaction{
 		UserID:      userID,
@@ -356,6 +360,8 @@ func (s *PaymentService) VerifyPayment(authority string, amount int) (*PaymentTr
 			zap.String("authority", authority),
 			zap.Int("code", response.Data.Code),
 			zap.String("message", response.Data.Message))
+		reportSecuritySignal(SecurityRulePaymentAnomaly, telegramIDForUser(transaction.UserID), "",
+			fmt.Sprintf("Repeated failed payment verifications; last code: %d", response.Data.Code))
 	}
 
 	// 7. ذخیره وضعیت نهایی با atomic update
@@ -524,8 +530,6 @@ func (s *PaymentService) UpdateUserSubscription(userID uint, planType string) er
 		user.FreeTrialExpireSMSSent = true
 	}
 
-	user.IsActive = true
-
 	if err := s.db.Save(&user).Error; err != nil {
 		logger.Error("Failed to update user subscription",
 			zap.Uint("user_id", userID),
@@ -533,6 +537,8 @@ func (s *PaymentService) UpdateUserSubscription(userID uint, planType string) er
 			zap.Error(err))
 		return err
 	}
+	// IsActive mirrors the user's bans, a payment does not lift them
+	syncUserBanFlags(user.TelegramID)
 
 	logger.Info("User subscription updated",
 		zap.Uint("user_id", userID),
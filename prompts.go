@@ -0,0 +1,555 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Prompt templates are Go text/template strings ({{.variable}}) stored with every edit as a new
+// version. The built-in copy in prompt_defaults.go is seeded as version 1 and stays the fallback
+// when the database is unavailable or an edited version fails to render.
+
+// promptCacheTTL bounds how long another instance keeps serving a version after an admin change
+const promptCacheTTL = time.Minute
+
+// PromptTemplate is a named prompt with a pointer to the version in use
+type PromptTemplate struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Description   string    `gorm:"size:255" json:"description"`
+	Variables     string    `gorm:"size:255" json:"variables"` // Comma separated, filled in by the code
+	ActiveVersion int       `gorm:"not null;default:1" json:"active_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// PromptTemplateVersion is one immutable revision of a template
+type PromptTemplateVersion struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TemplateID uint      `gorm:"not null;uniqueIndex:idx_prompt_template_version" json:"template_id"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_prompt_template_version" json:"version"`
+	Content    string    `gorm:"type:text;not null" json:"content"`
+	Note       string    `gorm:"size:255" json:"note"`
+	CreatedBy  *uint     `json:"created_by"` // Admin ID, nil for the built-in seed
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// builtinPrompt is the in-code default of a template
+type builtinPrompt struct {
+	Name        string
+	Description string
+	Feature     string   // LLM feature used by previews
+	Role        string   // "system" or "user" message
+	System      string   // Template sent as system prompt with a user template
+	Variables   []string // Keys the caller fills in
+	Content     string
+}
+
+type cachedPrompt struct {
+	tmpl     *template.Template
+	version  int // 0 when the built-in copy is served
+	loadedAt time.Time
+}
+
+var (
+	builtinPromptIndex     = map[string]*builtinPrompt{}
+	builtinPromptTemplates = map[string]*template.Template{}
+
+	promptCache      = map[string]cachedPrompt{}
+	promptCacheMutex sync.RWMutex
+)
+
+var errUnknownPrompt = errors.New("unknown prompt template")
+
+func init() {
+	for i := range builtinPrompts {
+		p := &builtinPrompts[i]
+		tmpl, err := validatePromptContent(p, p.Content)
+		if err != nil {
+			panic(fmt.Sprintf("built-in prompt %s: %v", p.Name, err))
+		}
+		builtinPromptIndex[p.Name] = p
+		builtinPromptTemplates[p.Name] = tmpl
+	}
+}
+
+// parsePrompt parses template content; a variable the caller does not provide is an error
+func parsePrompt(name, content string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(content)
+}
+
+// samplePromptVars returns a placeholder for every variable of a template
+func samplePromptVars(p *builtinPrompt, vars map[string]string) map[string]string {
+	sample := make(map[string]string, len(p.Variables))
+	for _, name := range p.Variables {
+		if value, ok := vars[name]; ok {
+			sample[name] = value
+		} else {
+			sample[name] = "[" + name + "]"
+		}
+	}
+	return sample
+}
+
+// validatePromptContent parses content and checks it only uses the variables of the template
+func validatePromptContent(p *builtinPrompt, content string) (*template.Template, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("content is empty")
+	}
+	tmpl, err := parsePrompt(p.Name, content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := executePrompt(tmpl, samplePromptVars(p, nil)); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func executePrompt(tmpl *template.Template, vars map[string]string) (string, error) {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// activePrompt returns the template in use for name, loading it from the database at most once per promptCacheTTL
+func activePrompt(name string) (*template.Template, int) {
+	promptCacheMutex.RLock()
+	cached, ok := promptCache[name]
+	promptCacheMutex.RUnlock()
+	if ok && time.Since(cached.loadedAt) < promptCacheTTL {
+		return cached.tmpl, cached.version
+	}
+
+	cached = cachedPrompt{tmpl: builtinPromptTemplates[name], loadedAt: time.Now()}
+	if db != nil {
+		if tmpl, version, err := loadActivePrompt(name); err == nil {
+			cached.tmpl, cached.version = tmpl, version
+		} else {
+			logger.Warn("Using built-in prompt template",
+				zap.String("prompt", name),
+				zap.Error(err))
+		}
+	}
+
+	promptCacheMutex.Lock()
+	promptCache[name] = cached
+	promptCacheMutex.Unlock()
+	return cached.tmpl, cached.version
+}
+
+func loadActivePrompt(name string) (*template.Template, int, error) {
+	var tpl PromptTemplate
+	if err := db.Where("name = ?", name).First(&tpl).Error; err != nil {
+		return nil, 0, err
+	}
+	var version PromptTemplateVersion
+	if err := db.Where("template_id = ? AND version = ?", tpl.ID, tpl.ActiveVersion).First(&version).Error; err != nil {
+		return nil, 0, err
+	}
+	tmpl, err := parsePrompt(name, version.Content)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tmpl, version.Version, nil
+}
+
+// promptVersion returns the version of a template in use, 0 when the built-in copy is served
+func promptVersion(name string) int {
+	_, version := activePrompt(name)
+	return version
+}
+
+// invalidatePrompt drops the cached copy of a template after an admin change
+func invalidatePrompt(name string) {
+	promptCacheMutex.Lock()
+	delete(promptCache, name)
+	promptCacheMutex.Unlock()
+}
+
+// renderPrompt renders the active version of a prompt template. If the stored version fails
+// to render the built-in copy is used, so a bad edit never breaks an AI feature.
+func renderPrompt(name string, vars map[string]string) string {
+	tmpl, version := activePrompt(name)
+	if tmpl != nil {
+		out, err := executePrompt(tmpl, vars)
+		if err == nil {
+			return out
+		}
+		logger.Error("Failed to render prompt template, using built-in copy",
+			zap.String("prompt", name),
+			zap.Int("version", version),
+			zap.Error(err))
+	}
+
+	builtin, ok := builtinPromptTemplates[name]
+	if !ok {
+		logger.Error("Unknown prompt template", zap.String("prompt", name))
+		return ""
+	}
+	out, err := executePrompt(builtin, vars)
+	if err != nil {
+		logger.Error("Failed to render built-in prompt template",
+			zap.String("prompt", name),
+			zap.Error(err))
+	}
+	return out
+}
+
+// seedPromptTemplates stores the built-in templates that are not in the database yet as version 1
+func seedPromptTemplates() {
+	for _, p := range builtinPrompts {
+		variables := strings.Join(p.Variables, ",")
+
+		var tpl PromptTemplate
+		err := db.Where("name = ?", p.Name).First(&tpl).Error
+		if err == nil {
+			// Variables and description belong to the code, keep them in sync
+			if tpl.Variables != variables || tpl.Description != p.Description {
+				db.Model(&tpl).Updates(map[string]interface{}{
+					"variables":   variables,
+					"description": p.Description,
+				})
+			}
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Error("Failed to load prompt template", zap.String("prompt", p.Name), zap.Error(err))
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			tpl = PromptTemplate{Name: p.Name, Description: p.Description, Variables: variables, ActiveVersion: 1}
+			if err := tx.Create(&tpl).Error; err != nil {
+				return err
+			}
+			return tx.Create(&PromptTemplateVersion{
+				TemplateID: tpl.ID,
+				Version:    1,
+				Content:    p.Content,
+				Note:       "Built-in default",
+			}).Error
+		})
+		if err != nil {
+			logger.Error("Failed to seed prompt template", zap.String("prompt", p.Name), zap.Error(err))
+			continue
+		}
+		logger.Info("Prompt template seeded", zap.String("prompt", p.Name))
+	}
+}
+
+// promptFromRequest loads the template named in the URL
+func promptFromRequest(c *gin.Context) (*builtinPrompt, *PromptTemplate, bool) {
+	name := c.Param("name")
+	builtin, ok := builtinPromptIndex[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": errUnknownPrompt.Error()})
+		return nil, nil, false
+	}
+
+	var tpl PromptTemplate
+	if err := db.Where("name = ?", name).First(&tpl).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Prompt template not seeded"})
+			return nil, nil, false
+		}
+		logger.Error("Failed to load prompt template", zap.String("prompt", name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return nil, nil, false
+	}
+	return builtin, &tpl, true
+}
+
+// logPromptAction records a template change in the admin audit log
+func logPromptAction(c *gin.Context, tpl *PromptTemplate, action, details string) {
+	adminID := getAdminIDFromContext(c)
+	if adminID != nil {
+		var admin Admin
+		admin.ID = *adminID
+		logAdminAction(&admin, action, details, "prompt_template", tpl.ID)
+	}
+	logger.Info("Prompt template changed by admin",
+		zap.String("prompt", tpl.Name),
+		zap.String("action", action),
+		zap.String("details", details))
+}
+
+// getPromptTemplatesAPI handles GET /api/v1/admin/prompts
+func getPromptTemplatesAPI(c *gin.Context) {
+	var templates []PromptTemplate
+	if err := db.Order("name ASC").Find(&templates).Error; err != nil {
+		logger.Error("Failed to list prompt templates", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(templates))
+	for _, tpl := range templates {
+		builtin, ok := builtinPromptIndex[tpl.Name]
+		if !ok {
+			continue // Template removed from the code
+		}
+		result = append(result, gin.H{
+			"id":             tpl.ID,
+			"name":           tpl.Name,
+			"description":    tpl.Description,
+			"variables":      builtin.Variables,
+			"feature":        builtin.Feature,
+			"role":           builtin.Role,
+			"active_version": tpl.ActiveVersion,
+			"updated_at":     tpl.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// getPromptTemplateAPI handles GET /api/v1/admin/prompts/:name, versions newest first
+func getPromptTemplateAPI(c *gin.Context) {
+	builtin, tpl, ok := promptFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var versions []PromptTemplateVersion
+	if err := db.Where("template_id = ?", tpl.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		logger.Error("Failed to load prompt versions", zap.String("prompt", tpl.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"template":        tpl,
+			"variables":       builtin.Variables,
+			"feature":         builtin.Feature,
+			"role":            builtin.Role,
+			"builtin_content": builtin.Content,
+			"versions":        versions,
+		},
+	})
+}
+
+// createPromptVersionAPI handles POST /api/v1/admin/prompts/:name/versions.
+// The new version is activated unless "activate" is false.
+func createPromptVersionAPI(c *gin.Context) {
+	builtin, tpl, ok := promptFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content  string `json:"content"`
+		Note     string `json:"note"`
+		Activate *bool  `json:"activate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+	if _, err := validatePromptContent(builtin, req.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid template: " + err.Error(),
+			"data":    gin.H{"variables": builtin.Variables},
+		})
+		return
+	}
+	activate := req.Activate == nil || *req.Activate
+
+	version := PromptTemplateVersion{
+		TemplateID: tpl.ID,
+		Content:    req.Content,
+		Note:       req.Note,
+		CreatedBy:  getAdminIDFromContext(c),
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&PromptTemplateVersion{}).Where("template_id = ?", tpl.ID).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		version.Version = latest + 1
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+		if activate {
+			return tx.Model(tpl).Update("active_version", version.Version).Error
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to create prompt version", zap.String("prompt", tpl.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to save prompt version"})
+		return
+	}
+
+	invalidatePrompt(tpl.Name)
+	logPromptAction(c, tpl, "prompt_version_created",
+		fmt.Sprintf("%s v%d (active: %t) %s", tpl.Name, version.Version, activate, req.Note))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"version": version, "active_version": tpl.ActiveVersion},
+	})
+}
+
+// activatePromptVersion points a template to one of its versions
+func activatePromptVersion(c *gin.Context, tpl *PromptTemplate, target int, action string) {
+	var version PromptTemplateVersion
+	if err := db.Where("template_id = ? AND version = ?", tpl.ID, target).First(&version).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Version not found"})
+		return
+	}
+	if _, err := parsePrompt(tpl.Name, version.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid template: " + err.Error()})
+		return
+	}
+
+	previous := tpl.ActiveVersion
+	if err := db.Model(tpl).Update("active_version", target).Error; err != nil {
+		logger.Error("Failed to activate prompt version", zap.String("prompt", tpl.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	invalidatePrompt(tpl.Name)
+	logPromptAction(c, tpl, action, fmt.Sprintf("%s v%d -> v%d", tpl.Name, previous, target))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"previous_version": previous, "active_version": target},
+	})
+}
+
+// activatePromptVersionAPI handles POST /api/v1/admin/prompts/:name/activate {"version": n}
+func activatePromptVersionAPI(c *gin.Context) {
+	_, tpl, ok := promptFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid version"})
+		return
+	}
+
+	activatePromptVersion(c, tpl, req.Version, "prompt_version_activated")
+}
+
+// rollbackPromptAPI handles POST /api/v1/admin/prompts/:name/rollback, activating the version before the active one
+func rollbackPromptAPI(c *gin.Context) {
+	_, tpl, ok := promptFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var previous PromptTemplateVersion
+	if err := db.Where("template_id = ? AND version < ?", tpl.ID, tpl.ActiveVersion).
+		Order("version DESC").First(&previous).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "No earlier version to roll back to"})
+		return
+	}
+
+	activatePromptVersion(c, tpl, previous.Version, "prompt_rolled_back")
+}
+
+// previewPromptAPI handles POST /api/v1/admin/prompts/:name/preview.
+// It renders unsaved content, a stored version or the active one with sample variables;
+// with "run": true the rendered prompt is also sent to the AI the way the feature does.
+func previewPromptAPI(c *gin.Context) {
+	builtin, tpl, ok := promptFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content   string            `json:"content"`
+		Version   int               `json:"version"`
+		Variables map[string]string `json:"variables"`
+		Message   string            `json:"message"` // User message sent with a system template
+		Run       bool              `json:"run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request"})
+		return
+	}
+
+	content := req.Content
+	version := 0
+	if content == "" {
+		version = tpl.ActiveVersion
+		if req.Version > 0 {
+			version = req.Version
+		}
+		var stored PromptTemplateVersion
+		if err := db.Where("template_id = ? AND version = ?", tpl.ID, version).First(&stored).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Version not found"})
+			return
+		}
+		content = stored.Content
+	}
+
+	tmpl, err := validatePromptContent(builtin, content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid template: " + err.Error()})
+		return
+	}
+	rendered, err := executePrompt(tmpl, samplePromptVars(builtin, req.Variables))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid template: " + err.Error()})
+		return
+	}
+
+	data := gin.H{
+		"version":  version,
+		"rendered": rendered,
+	}
+
+	if req.Run {
+		if aiClient == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "AI service not available"})
+			return
+		}
+
+		systemPrompt, userMessage := rendered, req.Message
+		if builtin.Role != "system" {
+			systemPrompt, userMessage = renderPrompt(builtin.System, nil), rendered
+		}
+		if strings.TrimSpace(userMessage) == "" {
+			userMessage = "سلام"
+		}
+
+		resp, err := aiClient.GenerateChatResponse(builtin.Feature, systemPrompt, userMessage, 2000)
+		if err != nil {
+			logger.Error("Prompt preview failed", zap.String("prompt", tpl.Name), zap.Error(err))
+			c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": "AI request failed: " + err.Error()})
+			return
+		}
+		data["response"] = resp.Content
+		data["provider"] = resp.Provider
+		data["model"] = resp.Model
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRenderPromptUsesBuiltinWithoutDatabase asserts templates render from the built-in copy
+// when no database is configured and that variable values are inserted verbatim.
+func TestRenderPromptUsesBuiltinWithoutDatabase(t *testing.T) {
+	got := renderPrompt(PromptClientFinderRequest, map[string]string{
+		"product":       "دوره {{.secret}}",
+		"target_client": "فریلنسرها",
+		"platforms":     "اینستاگرام, لینکدین",
+	})
+	for _, want := range []string{"محصول/خدمات: دوره {{.secret}}", "مخاطب هدف: فریلنسرها", "پلتفرم‌های مورد نظر: اینستاگرام, لینکدین"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rendered prompt is missing %q", want)
+		}
+	}
+
+	if renderPrompt(PromptChatSystem, nil) != builtinPromptIndex[PromptChatSystem].Content {
+		t.Error("a template without variables should render to its content")
+	}
+}
+
+// TestValidatePromptContentRejectsUnknownVariables asserts an edit can only use the variables the code provides.
+func TestValidatePromptContentRejectsUnknownVariables(t *testing.T) {
+	builtin := builtinPromptIndex[PromptSellKitRequest]
+
+	if _, err := validatePromptContent(builtin, "محصول: {{.product_name}} برای {{.target_audience}}"); err != nil {
+		t.Errorf("valid edit rejected: %v", err)
+	}
+	if _, err := validatePromptContent(builtin, "قیمت: {{.price}}"); err == nil {
+		t.Error("undeclared variable should be rejected")
+	}
+	if _, err := validatePromptContent(builtin, "محصول: {{.product_name"); err == nil {
+		t.Error("unterminated action should be rejected")
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Answer ratings: users rate chat answers and tool results with a thumbs up or down and an
+// optional comment, from inline buttons under bot answers or from the mini app. Each rating
+// keeps the prompt template version, provider and model that produced the answer so the
+// admin panel can compare prompt versions and models and list low-rated answers for tuning.
+
+const (
+	RatingTargetChatMessage = "chat_message"
+	RatingTargetToolResult  = "tool_result"
+
+	maxRatingCommentLength  = 1000
+	pendingRatingCommentTTL = 10 * time.Minute
+)
+
+// AIRating is one user's rating of an AI answer; rating the same answer again replaces it
+type AIRating struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	TelegramID    int64     `gorm:"index" json:"telegram_id"`
+	Target        string    `gorm:"size:16;uniqueIndex:idx_ai_rating_target" json:"target"` // chat_message or tool_result
+	TargetID      uint      `gorm:"uniqueIndex:idx_ai_rating_target" json:"target_id"`
+	Score         int       `json:"score"` // 1 helpful, -1 not helpful
+	Comment       string    `gorm:"size:1000" json:"comment,omitempty"`
+	Feature       string    `gorm:"size:32;index" json:"feature"` // chat or the tool's feature name
+	Prompt        string    `gorm:"size:64" json:"prompt"`        // Prompt template the answer was generated with
+	PromptVersion int       `json:"prompt_version"`               // 0 for the built-in copy
+	Provider      string    `gorm:"size:32" json:"provider"`
+	Model         string    `gorm:"size:100" json:"model"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+var errRatedAnswerNotFound = errors.New("rated answer not found")
+
+// ratedAnswer prepares a rating of an answer of telegramID with what produced the answer
+func ratedAnswer(telegramID int64, target string, targetID uint) (*AIRating, error) {
+	rating := &AIRating{TelegramID: telegramID, Target: target, TargetID: targetID}
+
+	var err error
+	switch target {
+	case RatingTargetChatMessage:
+		var message ChatMessage
+		if err = db.Where("id = ? AND telegram_id = ?", targetID, telegramID).First(&message).Error; err == nil {
+			rating.Feature, rating.Prompt, rating.PromptVersion = FeatureChat, PromptChatSystem, message.PromptVersion
+			rating.Provider, rating.Model = message.Provider, message.Model
+		}
+	case RatingTargetToolResult:
+		var result ToolResult
+		if err = db.Where("id = ? AND telegram_id = ?", targetID, telegramID).First(&result).Error; err == nil {
+			rating.Feature, rating.PromptVersion = result.Tool, result.PromptVersion
+			rating.Provider, rating.Model = result.Provider, result.Model
+			if tool := toolByFeature(result.Tool); tool != nil {
+				rating.Prompt = tool.Prompt
+			}
+		}
+	default:
+		return nil, errRatedAnswerNotFound
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errRatedAnswerNotFound
+	}
+	return rating, err
+}
+
+// rateAnswer saves a user's score for one of their answers. A nil comment keeps the comment
+// of an earlier rating.
+func rateAnswer(telegramID int64, target string, targetID uint, score int, comment *string) (*AIRating, error) {
+	rating, err := ratedAnswer(telegramID, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+	rating.Score = score
+
+	var existing AIRating
+	err = db.Where("target = ? AND target_id = ?", target, targetID).First(&existing).Error
+	switch {
+	case err == nil:
+		rating.ID, rating.CreatedAt, rating.Comment = existing.ID, existing.CreatedAt, existing.Comment
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+	if comment != nil {
+		rating.Comment = *comment
+	}
+
+	if err := db.Save(rating).Error; err != nil {
+		return nil, err
+	}
+	metrics.IncAIRating(rating.Target, ratingLabel(score))
+	return rating, nil
+}
+
+// commentOnRating adds a comment to the user's existing rating of an answer
+func commentOnRating(telegramID int64, target string, targetID uint, comment string) error {
+	result := db.Model(&AIRating{}).
+		Where("target = ? AND target_id = ? AND telegram_id = ?", target, targetID, telegramID).
+		Update("comment", comment)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errRatedAnswerNotFound
+	}
+	metrics.IncAIRating(target, "comment")
+	return nil
+}
+
+// normalizeRatingComment trims a comment; ok is false when it is too long
+func normalizeRatingComment(comment string) (string, bool) {
+	comment = strings.TrimSpace(comment)
+	return comment, utf8.RuneCountInString(comment) <= maxRatingCommentLength
+}
+
+func ratingLabel(score int) string {
+	if score > 0 {
+		return "up"
+	}
+	return "down"
+}
+
+// ==========================================
+// Bot
+// ==========================================
+
+// ratingKeyboard is shown under an AI answer in the bot. score marks the chosen button
+// after the user rated the answer (0 before).
+func ratingKeyboard(target string, targetID uint, score int) tgbotapi.InlineKeyboardMarkup {
+	up, down := "👍", "👎"
+	if score > 0 {
+		up = "✅ 👍"
+	} else if score < 0 {
+		down = "✅ 👎"
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(up, fmt.Sprintf("rate:%s:%d:up", target, targetID)),
+			tgbotapi.NewInlineKeyboardButtonData(down, fmt.Sprintf("rate:%s:%d:down", target, targetID)),
+		),
+	}
+	if score != 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✍️ افزودن توضیح", fmt.Sprintf("rate_comment:%s:%d", target, targetID)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// parseRatingCallback reads "rate:<target>:<id>:<up|down>" and "rate_comment:<target>:<id>";
+// score is 0 for a comment request
+func parseRatingCallback(data string) (target string, targetID uint, score int, ok bool) {
+	parts := strings.Split(data, ":")
+	switch {
+	case len(parts) == 4 && parts[0] == "rate" && parts[3] == "up":
+		score = 1
+	case len(parts) == 4 && parts[0] == "rate" && parts[3] == "down":
+		score = -1
+	case len(parts) == 3 && parts[0] == "rate_comment":
+	default:
+		return "", 0, 0, false
+	}
+	if parts[1] != RatingTargetChatMessage && parts[1] != RatingTargetToolResult {
+		return "", 0, 0, false
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil || id == 0 {
+		return "", 0, 0, false
+	}
+	return parts[1], uint(id), score, true
+}
+
+// pendingRatingComment is a rating whose comment is expected as the user's next message
+type pendingRatingComment struct {
+	Target    string
+	TargetID  uint
+	CreatedAt time.Time
+}
+
+var (
+	pendingRatingComments   = make(map[int64]pendingRatingComment)
+	pendingRatingCommentsMu sync.Mutex
+)
+
+// takePendingRatingComment removes and returns the user's pending comment if it is still valid
+func takePendingRatingComment(telegramID int64) (pendingRatingComment, bool) {
+	pendingRatingCommentsMu.Lock()
+	defer pendingRatingCommentsMu.Unlock()
+
+	pending, ok := pendingRatingComments[telegramID]
+	delete(pendingRatingComments, telegramID)
+	if !ok || time.Since(pending.CreatedAt) > pendingRatingCommentTTL {
+		return pendingRatingComment{}, false
+	}
+	return pending, true
+}
+
+// handleRatingCallback handles the rating and comment buttons under an AI answer
+func handleRatingCallback(callback *tgbotapi.CallbackQuery) {
+	target, targetID, score, ok := parseRatingCallback(callback.Data)
+	if !ok {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "❌ خطا"))
+		return
+	}
+
+	if score == 0 {
+		pendingRatingCommentsMu.Lock()
+		pendingRatingComments[callback.From.ID] = pendingRatingComment{Target: target, TargetID: targetID, CreatedAt: time.Now()}
+		pendingRatingCommentsMu.Unlock()
+
+		bot.Send(tgbotapi.NewCallback(callback.ID, ""))
+		sendMessage(callback.From.ID, "✍️ لطفا توضیح خود را درباره این پاسخ در یک پیام بنویسید:")
+		return
+	}
+
+	if _, err := rateAnswer(callback.From.ID, target, targetID, score, nil); err != nil {
+		if !errors.Is(err, errRatedAnswerNotFound) {
+			logger.Error("Failed to save answer rating",
+				zap.Int64("user_id", callback.From.ID),
+				zap.String("target", target),
+				zap.Uint("target_id", targetID),
+				zap.Error(err))
+		}
+		bot.Send(tgbotapi.NewCallback(callback.ID, "❌ ثبت امتیاز انجام نشد"))
+		return
+	}
+
+	bot.Send(tgbotapi.NewCallback(callback.ID, "🙏 از بازخورد شما ممنونیم"))
+	if callback.Message != nil {
+		bot.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+			ratingKeyboard(target, targetID, score)))
+	}
+}
+
+// saveRatingComment stores the user's message as the comment of a pending rating
+func saveRatingComment(telegramID int64, pending pendingRatingComment, text string) string {
+	comment, ok := normalizeRatingComment(text)
+	if !ok {
+		return fmt.Sprintf("❌ توضیح شما باید حداکثر %d کاراکتر باشد.", maxRatingCommentLength)
+	}
+	if comment == "" {
+		return "❌ توضیح نمی‌تواند خالی باشد."
+	}
+	if err := commentOnRating(telegramID, pending.Target, pending.TargetID, comment); err != nil {
+		logger.Error("Failed to save rating comment",
+			zap.Int64("user_id", telegramID),
+			zap.Error(err))
+		return "❌ ثبت توضیح انجام نشد. لطفا دوباره تلاش کنید."
+	}
+	return "✅ توضیح شما ثبت شد. از بازخورد شما ممنونیم 🙏"
+}
+
+// ==========================================
+// Mini App API
+// ==========================================
+
+// rateChatMessageAPI handles PUT /api/v1/user/:telegram_id/messages/:message_id/rating
+func rateChatMessageAPI(c *gin.Context) {
+	rateAnswerAPI(c, RatingTargetChatMessage, "message_id")
+}
+
+// rateToolResultAPI handles PUT /api/v1/user/:telegram_id/tool-results/:result_id/rating
+func rateToolResultAPI(c *gin.Context) {
+	rateAnswerAPI(c, RatingTargetToolResult, "result_id")
+}
+
+// rateAnswerAPI saves {"score": 1|-1, "comment": "..."} for an answer of the account owner
+func rateAnswerAPI(c *gin.Context, target, param string) {
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+	targetID, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid " + param,
+		})
+		return
+	}
+
+	var req struct {
+		Score   int     `json:"score"`
+		Comment *string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Score != 1 && req.Score != -1) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "score must be 1 or -1",
+		})
+		return
+	}
+	if req.Comment != nil {
+		comment, ok := normalizeRatingComment(*req.Comment)
+		if !ok {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Error:   fmt.Sprintf("comment must be at most %d characters", maxRatingCommentLength),
+			})
+			return
+		}
+		req.Comment = &comment
+	}
+
+	rating, err := rateAnswer(telegramID, target, uint(targetID), req.Score, req.Comment)
+	if errors.Is(err, errRatedAnswerNotFound) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Error:   "Answer not found",
+		})
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to save answer rating", zap.Int64("telegram_id", telegramID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    rating,
+	})
+}
+
+// ==========================================
+// Admin API
+// ==========================================
+
+// RatingCounts aggregates the ratings of a group
+type RatingCounts struct {
+	Ratings  int64   `json:"ratings"`
+	Positive int64   `json:"positive"`
+	Negative int64   `json:"negative"`
+	Comments int64   `json:"comments"`
+	Approval float64 `gorm:"-" json:"approval"` // Share of positive ratings, 0..1
+}
+
+// PromptRatingSummary is the ratings of one prompt template version
+type PromptRatingSummary struct {
+	Feature       string `json:"feature"`
+	Prompt        string `json:"prompt"`
+	PromptVersion int    `json:"prompt_version"`
+	RatingCounts
+}
+
+// ModelRatingSummary is the ratings of one provider model
+type ModelRatingSummary struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	RatingCounts
+}
+
+const ratingCountColumns = "COUNT(*) AS ratings, " +
+	"COALESCE(SUM(CASE WHEN score > 0 THEN 1 ELSE 0 END), 0) AS positive, " +
+	"COALESCE(SUM(CASE WHEN score < 0 THEN 1 ELSE 0 END), 0) AS negative, " +
+	"COALESCE(SUM(CASE WHEN comment <> '' THEN 1 ELSE 0 END), 0) AS comments"
+
+func (r *RatingCounts) computeApproval() {
+	if r.Ratings > 0 {
+		r.Approval = float64(r.Positive) / float64(r.Ratings)
+	}
+}
+
+// getAIRatingsAPI handles GET /api/admin/ai/ratings?days=30&feature=
+// Ratings are aggregated per prompt template version and per provider model.
+func getAIRatingsAPI(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if days < 1 || days > 366 {
+		days = 30
+	}
+	until := time.Now()
+	since := until.AddDate(0, 0, -days)
+
+	query := func() *gorm.DB {
+		q := db.Model(&AIRating{}).Where("updated_at >= ?", since)
+		if feature := c.Query("feature"); feature != "" {
+			q = q.Where("feature = ?", feature)
+		}
+		return q
+	}
+
+	var byPrompt []PromptRatingSummary
+	if err := query().Select("feature, prompt, prompt_version, " + ratingCountColumns).
+		Group("feature, prompt, prompt_version").Order("feature, prompt_version").
+		Scan(&byPrompt).Error; err != nil {
+		logger.Error("Failed to summarize ratings by prompt", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+	var byModel []ModelRatingSummary
+	if err := query().Select("provider, model, " + ratingCountColumns).
+		Group("provider, model").Order("ratings DESC").
+		Scan(&byModel).Error; err != nil {
+		logger.Error("Failed to summarize ratings by model", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	var total RatingCounts
+	for i := range byPrompt {
+		byPrompt[i].computeApproval()
+		total.Ratings += byPrompt[i].Ratings
+		total.Positive += byPrompt[i].Positive
+		total.Negative += byPrompt[i].Negative
+		total.Comments += byPrompt[i].Comments
+	}
+	for i := range byModel {
+		byModel[i].computeApproval()
+	}
+	total.computeApproval()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"since":     since,
+			"until":     until,
+			"total":     total,
+			"by_prompt": byPrompt,
+			"by_model":  byModel,
+		},
+	})
+}
+
+// lowRatedAnswer is a negative rating with the rated answer. Chat answers come with the
+// preceding turns of their thread.
+type lowRatedAnswer struct {
+	AIRating
+	Conversation []ChatMessage     `json:"conversation,omitempty"`
+	Result       *ToolResultDetail `json:"result,omitempty"`
+}
+
+// lowRatedContextTurns is how many earlier turns are shown with a low-rated chat answer
+const lowRatedContextTurns = 4
+
+// getLowRatedAnswersAPI handles GET /api/admin/ai/ratings/low?page=&limit=&feature=&prompt_version=&model=&commented=1
+func getLowRatedAnswersAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := db.Model(&AIRating{}).Where("score < 0")
+	if feature := c.Query("feature"); feature != "" {
+		query = query.Where("feature = ?", feature)
+	}
+	if version := c.Query("prompt_version"); version != "" {
+		query = query.Where("prompt_version = ?", version)
+	}
+	if model := c.Query("model"); model != "" {
+		query = query.Where("model = ?", model)
+	}
+	if c.Query("commented") == "1" {
+		query = query.Where("comment <> ''")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var ratings []AIRating
+	if err := query.Order("updated_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&ratings).Error; err != nil {
+		logger.Error("Failed to list low-rated answers", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	answers := make([]lowRatedAnswer, 0, len(ratings))
+	for _, rating := range ratings {
+		answer := lowRatedAnswer{AIRating: rating}
+		switch rating.Target {
+		case RatingTargetChatMessage:
+			answer.Conversation = ratedConversation(rating.TargetID)
+		case RatingTargetToolResult:
+			var result ToolResult
+			if db.First(&result, rating.TargetID).Error == nil {
+				detail := result.detail()
+				answer.Result = &detail
+			}
+		}
+		answers = append(answers, answer)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"answers": answers,
+			"total":   total,
+			"page":    page,
+			"limit":   limit,
+		},
+	})
+}
+
+// ratedConversation returns a rated chat message with the turns before it, oldest first.
+// It is empty when the message was deleted.
+func ratedConversation(messageID uint) []ChatMessage {
+	var message ChatMessage
+	if db.First(&message, messageID).Error != nil {
+		return nil
+	}
+	if message.ThreadID == nil {
+		return []ChatMessage{message}
+	}
+
+	var turns []ChatMessage
+	if err := db.Where("thread_id = ? AND id <= ?", *message.ThreadID, message.ID).
+		Order("id DESC").Limit(lowRatedContextTurns + 1).Find(&turns).Error; err != nil {
+		return []ChatMessage{message}
+	}
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+	return turns
+}
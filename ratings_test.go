@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRatingCallbacks covers the callback data of the rating buttons, comment limits and
+// the expiry of a pending comment.
+func TestRatingCallbacks(t *testing.T) {
+	keyboard := ratingKeyboard(RatingTargetChatMessage, 42, 0)
+	if len(keyboard.InlineKeyboard) != 1 {
+		t.Fatalf("an unrated answer should only have the score buttons, got %d rows", len(keyboard.InlineKeyboard))
+	}
+	down := *keyboard.InlineKeyboard[0][1].CallbackData
+	if target, id, score, ok := parseRatingCallback(down); !ok || target != RatingTargetChatMessage || id != 42 || score != -1 {
+		t.Fatalf("unexpected parse of %q: %s %d %d %v", down, target, id, score, ok)
+	}
+
+	rated := ratingKeyboard(RatingTargetToolResult, 7, 1)
+	if len(rated.InlineKeyboard) != 2 || !strings.HasPrefix(rated.InlineKeyboard[0][0].Text, "✅") {
+		t.Fatalf("a rated answer should mark the score and offer a comment: %+v", rated.InlineKeyboard)
+	}
+	comment := *rated.InlineKeyboard[1][0].CallbackData
+	if target, id, score, ok := parseRatingCallback(comment); !ok || target != RatingTargetToolResult || id != 7 || score != 0 {
+		t.Fatalf("unexpected parse of %q: %s %d %d %v", comment, target, id, score, ok)
+	}
+
+	for _, data := range []string{"rate:chat_message:42", "rate:ticket:1:up", "rate:chat_message:0:up", "rate:chat_message:x:down", "rate_comment:tool_result:7:up"} {
+		if _, _, _, ok := parseRatingCallback(data); ok {
+			t.Fatalf("%q should be rejected", data)
+		}
+	}
+
+	if text, ok := normalizeRatingComment("  خیلی کلی بود \n"); !ok || text != "خیلی کلی بود" {
+		t.Fatalf("unexpected comment %q", text)
+	}
+	if _, ok := normalizeRatingComment(strings.Repeat("ب", maxRatingCommentLength+1)); ok {
+		t.Fatal("a comment over the limit should be rejected")
+	}
+
+	pendingRatingComments[1] = pendingRatingComment{Target: RatingTargetChatMessage, TargetID: 42, CreatedAt: time.Now()}
+	pendingRatingComments[2] = pendingRatingComment{Target: RatingTargetChatMessage, TargetID: 43, CreatedAt: time.Now().Add(-pendingRatingCommentTTL - time.Second)}
+	if pending, ok := takePendingRatingComment(1); !ok || pending.TargetID != 42 {
+		t.Fatalf("the pending comment should be returned, got %+v", pending)
+	}
+	if _, ok := takePendingRatingComment(1); ok {
+		t.Fatal("a pending comment should only be taken once")
+	}
+	if _, ok := takePendingRatingComment(2); ok {
+		t.Fatal("an expired pending comment should be dropped")
+	}
+}
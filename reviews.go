@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Human review of AI-graded submissions. Rejections, low-confidence results and failed gradings are
+// always queued; approvals are sampled. A mentor confirms or overrides the verdict, and an override
+// unlocks or relocks the next session and is sent to the student.
+
+// Sources of reviewed submissions
+const (
+	ReviewSourceExercise = "exercise" // ExerciseSubmission sent to the bot
+	ReviewSourceQuiz     = "quiz"     // Mini App quiz (QuizEvaluation)
+)
+
+// Why a submission was queued for review
+const (
+	ReviewReasonRejected      = "rejected"       // The AI did not pass it
+	ReviewReasonLowConfidence = "low_confidence" // Passed close to the threshold or the verdict could not be parsed
+	ReviewReasonSampled       = "sampled"        // Random sample of AI approvals
+	ReviewReasonAIFailed      = "ai_failed"      // The AI never managed to grade it, or cannot read the submitted file
+)
+
+// Review statuses
+const (
+	ReviewStatusPending    = "pending"
+	ReviewStatusConfirmed  = "confirmed"  // Mentor agreed with the AI
+	ReviewStatusOverridden = "overridden" // Mentor changed the verdict
+)
+
+// reviewLowConfidenceMargin: quiz passes scoring less than this above the passing score are reviewed
+const reviewLowConfidenceMargin = 10
+
+// defaultReviewSampleRate is the share of AI approvals reviewed when EXERCISE_REVIEW_SAMPLE_RATE is unset
+const defaultReviewSampleRate = 0.1
+
+// reviewSample returns a number in [0, 1) for sampling approvals, replaced in tests
+var reviewSample = rand.Float64
+
+// ExerciseReview is a queued mentor review of an AI verdict
+type ExerciseReview struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Source         string     `gorm:"size:16;index:idx_review_source" json:"source"`
+	SourceID       uint       `gorm:"index:idx_review_source" json:"source_id"`
+	TelegramID     int64      `gorm:"index" json:"telegram_id"`
+	SessionID      uint       `json:"session_id"`
+	SessionNumber  int        `json:"session_number"`
+	Submission     string     `gorm:"type:text" json:"submission"`
+	Reason         string     `gorm:"size:16;index" json:"reason"`
+	AIPassed       bool       `json:"ai_passed"`
+	AIScore        int        `json:"ai_score"` // 0 for bot exercises, which are not scored
+	AIFeedback     string     `gorm:"type:text" json:"ai_feedback"`
+	Status         string     `gorm:"size:16;index;default:'pending'" json:"status"`
+	MentorPassed   *bool      `json:"mentor_passed"`
+	MentorFeedback string     `gorm:"type:text" json:"mentor_feedback"`
+	ReviewedBy     *uint      `json:"reviewed_by"` // Admin ID
+	ReviewedAt     *time.Time `json:"reviewed_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// reviewSampleRate returns EXERCISE_REVIEW_SAMPLE_RATE (0-1)
+func reviewSampleRate() float64 {
+	if value := os.Getenv("EXERCISE_REVIEW_SAMPLE_RATE"); value != "" {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate >= 0 && rate <= 1 {
+			return rate
+		}
+	}
+	return defaultReviewSampleRate
+}
+
+// reviewReason decides whether an AI verdict goes to a mentor; empty means no review
+func reviewReason(passed, lowConfidence bool) string {
+	switch {
+	case !passed:
+		return ReviewReasonRejected
+	case lowConfidence:
+		return ReviewReasonLowConfidence
+	case reviewSample() < reviewSampleRate():
+		return ReviewReasonSampled
+	}
+	return ""
+}
+
+// queueReview stores a pending review
+func queueReview(review *ExerciseReview) {
+	review.Status = ReviewStatusPending
+	if err := db.Create(review).Error; err != nil {
+		logger.Error("Failed to queue exercise review",
+			zap.String("source", review.Source),
+			zap.Uint("source_id", review.SourceID),
+			zap.Error(err))
+		return
+	}
+	metrics.IncExerciseReview(review.Reason)
+
+	logger.Info("Submission queued for mentor review",
+		zap.Uint("review_id", review.ID),
+		zap.String("source", review.Source),
+		zap.String("reason", review.Reason),
+		zap.Int64("user_id", review.TelegramID))
+}
+
+// flagExerciseForReview queues a bot exercise submission and returns whether it was queued.
+// parsed is false when the AI answer had no clear APPROVED line.
+func flagExerciseForReview(submission *ExerciseSubmission, sessionNumber int, approved, parsed bool) bool {
+	reason := reviewReason(approved, !parsed)
+	if reason == "" {
+		return false
+	}
+	queueReview(&ExerciseReview{
+		Source:        ReviewSourceExercise,
+		SourceID:      submission.ID,
+		TelegramID:    submission.TelegramID,
+		SessionID:     submission.SessionID,
+		SessionNumber: sessionNumber,
+		Submission:    submission.reviewText(),
+		Reason:        reason,
+		AIPassed:      approved,
+		AIFeedback:    submission.AIFeedback,
+	})
+	return true
+}
+
+// flagQuizEvaluationForReview queues a graded or failed quiz evaluation when the policy asks for it
+func flagQuizEvaluationForReview(evaluation *QuizEvaluation) {
+	reason := ReviewReasonAIFailed
+	if evaluation.Status == QuizEvaluationGraded {
+		reason = reviewReason(evaluation.Passed, evaluation.Score < evaluation.PassingScore+reviewLowConfidenceMargin)
+	}
+	if reason == "" {
+		return
+	}
+	queueReview(&ExerciseReview{
+		Source:        ReviewSourceQuiz,
+		SourceID:      evaluation.ID,
+		TelegramID:    evaluation.TelegramID,
+		SessionID:     evaluation.SessionID,
+		SessionNumber: evaluation.SessionNumber,
+		Submission:    evaluation.Answers,
+		Reason:        reason,
+		AIPassed:      evaluation.Passed,
+		AIScore:       evaluation.Score,
+		AIFeedback:    evaluation.Feedback,
+	})
+}
+
+// pendingReviewFor returns the pending review of a submission, nil when there is none
+func pendingReviewFor(source string, sourceID uint) *ExerciseReview {
+	var review ExerciseReview
+	if err := db.Where("source = ? AND source_id = ? AND status = ?", source, sourceID, ReviewStatusPending).
+		First(&review).Error; err != nil {
+		return nil
+	}
+	return &review
+}
+
+// relockUserSession moves a user who is on the session after sessionNumber back to it and removes
+// the points that passing had given. It reports whether the session was relocked.
+func relockUserSession(telegramID int64, sessionNumber, points int) bool {
+	result := db.Model(&User{}).
+		Where("telegram_id = ? AND current_session = ?", telegramID, sessionNumber+1).
+		Updates(map[string]interface{}{
+			"current_session": sessionNumber,
+			"points":          gorm.Expr("GREATEST(points - ?, 0)", points),
+		})
+	if result.Error != nil {
+		logger.Error("Failed to relock user session",
+			zap.Int64("user_id", telegramID),
+			zap.Int("session", sessionNumber),
+			zap.Error(result.Error))
+		return false
+	}
+	userCache.InvalidateUser(telegramID)
+	return result.RowsAffected > 0
+}
+
+// errReviewResolved is returned when a review was already resolved, possibly by another mentor
+var errReviewResolved = errors.New("review already resolved")
+
+// reviewOutcome is the result of resolving a review
+type reviewOutcome struct {
+	Review   *ExerciseReview `json:"review"`
+	Unlocked bool            `json:"unlocked"` // Next session opened by the override
+	Relocked bool            `json:"relocked"` // Next session closed again by the override
+}
+
+// resolveReview records the mentor verdict, updates the submission and the student's progress,
+// and notifies the student
+func resolveReview(review *ExerciseReview, passed bool, feedback string, adminID *uint) (*reviewOutcome, error) {
+	if review.Status != ReviewStatusPending {
+		return nil, errReviewResolved
+	}
+
+	now := time.Now()
+	review.MentorPassed, review.MentorFeedback = &passed, strings.TrimSpace(feedback)
+	review.ReviewedBy, review.ReviewedAt = adminID, &now
+	review.Status = ReviewStatusConfirmed
+	if passed != review.AIPassed {
+		review.Status = ReviewStatusOverridden
+	}
+
+	// Points the verdict is worth: the quiz score, bot exercises give none
+	points := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&ExerciseReview{}).
+			Where("id = ? AND status = ?", review.ID, ReviewStatusPending).
+			Updates(map[string]interface{}{
+				"status":          review.Status,
+				"mentor_passed":   passed,
+				"mentor_feedback": review.MentorFeedback,
+				"reviewed_by":     adminID,
+				"reviewed_at":     now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errReviewResolved
+		}
+
+		switch review.Source {
+		case ReviewSourceExercise:
+			status := "needs_revision"
+			if passed {
+				status = "approved"
+			}
+			updates := map[string]interface{}{"status": status, "reviewed_by": adminID, "reviewed_at": now}
+			if review.MentorFeedback != "" {
+				updates["feedback"] = review.MentorFeedback
+			}
+			return tx.Model(&ExerciseSubmission{}).Where("id = ?", review.SourceID).Updates(updates).Error
+		case ReviewSourceQuiz:
+			var evaluation QuizEvaluation
+			if err := tx.First(&evaluation, review.SourceID).Error; err != nil {
+				return err
+			}
+			points = evaluation.Score
+			evaluation.Passed = passed
+			if review.Reason == ReviewReasonAIFailed {
+				now := time.Now()
+				evaluation.Status, evaluation.GradedAt, evaluation.NextAttemptAt = QuizEvaluationGraded, &now, nil
+			}
+			if review.MentorFeedback != "" {
+				evaluation.Feedback = review.MentorFeedback
+			}
+			return tx.Save(&evaluation).Error
+		}
+		return fmt.Errorf("unknown review source %q", review.Source)
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.IncExerciseReviewResolved(review.Status)
+
+	outcome := &reviewOutcome{Review: review}
+	if review.Status == ReviewStatusOverridden || review.Reason == ReviewReasonAIFailed {
+		if passed {
+			outcome.Unlocked = advanceUserSession(review.TelegramID, review.SessionNumber, points)
+		} else if review.AIPassed {
+			outcome.Relocked = relockUserSession(review.TelegramID, review.SessionNumber, points)
+		}
+	}
+
+	logger.Info("Exercise review resolved",
+		zap.Uint("review_id", review.ID),
+		zap.String("status", review.Status),
+		zap.Bool("passed", passed),
+		zap.Bool("unlocked", outcome.Unlocked),
+		zap.Bool("relocked", outcome.Relocked))
+
+	notifyReviewOutcome(outcome)
+	return outcome, nil
+}
+
+// notifyReviewOutcome tells the student about a changed verdict or new mentor feedback
+func notifyReviewOutcome(outcome *reviewOutcome) {
+	review := outcome.Review
+	if bot == nil || (review.Status == ReviewStatusConfirmed && review.MentorFeedback == "" && review.Reason != ReviewReasonAIFailed) {
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "👨‍🏫 تمرین جلسه %d توسط منتور بررسی شد.\n\n", review.SessionNumber)
+	if *review.MentorPassed {
+		text.WriteString("✅ نتیجه: قبول\n")
+	} else {
+		text.WriteString("📝 نتیجه: نیاز به اصلاح\n")
+	}
+	if review.MentorFeedback != "" {
+		fmt.Fprintf(&text, "\n💬 نظر منتور:\n%s\n", review.MentorFeedback)
+	}
+	if outcome.Unlocked {
+		text.WriteString("\n🔓 مرحله بعد برات باز شد!")
+	}
+	if outcome.Relocked {
+		text.WriteString("\n🔒 مرحله بعد تا اصلاح تمرین دوباره قفل شد. تمرین رو با توجه به نظر منتور دوباره بفرست.")
+	}
+	bot.Send(tgbotapi.NewMessage(review.TelegramID, strings.TrimSpace(text.String())))
+}
+
+// getExerciseReviewsAPI handles GET /api/v1/admin/reviews?status=pending&reason=&source=&page=&limit=
+func getExerciseReviewsAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := db.Model(&ExerciseReview{})
+	if status := c.DefaultQuery("status", ReviewStatusPending); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var reviews []ExerciseReview
+	if err := query.Order("created_at ASC").Offset((page - 1) * limit).Limit(limit).Find(&reviews).Error; err != nil {
+		logger.Error("Failed to list exercise reviews", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"reviews": reviews,
+			"total":   total,
+			"page":    page,
+			"limit":   limit,
+		},
+	})
+}
+
+// getExerciseReviewAPI handles GET /api/v1/admin/reviews/:id, including the reviewed submission
+func getExerciseReviewAPI(c *gin.Context) {
+	var review ExerciseReview
+	if err := db.First(&review, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Review not found"})
+		return
+	}
+
+	var submission interface{}
+	switch review.Source {
+	case ReviewSourceExercise:
+		var exercise ExerciseSubmission
+		if err := db.First(&exercise, review.SourceID).Error; err == nil {
+			submission = exercise
+		}
+	case ReviewSourceQuiz:
+		var evaluation QuizEvaluation
+		if err := db.First(&evaluation, review.SourceID).Error; err == nil {
+			submission = evaluation
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"review":     review,
+			"submission": submission,
+		},
+	})
+}
+
+// resolveExerciseReviewAPI handles POST /api/v1/admin/reviews/:id/resolve {passed, feedback}
+func resolveExerciseReviewAPI(c *gin.Context) {
+	var req struct {
+		Passed   *bool  `json:"passed"`
+		Feedback string `json:"feedback"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Passed == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "passed is required"})
+		return
+	}
+	if !*req.Passed && strings.TrimSpace(req.Feedback) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Feedback is required when the submission does not pass"})
+		return
+	}
+
+	var review ExerciseReview
+	if err := db.First(&review, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Review not found"})
+		return
+	}
+	if review.Status != ReviewStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Review already resolved"})
+		return
+	}
+
+	adminID := getAdminIDFromContext(c)
+	outcome, err := resolveReview(&review, *req.Passed, req.Feedback, adminID)
+	if errors.Is(err, errReviewResolved) {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Review already resolved"})
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to resolve exercise review", zap.Uint("review_id", review.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Database error"})
+		return
+	}
+
+	if adminID != nil {
+		var admin Admin
+		admin.ID = *adminID
+		details, _ := json.Marshal(gin.H{"status": review.Status, "passed": *req.Passed})
+		logAdminAction(&admin, "resolve_review", string(details), "exercise_review", review.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": outcome})
+}
+
+// handleAdminReviews is the /admin_reviews bot command:
+// no arguments lists pending reviews, "pass|fail [id] [feedback]" resolves one
+func handleAdminReviews(admin *Admin, args []string) string {
+	if len(args) == 0 {
+		var reviews []ExerciseReview
+		db.Where("status = ?", ReviewStatusPending).Order("created_at ASC").Limit(10).Find(&reviews)
+
+		var pending int64
+		db.Model(&ExerciseReview{}).Where("status = ?", ReviewStatusPending).Count(&pending)
+
+		if len(reviews) == 0 {
+			return "✅ هیچ تمرینی در صف بررسی نیست"
+		}
+
+		reasons := map[string]string{
+			ReviewReasonRejected:      "رد شده توسط AI",
+			ReviewReasonLowConfidence: "اطمینان پایین",
+			ReviewReasonSampled:       "نمونه تصادفی",
+			ReviewReasonAIFailed:      "ارزیابی AI ناموفق",
+		}
+		var response strings.Builder
+		fmt.Fprintf(&response, "👨‍🏫 صف بررسی تمرین‌ها (%d مورد):\n\n", pending)
+		for _, review := range reviews {
+			verdict := "❌ رد"
+			if review.AIPassed {
+				verdict = "✅ قبول"
+			}
+			submission := []rune(review.Submission)
+			if len(submission) > 300 {
+				submission = append(submission[:300], '…')
+			}
+			fmt.Fprintf(&response, "🆔 %d | 👤 %d | 📚 جلسه %d\n🏷 %s | AI: %s", review.ID, review.TelegramID, review.SessionNumber, reasons[review.Reason], verdict)
+			if review.Source == ReviewSourceQuiz {
+				fmt.Fprintf(&response, " (%d)", review.AIScore)
+			}
+			fmt.Fprintf(&response, "\n📝 %s\n\n", string(submission))
+		}
+		response.WriteString("دستورات:\n• /admin_reviews pass [آیدی] [نظر] - قبول\n• /admin_reviews fail [آیدی] [نظر] - نیاز به اصلاح\n• /admin_reviews file [آیدی] - دریافت فایل تمرین")
+		sendLongMessage(admin.TelegramID, response.String(), nil)
+		return "برای ثبت نتیجه از دستورات بالا استفاده کنید"
+	}
+
+	if len(args) == 2 && args[0] == "file" {
+		return sendReviewFile(admin, args[1])
+	}
+	if len(args) < 2 || (args[0] != "pass" && args[0] != "fail") {
+		return "❌ فرمت دستور: /admin_reviews pass|fail [آیدی] [نظر]"
+	}
+	passed := args[0] == "pass"
+	feedback := strings.Join(args[2:], " ")
+	if !passed && feedback == "" {
+		return "❌ برای رد تمرین، نظر منتور الزامی است"
+	}
+
+	reviewID, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return "❌ آیدی نامعتبر"
+	}
+	var review ExerciseReview
+	if err := db.First(&review, reviewID).Error; err != nil {
+		return "❌ مورد بررسی یافت نشد"
+	}
+	if review.Status != ReviewStatusPending {
+		return "⚠️ این مورد قبلاً بررسی شده است"
+	}
+
+	adminID := admin.ID
+	outcome, err := resolveReview(&review, passed, feedback, &adminID)
+	if errors.Is(err, errReviewResolved) {
+		return "⚠️ این مورد قبلاً بررسی شده است"
+	}
+	if err != nil {
+		logger.Error("Failed to resolve exercise review", zap.Uint("review_id", review.ID), zap.Error(err))
+		return "❌ خطا در ثبت نتیجه بررسی"
+	}
+	logAdminAction(admin, "resolve_review", fmt.Sprintf("status=%s passed=%v", review.Status, passed), "exercise_review", review.ID)
+
+	response := "✅ نتیجه بررسی ثبت شد و برای دانشجو ارسال شد"
+	if review.Status == ReviewStatusConfirmed && review.MentorFeedback == "" {
+		response = "✅ رأی AI تایید شد"
+	}
+	if outcome.Unlocked {
+		response += "\n🔓 مرحله بعد برای دانشجو باز شد"
+	}
+	if outcome.Relocked {
+		response += "\n🔒 مرحله بعد برای دانشجو دوباره قفل شد"
+	}
+	return response
+}
+
+// sendReviewFile sends the file attached to a reviewed exercise to the mentor
+func sendReviewFile(admin *Admin, id string) string {
+	reviewID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return "❌ آیدی نامعتبر"
+	}
+	var review ExerciseReview
+	if err := db.First(&review, reviewID).Error; err != nil {
+		return "❌ مورد بررسی یافت نشد"
+	}
+	var submission ExerciseSubmission
+	if review.Source != ReviewSourceExercise || db.First(&submission, review.SourceID).Error != nil || submission.FileKey == "" {
+		return "❌ این تمرین فایل ضمیمه ندارد"
+	}
+
+	// Sent from the storage as a document: Telegram does not accept photo or voice file IDs as documents
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	file, err := getFileStorage().Open(ctx, submission.FileKey)
+	if err != nil {
+		logger.Error("Failed to open review file", zap.Uint("review_id", review.ID), zap.Error(err))
+		return "❌ فایل تمرین یافت نشد"
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		logger.Error("Failed to read review file", zap.Uint("review_id", review.ID), zap.Error(err))
+		return "❌ فایل تمرین یافت نشد"
+	}
+
+	document := tgbotapi.NewDocument(admin.TelegramID, tgbotapi.FileBytes{Name: submission.FileName, Bytes: data})
+	document.Caption = fmt.Sprintf("📎 تمرین جلسه %d، بررسی %d", review.SessionNumber, review.ID)
+	if _, err := bot.Send(document); err != nil {
+		logger.Error("Failed to send review file", zap.Uint("review_id", review.ID), zap.Error(err))
+		return "❌ خطا در ارسال فایل"
+	}
+	return "✅ فایل تمرین ارسال شد"
+}
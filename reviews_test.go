@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+// TestReviewReasonPolicy asserts rejections and low-confidence passes always go to a mentor
+// and that approvals are sampled at EXERCISE_REVIEW_SAMPLE_RATE.
+func TestReviewReasonPolicy(t *testing.T) {
+	previous := reviewSample
+	defer func() { reviewSample = previous }()
+	t.Setenv("EXERCISE_REVIEW_SAMPLE_RATE", "0.25")
+
+	reviewSample = func() float64 { return 0.9 }
+	cases := []struct {
+		passed, lowConfidence bool
+		want                  string
+	}{
+		{false, false, ReviewReasonRejected},
+		{false, true, ReviewReasonRejected},
+		{true, true, ReviewReasonLowConfidence},
+		{true, false, ""},
+	}
+	for _, tc := range cases {
+		if got := reviewReason(tc.passed, tc.lowConfidence); got != tc.want {
+			t.Errorf("reviewReason(%v, %v) = %q, want %q", tc.passed, tc.lowConfidence, got, tc.want)
+		}
+	}
+
+	reviewSample = func() float64 { return 0.2 }
+	if got := reviewReason(true, false); got != ReviewReasonSampled {
+		t.Errorf("expected an approval below the sample rate to be sampled, got %q", got)
+	}
+
+	t.Setenv("EXERCISE_REVIEW_SAMPLE_RATE", "2")
+	if rate := reviewSampleRate(); rate != defaultReviewSampleRate {
+		t.Errorf("invalid rate should fall back to %v, got %v", defaultReviewSampleRate, rate)
+	}
+}
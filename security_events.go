@@ -0,0 +1,454 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"MonetizeeAI_bot/fieldcrypt"
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Security rule names
+const (
+	SecurityRuleAIBurst         = "ai_burst"
+	SecurityRuleInvalidChat     = "invalid_chat"
+	SecurityRuleSharedPhone     = "shared_phone"
+	SecurityRuleLicenseGuessing = "license_guessing"
+	SecurityRuleWebLoginFailure = "web_login_failure"
+	SecurityRulePaymentAnomaly  = "payment_anomaly"
+
+	// AI moderation, see moderation.go
+	SecurityRulePromptInjection   = "prompt_injection"
+	SecurityRuleDisallowedContent = "disallowed_content"
+	SecurityRulePromptLeak        = "prompt_leak"
+)
+
+// Security event severities
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// SecurityEvent is a finding of the suspicious-activity detector
+type SecurityEvent struct {
+	gorm.Model
+	TelegramID     int64      `gorm:"index" json:"telegram_id"`                   // 0 when the subject is not a known user (e.g. an IP)
+	Rule           string     `gorm:"type:varchar(50);index" json:"rule"`         // ai_burst, invalid_chat, shared_phone, ...
+	Severity       string     `gorm:"type:varchar(20);index" json:"severity"`     // low, medium, high, critical
+	Subject        string     `gorm:"type:varchar(100);index" json:"subject"`     // What the rule counted on: user ID or IP
+	Details        string     `gorm:"type:text" json:"details"`                   // Human-readable explanation
+	SignalCount    int        `json:"signal_count"`                               // Signals seen in the rule window
+	Resolved       bool       `gorm:"default:false;index" json:"resolved"`        // Handled by an admin
+	ResolvedBy     *uint      `json:"resolved_by"`                                // Admin who resolved it
+	ResolvedAt     *time.Time `json:"resolved_at"`                                // When it was resolved
+	ResolutionNote string     `gorm:"type:text" json:"resolution_note,omitempty"` // Admin note
+}
+
+// SecurityRule raises an event when Threshold signals for the same subject arrive within Window.
+// After firing, the subject is quiet for one Window so a single burst produces a single event.
+type SecurityRule struct {
+	Name        string
+	Threshold   int
+	Window      time.Duration
+	Severity    string
+	Description string // Persian, shown in the admin bot
+}
+
+var securityRules = map[string]SecurityRule{
+	SecurityRuleAIBurst: {
+		Name:        SecurityRuleAIBurst,
+		Threshold:   60, // Counts attempts from the bot and the Mini App, including rate-limited ones
+		Window:      5 * time.Minute,
+		Severity:    SeverityHigh,
+		Description: "درخواست‌های پشت سر هم به هوش مصنوعی",
+	},
+	SecurityRuleInvalidChat: {
+		Name:        SecurityRuleInvalidChat,
+		Threshold:   3,
+		Window:      10 * time.Minute,
+		Severity:    SeverityMedium,
+		Description: "ارسال پیام‌های نامعتبر به چت",
+	},
+	SecurityRuleSharedPhone: {
+		Name:        SecurityRuleSharedPhone,
+		Threshold:   1, // Checked on phone save, the check itself decides
+		Window:      24 * time.Hour,
+		Severity:    SeverityMedium,
+		Description: "چند حساب با یک شماره موبایل",
+	},
+	SecurityRuleLicenseGuessing: {
+		Name:        SecurityRuleLicenseGuessing,
+		Threshold:   5,
+		Window:      30 * time.Minute,
+		Severity:    SeverityHigh,
+		Description: "تلاش مکرر برای حدس لایسنس",
+	},
+	SecurityRuleWebLoginFailure: {
+		Name:        SecurityRuleWebLoginFailure,
+		Threshold:   5,
+		Window:      10 * time.Minute,
+		Severity:    SeverityMedium,
+		Description: "ورود ناموفق مکرر به نسخه وب",
+	},
+	SecurityRulePaymentAnomaly: {
+		Name:        SecurityRulePaymentAnomaly,
+		Threshold:   5,
+		Window:      30 * time.Minute,
+		Severity:    SeverityMedium,
+		Description: "رفتار غیرعادی در پرداخت",
+	},
+	// Refused AI inputs are recorded one by one; these thresholds apply to flagged ones
+	SecurityRulePromptInjection: {
+		Name:        SecurityRulePromptInjection,
+		Threshold:   3,
+		Window:      time.Hour,
+		Severity:    SeverityHigh,
+		Description: "تلاش برای دور زدن دستورالعمل‌های هوش مصنوعی",
+	},
+	SecurityRuleDisallowedContent: {
+		Name:        SecurityRuleDisallowedContent,
+		Threshold:   3,
+		Window:      time.Hour,
+		Severity:    SeverityMedium,
+		Description: "ارسال محتوای غیرمجاز به هوش مصنوعی",
+	},
+	SecurityRulePromptLeak: {
+		Name:        SecurityRulePromptLeak,
+		Threshold:   1,
+		Window:      time.Hour,
+		Severity:    SeverityHigh,
+		Description: "تکرار دستورالعمل سیستمی در پاسخ هوش مصنوعی",
+	},
+}
+
+// MaxSharedPhoneAccounts is how many accounts may share one phone number before it is reported
+const MaxSharedPhoneAccounts = 2
+
+// SecurityDetector keeps sliding windows of signals per rule and subject
+type SecurityDetector struct {
+	signals    map[string][]time.Time
+	quietUntil map[string]time.Time
+	mu         sync.Mutex
+}
+
+var securityDetector = NewSecurityDetector()
+
+// NewSecurityDetector creates an empty detector
+func NewSecurityDetector() *SecurityDetector {
+	return &SecurityDetector{
+		signals:    make(map[string][]time.Time),
+		quietUntil: make(map[string]time.Time),
+	}
+}
+
+// Record registers one signal and reports whether the rule fired, with the number of signals in the window
+func (d *SecurityDetector) Record(rule SecurityRule, subject string, now time.Time) (int, bool) {
+	key := rule.Name + ":" + subject
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Before(d.quietUntil[key]) {
+		return 0, false
+	}
+
+	// Drop signals that fell out of the window
+	cutoff := now.Add(-rule.Window)
+	kept := d.signals[key][:0]
+	for _, t := range d.signals[key] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+
+	if len(kept) < rule.Threshold {
+		d.signals[key] = kept
+		return len(kept), false
+	}
+
+	delete(d.signals, key)
+	d.quietUntil[key] = now.Add(rule.Window)
+	return len(kept), true
+}
+
+// Cleanup drops subjects with no recent signals
+func (d *SecurityDetector) Cleanup(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, until := range d.quietUntil {
+		if now.After(until) {
+			delete(d.quietUntil, key)
+		}
+	}
+	for key, times := range d.signals {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) > 24*time.Hour {
+			delete(d.signals, key)
+		}
+	}
+}
+
+// startSecurityDetectorCleanup periodically frees detector memory
+func startSecurityDetectorCleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	go func() {
+		for range ticker.C {
+			securityDetector.Cleanup(time.Now())
+		}
+	}()
+}
+
+// reportSecuritySignal feeds one signal to the detector and records a SecurityEvent when the rule fires.
+// The subject is the user when telegramID is set, otherwise the client IP.
+func reportSecuritySignal(ruleName string, telegramID int64, ip string, details string) {
+	rule, ok := securityRules[ruleName]
+	if !ok {
+		logger.Error("Unknown security rule", zap.String("rule", ruleName))
+		return
+	}
+
+	subject := ip
+	if telegramID != 0 {
+		subject = strconv.FormatInt(telegramID, 10)
+	}
+
+	count, fired := securityDetector.Record(rule, subject, time.Now())
+	if !fired {
+		return
+	}
+
+	recordSecurityEvent(&SecurityEvent{
+		TelegramID:  telegramID,
+		Rule:        rule.Name,
+		Severity:    rule.Severity,
+		Subject:     subject,
+		Details:     details,
+		SignalCount: count,
+	})
+}
+
+// recordSecurityEvent stores the event and pushes it to connected admins
+func recordSecurityEvent(event *SecurityEvent) {
+	logger.Warn("Security event detected",
+		zap.String("rule", event.Rule),
+		zap.String("severity", event.Severity),
+		zap.Int64("user_id", event.TelegramID),
+		zap.Int("signal_count", event.SignalCount))
+
+	metrics.IncSecurityEvent(event.Rule, event.Severity)
+
+	if db == nil {
+		return
+	}
+
+	if err := db.Create(event).Error; err != nil {
+		logger.Error("Failed to save security event",
+			zap.String("rule", event.Rule),
+			zap.Error(err))
+		return
+	}
+
+	BroadcastSecurityEventToAdmins(event)
+}
+
+// checkSharedPhone reports a phone number used by more than MaxSharedPhoneAccounts accounts
+func checkSharedPhone(telegramID int64, phone string) {
+	if phone == "" || db == nil {
+		return
+	}
+
+	// 🔒 SECURITY: Only the blind index is used, the detector never holds the plain number
+	phoneHash := fieldcrypt.PhoneIndex(phone)
+
+	var telegramIDs []int64
+	if err := db.Model(&User{}).
+		Where("phone_hash = ?", phoneHash).
+		Pluck("telegram_id", &telegramIDs).Error; err != nil {
+		logger.Error("Failed to check shared phone", zap.Error(err))
+		return
+	}
+
+	if len(telegramIDs) <= MaxSharedPhoneAccounts {
+		return
+	}
+
+	rule := securityRules[SecurityRuleSharedPhone]
+	if _, fired := securityDetector.Record(rule, phoneHash, time.Now()); !fired {
+		return
+	}
+
+	recordSecurityEvent(&SecurityEvent{
+		TelegramID:  telegramID,
+		Rule:        rule.Name,
+		Severity:    rule.Severity,
+		Subject:     strconv.FormatInt(telegramID, 10),
+		Details:     fmt.Sprintf("%d accounts share one phone number: %v", len(telegramIDs), telegramIDs),
+		SignalCount: len(telegramIDs),
+	})
+}
+
+// truncateForSecurityEvent keeps event details short
+func truncateForSecurityEvent(text string) string {
+	runes := []rune(text)
+	if len(runes) > 100 {
+		return string(runes[:100]) + "..."
+	}
+	return text
+}
+
+// telegramIDForUser resolves a user's database ID to their Telegram ID (0 if unknown)
+func telegramIDForUser(userID uint) int64 {
+	var telegramID int64
+	if db != nil {
+		db.Model(&User{}).Where("id = ?", userID).Pluck("telegram_id", &telegramID)
+	}
+	return telegramID
+}
+
+// countOpenSecurityEvents returns unresolved events, optionally only of the given severities
+func countOpenSecurityEvents(severities ...string) int64 {
+	var count int64
+	query := db.Model(&SecurityEvent{}).Where("resolved = ?", false)
+	if len(severities) > 0 {
+		query = query.Where("severity IN ?", severities)
+	}
+	query.Count(&count)
+	return count
+}
+
+// resolveSecurityEvent marks an event as handled
+func resolveSecurityEvent(eventID uint, adminID *uint, note string) (*SecurityEvent, error) {
+	var event SecurityEvent
+	if err := db.First(&event, eventID).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	event.Resolved = true
+	event.ResolvedBy = adminID
+	event.ResolvedAt = &now
+	event.ResolutionNote = note
+	if err := db.Save(&event).Error; err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// ==========================================
+// Admin API handlers
+// ==========================================
+
+// Get suspicious activity (security events)
+func getSuspiciousActivity(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	query := db.Model(&SecurityEvent{})
+
+	switch c.DefaultQuery("status", "open") {
+	case "open":
+		query = query.Where("resolved = ?", false)
+	case "resolved":
+		query = query.Where("resolved = ?", true)
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if rule := c.Query("rule"); rule != "" {
+		query = query.Where("rule = ?", rule)
+	}
+	if telegramID := c.Query("telegram_id"); telegramID != "" {
+		query = query.Where("telegram_id = ?", telegramID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Error("Failed to count security events", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to count security events",
+		})
+		return
+	}
+
+	var events []SecurityEvent
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&events).Error; err != nil {
+		logger.Error("Failed to fetch security events", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch security events",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"events": events,
+			"total":  total,
+			"page":   page,
+			"limit":  limit,
+		},
+	})
+}
+
+// Resolve a security event
+func resolveSecurityEventAPI(c *gin.Context) {
+	eventID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	event, err := resolveSecurityEvent(uint(eventID), getAdminIDFromContext(c), req.Note)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Security event not found"})
+			return
+		}
+		logger.Error("Failed to resolve security event", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to resolve security event",
+		})
+		return
+	}
+
+	logger.Info("Security event resolved by admin",
+		zap.Uint("event_id", event.ID),
+		zap.Int64("admin_telegram_id", c.GetInt64("admin_telegram_id")))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    event,
+	})
+}
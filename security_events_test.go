@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"MonetizeeAI_bot/fieldcrypt"
+)
+
+// TestSecurityDetectorWindow covers the sliding window, the quiet period after a rule fires
+// and that subjects and rules are counted separately.
+func TestSecurityDetectorWindow(t *testing.T) {
+	rule := SecurityRule{Name: "test", Threshold: 3, Window: 10 * time.Minute}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		offsets []time.Duration // Signal times after start, the last one is checked
+		count   int
+		fired   bool
+	}{
+		{"below threshold", []time.Duration{0, time.Minute}, 2, false},
+		{"threshold within window", []time.Duration{0, time.Minute, 2 * time.Minute}, 3, true},
+		{"old signals drop out", []time.Duration{0, 2 * time.Minute, 11 * time.Minute}, 2, false},
+		{"exactly one window apart", []time.Duration{0, 5 * time.Minute, 10 * time.Minute}, 2, false},
+		{"quiet after firing", []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute}, 0, false},
+		{"fires again after quiet period", []time.Duration{0, time.Minute, 2 * time.Minute, 13 * time.Minute, 14 * time.Minute, 15 * time.Minute}, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := NewSecurityDetector()
+			var count int
+			var fired bool
+			for _, offset := range tt.offsets {
+				count, fired = detector.Record(rule, "user", start.Add(offset))
+			}
+			if count != tt.count || fired != tt.fired {
+				t.Fatalf("got count %d fired %v, want %d %v", count, fired, tt.count, tt.fired)
+			}
+		})
+	}
+
+	detector := NewSecurityDetector()
+	other := SecurityRule{Name: "other", Threshold: 3, Window: 10 * time.Minute}
+	detector.Record(rule, "a", start)
+	detector.Record(rule, "b", start)
+	detector.Record(other, "a", start)
+	if count, fired := detector.Record(rule, "a", start.Add(time.Second)); count != 2 || fired {
+		t.Fatalf("signals of other subjects or rules were counted: %d %v", count, fired)
+	}
+
+	detector.Cleanup(start.Add(25 * time.Hour))
+	if len(detector.signals) != 0 || len(detector.quietUntil) != 0 {
+		t.Fatalf("cleanup kept stale subjects: %v %v", detector.signals, detector.quietUntil)
+	}
+}
+
+// TestSecurityRuleThresholds checks every rule can fire and that the thresholds the
+// admin bot describes stay as documented.
+func TestSecurityRuleThresholds(t *testing.T) {
+	for name, rule := range securityRules {
+		if rule.Name != name || rule.Threshold < 1 || rule.Window <= 0 || rule.Severity == "" || rule.Description == "" {
+			t.Fatalf("rule %s is incomplete: %+v", name, rule)
+		}
+
+		detector := NewSecurityDetector()
+		now := time.Now()
+		for i := 1; i < rule.Threshold; i++ {
+			if _, fired := detector.Record(rule, "subject", now); fired {
+				t.Fatalf("rule %s fired after %d of %d signals", name, i, rule.Threshold)
+			}
+		}
+		if count, fired := detector.Record(rule, "subject", now); !fired || count != rule.Threshold {
+			t.Fatalf("rule %s did not fire at its threshold: %d %v", name, count, fired)
+		}
+	}
+
+	want := map[string]int{
+		SecurityRuleAIBurst:         60,
+		SecurityRuleInvalidChat:     3,
+		SecurityRuleSharedPhone:     1,
+		SecurityRuleLicenseGuessing: 5,
+		SecurityRulePromptLeak:      1,
+	}
+	for name, threshold := range want {
+		if securityRules[name].Threshold != threshold {
+			t.Fatalf("rule %s threshold is %d, want %d", name, securityRules[name].Threshold, threshold)
+		}
+	}
+}
+
+// TestContactUpdatesKeepBlindIndexes checks a profile update recomputes both blind indexes,
+// falls back to the bot contact number and clears the email index when it is blanked, so
+// the shared phone rule and the admin search never match stale values.
+func TestContactUpdatesKeepBlindIndexes(t *testing.T) {
+	useTestDB(t, &User{})
+
+	const telegramID = int64(3301)
+	user := User{TelegramID: telegramID, Username: "contact", PhoneNumber: "09120000001", Phone: "09120000002", Email: "old@example.com"}
+	mustCreate(t, &user)
+
+	tests := []struct {
+		name, phone, email   string
+		phoneHash, emailHash string
+	}{
+		{"both changed", "09120000003", "new@example.com", fieldcrypt.PhoneIndex("09120000003"), fieldcrypt.EmailIndex("new@example.com")},
+		{"phone blanked", "", "new@example.com", fieldcrypt.PhoneIndex("09120000001"), fieldcrypt.EmailIndex("new@example.com")},
+		{"email blanked", "09120000003", "", fieldcrypt.PhoneIndex("09120000003"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := map[string]interface{}{}
+			if err := setEncryptedContactUpdates(updates, tt.phone, user.PhoneNumber, tt.email); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Model(&User{}).Where("telegram_id = ?", telegramID).Updates(updates).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			var stored User
+			db.Where("telegram_id = ?", telegramID).First(&stored)
+			if stored.PhoneHash != tt.phoneHash || stored.EmailHash != tt.emailHash {
+				t.Errorf("got phone hash %q email hash %q, want %q %q", stored.PhoneHash, stored.EmailHash, tt.phoneHash, tt.emailHash)
+			}
+		})
+	}
+}
@@ -178,7 +178,7 @@ func sendTextStatistics(admin *Admin) {
 	db.Model(&User{}).Where("is_active = ?", false).Count(&stats.BannedUsers)
 	db.Model(&Session{}).Count(&stats.TotalSessions)
 	db.Model(&Video{}).Count(&stats.TotalVideos)
-	db.Model(&Exercise{}).Count(&stats.TotalExercises)
+	db.Model(&ExerciseSubmission{}).Count(&stats.TotalExercises)
 
 	// Get new user statistics
 	today := time.Now().Truncate(24 * time.Hour)
@@ -291,12 +291,12 @@ func generateSessionStats() (interface{}, error) {
 	err := db.Raw(`
 		SELECT 
 			CASE 
-				WHEN exercises.status = 'approved' THEN 'تکمیل شده'
+				WHEN exercise_submissions.status = 'approved' THEN 'تکمیل شده'
 				ELSE 'در حال انجام'
 			END as status,
 			COUNT(*) as count
 		FROM user_sessions
-		LEFT JOIN exercises ON exercises.user_id = user_sessions.user_id AND exercises.session_id = user_sessions.session_id
+		LEFT JOIN exercise_submissions ON exercise_submissions.user_id = user_sessions.user_id AND exercise_submissions.session_id = user_sessions.session_id
 		GROUP BY status
 	`).Scan(&stats).Error
 
@@ -413,7 +413,7 @@ func generateExerciseStats() (interface{}, error) {
 			s.title as exercise_title,
 			COUNT(CASE WHEN e.status = 'approved' THEN 1 END) * 100.0 / COUNT(*) as completion_rate
 		FROM sessions s
-		LEFT JOIN exercises e ON e.session_id = s.id
+		LEFT JOIN exercise_submissions e ON e.session_id = s.id
 		GROUP BY s.id, s.title
 		ORDER BY completion_rate DESC
 		LIMIT 10
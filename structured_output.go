@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"MonetizeeAI_bot/logger"
+	"MonetizeeAI_bot/metrics"
+
+	"go.uber.org/zap"
+)
+
+// toolOutputMaxAttempts is the first answer plus one re-ask with the validation errors
+const toolOutputMaxAttempts = 2
+
+// Categories of unusable tool outputs (tool_output_failures_total)
+const (
+	ToolOutputLLMError    = "llm_error"    // The AI request itself failed
+	ToolOutputNoJSON      = "no_json"      // No JSON object in the answer
+	ToolOutputInvalidJSON = "invalid_json" // JSON syntax error that the repair could not fix
+	ToolOutputSchema      = "schema"       // Valid JSON that does not match the schema
+)
+
+// JSONSchema is the subset of JSON Schema the AI tools use. Every property of an object is required,
+// and the order of Properties is the order the model is asked to write them in.
+type JSONSchema struct {
+	Type       string // object, array, string, number, boolean
+	Title      string // Label shown to users (mini app forms, exports)
+	Properties []SchemaProperty
+	Items      *JSONSchema
+	MinItems   int
+	MaxItems   int // 0 means unlimited
+	MinLength  int
+}
+
+// SchemaProperty is a named property of an object schema
+type SchemaProperty struct {
+	Name   string
+	Schema *JSONSchema
+}
+
+// ToolOutputError describes why a model answer could not be used
+type ToolOutputError struct {
+	Tool     string
+	Category string
+	Errors   []string
+}
+
+func (e *ToolOutputError) Error() string {
+	return fmt.Sprintf("%s output rejected (%s): %s", e.Tool, e.Category, strings.Join(e.Errors, "; "))
+}
+
+func stringSchema() *JSONSchema {
+	return &JSONSchema{Type: "string", MinLength: 1}
+}
+
+func numberSchema() *JSONSchema {
+	return &JSONSchema{Type: "number"}
+}
+
+func stringArraySchema(minItems int) *JSONSchema {
+	return &JSONSchema{Type: "array", Items: stringSchema(), MinItems: minItems}
+}
+
+func objectSchema(properties ...SchemaProperty) *JSONSchema {
+	return &JSONSchema{Type: "object", Properties: properties}
+}
+
+func prop(name string, schema *JSONSchema) SchemaProperty {
+	return SchemaProperty{Name: name, Schema: schema}
+}
+
+// titled sets the user-facing label of a schema
+func titled(title string, schema *JSONSchema) *JSONSchema {
+	schema.Title = title
+	return schema
+}
+
+// property returns the schema of a named property, nil when it is not declared
+func (s *JSONSchema) property(name string) *JSONSchema {
+	if s == nil {
+		return nil
+	}
+	for _, p := range s.Properties {
+		if p.Name == name {
+			return p.Schema
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes the schema as standard JSON Schema, keeping the property order
+func (s *JSONSchema) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"type":%q`, s.Type)
+	if s.Title != "" {
+		title, _ := json.Marshal(s.Title)
+		fmt.Fprintf(&buf, `,"title":%s`, title)
+	}
+	switch s.Type {
+	case "object":
+		buf.WriteString(`,"properties":{`)
+		required := make([]string, 0, len(s.Properties))
+		for i, p := range s.Properties {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			inner, err := p.Schema.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&buf, "%q:%s", p.Name, inner)
+			required = append(required, p.Name)
+		}
+		buf.WriteString(`},"required":`)
+		names, _ := json.Marshal(required)
+		buf.Write(names)
+	case "array":
+		if s.Items != nil {
+			inner, err := s.Items.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&buf, `,"items":%s`, inner)
+		}
+		if s.MinItems > 0 {
+			fmt.Fprintf(&buf, `,"minItems":%d`, s.MinItems)
+		}
+		if s.MaxItems > 0 {
+			fmt.Fprintf(&buf, `,"maxItems":%d`, s.MaxItems)
+		}
+	case "string":
+		if s.MinLength > 0 {
+			fmt.Fprintf(&buf, `,"minLength":%d`, s.MinLength)
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Validate returns the violations of value (as decoded by decodeToolJSON) against the schema
+func (s *JSONSchema) Validate(value interface{}) []string {
+	var errs []string
+	s.validate("$", value, &errs)
+	return errs
+}
+
+func (s *JSONSchema) validate(path string, value interface{}, errs *[]string) {
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected object", path))
+			return
+		}
+		for _, p := range s.Properties {
+			child, ok := obj[p.Name]
+			if !ok {
+				*errs = append(*errs, fmt.Sprintf("%s.%s: missing required field", path, p.Name))
+				continue
+			}
+			p.Schema.validate(path+"."+p.Name, child, errs)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected array", path))
+			return
+		}
+		if len(items) < s.MinItems {
+			*errs = append(*errs, fmt.Sprintf("%s: expected at least %d items, got %d", path, s.MinItems, len(items)))
+		}
+		if s.MaxItems > 0 && len(items) > s.MaxItems {
+			*errs = append(*errs, fmt.Sprintf("%s: expected at most %d items, got %d", path, s.MaxItems, len(items)))
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected string", path))
+			return
+		}
+		if len([]rune(strings.TrimSpace(str))) < s.MinLength {
+			*errs = append(*errs, fmt.Sprintf("%s: must not be empty", path))
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected number", path))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected boolean", path))
+		}
+	}
+}
+
+// stripTrailingCommas removes commas directly before a closing bracket outside of strings
+func stripTrailingCommas(s string) string {
+	var out strings.Builder
+	out.Grow(len(s))
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if inString {
+			out.WriteByte(ch)
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+		if ch == '"' {
+			inString = true
+		}
+		if ch == ',' {
+			j := i + 1
+			for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+				j++
+			}
+			if j < len(s) && (s[j] == '}' || s[j] == ']') {
+				continue
+			}
+		}
+		out.WriteByte(ch)
+	}
+	return out.String()
+}
+
+// decodeToolJSON extracts the JSON object from a model answer and decodes it guided by the schema.
+// It repairs the mistakes models commonly make: markdown fences, text around the object,
+// trailing commas and empty keys ("": ...), which are named by their position in the schema.
+func decodeToolJSON(raw string, schema *JSONSchema) (interface{}, *ToolOutputError) {
+	text := extractJSONFromResponse(raw)
+	if !strings.HasPrefix(text, "{") {
+		return nil, &ToolOutputError{Category: ToolOutputNoJSON, Errors: []string{"answer contains no JSON object"}}
+	}
+
+	dec := json.NewDecoder(strings.NewReader(stripTrailingCommas(text)))
+	dec.UseNumber()
+	value, err := decodeSchemaValue(dec, schema)
+	if err != nil {
+		return nil, &ToolOutputError{Category: ToolOutputInvalidJSON, Errors: []string{err.Error()}}
+	}
+	return value, nil
+}
+
+func decodeSchemaValue(dec *json.Decoder, schema *JSONSchema) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := map[string]interface{}{}
+		for index := 0; dec.More(); index++ {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := keyTok.(string)
+			if key == "" && schema != nil && index < len(schema.Properties) {
+				key = schema.Properties[index].Name
+			}
+			value, err := decodeSchemaValue(dec, schema.property(key))
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = value
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case '[':
+		var items *JSONSchema
+		if schema != nil {
+			items = schema.Items
+		}
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeSchemaValue(dec, items)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected %v", delim)
+}
+
+// parseToolOutput decodes, repairs and validates a model answer into T
+func parseToolOutput[T any](raw string, schema *JSONSchema) (*T, *ToolOutputError) {
+	value, perr := decodeToolJSON(raw, schema)
+	if perr != nil {
+		return nil, perr
+	}
+	if errs := schema.Validate(value); len(errs) > 0 {
+		return nil, &ToolOutputError{Category: ToolOutputSchema, Errors: errs}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, &ToolOutputError{Category: ToolOutputSchema, Errors: []string{err.Error()}}
+	}
+	var out T
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, &ToolOutputError{Category: ToolOutputSchema, Errors: []string{err.Error()}}
+	}
+	return &out, nil
+}
+
+// generateToolOutput asks the AI for the structured output of a tool. An answer that does not match
+// the schema is re-asked once with the validation errors; the caller falls back when an error is returned.
+func generateToolOutput[T any](user *User, feature, prompt string, schema *JSONSchema) (*T, error) {
+	out, _, err := generateToolOutputWith[T](aiClient.ForUser(user), user, feature, prompt, schema)
+	return out, err
+}
+
+// generateToolOutputWith is generateToolOutput on a given client, e.g. an uncached one. It
+// also returns the answer the output was parsed from.
+func generateToolOutputWith[T any](client *AIClient, user *User, feature, prompt string, schema *JSONSchema) (*T, *LLMResponse, error) {
+	if client == nil {
+		metrics.IncToolOutputFailure(feature, ToolOutputLLMError)
+		metrics.IncToolOutput(feature, "failed")
+		return nil, nil, errors.New("AI client not initialized")
+	}
+
+	message := prompt
+	var conv *ConversationContext
+	for attempt := 1; ; attempt++ {
+		resp, err := client.GenerateMonetizeAIResponse(feature, message, conv)
+		if err != nil {
+			metrics.IncToolOutputFailure(feature, ToolOutputLLMError)
+			metrics.IncToolOutput(feature, "failed")
+			return nil, nil, err
+		}
+
+		out, perr := parseToolOutput[T](resp.Content, schema)
+		if perr == nil {
+			result := "ok"
+			if attempt > 1 {
+				result = "reask"
+			}
+			metrics.IncToolOutput(feature, result)
+			return out, resp, nil
+		}
+
+		perr.Tool = feature
+		metrics.IncToolOutputFailure(feature, perr.Category)
+		logger.Warn("AI tool output rejected",
+			zap.Int64("user_id", user.TelegramID),
+			zap.String("tool", feature),
+			zap.Int("attempt", attempt),
+			zap.String("category", perr.Category),
+			zap.Strings("errors", perr.Errors),
+			zap.String("provider", resp.Provider),
+			zap.String("model", resp.Model))
+
+		if attempt >= toolOutputMaxAttempts {
+			metrics.IncToolOutput(feature, "failed")
+			return nil, nil, perr
+		}
+
+		schemaJSON, _ := schema.MarshalJSON()
+		conv = &ConversationContext{Turns: []LLMMessage{
+			{Role: "user", Content: prompt},
+			{Role: "assistant", Content: resp.Content},
+		}}
+		message = renderPrompt(PromptToolOutputReask, map[string]string{
+			"errors": "- " + strings.Join(perr.Errors, "\n- "),
+			"schema": string(schemaJSON),
+		})
+	}
+}
+
+// Schemas of the AI tool outputs, matching the JSON each tool prompt asks for
+var (
+	businessBuilderSchema = objectSchema(
+		prop("businessName", titled("نام کسب‌وکار", stringSchema())),
+		prop("tagline", titled("شعار", stringSchema())),
+		prop("description", titled("توضیحات", stringSchema())),
+		prop("targetAudience", titled("مخاطب هدف", stringSchema())),
+		prop("products", titled("محصولات و خدمات", stringArraySchema(1))),
+		prop("monetization", titled("روش‌های کسب درآمد", stringArraySchema(1))),
+		prop("firstAction", titled("اولین قدم", stringSchema())),
+	)
+
+	sellKitSchema = objectSchema(
+		prop("title", titled("عنوان", stringSchema())),
+		prop("headline", titled("تیتر", stringSchema())),
+		prop("description", titled("توضیحات", stringSchema())),
+		prop("benefits", titled("مزایا", stringArraySchema(1))),
+		prop("priceRange", titled("بازه قیمت", stringSchema())),
+		prop("offer", titled("پیشنهاد ویژه", stringSchema())),
+		prop("visualSuggestion", titled("پیشنهاد تصویری", stringSchema())),
+	)
+
+	clientFinderSchema = objectSchema(
+		prop("channels", titled("کانال‌های پیشنهادی", &JSONSchema{
+			Type: "array",
+			Items: objectSchema(
+				prop("name", titled("کانال", stringSchema())),
+				prop("reason", titled("دلیل", stringSchema())),
+			),
+			MinItems: 1,
+		})),
+		prop("outreachMessage", titled("پیام ارتباط اولیه", stringSchema())),
+		prop("hashtags", titled("هشتگ‌ها", stringArraySchema(1))),
+		prop("actionPlan", titled("برنامه اقدام", stringArraySchema(1))),
+	)
+
+	salesPathSchema = objectSchema(
+		prop("dailyPlan", titled("برنامه روزانه", &JSONSchema{
+			Type: "array",
+			Items: objectSchema(
+				prop("day", titled("روز", stringSchema())),
+				prop("action", titled("اقدام", stringSchema())),
+				prop("content", titled("جزئیات", stringSchema())),
+			),
+			MinItems: 7,
+			MaxItems: 7,
+		})),
+		prop("salesTips", titled("نکات فروش", stringArraySchema(1))),
+		prop("engagement", titled("ایده‌های تعامل", stringArraySchema(1))),
+	)
+)
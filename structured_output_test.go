@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// parseToolOutputForGolden parses a recorded answer of a tool into the text stored in its golden file
+func parseToolOutputForGolden(t *testing.T, tool, raw string) string {
+	var (
+		out  interface{}
+		perr *ToolOutputError
+	)
+	switch tool {
+	case FeatureBusinessBuilder:
+		out, perr = parseToolOutput[BusinessBuilderResponse](raw, businessBuilderSchema)
+	case FeatureSellKit:
+		out, perr = parseToolOutput[SellKitResponse](raw, sellKitSchema)
+	case FeatureClientFinder:
+		out, perr = parseToolOutput[ClientFinderResponse](raw, clientFinderSchema)
+	case FeatureSalesPath:
+		out, perr = parseToolOutput[SalesPathResponse](raw, salesPathSchema)
+	default:
+		t.Fatalf("no schema for tool %q", tool)
+	}
+
+	if perr != nil {
+		return "error: " + perr.Category + "\n" + strings.Join(perr.Errors, "\n") + "\n"
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+// TestToolOutputGolden runs the recorded model answers in testdata/tool_outputs through the
+// repair and validation of their tool. Run with -update to rewrite the golden files.
+func TestToolOutputGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "tool_outputs", "*.input"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no golden inputs found: %v", err)
+	}
+
+	tools := []string{FeatureBusinessBuilder, FeatureSellKit, FeatureClientFinder, FeatureSalesPath}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".input")
+		t.Run(name, func(t *testing.T) {
+			tool := ""
+			for _, candidate := range tools {
+				if strings.HasPrefix(name, candidate+"_") {
+					tool = candidate
+				}
+			}
+
+			raw, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := parseToolOutputForGolden(t, tool, string(raw))
+
+			golden := strings.TrimSuffix(input, ".input") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file, run go test -run TestToolOutputGolden -update: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// TestGenerateToolOutputReasksWithValidationErrors asserts an invalid answer is re-asked once
+// with its validation errors and that a second invalid answer is reported as failed.
+func TestGenerateToolOutputReasksWithValidationErrors(t *testing.T) {
+	previous := aiClient
+	defer func() { aiClient = previous }()
+
+	valid, err := os.ReadFile(filepath.Join("testdata", "tool_outputs", "business_builder_clean.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := NewFakeLLMProvider("fake", `{"businessName": "فقط اسم"}`, string(valid))
+	aiClient = &AIClient{router: NewLLMRouter([]LLMProvider{fake}, nil)}
+
+	user := &User{TelegramID: 42}
+	plan, err := generateToolOutput[BusinessBuilderResponse](user, FeatureBusinessBuilder, "طرح بساز", businessBuilderSchema)
+	if err != nil {
+		t.Fatalf("generateToolOutput: %v", err)
+	}
+	if plan.BusinessName != "آکادمی هوش تجاری" {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected one re-ask, got %d calls", len(calls))
+	}
+	reask := calls[1].Messages[len(calls[1].Messages)-1].Content
+	if !strings.Contains(reask, "$.tagline: missing required field") || !strings.Contains(reask, `"required":["businessName"`) {
+		t.Errorf("re-ask should carry the validation errors and the schema, got:\n%s", reask)
+	}
+
+	fake = NewFakeLLMProvider("fake", "نه", "باز هم نه")
+	aiClient = &AIClient{router: NewLLMRouter([]LLMProvider{fake}, nil)}
+	_, err = generateToolOutput[BusinessBuilderResponse](user, FeatureBusinessBuilder, "طرح بساز", businessBuilderSchema)
+	var perr *ToolOutputError
+	if !errors.As(err, &perr) || perr.Category != ToolOutputNoJSON || len(fake.Calls()) != toolOutputMaxAttempts {
+		t.Fatalf("expected a no_json failure after %d attempts, got %v", toolOutputMaxAttempts, err)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// Exercise submissions sent as files: PDF, DOCX, images and voice notes are downloaded from
+// Telegram into the file storage and linked to the submission. Text is extracted from PDF and
+// DOCX for the AI evaluation; files without readable text go straight to a mentor.
+
+// Kinds of files accepted as exercise submissions
+const (
+	SubmissionFilePDF   = "pdf"
+	SubmissionFileDOCX  = "docx"
+	SubmissionFileImage = "image"
+	SubmissionFileVoice = "voice"
+)
+
+// defaultSubmissionMaxFileMB is used when SUBMISSION_MAX_FILE_MB is unset. Telegram bots can
+// not download files larger than 20 MB.
+const defaultSubmissionMaxFileMB = 20
+
+const docxMimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// submissionFile is a file attached to an exercise submission
+type submissionFile struct {
+	Kind           string
+	TelegramFileID string
+	Name           string
+	MimeType       string
+	Size           int64
+	Key            string // Storage key once stored
+	Text           string // Text extracted for the AI, empty when the file cannot be read
+}
+
+// submissionMaxFileBytes returns the accepted file size (SUBMISSION_MAX_FILE_MB)
+func submissionMaxFileBytes() int64 {
+	megabytes := defaultSubmissionMaxFileMB
+	if value, err := strconv.Atoi(os.Getenv("SUBMISSION_MAX_FILE_MB")); err == nil && value > 0 && value <= defaultSubmissionMaxFileMB {
+		megabytes = value
+	}
+	return int64(megabytes) << 20
+}
+
+// submissionFileFromMessage returns the file attached to message, or nil when there is none
+// or its format is not accepted
+func submissionFileFromMessage(message *tgbotapi.Message) *submissionFile {
+	switch {
+	case message.Document != nil:
+		doc := message.Document
+		file := &submissionFile{
+			TelegramFileID: doc.FileID,
+			Name:           doc.FileName,
+			MimeType:       doc.MimeType,
+			Size:           int64(doc.FileSize),
+		}
+		ext := strings.ToLower(path.Ext(doc.FileName))
+		switch {
+		case doc.MimeType == "application/pdf" || ext == ".pdf":
+			file.Kind = SubmissionFilePDF
+		case doc.MimeType == docxMimeType || ext == ".docx":
+			file.Kind = SubmissionFileDOCX
+		case strings.HasPrefix(doc.MimeType, "image/"):
+			file.Kind = SubmissionFileImage
+		case strings.HasPrefix(doc.MimeType, "audio/"):
+			file.Kind = SubmissionFileVoice
+		default:
+			return nil
+		}
+		return file
+	case len(message.Photo) > 0:
+		photo := message.Photo[len(message.Photo)-1] // Largest size
+		return &submissionFile{
+			Kind:           SubmissionFileImage,
+			TelegramFileID: photo.FileID,
+			Name:           "photo.jpg",
+			MimeType:       "image/jpeg",
+			Size:           int64(photo.FileSize),
+		}
+	case message.Voice != nil:
+		return &submissionFile{
+			Kind:           SubmissionFileVoice,
+			TelegramFileID: message.Voice.FileID,
+			Name:           "voice.ogg",
+			MimeType:       message.Voice.MimeType,
+			Size:           int64(message.Voice.FileSize),
+		}
+	case message.Audio != nil:
+		return &submissionFile{
+			Kind:           SubmissionFileVoice,
+			TelegramFileID: message.Audio.FileID,
+			Name:           message.Audio.FileName,
+			MimeType:       message.Audio.MimeType,
+			Size:           int64(message.Audio.FileSize),
+		}
+	}
+	return nil
+}
+
+// hasSubmissionAttachment reports whether message carries a file of any kind
+func hasSubmissionAttachment(message *tgbotapi.Message) bool {
+	return message.Document != nil || len(message.Photo) > 0 || message.Voice != nil ||
+		message.Audio != nil || message.Video != nil || message.VideoNote != nil
+}
+
+// handleExerciseFileSubmission stores a file sent in the submitting_exercise state and submits it
+func handleExerciseFileSubmission(user *User, message *tgbotapi.Message) string {
+	file := submissionFileFromMessage(message)
+	if file == nil {
+		return "❌ این نوع فایل پشتیبانی نمی‌شود. لطفا تمرین را به صورت متن، PDF، Word (DOCX)، عکس یا پیام صوتی ارسال کنید."
+	}
+	data, errMsg := storeSubmissionFile(user, file)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	if file.Kind == SubmissionFilePDF || file.Kind == SubmissionFileDOCX {
+		text, err := extractDocumentText(file.Kind, data)
+		if err != nil {
+			logger.Info("No text extracted from submission file",
+				zap.Int64("user_id", user.TelegramID),
+				zap.String("kind", file.Kind),
+				zap.Error(err))
+		}
+		file.Text = text
+	}
+
+	content := strings.TrimSpace(message.Caption)
+	if file.Text != "" {
+		content = strings.TrimSpace(content + "\n\n" + file.Text)
+	}
+	return handleExerciseSubmission(user, content, file)
+}
+
+// storeSubmissionFile downloads the file from Telegram and puts it in the file storage,
+// setting its Key. It returns the file's data, or the message for the user when it fails.
+func storeSubmissionFile(user *User, file *submissionFile) ([]byte, string) {
+	maxBytes := submissionMaxFileBytes()
+	if file.Size > maxBytes {
+		return nil, fmt.Sprintf("❌ حجم فایل بیشتر از %d مگابایت است. لطفا فایل کوچک‌تری ارسال کنید.", maxBytes>>20)
+	}
+
+	data, err := downloadTelegramFile(file.TelegramFileID, maxBytes)
+	if err != nil {
+		logger.Error("Failed to download submission file",
+			zap.Int64("user_id", user.TelegramID),
+			zap.String("kind", file.Kind),
+			zap.Error(err))
+		return nil, "❌ خطا در دریافت فایل. لطفا دوباره تلاش کنید."
+	}
+	file.Size = int64(len(data))
+	if file.MimeType == "" {
+		file.MimeType = http.DetectContentType(data)
+	}
+
+	file.Key = submissionFileKey(user.TelegramID, file)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := getFileStorage().Put(ctx, file.Key, data, file.MimeType); err != nil {
+		logger.Error("Failed to store submission file",
+			zap.Int64("user_id", user.TelegramID),
+			zap.String("key", file.Key),
+			zap.Error(err))
+		return nil, "❌ خطا در ذخیره فایل. لطفا دوباره تلاش کنید."
+	}
+	return data, ""
+}
+
+// attachTo copies the stored file onto a submission; a nil file leaves it unchanged
+func (f *submissionFile) attachTo(submission *ExerciseSubmission) {
+	if f == nil {
+		return
+	}
+	submission.FileKind = f.Kind
+	submission.FileName = f.Name
+	submission.FileMime = f.MimeType
+	submission.FileSize = f.Size
+	submission.FileKey = f.Key
+	submission.TelegramFileID = f.TelegramFileID
+}
+
+// submitFileForMentorReview saves a file the AI cannot read as a pending submission and
+// queues it for a mentor, who unlocks the next session on a pass
+func submitFileForMentorReview(user *User, session *Session, caption string, file *submissionFile) string {
+	submission := ExerciseSubmission{
+		UserID:      user.ID,
+		TelegramID:  user.TelegramID,
+		SessionID:   session.ID,
+		Attempt:     nextSubmissionAttempt(user.TelegramID, session.ID),
+		Content:     caption,
+		Status:      "pending",
+		SubmittedAt: time.Now(),
+	}
+	linkSessionAssignment(&submission)
+	file.attachTo(&submission)
+
+	if err := db.Create(&submission).Error; err != nil {
+		logger.Error("Failed to save exercise submission",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Uint("session_id", session.ID),
+			zap.Error(err))
+		return "❌ خطا در ثبت تمرین. لطفا دوباره تلاش کنید."
+	}
+	queueReview(&ExerciseReview{
+		Source:        ReviewSourceExercise,
+		SourceID:      submission.ID,
+		TelegramID:    submission.TelegramID,
+		SessionID:     submission.SessionID,
+		SessionNumber: session.Number,
+		Submission:    submission.reviewText(),
+		Reason:        ReviewReasonAIFailed,
+	})
+
+	logger.Info("Exercise file queued for mentor review",
+		zap.Int64("user_id", user.TelegramID),
+		zap.Uint("submission_id", submission.ID),
+		zap.String("kind", file.Kind))
+
+	return "📎 فایل تمرین شما دریافت شد.\n\n👨‍🏫 این تمرین توسط منتور بررسی می‌شود و نتیجه به همین ربات ارسال خواهد شد."
+}
+
+// reviewText is the submission as shown in the review queue, naming the attached file
+func (s *ExerciseSubmission) reviewText() string {
+	if s.FileName == "" {
+		return s.Content
+	}
+	return strings.TrimSpace(fmt.Sprintf("📎 %s (%s)\n%s", s.FileName, s.FileKind, s.Content))
+}
+
+// downloadTelegramFile fetches a file sent to the bot, up to maxBytes
+func downloadTelegramFile(fileID string, maxBytes int64) ([]byte, error) {
+	url, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("telegram file download: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, errors.New("file is larger than the limit")
+	}
+	return data, nil
+}
+
+// submissionFileKey returns a unique storage key for a user's file
+func submissionFileKey(telegramID int64, file *submissionFile) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	// 🔒 SECURITY: the user's file name only contributes a plain extension to the key
+	ext := strings.ToLower(path.Ext(file.Name))
+	if len(ext) < 2 || len(ext) > 8 || strings.IndexFunc(ext[1:], func(r rune) bool {
+		return !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9')
+	}) >= 0 {
+		ext = "." + file.Kind
+	}
+	return fmt.Sprintf("submissions/%d/%s-%s%s", telegramID, time.Now().Format("20060102-150405"), hex.EncodeToString(suffix), ext)
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AI tools of the mini app, declared as data: a tool is its form fields, a prompt template
+// (see prompt_defaults.go), an output schema, the plans it is available on and an optional
+// rate limit. POST /api/v1/tools/:name serves every tool; GET /api/v1/tools lets the mini
+// app render the forms. Adding a tool means adding a ToolDefinition and its prompt template.
+
+// Types of tool form fields
+const (
+	ToolFieldText        = "text"
+	ToolFieldTextarea    = "textarea"
+	ToolFieldSelect      = "select"
+	ToolFieldMultiSelect = "multiselect" // A list of strings, joined with ", " in the prompt
+)
+
+// defaultToolFieldMaxLength applies to fields without MaxLength
+const defaultToolFieldMaxLength = 1000
+
+// ToolField is one input of a tool form. Its Name is the prompt template variable.
+type ToolField struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	MaxLength   int      `json:"max_length,omitempty"` // In characters, per item for multiselect
+	MaxItems    int      `json:"max_items,omitempty"`  // multiselect only
+	Options     []string `json:"options,omitempty"`    // Allowed values of select, suggestions of multiselect
+	Placeholder string   `json:"placeholder,omitempty"`
+	Default     string   `json:"-"` // Prompt value when an optional field is left empty
+}
+
+// ToolRateLimit allows Requests calls per Window and user. It applies on top of the shared
+// limit of AI calls from the mini app (MaxMiniAppCallsPerMinute).
+type ToolRateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ToolDefinition declares an AI tool
+type ToolDefinition struct {
+	Name        string        // URL name, e.g. business-builder
+	Feature     string        // Model routing, usage metering and saved results (LLM_MODEL_<FEATURE>)
+	Title       string        // Shown in the mini app and exports
+	Description string        // Shown in the mini app
+	Fields      []ToolField   // Form fields, in display order
+	Prompt      string        // Prompt template rendered with the field values
+	Output      *JSONSchema   // Output the model must return
+	Plans       []string      // Usage plans the tool is available on, empty for every plan
+	RateLimit   ToolRateLimit // Zero value: only the shared mini app limit
+	TitleField  string        // Output property or field naming saved results
+
+	// Fallback builds an output from the form when the AI output is unusable. Without it
+	// the request fails.
+	Fallback func(input map[string]string) interface{}
+}
+
+// toolRegistry holds the tools in discovery order
+var toolRegistry = []*ToolDefinition{
+	{
+		Name:        "business-builder",
+		Feature:     FeatureBusinessBuilder,
+		Title:       "Business Builder",
+		Description: "ساخت طرح کسب‌وکار بر اساس علاقه‌مندی‌ها، مهارت‌ها و بازار هدف",
+		Fields: []ToolField{
+			{Name: "user_name", Label: "نام", Type: ToolFieldText, Required: true, MaxLength: 100},
+			{Name: "interests", Label: "علاقه‌مندی‌ها", Type: ToolFieldTextarea, Required: true},
+			{Name: "skills", Label: "مهارت‌ها", Type: ToolFieldTextarea},
+			{Name: "market", Label: "بازار هدف", Type: ToolFieldText, Required: true, MaxLength: 300},
+		},
+		Prompt:     PromptBusinessBuilderRequest,
+		Output:     businessBuilderSchema,
+		TitleField: "businessName",
+		Fallback: func(input map[string]string) interface{} {
+			return &BusinessBuilderResponse{
+				BusinessName:   fmt.Sprintf("استارتاپ %s", input["interests"]),
+				Tagline:        fmt.Sprintf("%s را به زبان خودت بیاموز", input["interests"]),
+				Description:    fmt.Sprintf("پلتفرم آموزشی آنلاین برای %s که به کاربران کمک می‌کند مهارت‌های خود را توسعه دهند", input["market"]),
+				TargetAudience: input["market"],
+				Products:       []string{"دوره‌های آنلاین", "پروژه‌های عملی", "پشتیبانی تخصصی"},
+				Monetization:   []string{"عضویت ماهیانه", "فروش دوره‌های اختصاصی", "مشاوره تخصصی"},
+				FirstAction:    "ثبت نام در یک دوره آنلاین و آغاز آموزش به‌صورت رایگان",
+			}
+		},
+	},
+	{
+		Name:        "sellkit",
+		Feature:     FeatureSellKit,
+		Title:       "SellKit",
+		Description: "ساخت کیت فروش حرفه‌ای برای محصول یا خدمات",
+		Fields: []ToolField{
+			{Name: "product_name", Label: "نام محصول", Type: ToolFieldText, Required: true, MaxLength: 200},
+			{Name: "description", Label: "توضیحات", Type: ToolFieldTextarea, Required: true},
+			{Name: "target_audience", Label: "مخاطب هدف", Type: ToolFieldText, Required: true, MaxLength: 300},
+			{Name: "benefits", Label: "مزایای اصلی", Type: ToolFieldTextarea},
+		},
+		Prompt:     PromptSellKitRequest,
+		Output:     sellKitSchema,
+		TitleField: "product_name",
+		Fallback: func(input map[string]string) interface{} {
+			return &SellKitResponse{
+				Title:            fmt.Sprintf("کیت فروش %s", input["product_name"]),
+				Headline:         fmt.Sprintf("بهترین %s برای %s", input["product_name"], input["target_audience"]),
+				Description:      fmt.Sprintf("محصول %s طراحی شده برای %s که مشکلات اصلی آنها را حل می‌کند", input["product_name"], input["target_audience"]),
+				Benefits:         []string{"کیفیت بالا", "قیمت مناسب", "پشتیبانی 24 ساعته", "ضمانت کیفیت"},
+				PriceRange:       "500,000 تا 2,000,000 تومان",
+				Offer:            "تخفیف ویژه 20% برای خریداران اولیه",
+				VisualSuggestion: "تصاویر با کیفیت از محصول و مشتریان راضی",
+			}
+		},
+	},
+	{
+		Name:        "clientfinder",
+		Feature:     FeatureClientFinder,
+		Title:       "ClientFinder",
+		Description: "راهنمای یافتن مشتری در کانال‌های مناسب",
+		Fields: []ToolField{
+			{Name: "product", Label: "محصول یا خدمات", Type: ToolFieldText, Required: true, MaxLength: 200},
+			{Name: "target_client", Label: "مخاطب هدف", Type: ToolFieldText, Required: true, MaxLength: 300},
+			{Name: "platforms", Label: "پلتفرم‌ها", Type: ToolFieldMultiSelect, MaxLength: 50, MaxItems: 10,
+				Options: []string{"Instagram", "Telegram", "LinkedIn", "Email"}, Default: "همه پلتفرم‌ها"},
+		},
+		Prompt:     PromptClientFinderRequest,
+		Output:     clientFinderSchema,
+		TitleField: "product",
+		Fallback: func(input map[string]string) interface{} {
+			return &ClientFinderResponse{
+				Channels: []ClientChannel{
+					{Name: "اینستاگرام", Reason: "پلتفرم اصلی برای ارتباط با مشتریان ایرانی"},
+					{Name: "تلگرام", Reason: "کانال‌های تخصصی و گروه‌های هدفمند"},
+					{Name: "لینکدین", Reason: "شبکه حرفه‌ای برای B2B"},
+				},
+				OutreachMessage: fmt.Sprintf("سلام! محصول %s ما می‌تواند به شما در %s کمک کند. آیا علاقه‌مند به اطلاعات بیشتر هستید؟", input["product"], input["target_client"]),
+				Hashtags:        []string{"#فروش", "#کسب_و_کار", "#ایران", "#آنلاین"},
+				ActionPlan:      []string{"شناسایی مخاطبان هدف", "تولید محتوای جذاب", "ارسال پیام‌های شخصی", "پیگیری منظم"},
+			}
+		},
+	},
+	{
+		Name:        "salespath",
+		Feature:     FeatureSalesPath,
+		Title:       "SalesPath",
+		Description: "برنامه فروش ۷ روزه برای محصول و کانال فروش",
+		Fields: []ToolField{
+			{Name: "product_name", Label: "نام محصول یا خدمات", Type: ToolFieldText, Required: true, MaxLength: 200},
+			{Name: "target_audience", Label: "مخاطب هدف", Type: ToolFieldText, Required: true, MaxLength: 300},
+			{Name: "sales_channel", Label: "کانال فروش", Type: ToolFieldText, Required: true, MaxLength: 200},
+			{Name: "goal", Label: "هدف فروش", Type: ToolFieldText, MaxLength: 300},
+		},
+		Prompt:     PromptSalesPathRequest,
+		Output:     salesPathSchema,
+		TitleField: "product_name",
+		Fallback: func(input map[string]string) interface{} {
+			return &SalesPathResponse{
+				DailyPlan: []DailyPlan{
+					{Day: "روز ۱", Action: "آماده‌سازی محتوا", Content: "ایجاد پست معرفی محصول و آماده‌سازی پیام‌های فروش"},
+					{Day: "روز ۲", Action: "شروع تعامل", Content: "ارسال پیام به 20 مخاطب هدف و پاسخ به کامنت‌ها"},
+					{Day: "روز ۳", Action: "ارائه پیشنهاد", Content: "ارائه تخفیف ویژه و تماس با مشتریان علاقه‌مند"},
+					{Day: "روز ۴", Action: "پیگیری فروش", Content: "تماس با مشتریان و بستن اولین معاملات"},
+					{Day: "روز ۵", Action: "بهینه‌سازی", Content: "تحلیل نتایج و بهبود استراتژی فروش"},
+					{Day: "روز ۶", Action: "توسعه بازار", Content: "جستجوی مشتریان جدید و گسترش شبکه"},
+					{Day: "روز ۷", Action: "نتیجه‌گیری", Content: "ارزیابی نتایج و برنامه‌ریزی برای هفته بعد"},
+				},
+				SalesTips: []string{
+					"همیشه روی ارزش محصول تمرکز کنید نه قیمت",
+					"مشتریان را گوش دهید و نیازهایشان را درک کنید",
+					"از داستان‌سرایی برای جذب توجه استفاده کنید",
+					"پیگیری منظم و مداوم داشته باشید",
+				},
+				Engagement: []string{
+					"پرسش‌های تعاملی",
+					"محتوای آموزشی",
+					"تخفیف‌های محدود",
+					"گواهی‌نامه‌های کیفیت",
+				},
+			}
+		},
+	},
+}
+
+// Outputs of the built-in tools, used by their fallbacks. They match the tool schemas.
+
+// BusinessBuilderResponse represents the structured business plan response
+type BusinessBuilderResponse struct {
+	BusinessName   string   `json:"businessName"`
+	Tagline        string   `json:"tagline"`
+	Description    string   `json:"description"`
+	TargetAudience string   `json:"targetAudience"`
+	Products       []string `json:"products"`
+	Monetization   []string `json:"monetization"`
+	FirstAction    string   `json:"firstAction"`
+}
+
+// SellKitResponse represents the structured sales kit response
+type SellKitResponse struct {
+	Title            string   `json:"title"`
+	Headline         string   `json:"headline"`
+	Description      string   `json:"description"`
+	Benefits         []string `json:"benefits"`
+	PriceRange       string   `json:"priceRange"`
+	Offer            string   `json:"offer"`
+	VisualSuggestion string   `json:"visualSuggestion"`
+}
+
+// ClientFinderResponse represents the structured client finder response
+type ClientFinderResponse struct {
+	Channels        []ClientChannel `json:"channels"`
+	OutreachMessage string          `json:"outreachMessage"`
+	Hashtags        []string        `json:"hashtags"`
+	ActionPlan      []string        `json:"actionPlan"`
+}
+
+// ClientChannel represents a recommended channel for finding clients
+type ClientChannel struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// SalesPathResponse represents the structured sales path response
+type SalesPathResponse struct {
+	DailyPlan  []DailyPlan `json:"dailyPlan"`
+	SalesTips  []string    `json:"salesTips"`
+	Engagement []string    `json:"engagement"`
+}
+
+// DailyPlan represents a daily action in the sales path
+type DailyPlan struct {
+	Day     string `json:"day"`
+	Action  string `json:"action"`
+	Content string `json:"content"`
+}
+
+// findTool returns the tool with a URL name, nil when there is none
+func findTool(name string) *ToolDefinition {
+	for _, tool := range toolRegistry {
+		if tool.Name == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// toolByFeature returns the tool of a feature, nil when there is none
+func toolByFeature(feature string) *ToolDefinition {
+	for _, tool := range toolRegistry {
+		if tool.Feature == feature {
+			return tool
+		}
+	}
+	return nil
+}
+
+// toolFeatures lists the features of all tools, for per-feature model settings
+func toolFeatures() []string {
+	features := make([]string, 0, len(toolRegistry))
+	for _, tool := range toolRegistry {
+		features = append(features, tool.Feature)
+	}
+	return features
+}
+
+// availableOn reports whether the tool is included in a usage plan
+func (t *ToolDefinition) availableOn(plan string) bool {
+	if len(t.Plans) == 0 {
+		return true
+	}
+	for _, allowed := range t.Plans {
+		if allowed == plan {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInput validates a submitted form. It returns the cleaned values to store (strings, or
+// string lists for multiselect) and the prompt variables, or the errors to show the user.
+func (t *ToolDefinition) parseInput(raw map[string]interface{}) (stored map[string]interface{}, vars map[string]string, errs []string) {
+	stored = make(map[string]interface{}, len(t.Fields))
+	vars = make(map[string]string, len(t.Fields))
+	var missing []string
+
+	for _, field := range t.Fields {
+		maxLength := field.MaxLength
+		if maxLength <= 0 {
+			maxLength = defaultToolFieldMaxLength
+		}
+
+		if field.Type == ToolFieldMultiSelect {
+			var items []string
+			switch value := raw[field.Name].(type) {
+			case nil:
+			case []interface{}:
+				for _, item := range value {
+					text, ok := item.(string)
+					if !ok {
+						errs = append(errs, fmt.Sprintf("%s نامعتبر است", field.Label))
+						break
+					}
+					if text = strings.TrimSpace(text); text != "" {
+						items = append(items, text)
+					}
+				}
+			default:
+				errs = append(errs, fmt.Sprintf("%s باید فهرست باشد", field.Label))
+				continue
+			}
+			if field.MaxItems > 0 && len(items) > field.MaxItems {
+				errs = append(errs, fmt.Sprintf("حداکثر %d مورد برای %s مجاز است", field.MaxItems, field.Label))
+			}
+			for _, item := range items {
+				if utf8.RuneCountInString(item) > maxLength {
+					errs = append(errs, fmt.Sprintf("%s بیش از حد طولانی است", field.Label))
+					break
+				}
+			}
+			if len(items) == 0 && field.Required {
+				missing = append(missing, field.Label)
+			}
+			stored[field.Name] = items
+			vars[field.Name] = strings.Join(items, ", ")
+			if len(items) == 0 {
+				vars[field.Name] = field.Default
+			}
+			continue
+		}
+
+		var text string
+		switch value := raw[field.Name].(type) {
+		case nil:
+		case string:
+			text = strings.TrimSpace(value)
+		default:
+			errs = append(errs, fmt.Sprintf("%s باید متن باشد", field.Label))
+			continue
+		}
+		switch {
+		case text == "" && field.Required:
+			missing = append(missing, field.Label)
+		case utf8.RuneCountInString(text) > maxLength:
+			errs = append(errs, fmt.Sprintf("%s حداکثر %d کاراکتر است", field.Label, maxLength))
+		case text != "" && field.Type == ToolFieldSelect && !containsString(field.Options, text):
+			errs = append(errs, fmt.Sprintf("مقدار %s نامعتبر است", field.Label))
+		}
+		stored[field.Name] = text
+		vars[field.Name] = text
+		if text == "" {
+			vars[field.Name] = field.Default
+		}
+	}
+
+	if len(missing) > 0 {
+		errs = append([]string{strings.Join(missing, "، ") + " الزامی است"}, errs...)
+	}
+	return stored, vars, errs
+}
+
+// inputText joins the form values in field order, as checked by moderation
+func (t *ToolDefinition) inputText(vars map[string]string) string {
+	values := make([]string, 0, len(t.Fields))
+	for _, field := range t.Fields {
+		if value := vars[field.Name]; value != "" {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, "\n")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// toolRun is one generated tool output and what produced it
+type toolRun struct {
+	Output        interface{}
+	Fallback      bool   // The AI output was unusable and the tool's fallback was used instead
+	Provider      string // Empty for a fallback
+	Model         string
+	PromptVersion int // Version of the tool's prompt template, 0 for the built-in copy
+}
+
+// run generates the output of a tool for validated prompt variables. fresh skips the
+// response cache, for regenerating a result.
+func (t *ToolDefinition) run(user *User, vars map[string]string, fresh bool) (*toolRun, error) {
+	client := aiClient.ForUser(user)
+	if fresh {
+		client = client.Uncached()
+	}
+	prompt := renderPrompt(t.Prompt, vars)
+	run := &toolRun{PromptVersion: promptVersion(t.Prompt)}
+	out, served, err := generateToolOutputWith[map[string]interface{}](client, user, t.Feature, prompt, t.Output)
+	if err == nil {
+		run.Output, run.Provider, run.Model = *out, served.Provider, served.Model
+		return run, nil
+	}
+	if t.Fallback == nil {
+		return nil, err
+	}
+	logger.Error("AI tool output unusable, using fallback",
+		zap.Int64("telegram_id", user.TelegramID),
+		zap.String("tool", t.Name),
+		zap.Error(err))
+	run.Output, run.Fallback = t.Fallback(vars), true
+	return run, nil
+}
+
+// resultTitle names a saved result after TitleField, read from the output or the form
+func (t *ToolDefinition) resultTitle(output interface{}, vars map[string]string) string {
+	if t.TitleField == "" {
+		return t.Title
+	}
+	if value, ok := vars[t.TitleField]; ok && value != "" {
+		return value
+	}
+	var fields map[string]interface{}
+	if data, err := json.Marshal(output); err == nil && json.Unmarshal(data, &fields) == nil {
+		if title, ok := fields[t.TitleField].(string); ok && title != "" {
+			return title
+		}
+	}
+	return t.Title
+}
+
+// ==========================================
+// Rate limits
+// ==========================================
+
+var (
+	toolCalls   = make(map[string][]time.Time) // "tool:telegram_id" -> calls inside the window
+	toolCallsMu sync.Mutex
+)
+
+// allowCall records a call of the tool if its own rate limit allows it
+func (t *ToolDefinition) allowCall(telegramID int64, now time.Time) bool {
+	if t.RateLimit.Requests <= 0 || t.RateLimit.Window <= 0 {
+		return true
+	}
+	key := fmt.Sprintf("%s:%d", t.Name, telegramID)
+
+	toolCallsMu.Lock()
+	defer toolCallsMu.Unlock()
+
+	recent := toolCalls[key][:0]
+	for _, call := range toolCalls[key] {
+		if now.Sub(call) < t.RateLimit.Window {
+			recent = append(recent, call)
+		}
+	}
+	if len(recent) >= t.RateLimit.Requests {
+		toolCalls[key] = recent
+		return false
+	}
+	toolCalls[key] = append(recent, now)
+	return true
+}
+
+// ==========================================
+// Mini App API
+// ==========================================
+
+// toolView is a tool as described to the mini app
+type toolView struct {
+	Name          string      `json:"name"`
+	Title         string      `json:"title"`
+	Description   string      `json:"description"`
+	Fields        []ToolField `json:"fields"`
+	OutputSchema  *JSONSchema `json:"output_schema"`
+	Plans         []string    `json:"plans,omitempty"`
+	RateLimit     int         `json:"rate_limit,omitempty"` // Calls per RateWindowSec, on top of the shared limit
+	RateWindowSec int         `json:"rate_window_seconds,omitempty"`
+}
+
+func (t *ToolDefinition) view() toolView {
+	return toolView{
+		Name:          t.Name,
+		Title:         t.Title,
+		Description:   t.Description,
+		Fields:        t.Fields,
+		OutputSchema:  t.Output,
+		Plans:         t.Plans,
+		RateLimit:     t.RateLimit.Requests,
+		RateWindowSec: int(t.RateLimit.Window / time.Second),
+	}
+}
+
+// listToolsAPI handles GET /api/v1/tools
+func listToolsAPI(c *gin.Context) {
+	tools := make([]toolView, 0, len(toolRegistry))
+	for _, tool := range toolRegistry {
+		tools = append(tools, tool.view())
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    tools,
+	})
+}
+
+// getToolAPI handles GET /api/v1/tools/:name
+func getToolAPI(c *gin.Context) {
+	tool := findTool(c.Param("name"))
+	if tool == nil {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Error:   "Tool not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    tool.view(),
+	})
+}
+
+// handleToolRequestAPI handles POST /api/v1/tools/:name. The body is the form as a flat
+// object with telegram_id, e.g. {"telegram_id": 1, "product_name": "..."}. With "async": true
+// the tool runs as an AI job and 202 returns its job_id.
+func handleToolRequestAPI(c *gin.Context) {
+	serveTool(c, c.Param("name"))
+}
+
+// toolHandler serves one tool on its own route (/business-builder, /sellkit, ...)
+func toolHandler(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveTool(c, name)
+	}
+}
+
+// serveTool runs a tool for the form in the request body
+func serveTool(c *gin.Context, name string) {
+	tool := findTool(name)
+	if tool == nil {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Error:   "Tool not found",
+		})
+		return
+	}
+
+	var raw map[string]interface{}
+	body, err := c.GetRawData()
+	if err == nil {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+	number, _ := raw["telegram_id"].(json.Number)
+	telegramID, err := number.Int64()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid telegram_id",
+		})
+		return
+	}
+
+	// 🔒 SECURITY: The tool runs on this user's quota and history, so the caller must own it
+	if !requireAccountOwner(c, telegramID) {
+		return
+	}
+
+	// 📢 Check channel membership
+	if errMsg := checkChannelMembershipAPI(telegramID); errMsg != "" {
+		c.JSON(http.StatusForbidden, APIResponse{
+			Success: false,
+			Error:   errMsg,
+		})
+		return
+	}
+
+	stored, vars, errs := tool.parseInput(raw)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   strings.Join(errs, "\n"),
+		})
+		return
+	}
+
+	user, ok := toolUser(c, tool, telegramID)
+	if !ok {
+		return
+	}
+
+	// 🔒 SECURITY: The form is moderated like a chat message
+	if rejectIfModerated(c, user, tool.Feature, tool.inputText(vars)) {
+		return
+	}
+
+	// Long requests can run in the background: {"async": true, "deliver_to_telegram": true}.
+	// Delivery only ever reaches the caller, the owner check above runs before the job is queued.
+	if async, _ := raw["async"].(bool); async {
+		deliver, _ := raw["deliver_to_telegram"].(bool)
+		input, _ := json.Marshal(stored)
+		job := &AIJob{
+			TelegramID:        telegramID,
+			Kind:              AIJobTool,
+			Source:            AIJobSourceMiniApp,
+			Tool:              tool.Name,
+			Input:             string(input),
+			DeliverToTelegram: deliver,
+		}
+		if err := enqueueAIJob(job, 0); err != nil {
+			logger.Error("Failed to queue AI tool request",
+				zap.Int64("telegram_id", telegramID),
+				zap.String("tool", tool.Name),
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Error:   "Database error",
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, APIResponse{
+			Success: true,
+			Data:    gin.H{"job_id": job.ID, "status": job.Status},
+		})
+		return
+	}
+
+	run, err := tool.run(user, vars, false)
+	if err != nil {
+		logger.Error("AI tool failed",
+			zap.Int64("telegram_id", telegramID),
+			zap.String("tool", tool.Name),
+			zap.Error(err))
+		c.JSON(http.StatusBadGateway, APIResponse{
+			Success: false,
+			Error:   "در حال حاضر امکان پاسخگویی وجود ندارد، لطفا دوباره تلاش کنید",
+		})
+		return
+	}
+	result := saveToolResult(user, tool.Feature, tool.resultTitle(run.Output, vars), stored, run, nil)
+
+	logger.Info("AI tool output generated",
+		zap.Int64("telegram_id", telegramID),
+		zap.String("tool", tool.Name),
+		zap.Bool("fallback", run.Fallback))
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    withToolResult(run.Output, result),
+	})
+}
+
+// toolUser loads the user and applies the access rules of an AI tool call: bans, plan
+// entitlement, rate limits and the token quota
+func toolUser(c *gin.Context, tool *ToolDefinition, telegramID int64) (*User, bool) {
+	// ⚡ PERFORMANCE: Get user from cache
+	user, err := userCache.GetUser(telegramID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "کاربر یافت نشد",
+			})
+			return nil, false
+		}
+		logger.Error("Database error in finding user for AI tool",
+			zap.String("tool", tool.Name),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return nil, false
+	}
+
+	// 🔒 SECURITY: Banned users can't use AI tools
+	if rejectIfBanned(c, telegramID, BanScopeMiniApp) {
+		return nil, false
+	}
+
+	if !tool.availableOn(usagePlan(user)) {
+		c.JSON(http.StatusForbidden, APIResponse{
+			Success: false,
+			Error:   "این ابزار در پلن شما فعال نیست، برای استفاده پلن خود را ارتقا دهید",
+		})
+		return nil, false
+	}
+
+	// 🔒 SECURITY: Rate limiting for AI tools
+	if !checkMiniAppRateLimit(telegramID) {
+		c.JSON(http.StatusTooManyRequests, APIResponse{
+			Success: false,
+			Error:   "شما به محدودیت سه تا سوال در دقیقه رسیدید لطفا دقایق دیگر امتحان کنید",
+		})
+		return nil, false
+	}
+	if !tool.allowCall(telegramID, time.Now()) {
+		c.JSON(http.StatusTooManyRequests, APIResponse{
+			Success: false,
+			Error:   fmt.Sprintf("شما به محدودیت استفاده از %s رسیدید، لطفا کمی بعد دوباره امتحان کنید", tool.Title),
+		})
+		return nil, false
+	}
+
+	// Daily and monthly token quota of the plan
+	if rejectIfTokenQuotaExceeded(c, user) {
+		return nil, false
+	}
+	return user, true
+}
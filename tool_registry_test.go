@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestToolRegistry checks that every tool has a prompt template for its fields and an
+// output schema, and covers form validation and per-tool rate limits.
+func TestToolRegistry(t *testing.T) {
+	names := map[string]bool{}
+	for _, tool := range toolRegistry {
+		if names[tool.Name] {
+			t.Errorf("duplicate tool %q", tool.Name)
+		}
+		names[tool.Name] = true
+		if tool.Output == nil || tool.Feature == "" {
+			t.Errorf("tool %q needs a feature and an output schema", tool.Name)
+		}
+
+		var prompt *builtinPrompt
+		for i := range builtinPrompts {
+			if builtinPrompts[i].Name == tool.Prompt {
+				prompt = &builtinPrompts[i]
+			}
+		}
+		if prompt == nil {
+			t.Errorf("tool %q uses unknown prompt %q", tool.Name, tool.Prompt)
+			continue
+		}
+		fields := make([]string, 0, len(tool.Fields))
+		for _, field := range tool.Fields {
+			fields = append(fields, field.Name)
+		}
+		if strings.Join(fields, ",") != strings.Join(prompt.Variables, ",") {
+			t.Errorf("tool %q fields %v don't match prompt variables %v", tool.Name, fields, prompt.Variables)
+		}
+	}
+
+	tool := findTool("clientfinder")
+	stored, vars, errs := tool.parseInput(map[string]interface{}{
+		"telegram_id":   float64(1),
+		"product":       "  دوره طراحی ",
+		"target_client": "طراحان تازه‌کار",
+	})
+	if len(errs) > 0 || stored["product"] != "دوره طراحی" || vars["platforms"] != "همه پلتفرم‌ها" {
+		t.Errorf("unexpected parse: %v %v %v", stored, vars, errs)
+	}
+	_, vars, _ = tool.parseInput(map[string]interface{}{
+		"product": "x", "target_client": "y", "platforms": []interface{}{"Instagram", "Telegram"},
+	})
+	if vars["platforms"] != "Instagram, Telegram" {
+		t.Errorf("multiselect should be joined, got %q", vars["platforms"])
+	}
+	_, _, errs = tool.parseInput(map[string]interface{}{
+		"product": strings.Repeat("ا", 201), "platforms": "Instagram",
+	})
+	if len(errs) != 3 || !strings.Contains(errs[0], "مخاطب هدف الزامی است") {
+		t.Errorf("expected missing, too long and not a list errors, got %v", errs)
+	}
+
+	limited := &ToolDefinition{Name: "limited", RateLimit: ToolRateLimit{Requests: 2, Window: time.Minute}}
+	now := time.Now()
+	if !limited.allowCall(42, now) || !limited.allowCall(42, now) || limited.allowCall(42, now) {
+		t.Error("third call inside the window should be rejected")
+	}
+	if !limited.allowCall(42, now.Add(time.Minute)) {
+		t.Error("calls outside the window should be allowed")
+	}
+	if !(&ToolDefinition{Plans: nil}).availableOn(UsagePlanFree) || (&ToolDefinition{Plans: []string{"pro"}}).availableOn(UsagePlanFree) {
+		t.Error("plan entitlement not applied")
+	}
+}
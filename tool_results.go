@@ -0,0 +1,839 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Saved results of the AI tools (Business Builder, SellKit, ClientFinder, SalesPath). Every
+// generated output is stored with the form it came from. Regenerating a result adds a new
+// version to the same group, so versions can be listed and compared.
+
+// Export formats of a saved result
+const (
+	ToolResultFormatMarkdown = "markdown"
+	ToolResultFormatPDF      = "pdf"
+)
+
+// ToolResult is one generated output of an AI tool
+type ToolResult struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	TelegramID int64  `gorm:"index" json:"telegram_id"`
+	Tool       string `gorm:"size:32;index" json:"tool"`         // Feature name, e.g. business_builder
+	GroupID    uint   `gorm:"index" json:"group_id"`             // ID of the first version
+	Version    int    `gorm:"default:1" json:"version"`          // 1 for the first generation, +1 per regeneration
+	Title      string `gorm:"size:120" json:"title"`             // Taken from the form, can be renamed
+	Input      string `gorm:"type:text" json:"-"`                // Form as JSON
+	Output     string `gorm:"type:mediumtext" json:"-"`          // Tool output as JSON
+	Fallback   bool   `gorm:"default:false" json:"fallback"`     // Output was built from the form, the AI answer was unusable
+	Provider   string `gorm:"size:32" json:"provider,omitempty"` // LLM provider that served the output
+	Model      string `gorm:"size:100" json:"model,omitempty"`
+	// Version of the tool's prompt template, 0 for the built-in copy
+	PromptVersion int       `json:"prompt_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ToolResultDetail is a saved result with its form and output
+type ToolResultDetail struct {
+	ToolResult
+	Input  json.RawMessage `json:"input"`
+	Output json.RawMessage `json:"output"`
+}
+
+// detail returns the result with its stored JSON inlined
+func (r *ToolResult) detail() ToolResultDetail {
+	return ToolResultDetail{ToolResult: *r, Input: json.RawMessage(r.Input), Output: json.RawMessage(r.Output)}
+}
+
+// saveToolResult stores a generated output. With a previous version the result joins its
+// group as the next version and keeps its title. Failures are logged: the user still gets
+// the output, only the history misses it.
+func saveToolResult(user *User, tool, title string, input interface{}, run *toolRun, previous *ToolResult) *ToolResult {
+	if db == nil || user == nil {
+		return nil
+	}
+	inputJSON, err := json.Marshal(input)
+	if err == nil {
+		var outputJSON []byte
+		if outputJSON, err = json.Marshal(run.Output); err == nil {
+			result := &ToolResult{
+				TelegramID:    user.TelegramID,
+				Tool:          tool,
+				Version:       1,
+				Title:         chatThreadTitle(title), // Same rules as chat thread titles
+				Input:         string(inputJSON),
+				Output:        string(outputJSON),
+				Fallback:      run.Fallback,
+				Provider:      run.Provider,
+				Model:         run.Model,
+				PromptVersion: run.PromptVersion,
+			}
+			err = db.Transaction(func(tx *gorm.DB) error {
+				if previous != nil {
+					var latest int
+					if err := tx.Model(&ToolResult{}).Where("group_id = ?", previous.GroupID).
+						Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+						return err
+					}
+					result.GroupID = previous.GroupID
+					result.Version = latest + 1
+					result.Title = previous.Title
+					return tx.Create(result).Error
+				}
+				if err := tx.Create(result).Error; err != nil {
+					return err
+				}
+				result.GroupID = result.ID
+				return tx.Model(result).Update("group_id", result.ID).Error
+			})
+			if err == nil {
+				return result
+			}
+		}
+	}
+
+	logger.Error("Failed to save tool result",
+		zap.Int64("user_id", user.TelegramID),
+		zap.String("tool", tool),
+		zap.Error(err))
+	return nil
+}
+
+// withToolResult adds the saved result's id and version to a tool output sent to the mini app
+func withToolResult(output interface{}, result *ToolResult) interface{} {
+	if result == nil {
+		return output
+	}
+	var fields map[string]interface{}
+	data, err := json.Marshal(output)
+	if err != nil || json.Unmarshal(data, &fields) != nil {
+		return output
+	}
+	fields["resultId"] = result.ID
+	fields["version"] = result.Version
+	return fields
+}
+
+// ToolOutputChange is one top-level field of two compared outputs
+type ToolOutputChange struct {
+	Field   string          `json:"field"`
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+	Changed bool            `json:"changed"`
+}
+
+// compareToolOutputs lists the top-level fields of two outputs, sorted by name
+func compareToolOutputs(before, after string) ([]ToolOutputChange, error) {
+	var a, b map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(before), &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(after), &b); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(a)+len(b))
+	for field := range a {
+		fields = append(fields, field)
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]ToolOutputChange, 0, len(fields))
+	for _, field := range fields {
+		changes = append(changes, ToolOutputChange{
+			Field:   field,
+			Before:  a[field],
+			After:   b[field],
+			Changed: !jsonEqual(a[field], b[field]),
+		})
+	}
+	return changes, nil
+}
+
+// jsonEqual compares two JSON values ignoring formatting
+func jsonEqual(a, b json.RawMessage) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	normalizedA, _ := json.Marshal(x)
+	normalizedB, _ := json.Marshal(y)
+	return bytes.Equal(normalizedA, normalizedB)
+}
+
+// ==========================================
+// Markdown and PDF
+// ==========================================
+
+// toolOutputMarkdown renders an output following its schema: text properties become
+// sections, lists become bullets and lists of objects one bullet per object.
+func toolOutputMarkdown(schema *JSONSchema, output []byte) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(output, &fields); err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, property := range schema.Properties {
+		heading := property.Schema.Title
+		if heading == "" {
+			heading = property.Name
+		}
+		raw, ok := fields[property.Name]
+		if !ok {
+			continue
+		}
+		switch property.Schema.Type {
+		case "string":
+			var text string
+			if json.Unmarshal(raw, &text) == nil && strings.TrimSpace(text) != "" {
+				fmt.Fprintf(&out, "## %s\n\n%s\n\n", heading, text)
+			}
+		case "array":
+			var items []string
+			if property.Schema.Items != nil && property.Schema.Items.Type == "object" {
+				var objects []map[string]interface{}
+				json.Unmarshal(raw, &objects)
+				for _, object := range objects {
+					items = append(items, markdownObject(property.Schema.Items, object))
+				}
+			} else {
+				json.Unmarshal(raw, &items)
+			}
+			if len(items) == 0 {
+				continue
+			}
+			fmt.Fprintf(&out, "## %s\n\n", heading)
+			for _, item := range items {
+				fmt.Fprintf(&out, "- %s\n", item)
+			}
+			out.WriteString("\n")
+		}
+	}
+	return out.String(), nil
+}
+
+// markdownObject renders an object on one line: "**first**: second - third"
+func markdownObject(schema *JSONSchema, object map[string]interface{}) string {
+	var values []string
+	for _, property := range schema.Properties {
+		if value := fmt.Sprint(object[property.Name]); object[property.Name] != nil && value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) <= 1 {
+		return strings.Join(values, "")
+	}
+	return fmt.Sprintf("**%s**: %s", values[0], strings.Join(values[1:], " - "))
+}
+
+// toolResultMarkdown renders a saved result as a Markdown document
+func toolResultMarkdown(result *ToolResult) (string, error) {
+	tool := toolByFeature(result.Tool)
+	if tool == nil {
+		return "", fmt.Errorf("unknown tool %q", result.Tool)
+	}
+	body, err := toolOutputMarkdown(tool.Output, []byte(result.Output))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("# %s\n\n%s · نسخه %d · %s\n\n---\n\n%s",
+		result.Title, tool.Title, result.Version, result.CreatedAt.Format("2006-01-02 15:04"), body), nil
+}
+
+var markdownBoldPattern = regexp.MustCompile(`\*\*(.+?)\*\*`)
+
+// markdownToHTML converts the Markdown written by toolResultMarkdown into a right-to-left HTML page
+func markdownToHTML(title, markdown string) string {
+	inline := func(text string) string {
+		return markdownBoldPattern.ReplaceAllString(html.EscapeString(text), "<strong>$1</strong>")
+	}
+
+	var body strings.Builder
+	inList := false
+	for _, line := range strings.Split(markdown, "\n") {
+		line = strings.TrimSpace(line)
+		if inList && !strings.HasPrefix(line, "- ") {
+			body.WriteString("</ul>\n")
+			inList = false
+		}
+		switch {
+		case line == "":
+		case line == "---":
+			body.WriteString("<hr>\n")
+		case strings.HasPrefix(line, "## "):
+			fmt.Fprintf(&body, "<h2>%s</h2>\n", inline(line[3:]))
+		case strings.HasPrefix(line, "# "):
+			fmt.Fprintf(&body, "<h1>%s</h1>\n", inline(line[2:]))
+		case strings.HasPrefix(line, "- "):
+			if !inList {
+				body.WriteString("<ul>\n")
+				inList = true
+			}
+			fmt.Fprintf(&body, "<li>%s</li>\n", inline(line[2:]))
+		case len(line) > 2 && strings.HasPrefix(line, "_") && strings.HasSuffix(line, "_"):
+			fmt.Fprintf(&body, "<p><em>%s</em></p>\n", inline(line[1:len(line)-1]))
+		default:
+			fmt.Fprintf(&body, "<p>%s</p>\n", inline(line))
+		}
+	}
+	if inList {
+		body.WriteString("</ul>\n")
+	}
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="fa" dir="rtl">
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: Vazirmatn, Tahoma, sans-serif; line-height: 1.9; margin: 40px; color: #1f2937; }
+h1 { color: #111827; margin-bottom: 4px; }
+h2 { color: #2563eb; margin-top: 28px; }
+hr { border: none; border-top: 1px solid #e5e7eb; }
+</style>
+</head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(title), body.String())
+}
+
+// errPDFRendererNotConfigured means PDF_RENDERER_URL is unset
+var errPDFRendererNotConfigured = errors.New("PDF renderer is not configured")
+
+// renderPDF converts an HTML page to PDF with a Gotenberg-compatible service at
+// PDF_RENDERER_URL. A browser engine is needed to shape Persian text correctly.
+func renderPDF(ctx context.Context, page string) ([]byte, error) {
+	baseURL := strings.TrimRight(os.Getenv("PDF_RENDERER_URL"), "/")
+	if baseURL == "" {
+		return nil, errPDFRendererNotConfigured
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(page))
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/forms/chromium/convert/html", &form)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("pdf renderer: status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 20<<20))
+}
+
+// exportToolResult renders a result as a file in the given format
+func exportToolResult(ctx context.Context, result *ToolResult, format string) (name, contentType string, data []byte, err error) {
+	markdown, err := toolResultMarkdown(result)
+	if err != nil {
+		return "", "", nil, err
+	}
+	base := fmt.Sprintf("%s-%d-v%d", strings.ReplaceAll(result.Tool, "_", "-"), result.GroupID, result.Version)
+	if format == ToolResultFormatPDF {
+		pdf, err := renderPDF(ctx, markdownToHTML(result.Title, markdown))
+		if err != nil {
+			return "", "", nil, err
+		}
+		return base + ".pdf", "application/pdf", pdf, nil
+	}
+	return base + ".md", "text/markdown; charset=utf-8", []byte(markdown), nil
+}
+
+// ==========================================
+// Mini App API
+// ==========================================
+
+// ToolResultPage is a page of saved results, newest first; NextCursor is empty on the last page
+type ToolResultPage struct {
+	Results    []ToolResult `json:"results"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// ownedToolResultFromRequest loads :result_id of the account owner
+func ownedToolResultFromRequest(c *gin.Context) (*ToolResult, bool) {
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return nil, false
+	}
+	resultID, err := strconv.ParseUint(c.Param("result_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid result_id",
+		})
+		return nil, false
+	}
+	return loadOwnedToolResult(c, telegramID, uint(resultID))
+}
+
+// loadOwnedToolResult loads a result of telegramID and answers 404 when there is none
+func loadOwnedToolResult(c *gin.Context, telegramID int64, resultID uint) (*ToolResult, bool) {
+	var result ToolResult
+	if err := db.Where("id = ? AND telegram_id = ?", resultID, telegramID).First(&result).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "Result not found",
+			})
+			return nil, false
+		}
+		logger.Error("Failed to load tool result", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return nil, false
+	}
+	return &result, true
+}
+
+// listToolResultsAPI handles GET /api/v1/user/:telegram_id/tool-results?tool=&cursor=&limit=
+// Only the latest version of each result is listed; older ones are under /versions.
+func listToolResultsAPI(c *gin.Context) {
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	latest := db.Model(&ToolResult{}).Select("MAX(id)").Where("telegram_id = ?", telegramID).Group("group_id")
+	query := db.Where("telegram_id = ? AND id IN (?)", telegramID, latest)
+	if tool := c.Query("tool"); tool != "" {
+		if toolByFeature(tool) == nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Error:   "Unknown tool",
+			})
+			return
+		}
+		query = query.Where("tool = ?", tool)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		var beforeID uint
+		if err := decodeCursor(cursor, &beforeID); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Error:   "Invalid cursor",
+			})
+			return
+		}
+		query = query.Where("id < ?", beforeID)
+	}
+
+	limit := pageSize(c)
+	var results []ToolResult
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&results).Error; err != nil {
+		logger.Error("Failed to list tool results", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	page := ToolResultPage{Results: results}
+	if len(results) > limit {
+		page.Results = results[:limit]
+		page.NextCursor = encodeCursor(page.Results[limit-1].ID)
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// getToolResultAPI handles GET /api/v1/user/:telegram_id/tool-results/:result_id
+func getToolResultAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result.detail(),
+	})
+}
+
+// listToolResultVersionsAPI handles GET /api/v1/user/:telegram_id/tool-results/:result_id/versions
+func listToolResultVersionsAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var versions []ToolResult
+	if err := db.Where("group_id = ? AND telegram_id = ?", result.GroupID, result.TelegramID).
+		Order("version DESC").Find(&versions).Error; err != nil {
+		logger.Error("Failed to list tool result versions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    versions,
+	})
+}
+
+// renameToolResultAPI handles PUT /api/v1/user/:telegram_id/tool-results/:result_id
+// The title applies to every version of the result.
+func renameToolResultAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title string `json:"title"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid request data",
+		})
+		return
+	}
+	title := chatThreadTitle(req.Title)
+	if title == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Title cannot be empty",
+		})
+		return
+	}
+
+	if err := db.Model(&ToolResult{}).Where("group_id = ? AND telegram_id = ?", result.GroupID, result.TelegramID).
+		Update("title", title).Error; err != nil {
+		logger.Error("Failed to rename tool result", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+	result.Title = title
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// regenerateToolResultAPI handles POST /api/v1/user/:telegram_id/tool-results/:result_id/regenerate
+// The tool runs again on the stored form and the output is saved as the next version.
+func regenerateToolResultAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+	tool := toolByFeature(result.Tool)
+	if tool == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Unknown tool",
+		})
+		return
+	}
+
+	// 📢 Check channel membership
+	if errMsg := checkChannelMembershipAPI(result.TelegramID); errMsg != "" {
+		c.JSON(http.StatusForbidden, APIResponse{
+			Success: false,
+			Error:   errMsg,
+		})
+		return
+	}
+
+	// The stored form is validated again: the tool's fields may have changed since
+	var raw map[string]interface{}
+	err := json.Unmarshal([]byte(result.Input), &raw)
+	var vars map[string]string
+	var errs []string
+	if err == nil {
+		_, vars, errs = tool.parseInput(raw)
+	}
+	if err != nil || len(errs) > 0 {
+		logger.Error("Stored tool form is unusable",
+			zap.Uint("result_id", result.ID),
+			zap.Strings("errors", errs),
+			zap.Error(err))
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Success: false,
+			Error:   "فرم این نتیجه قابل استفاده نیست",
+		})
+		return
+	}
+
+	user, ok := toolUser(c, tool, result.TelegramID)
+	if !ok {
+		return
+	}
+	if rejectIfModerated(c, user, tool.Feature, tool.inputText(vars)) {
+		return
+	}
+
+	run, err := tool.run(user, vars, true)
+	if err != nil {
+		logger.Error("AI tool failed",
+			zap.Int64("telegram_id", result.TelegramID),
+			zap.String("tool", tool.Name),
+			zap.Error(err))
+		c.JSON(http.StatusBadGateway, APIResponse{
+			Success: false,
+			Error:   "در حال حاضر امکان پاسخگویی وجود ندارد، لطفا دوباره تلاش کنید",
+		})
+		return
+	}
+
+	var input json.RawMessage = []byte(result.Input)
+	next := saveToolResult(user, result.Tool, result.Title, input, run, result)
+	if next == nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	logger.Info("Tool result regenerated",
+		zap.Int64("telegram_id", result.TelegramID),
+		zap.String("tool", result.Tool),
+		zap.Uint("group_id", next.GroupID),
+		zap.Int("version", next.Version))
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Data:    next.detail(),
+	})
+}
+
+// compareToolResultsAPI handles GET /api/v1/user/:telegram_id/tool-results/:result_id/compare?with=
+func compareToolResultsAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+	otherID, err := strconv.ParseUint(c.Query("with"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid with",
+		})
+		return
+	}
+	other, ok := loadOwnedToolResult(c, result.TelegramID, uint(otherID))
+	if !ok {
+		return
+	}
+	if other.Tool != result.Tool {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Results of different tools cannot be compared",
+		})
+		return
+	}
+
+	// Older version first
+	before, after := other, result
+	if before.ID > after.ID {
+		before, after = after, before
+	}
+	changes, err := compareToolOutputs(before.Output, after.Output)
+	if err != nil {
+		logger.Error("Failed to compare tool results", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data: gin.H{
+			"before":  before.detail(),
+			"after":   after.detail(),
+			"changes": changes,
+		},
+	})
+}
+
+// deleteToolResultAPI handles DELETE /api/v1/user/:telegram_id/tool-results/:result_id?all_versions=true
+func deleteToolResultAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+
+	query := db.Where("id = ?", result.ID)
+	if c.Query("all_versions") == "true" {
+		query = db.Where("group_id = ? AND telegram_id = ?", result.GroupID, result.TelegramID)
+	}
+	deleted := query.Delete(&ToolResult{})
+	if deleted.Error != nil {
+		logger.Error("Failed to delete tool result", zap.Error(deleted.Error))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    gin.H{"deleted": deleted.RowsAffected},
+	})
+}
+
+// toolResultFormat reads the export format, Markdown by default
+func toolResultFormat(c *gin.Context, format string) (string, bool) {
+	switch format {
+	case "", "md", ToolResultFormatMarkdown:
+		return ToolResultFormatMarkdown, true
+	case ToolResultFormatPDF:
+		return ToolResultFormatPDF, true
+	}
+	c.JSON(http.StatusBadRequest, APIResponse{
+		Success: false,
+		Error:   "Format must be markdown or pdf",
+	})
+	return "", false
+}
+
+// respondExportError answers a failed export
+func respondExportError(c *gin.Context, result *ToolResult, err error) {
+	if err == errPDFRendererNotConfigured {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Error:   "خروجی PDF در حال حاضر در دسترس نیست، لطفا Markdown را انتخاب کنید",
+		})
+		return
+	}
+	logger.Error("Failed to export tool result",
+		zap.Uint("result_id", result.ID),
+		zap.Error(err))
+	c.JSON(http.StatusInternalServerError, APIResponse{
+		Success: false,
+		Error:   "Internal server error",
+	})
+}
+
+// exportToolResultAPI handles GET /api/v1/user/:telegram_id/tool-results/:result_id/export?format=markdown|pdf
+func exportToolResultAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+	format, ok := toolResultFormat(c, c.Query("format"))
+	if !ok {
+		return
+	}
+
+	name, contentType, data, err := exportToolResult(c.Request.Context(), result, format)
+	if err != nil {
+		respondExportError(c, result, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// sendToolResultAPI handles POST /api/v1/user/:telegram_id/tool-results/:result_id/send
+// The result is sent to the user's Telegram chat as a file. Body: {"format": "markdown"|"pdf"}
+func sendToolResultAPI(c *gin.Context) {
+	result, ok := ownedToolResultFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Format string `json:"format"`
+	}
+	// The body is optional, Markdown is sent by default
+	_ = c.ShouldBindJSON(&req)
+	format, ok := toolResultFormat(c, req.Format)
+	if !ok {
+		return
+	}
+
+	if bot == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Error:   "Bot is not available",
+		})
+		return
+	}
+
+	name, _, data, err := exportToolResult(c.Request.Context(), result, format)
+	if err != nil {
+		respondExportError(c, result, err)
+		return
+	}
+
+	doc := tgbotapi.NewDocument(result.TelegramID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = fmt.Sprintf("📄 %s\n%s · نسخه %d", result.Title, toolByFeature(result.Tool).Title, result.Version)
+	if _, err := bot.Send(doc); err != nil {
+		logger.Error("Failed to send tool result to Telegram",
+			zap.Int64("telegram_id", result.TelegramID),
+			zap.Uint("result_id", result.ID),
+			zap.Error(err))
+		c.JSON(http.StatusBadGateway, APIResponse{
+			Success: false,
+			Error:   "ارسال به تلگرام انجام نشد، لطفا دوباره تلاش کنید",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    gin.H{"sent": name},
+	})
+}
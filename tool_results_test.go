@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestToolResultExportAndCompare covers the Markdown and HTML export of a saved business plan
+// and the field comparison of two versions.
+func TestToolResultExportAndCompare(t *testing.T) {
+	first := BusinessBuilderResponse{
+		BusinessName:   "آکادمی <AI>",
+		Tagline:        "یادگیری سریع",
+		Description:    "دوره‌های کوتاه هوش مصنوعی",
+		TargetAudience: "فریلنسرها",
+		Products:       []string{"دوره آنلاین", "کارگاه"},
+		Monetization:   []string{"عضویت ماهیانه"},
+		FirstAction:    "ساخت صفحه فرود",
+	}
+	second := first
+	second.Tagline = "یادگیری عملی"
+	second.Products = []string{"دوره آنلاین", "مشاوره"}
+
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	result := &ToolResult{
+		ID:        7,
+		GroupID:   5,
+		Tool:      FeatureBusinessBuilder,
+		Version:   2,
+		Title:     first.BusinessName,
+		Output:    encode(first),
+		CreatedAt: time.Date(2025, 3, 1, 10, 30, 0, 0, time.UTC),
+	}
+
+	markdown, err := toolResultMarkdown(result)
+	if err != nil {
+		t.Fatalf("markdown: %v", err)
+	}
+	for _, want := range []string{"# آکادمی <AI>", "نسخه 2 · 2025-03-01 10:30", "## شعار\n\nیادگیری سریع", "## محصولات و خدمات\n\n- دوره آنلاین\n- کارگاه", "## اولین قدم"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, markdown)
+		}
+	}
+
+	page := markdownToHTML(result.Title, markdown)
+	if strings.Contains(page, "<AI>") || !strings.Contains(page, "&lt;AI&gt;") {
+		t.Error("user text must be escaped in the HTML export")
+	}
+	if !strings.Contains(page, `dir="rtl"`) || !strings.Contains(page, "<ul>\n<li>دوره آنلاین</li>\n<li>کارگاه</li>\n</ul>") {
+		t.Errorf("unexpected HTML export:\n%s", page)
+	}
+
+	changes, err := compareToolOutputs(encode(first), encode(second))
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	changed := map[string]bool{}
+	for _, change := range changes {
+		changed[change.Field] = change.Changed
+	}
+	if len(changes) != 7 || !changed["tagline"] || !changed["products"] || changed["businessName"] || changed["monetization"] {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	data, _ := json.Marshal(withToolResult(&first, result))
+	if !strings.Contains(string(data), `"resultId":7`) || !strings.Contains(string(data), `"businessName":"آکادمی \u003cAI\u003e"`) {
+		t.Errorf("tool output should carry the result id, got %s", data)
+	}
+}
+
+// TestToolRequestRequiresAccountOwner asserts a tool request for another user's telegram_id is
+// refused and saves nothing into that user's history.
+func TestToolRequestRequiresAccountOwner(t *testing.T) {
+	useTestDB(t, &User{}, &ToolResult{}, &AIUsage{})
+	mustCreate(t, &User{TelegramID: 2002, Username: "victim", IsActive: true})
+
+	r := sessionRouter(1001)
+	r.POST("/api/v1/business-builder", toolHandler("business-builder"))
+	r.POST("/api/v1/tools/:name", handleToolRequestAPI)
+
+	body := `{"telegram_id": 2002, "user_name": "Ali", "interests": "طراحی", "market": "فریلنسرها"}`
+	for _, path := range []string{"/api/v1/business-builder", "/api/v1/tools/business-builder"} {
+		if w := serveJSON(r, http.MethodPost, path, body); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403 for another user's telegram_id, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	var saved int64
+	db.Model(&ToolResult{}).Where("telegram_id = ?", 2002).Count(&saved)
+	if saved != 0 {
+		t.Errorf("forged requests saved %d results into the victim's history", saved)
+	}
+}
@@ -0,0 +1,680 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"MonetizeeAI_bot/fieldcrypt"
+	"MonetizeeAI_bot/logger"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Who started an erasure
+const (
+	ErasureViaBot     = "bot"
+	ErasureViaMiniApp = "miniapp"
+	ErasureViaAdmin   = "admin"
+)
+
+// DataErasure is the audit record of an account erasure.
+// It keeps no personal data: the user is identified only by a blind index of the Telegram ID.
+type DataErasure struct {
+	gorm.Model
+	UserID          uint   `gorm:"index" json:"user_id"`                  // Anonymized users row, still referenced by payments
+	TelegramIDHash  string `gorm:"size:64;index" json:"telegram_id_hash"` // Blind index, lets support answer "was this account erased?"
+	RequestedVia    string `gorm:"type:varchar(20)" json:"requested_via"` // bot, miniapp, admin
+	RequestedBy     *uint  `json:"requested_by"`                          // Admin ID for admin erasures
+	DeletedMessages int64  `json:"deleted_messages"`                      // Chat messages
+	DeletedTickets  int64  `json:"deleted_tickets"`                       // Tickets (with their messages)
+	DeletedOther    int64  `json:"deleted_other"`                         // Exercises, quiz evaluations, progress, license verifications
+	KeptPayments    int64  `json:"kept_payments"`                         // Anonymized financial records
+}
+
+// ==========================================
+// Export
+// ==========================================
+
+type exportProfile struct {
+	TelegramID         int64      `json:"telegram_id"`
+	Username           string     `json:"username"`
+	FirstName          string     `json:"first_name"`
+	LastName           string     `json:"last_name"`
+	Phone              string     `json:"phone"`
+	Email              string     `json:"email"`
+	MonthlyIncome      int64      `json:"monthly_income"`
+	Points             int        `json:"points"`
+	CurrentSession     int        `json:"current_session"`
+	IsVerified         bool       `json:"is_verified"`
+	SubscriptionType   string     `json:"subscription_type"`
+	PlanName           string     `json:"plan_name"`
+	SubscriptionExpiry *time.Time `json:"subscription_expiry"`
+	ChatMessagesUsed   int        `json:"chat_messages_used"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+type exportExercise struct {
+	SessionID   uint      `json:"session_id"`
+	Attempt     int       `json:"attempt"`
+	Content     string    `json:"content"`
+	Status      string    `json:"status"`
+	Score       int       `json:"score"`
+	AIFeedback  string    `json:"ai_feedback"`
+	Feedback    string    `json:"feedback"`
+	FileName    string    `json:"file_name,omitempty"`
+	FileKind    string    `json:"file_kind,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+type exportPayment struct {
+	ID          uint      `json:"id"`
+	Type        string    `json:"type"`
+	Amount      int       `json:"amount"`
+	Status      string    `json:"status"`
+	RefID       string    `json:"ref_id"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type exportLicenseVerification struct {
+	License   string    `json:"license"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportBan struct {
+	Scope     string     `json:"scope"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	LiftedAt  *time.Time `json:"lifted_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserDataExport is everything stored about one Telegram user
+type UserDataExport struct {
+	ExportedAt           time.Time                   `json:"exported_at"`
+	Profile              exportProfile               `json:"profile"`
+	CompletedSessions    []uint                      `json:"completed_sessions"`
+	Exercises            []exportExercise            `json:"exercises"`
+	QuizEvaluations      []QuizEvaluation            `json:"quiz_evaluations"`
+	ChatMessages         []ChatMessage               `json:"chat_messages"`
+	ChatThreads          []ChatThread                `json:"chat_threads"`
+	ToolResults          []ToolResultDetail          `json:"tool_results"`
+	AIRatings            []AIRating                  `json:"ai_ratings"`
+	Tickets              []Ticket                    `json:"tickets"`
+	Payments             []exportPayment             `json:"payments"`
+	LicenseVerifications []exportLicenseVerification `json:"license_verifications"`
+	Bans                 []exportBan                 `json:"bans"`
+}
+
+// buildUserDataExport collects all records tied to a Telegram ID
+func buildUserDataExport(telegramID int64) (*UserDataExport, error) {
+	var user User
+	if err := db.Where("telegram_id = ?", telegramID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	export := &UserDataExport{
+		ExportedAt: time.Now(),
+		Profile: exportProfile{
+			TelegramID:         user.TelegramID,
+			Username:           user.Username,
+			FirstName:          user.FirstName,
+			LastName:           user.LastName,
+			Phone:              user.Phone,
+			Email:              user.Email,
+			MonthlyIncome:      user.MonthlyIncome,
+			Points:             user.Points,
+			CurrentSession:     user.CurrentSession,
+			IsVerified:         user.IsVerified,
+			SubscriptionType:   user.SubscriptionType,
+			PlanName:           user.PlanName,
+			SubscriptionExpiry: user.SubscriptionExpiry,
+			ChatMessagesUsed:   user.ChatMessagesUsed,
+			CreatedAt:          user.CreatedAt,
+		},
+	}
+	if export.Profile.Phone == "" {
+		export.Profile.Phone = user.PhoneNumber
+	}
+
+	if err := db.Model(&UserSession{}).Where("user_id = ?", user.ID).
+		Pluck("session_id", &export.CompletedSessions).Error; err != nil {
+		return nil, fmt.Errorf("sessions: %w", err)
+	}
+
+	var exercises []ExerciseSubmission
+	if err := db.Where("user_id = ? OR telegram_id = ?", user.ID, telegramID).Order("submitted_at").Find(&exercises).Error; err != nil {
+		return nil, fmt.Errorf("exercises: %w", err)
+	}
+	for _, exercise := range exercises {
+		export.Exercises = append(export.Exercises, exportExercise{
+			SessionID:   exercise.SessionID,
+			Attempt:     exercise.Attempt,
+			Content:     exercise.Content,
+			Status:      exercise.Status,
+			Score:       exercise.Score,
+			AIFeedback:  exercise.AIFeedback,
+			Feedback:    exercise.Feedback,
+			FileName:    exercise.FileName,
+			FileKind:    exercise.FileKind,
+			SubmittedAt: exercise.SubmittedAt,
+		})
+	}
+
+	if err := db.Where("telegram_id = ?", telegramID).Order("created_at").
+		Find(&export.QuizEvaluations).Error; err != nil {
+		return nil, fmt.Errorf("quiz evaluations: %w", err)
+	}
+
+	if err := db.Where("telegram_id = ?", telegramID).Order("created_at").
+		Find(&export.ChatMessages).Error; err != nil {
+		return nil, fmt.Errorf("chat messages: %w", err)
+	}
+	if err := db.Where("telegram_id = ?", telegramID).Order("created_at").
+		Find(&export.ChatThreads).Error; err != nil {
+		return nil, fmt.Errorf("chat threads: %w", err)
+	}
+
+	var toolResults []ToolResult
+	if err := db.Where("telegram_id = ?", telegramID).Order("created_at").Find(&toolResults).Error; err != nil {
+		return nil, fmt.Errorf("tool results: %w", err)
+	}
+	for i := range toolResults {
+		export.ToolResults = append(export.ToolResults, toolResults[i].detail())
+	}
+
+	if err := db.Where("telegram_id = ?", telegramID).Order("created_at").
+		Find(&export.AIRatings).Error; err != nil {
+		return nil, fmt.Errorf("ai ratings: %w", err)
+	}
+
+	if err := db.Preload("Messages", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("created_at")
+	}).Where("telegram_id = ?", telegramID).Order("created_at").Find(&export.Tickets).Error; err != nil {
+		return nil, fmt.Errorf("tickets: %w", err)
+	}
+
+	var payments []PaymentTransaction
+	if err := db.Where("user_id = ?", user.ID).Order("created_at").Find(&payments).Error; err != nil {
+		return nil, fmt.Errorf("payments: %w", err)
+	}
+	for _, payment := range payments {
+		export.Payments = append(export.Payments, exportPayment{
+			ID:          payment.ID,
+			Type:        payment.Type,
+			Amount:      payment.Amount,
+			Status:      payment.Status,
+			RefID:       payment.RefID,
+			Description: payment.Description,
+			CreatedAt:   payment.CreatedAt,
+		})
+	}
+
+	var verifications []LicenseVerification
+	if err := db.Where("user_id = ?", user.ID).Order("created_at").Find(&verifications).Error; err != nil {
+		return nil, fmt.Errorf("license verifications: %w", err)
+	}
+	for _, verification := range verifications {
+		export.LicenseVerifications = append(export.LicenseVerifications, exportLicenseVerification{
+			License:   verification.License,
+			Status:    verification.Status,
+			CreatedAt: verification.CreatedAt,
+		})
+	}
+
+	var bans []Ban
+	if err := db.Where("telegram_id = ?", telegramID).Order("created_at").Find(&bans).Error; err != nil {
+		return nil, fmt.Errorf("bans: %w", err)
+	}
+	for _, ban := range bans {
+		export.Bans = append(export.Bans, exportBan{
+			Scope:     ban.Scope,
+			Reason:    ban.Reason,
+			ExpiresAt: ban.ExpiresAt,
+			LiftedAt:  ban.LiftedAt,
+			CreatedAt: ban.CreatedAt,
+		})
+	}
+
+	return export, nil
+}
+
+// userDataZip packs the export as one JSON file per section
+func userDataZip(export *UserDataExport) ([]byte, error) {
+	sections := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"completed_sessions.json", export.CompletedSessions},
+		{"exercises.json", export.Exercises},
+		{"quiz_evaluations.json", export.QuizEvaluations},
+		{"chat_messages.json", export.ChatMessages},
+		{"chat_threads.json", export.ChatThreads},
+		{"tool_results.json", export.ToolResults},
+		{"ai_ratings.json", export.AIRatings},
+		{"tickets.json", export.Tickets},
+		{"payments.json", export.Payments},
+		{"license_verifications.json", export.LicenseVerifications},
+		{"bans.json", export.Bans},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, section := range sections {
+		data, err := json.MarshalIndent(section.data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     section.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ==========================================
+// Erasure
+// ==========================================
+
+// eraseUserData hard-deletes personal records and anonymizes the rest.
+// Payments are financial records: they are kept and stay linked to the anonymized users row.
+// Bans and security events are kept (by Telegram ID) so an erasure cannot be used to escape a
+// ban; the event details, which may quote the user's messages, are blanked.
+func eraseUserData(telegramID int64, requestedVia string, requestedBy *uint) (*DataErasure, error) {
+	var user User
+	if err := db.Where("telegram_id = ?", telegramID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	erasure := &DataErasure{
+		UserID:         user.ID,
+		TelegramIDHash: fieldcrypt.BlindIndex("telegram_id", strconv.FormatInt(telegramID, 10)),
+		RequestedVia:   requestedVia,
+		RequestedBy:    requestedBy,
+	}
+
+	// Submitted files are removed from the storage once their rows are gone
+	var fileKeys []string
+	db.Model(&ExerciseSubmission{}).Where("(user_id = ? OR telegram_id = ?) AND file_key <> ''", user.ID, telegramID).
+		Pluck("file_key", &fileKeys)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("telegram_id = ?", telegramID).Delete(&ChatMessage{})
+		if result.Error != nil {
+			return fmt.Errorf("chat messages: %w", result.Error)
+		}
+		erasure.DeletedMessages = result.RowsAffected
+
+		if err := tx.Where("telegram_id = ?", telegramID).Delete(&ChatThread{}).Error; err != nil {
+			return fmt.Errorf("chat threads: %w", err)
+		}
+
+		var ticketIDs []uint
+		if err := tx.Unscoped().Model(&Ticket{}).Where("telegram_id = ?", telegramID).Pluck("id", &ticketIDs).Error; err != nil {
+			return fmt.Errorf("tickets: %w", err)
+		}
+		if len(ticketIDs) > 0 {
+			if err := tx.Unscoped().Where("ticket_id IN ?", ticketIDs).Delete(&TicketMessage{}).Error; err != nil {
+				return fmt.Errorf("ticket messages: %w", err)
+			}
+			result = tx.Unscoped().Where("id IN ?", ticketIDs).Delete(&Ticket{})
+			if result.Error != nil {
+				return fmt.Errorf("tickets: %w", result.Error)
+			}
+			erasure.DeletedTickets = result.RowsAffected
+		}
+
+		result = tx.Unscoped().Where("user_id = ? OR telegram_id = ?", user.ID, telegramID).Delete(&ExerciseSubmission{})
+		if result.Error != nil {
+			return fmt.Errorf("exercises: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		result = tx.Where("telegram_id = ?", telegramID).Delete(&QuizEvaluation{})
+		if result.Error != nil {
+			return fmt.Errorf("quiz evaluations: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		result = tx.Where("telegram_id = ?", telegramID).Delete(&ExerciseReview{})
+		if result.Error != nil {
+			return fmt.Errorf("exercise reviews: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		result = tx.Where("telegram_id = ?", telegramID).Delete(&ToolResult{})
+		if result.Error != nil {
+			return fmt.Errorf("tool results: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		result = tx.Where("telegram_id = ?", telegramID).Delete(&AIJob{})
+		if result.Error != nil {
+			return fmt.Errorf("ai jobs: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		result = tx.Where("telegram_id = ?", telegramID).Delete(&AIRating{})
+		if result.Error != nil {
+			return fmt.Errorf("ai ratings: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		result = tx.Unscoped().Where("user_id = ?", user.ID).Delete(&LicenseVerification{})
+		if result.Error != nil {
+			return fmt.Errorf("license verifications: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		result = tx.Where("user_id = ?", user.ID).Delete(&UserSession{})
+		if result.Error != nil {
+			return fmt.Errorf("sessions: %w", result.Error)
+		}
+		erasure.DeletedOther += result.RowsAffected
+
+		// Security events are kept with the bans, but their details quote the user's own messages
+		if err := tx.Model(&SecurityEvent{}).Unscoped().Where("telegram_id = ?", telegramID).Updates(map[string]interface{}{
+			"details":         "",
+			"resolution_note": "",
+		}).Error; err != nil {
+			return fmt.Errorf("security events: %w", err)
+		}
+
+		if err := tx.Model(&PaymentTransaction{}).Where("user_id = ?", user.ID).Count(&erasure.KeptPayments).Error; err != nil {
+			return fmt.Errorf("payments: %w", err)
+		}
+
+		// AI usage is kept for cost reporting under the anonymized ID
+		if err := tx.Model(&AIUsage{}).Where("telegram_id = ?", telegramID).
+			Update("telegram_id", -int64(user.ID)).Error; err != nil {
+			return fmt.Errorf("ai usage: %w", err)
+		}
+
+		// Anonymize the users row. The Telegram ID is replaced so the person can register again
+		// and the row can no longer be linked back to them.
+		if err := tx.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"telegram_id":  -int64(user.ID),
+			"username":     "",
+			"first_name":   "کاربر حذف شده",
+			"last_name":    "",
+			"email":        "",
+			"email_hash":   "",
+			"phone":        "",
+			"phone_number": "",
+			"phone_hash":   "",
+			"license":      "",
+			"is_active":    false,
+		}).Error; err != nil {
+			return fmt.Errorf("user: %w", err)
+		}
+		if err := tx.Delete(&User{}, user.ID).Error; err != nil {
+			return fmt.Errorf("user: %w", err)
+		}
+
+		return tx.Create(erasure).Error
+	})
+	if err != nil {
+		logger.Error("User data erasure failed",
+			zap.Int64("user_id", telegramID),
+			zap.String("requested_via", requestedVia),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Forget in-memory state
+	userCache.InvalidateUser(telegramID)
+	for _, key := range fileKeys {
+		if err := getFileStorage().Delete(context.Background(), key); err != nil {
+			logger.Error("Failed to delete submission file", zap.String("key", key), zap.Error(err))
+		}
+	}
+
+	delete(userStates, telegramID)
+	delete(chatRateLimits, telegramID)
+	delete(chatMessageCounts, telegramID)
+	delete(suspiciousActivityCount, telegramID)
+
+	logger.Warn("User data erased",
+		zap.Uint("erasure_id", erasure.ID),
+		zap.String("requested_via", requestedVia),
+		zap.Int64("deleted_messages", erasure.DeletedMessages),
+		zap.Int64("deleted_tickets", erasure.DeletedTickets),
+		zap.Int64("kept_payments", erasure.KeptPayments))
+
+	return erasure, nil
+}
+
+// ==========================================
+// Bot
+// ==========================================
+
+// handleExportDataCommand sends the user a ZIP of their data
+func handleExportDataCommand(user *User) {
+	export, err := buildUserDataExport(user.TelegramID)
+	if err != nil {
+		logger.Error("Failed to build user data export", zap.Int64("user_id", user.TelegramID), zap.Error(err))
+		sendMessage(user.TelegramID, "❌ خطا در آماده‌سازی اطلاعات. لطفا بعدا دوباره تلاش کنید.")
+		return
+	}
+
+	archive, err := userDataZip(export)
+	if err != nil {
+		logger.Error("Failed to zip user data export", zap.Int64("user_id", user.TelegramID), zap.Error(err))
+		sendMessage(user.TelegramID, "❌ خطا در آماده‌سازی اطلاعات. لطفا بعدا دوباره تلاش کنید.")
+		return
+	}
+
+	doc := tgbotapi.NewDocument(user.TelegramID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("monetizeai-data-%s.zip", export.ExportedAt.Format("2006-01-02")),
+		Bytes: archive,
+	})
+	doc.Caption = "📦 نسخه‌ای از تمام اطلاعات شما در MonetizeAI"
+	if _, err := bot.Send(doc); err != nil {
+		logger.Error("Failed to send user data export", zap.Int64("user_id", user.TelegramID), zap.Error(err))
+		return
+	}
+
+	logger.Info("User data exported", zap.Int64("user_id", user.TelegramID), zap.String("via", ErasureViaBot))
+}
+
+// handleDeleteAccountCommand asks the user to confirm the erasure
+func handleDeleteAccountCommand(user *User) {
+	msg := tgbotapi.NewMessage(user.TelegramID,
+		"⚠️ *حذف حساب کاربری*\n\n"+
+			"با تایید، این اطلاعات برای همیشه حذف می‌شوند:\n"+
+			"• پروفایل، شماره موبایل و ایمیل\n"+
+			"• تاریخچه چت با هوش مصنوعی\n"+
+			"• تیکت‌های پشتیبانی\n"+
+			"• تمرین‌ها و پیشرفت دوره\n\n"+
+			"🧾 سوابق پرداخت به صورت ناشناس نگهداری می‌شوند.\n"+
+			"💡 قبل از حذف می‌توانید با /export\\_data یک نسخه از اطلاعات خود بگیرید.\n\n"+
+			"این عمل قابل بازگشت نیست.")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 حذف دائمی حساب", "erase_confirm"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ انصراف", "erase_cancel"),
+		),
+	)
+	bot.Send(msg)
+}
+
+// handleEraseCallback runs or cancels the erasure from the confirmation buttons
+func handleEraseCallback(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	if callback.Data == "erase_cancel" {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "لغو شد"))
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "✅ حذف حساب لغو شد."))
+		return
+	}
+
+	if _, err := eraseUserData(callback.From.ID, ErasureViaBot, nil); err != nil {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "❌ خطا"))
+		if err == gorm.ErrRecordNotFound {
+			bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "❌ حسابی برای حذف پیدا نشد."))
+			return
+		}
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "❌ خطا در حذف حساب. لطفا با پشتیبانی تماس بگیرید."))
+		return
+	}
+
+	bot.Send(tgbotapi.NewCallback(callback.ID, "✅ حذف شد"))
+	bot.Send(tgbotapi.NewEditMessageText(chatID, messageID,
+		"✅ حساب شما و اطلاعات مرتبط با آن حذف شد.\n\nبرای استفاده دوباره کافی است /start را بزنید."))
+}
+
+// ==========================================
+// Mini App
+// ==========================================
+
+// requireAccountOwner allows only the owner of telegramID: a web session for that user or
+// validated Telegram init data. The telegram_id path parameter alone is not trusted.
+func requireAccountOwner(c *gin.Context, telegramID int64) bool {
+	if c.GetBool("web_session") && c.GetInt64("telegram_id") == telegramID {
+		return true
+	}
+
+	if initData := getTelegramInitDataFromRequest(c); initData != "" {
+		if verifiedID, err := validateTelegramInitData(initData); err == nil && verifiedID == telegramID {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, APIResponse{
+		Success: false,
+		Error:   "Only the account owner can do this",
+	})
+	return false
+}
+
+// exportUserDataAPI returns the user's data as JSON (default) or a ZIP (?format=zip)
+func exportUserDataAPI(c *gin.Context) {
+	telegramID, err := strconv.ParseInt(c.Param("telegram_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid telegram_id",
+		})
+		return
+	}
+	if !requireAccountOwner(c, telegramID) {
+		return
+	}
+
+	export, err := buildUserDataExport(telegramID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "User not found",
+			})
+			return
+		}
+		logger.Error("Failed to build user data export", zap.Int64("telegram_id", telegramID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	logger.Info("User data exported", zap.Int64("telegram_id", telegramID), zap.String("via", ErasureViaMiniApp))
+
+	if c.Query("format") != "zip" {
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Data:    export,
+		})
+		return
+	}
+
+	archive, err := userDataZip(export)
+	if err != nil {
+		logger.Error("Failed to zip user data export", zap.Int64("telegram_id", telegramID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Internal server error",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="monetizeai-data-%s.zip"`, export.ExportedAt.Format("2006-01-02")))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// eraseUserDataAPI erases the account. The body must be {"confirm": "DELETE"}.
+func eraseUserDataAPI(c *gin.Context) {
+	telegramID, err := strconv.ParseInt(c.Param("telegram_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   "Invalid telegram_id",
+		})
+		return
+	}
+	if !requireAccountOwner(c, telegramID) {
+		return
+	}
+
+	var req struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Confirm != "DELETE" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Error:   `Send {"confirm": "DELETE"} to erase the account`,
+		})
+		return
+	}
+
+	erasure, err := eraseUserData(telegramID, ErasureViaMiniApp, nil)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "User not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Failed to erase account",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"deleted_messages": erasure.DeletedMessages,
+			"deleted_tickets":  erasure.DeletedTickets,
+			"deleted_other":    erasure.DeletedOther,
+			"kept_payments":    erasure.KeptPayments,
+		},
+	})
+}
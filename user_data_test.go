@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB points the global db at a fresh in-memory SQLite database with the given tables
+// for the duration of the test
+func useTestDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+
+	testDB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	// One connection, every new in-memory connection would be a new empty database
+	if sqlDB, err := testDB.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := testDB.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previous
+		if sqlDB, err := testDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// TestEraseUserData erases a user with records in every table and checks what is deleted,
+// what is anonymized and that another user's data is untouched.
+func TestEraseUserData(t *testing.T) {
+	useTestDB(t, &User{}, &ChatMessage{}, &ChatThread{}, &Ticket{}, &TicketMessage{}, &ExerciseSubmission{},
+		&QuizEvaluation{}, &ExerciseReview{}, &ToolResult{}, &AIJob{}, &AIRating{}, &LicenseVerification{},
+		&UserSession{}, &PaymentTransaction{}, &AIUsage{}, &SecurityEvent{}, &Ban{}, &DataErasure{})
+
+	const telegramID, otherID = int64(1001), int64(2002)
+	user := User{TelegramID: telegramID, Username: "erased", FirstName: "Ali", Phone: "09120000000", Email: "a@example.com"}
+	other := User{TelegramID: otherID, Username: "kept", FirstName: "Sara"}
+	for _, u := range []*User{&user, &other} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []int64{telegramID, otherID} {
+		thread := ChatThread{TelegramID: id, Title: "thread"}
+		mustCreate(t, &thread)
+		mustCreate(t, &ChatMessage{TelegramID: id, ThreadID: &thread.ID, Message: "my secret plan", Response: "answer"})
+		ticket := Ticket{TelegramID: id, Subject: "help"}
+		mustCreate(t, &ticket)
+		mustCreate(t, &TicketMessage{TicketID: ticket.ID, Message: "ticket text"})
+		mustCreate(t, &ToolResult{TelegramID: id, Tool: "business_builder", Title: "idea"})
+		mustCreate(t, &AIRating{TelegramID: id, Target: RatingTargetToolResult, TargetID: uint(id), Score: 1})
+		mustCreate(t, &AIUsage{TelegramID: id, Feature: FeatureChat})
+		mustCreate(t, &SecurityEvent{TelegramID: id, Rule: SecurityRuleInvalidChat, Details: "Repeated invalid chat messages; last: my secret plan"})
+	}
+	mustCreate(t, &PaymentTransaction{UserID: user.ID, Amount: 1000})
+	mustCreate(t, &Ban{TelegramID: telegramID, Scope: BanScopeChat, Reason: "spam"})
+
+	erasure, err := eraseUserData(telegramID, "test", nil)
+	if err != nil {
+		t.Fatalf("erasure failed: %v", err)
+	}
+	if erasure.DeletedMessages != 1 || erasure.DeletedTickets != 1 || erasure.KeptPayments != 1 {
+		t.Fatalf("unexpected erasure counts: %+v", erasure)
+	}
+
+	// Deleted records
+	for name, model := range map[string]interface{}{
+		"chat messages": &ChatMessage{}, "chat threads": &ChatThread{}, "tickets": &Ticket{},
+		"tool results": &ToolResult{}, "ratings": &AIRating{},
+	} {
+		var count int64
+		db.Unscoped().Model(model).Where("telegram_id = ?", telegramID).Count(&count)
+		if count != 0 {
+			t.Fatalf("%s of the erased user survived: %d", name, count)
+		}
+	}
+
+	// Anonymized records
+	var anonymized User
+	if err := db.Unscoped().First(&anonymized, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if anonymized.TelegramID == telegramID || anonymized.Username != "" || anonymized.Phone != "" ||
+		anonymized.Email != "" || anonymized.PhoneHash != "" || !anonymized.DeletedAt.Valid {
+		t.Fatalf("user row was not anonymized: %+v", anonymized)
+	}
+	var usage AIUsage
+	db.Where("telegram_id = ?", -int64(user.ID)).First(&usage)
+	if usage.ID == 0 {
+		t.Fatal("AI usage should be kept under the anonymized ID")
+	}
+	var event SecurityEvent
+	db.Where("telegram_id = ?", telegramID).First(&event)
+	if event.ID == 0 || strings.Contains(event.Details, "secret") {
+		t.Fatalf("security event should be kept without the user's text: %+v", event)
+	}
+	var bans int64
+	db.Model(&Ban{}).Where("telegram_id = ?", telegramID).Count(&bans)
+	if bans != 1 {
+		t.Fatal("bans must survive an erasure")
+	}
+
+	// The other user is untouched
+	var otherMessages, otherEvents int64
+	db.Model(&ChatMessage{}).Where("telegram_id = ?", otherID).Count(&otherMessages)
+	db.Model(&SecurityEvent{}).Where("telegram_id = ? AND details <> ''", otherID).Count(&otherEvents)
+	if otherMessages != 1 || otherEvents != 1 {
+		t.Fatalf("another user's data was touched: %d messages, %d events", otherMessages, otherEvents)
+	}
+
+	if _, err := eraseUserData(telegramID, "test", nil); err == nil {
+		t.Fatal("erasing an already erased user should fail")
+	}
+}
+
+func mustCreate(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
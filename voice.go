@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"MonetizeeAI_bot/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// Voice messages in chat_mode and submitting_exercise are transcribed, echoed back for
+// confirmation and, once confirmed, handled exactly like typed text. An exercise answer also
+// keeps the voice message as its file. Transcribed minutes count against the plan (see
+// transcriptionSecondsLeft).
+
+// maxVoiceSeconds is the longest voice message that is transcribed
+const maxVoiceSeconds = 300
+
+// pendingTranscriptTTL is how long a transcript waits for confirmation
+const pendingTranscriptTTL = 10 * time.Minute
+
+// pendingTranscript is a transcript waiting for the user to confirm it
+type pendingTranscript struct {
+	Text      string
+	State     string          // userStates value the voice message was sent in
+	File      *submissionFile // The voice message itself, kept with an exercise answer
+	CreatedAt time.Time
+}
+
+var (
+	pendingTranscripts   = make(map[int64]pendingTranscript)
+	pendingTranscriptsMu sync.Mutex
+)
+
+// isVoiceMessage reports whether message is a voice note or an audio file
+func isVoiceMessage(message *tgbotapi.Message) bool {
+	return message.Voice != nil || message.Audio != nil
+}
+
+// handleVoiceMessage transcribes a voice message sent in a state that accepts text and asks
+// the user to confirm the transcript. It returns false when the state takes no voice input.
+func handleVoiceMessage(user *User, message *tgbotapi.Message) bool {
+	state := userStates[user.TelegramID]
+	if state != "chat_mode" && state != "submitting_exercise" {
+		return false
+	}
+
+	// 🔒 SECURITY: Banned users get the ban notice before any AI call
+	if state == "chat_mode" {
+		if ban := getActiveBan(user.TelegramID, BanScopeChat); ban != nil {
+			sendBanNotice(user.TelegramID, ban)
+			return true
+		}
+	}
+
+	var telegramFileID, fileName string
+	var seconds int
+	if message.Voice != nil {
+		telegramFileID, fileName, seconds = message.Voice.FileID, "voice.ogg", message.Voice.Duration
+	} else {
+		telegramFileID, fileName, seconds = message.Audio.FileID, message.Audio.FileName, message.Audio.Duration
+		if fileName == "" {
+			fileName = "audio.mp3"
+		}
+	}
+
+	if seconds > maxVoiceSeconds {
+		sendMessage(user.TelegramID, fmt.Sprintf("❌ پیام صوتی باید کوتاه‌تر از %d دقیقه باشد. لطفا کوتاه‌تر ضبط کنید یا متن را تایپ کنید.", maxVoiceSeconds/60))
+		return true
+	}
+	if left, unlimited := transcriptionSecondsLeft(user); !unlimited && left < int64(seconds) {
+		sendMessage(user.TelegramID, "⚠️ دقیقه‌های تبدیل صوت به متن پلن شما برای این ماه تمام شده است. لطفا پیام خود را تایپ کنید یا پلن خود را ارتقا دهید.")
+		return true
+	}
+
+	bot.Send(tgbotapi.NewChatAction(user.TelegramID, tgbotapi.ChatTyping))
+
+	var transcript string
+	audio, err := downloadTelegramFile(telegramFileID, submissionMaxFileBytes())
+	if err == nil {
+		var resp *TranscriptionResponse
+		if resp, err = aiClient.ForUser(user).TranscribeAudio(audio, fileName, seconds); err == nil {
+			transcript = strings.TrimSpace(resp.Text)
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to transcribe voice message",
+			zap.Int64("user_id", user.TelegramID),
+			zap.String("state", state),
+			zap.Error(err))
+		if state == "submitting_exercise" {
+			// The voice note is still a valid answer: a mentor listens to it instead
+			userStates[user.TelegramID] = ""
+			msg := tgbotapi.NewMessage(user.TelegramID, handleExerciseFileSubmission(user, message))
+			msg.ReplyMarkup = getMainMenuKeyboard(user)
+			bot.Send(msg)
+			return true
+		}
+		sendMessage(user.TelegramID, "❌ تبدیل پیام صوتی به متن انجام نشد. لطفا دوباره تلاش کنید یا پیام خود را تایپ کنید.")
+		return true
+	}
+	if transcript == "" {
+		sendMessage(user.TelegramID, "🔇 صدایی در پیام شما تشخیص داده نشد. لطفا دوباره ضبط کنید یا پیام خود را تایپ کنید.")
+		return true
+	}
+
+	pending := pendingTranscript{Text: transcript, State: state, CreatedAt: time.Now()}
+	if state == "submitting_exercise" {
+		pending.File = submissionFileFromMessage(message)
+	}
+	pendingTranscriptsMu.Lock()
+	pendingTranscripts[user.TelegramID] = pending
+	pendingTranscriptsMu.Unlock()
+
+	question := "این پیام برای دستیار ارسال شود؟"
+	if state == "submitting_exercise" {
+		question = "این متن به عنوان پاسخ تمرین ارسال شود؟"
+	}
+	msg := tgbotapi.NewMessage(user.TelegramID, fmt.Sprintf("🎙 متن پیام صوتی شما:\n\n«%s»\n\n%s", transcript, question))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ ارسال", "voice_confirm"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ لغو", "voice_cancel"),
+		),
+	)
+	bot.Send(msg)
+	return true
+}
+
+// takePendingTranscript removes and returns the user's transcript if it is still valid
+func takePendingTranscript(telegramID int64) (pendingTranscript, bool) {
+	pendingTranscriptsMu.Lock()
+	defer pendingTranscriptsMu.Unlock()
+
+	pending, ok := pendingTranscripts[telegramID]
+	delete(pendingTranscripts, telegramID)
+	if !ok || time.Since(pending.CreatedAt) > pendingTranscriptTTL {
+		return pendingTranscript{}, false
+	}
+	return pending, true
+}
+
+// handleVoiceTranscriptCallback handles the confirm and cancel buttons under a transcript
+func handleVoiceTranscriptCallback(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	pending, ok := takePendingTranscript(callback.From.ID)
+	if callback.Data == "voice_cancel" {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "لغو شد"))
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "❌ پیام صوتی لغو شد. می‌توانید دوباره ضبط کنید یا پیام خود را تایپ کنید."))
+		return
+	}
+	if !ok || userStates[callback.From.ID] != pending.State {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "منقضی شده"))
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "⌛️ این پیام صوتی منقضی شده است. لطفا دوباره ارسال کنید."))
+		return
+	}
+
+	var user User
+	if err := db.Where("telegram_id = ?", callback.From.ID).First(&user).Error; err != nil {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "❌ خطا"))
+		return
+	}
+	// 🔒 SECURITY: the same ban check as for typed messages
+	if ban := getActiveBan(user.TelegramID, BanScopeBot); ban != nil {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "❌ دسترسی غیرمجاز"))
+		sendBanNotice(chatID, ban)
+		return
+	}
+	if !user.HasActiveSubscription() {
+		bot.Send(tgbotapi.NewCallback(callback.ID, "⚠️ اشتراک شما به پایان رسیده است"))
+		return
+	}
+
+	bot.Send(tgbotapi.NewCallback(callback.ID, "✅ ارسال شد"))
+	bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, fmt.Sprintf("🎙 «%s»", pending.Text)))
+
+	// An exercise answer keeps the voice message so a mentor can listen to it
+	if pending.State == "submitting_exercise" && pending.File != nil {
+		userStates[user.TelegramID] = ""
+		msg := tgbotapi.NewMessage(chatID, submitVoiceTranscript(&user, pending))
+		msg.ReplyMarkup = getMainMenuKeyboard(&user)
+		bot.Send(msg)
+		return
+	}
+
+	// Handled exactly like typed text
+	if response := processUserInput(pending.Text, &user); response != "" {
+		sendMessage(chatID, response)
+	}
+}
+
+// submitVoiceTranscript submits a confirmed transcript as the exercise answer, with the voice
+// message stored and attached to the submission
+func submitVoiceTranscript(user *User, pending pendingTranscript) string {
+	if _, errMsg := storeSubmissionFile(user, pending.File); errMsg != "" {
+		return errMsg
+	}
+	pending.File.Text = pending.Text
+	return handleExerciseSubmission(user, pending.Text, pending.File)
+}
@@ -5,11 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,11 +35,6 @@ var (
 	miniAppRateLimits = make(map[int64]time.Time)
 	miniAppCallCounts = make(map[int64]int)
 	rateLimitMutex    sync.RWMutex // ⚡ PERFORMANCE: Add mutex for thread-safe access
-
-	// User blocking for Mini App
-	miniAppBlockedUsers            = make(map[int64]bool)
-	miniAppSuspiciousActivityCount = make(map[int64]int)
-	blockedUsersMutex              sync.RWMutex // ⚡ PERFORMANCE: Add mutex for thread-safe access
 )
 
 const (
@@ -46,20 +43,20 @@ const (
 	MiniAppRateLimitWindow   = time.Minute
 )
 
-// 🔒 SECURITY: Block suspicious users for Mini App
-func blockMiniAppUser(telegramID int64, reason string) {
-	miniAppBlockedUsers[telegramID] = true
-	miniAppSuspiciousActivityCount[telegramID]++
+// 🔒 SECURITY: Ban a user from the Mini App (zero duration = permanent)
+func blockMiniAppUser(telegramID int64, reason string, duration time.Duration, issuedBy *uint) error {
+	if _, err := issueBan(telegramID, BanScopeMiniApp, reason, duration, issuedBy); err != nil {
+		logger.Error("Failed to block Mini App user",
+			zap.Int64("user_id", telegramID),
+			zap.Error(err))
+		return err
+	}
 
 	logger.Warn("Mini App user blocked for suspicious activity",
 		zap.Int64("user_id", telegramID),
 		zap.String("reason", reason),
-		zap.Int("violation_count", miniAppSuspiciousActivityCount[telegramID]))
-}
-
-// 🔒 SECURITY: Check if Mini App user is blocked
-func isMiniAppUserBlocked(telegramID int64) bool {
-	return miniAppBlockedUsers[telegramID]
+		zap.Int64("violation_count", countBans(telegramID)))
+	return nil
 }
 
 // 🔒 SECURITY: Simple input validation for Mini App (only length check)
@@ -76,6 +73,9 @@ func isValidMiniAppInput(input string, maxLength int) bool {
 // 🔒 SECURITY: Rate limiting for Mini App API calls
 // ⚡ PERFORMANCE: Thread-safe with mutex
 func checkMiniAppRateLimit(telegramID int64) bool {
+	// Reported before taking the lock, a fired rule writes to the database
+	reportSecuritySignal(SecurityRuleAIBurst, telegramID, "", "Burst of AI requests from the Mini App")
+
 	now := time.Now()
 	rateLimitMutex.Lock()
 	defer rateLimitMutex.Unlock()
@@ -568,7 +568,8 @@ func StartWebAPI() {
 	r.Use(gin.Recovery())
 
 	// ⚡ PERFORMANCE: Enable Gzip compression for faster response times
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	// SSE responses are excluded so tokens are not held back by the compressor
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/api/v1/chat/stream"})))
 
 	// Path normalization middleware - normalize double slashes and trailing slashes
 	r.Use(func(c *gin.Context) {
@@ -691,20 +692,44 @@ func StartWebAPI() {
 
 		// Chat endpoints
 		v1.POST("/chat", handleChatRequest)
+		v1.POST("/chat/stream", handleChatStreamRequest)
 		v1.GET("/user/:telegram_id/chat-history", getChatHistory)
 		v1.POST("/user/:telegram_id/chat-history", saveChatMessage)
 
-		// Business Builder AI endpoint
-		v1.POST("/business-builder", handleBusinessBuilderRequest)
-
-		// SellKit AI endpoint
-		v1.POST("/sellkit", handleSellKitRequest)
-
-		// ClientFinder AI endpoint
-		v1.POST("/clientfinder", handleClientFinderRequest)
-
-		// SalesPath AI endpoint
-		v1.POST("/salespath", handleSalesPathRequest)
+		// Chat threads
+		v1.GET("/user/:telegram_id/threads", listChatThreadsAPI)
+		v1.POST("/user/:telegram_id/threads", createChatThreadAPI)
+		v1.PUT("/user/:telegram_id/threads/:thread_id", updateChatThreadAPI)
+		v1.DELETE("/user/:telegram_id/threads/:thread_id", deleteChatThreadAPI)
+		v1.GET("/user/:telegram_id/threads/:thread_id/messages", listChatThreadMessagesAPI)
+		v1.POST("/user/:telegram_id/threads/:thread_id/reset", resetConversationAPI)
+		v1.PUT("/user/:telegram_id/messages/:message_id/rating", rateChatMessageAPI)
+
+		// AI tools (tool_registry.go): discovery and one endpoint for every tool
+		v1.GET("/tools", listToolsAPI)
+		v1.GET("/tools/:name", getToolAPI)
+		v1.POST("/tools/:name", handleToolRequestAPI)
+
+		// Routes of the first tools, kept for older mini app builds
+		v1.POST("/business-builder", toolHandler("business-builder"))
+		v1.POST("/sellkit", toolHandler("sellkit"))
+		v1.POST("/clientfinder", toolHandler("clientfinder"))
+		v1.POST("/salespath", toolHandler("salespath"))
+
+		// Saved AI tool results
+		v1.GET("/user/:telegram_id/tool-results", listToolResultsAPI)
+		v1.GET("/user/:telegram_id/tool-results/:result_id", getToolResultAPI)
+		v1.PUT("/user/:telegram_id/tool-results/:result_id", renameToolResultAPI)
+		v1.DELETE("/user/:telegram_id/tool-results/:result_id", deleteToolResultAPI)
+		v1.GET("/user/:telegram_id/tool-results/:result_id/versions", listToolResultVersionsAPI)
+		v1.GET("/user/:telegram_id/tool-results/:result_id/compare", compareToolResultsAPI)
+		v1.POST("/user/:telegram_id/tool-results/:result_id/regenerate", regenerateToolResultAPI)
+		v1.GET("/user/:telegram_id/tool-results/:result_id/export", exportToolResultAPI)
+		v1.POST("/user/:telegram_id/tool-results/:result_id/send", sendToolResultAPI)
+		v1.PUT("/user/:telegram_id/tool-results/:result_id/rating", rateToolResultAPI)
+
+		// Queued AI requests (ai_jobs.go)
+		v1.GET("/user/:telegram_id/jobs/:job_id", getAIJobAPI)
 
 		// Profile endpoints
 		v1.GET("/user/:telegram_id/profile", getUserProfile)
@@ -715,6 +740,7 @@ func StartWebAPI() {
 
 		// Quiz evaluation endpoint
 		v1.POST("/evaluate-quiz", handleQuizEvaluation)
+		v1.GET("/user/:telegram_id/quiz-evaluations", getUserQuizEvaluationsAPI)
 
 		// 🔒 SECURITY: Mini App security management endpoint
 		v1.POST("/security", handleMiniAppSecurityAPI)
@@ -729,6 +755,14 @@ func StartWebAPI() {
 		v1.GET("/tickets/:id", handleGetTicket)
 		v1.POST("/tickets/:id/reply", handleReplyTicket)
 		v1.POST("/tickets/:id/close", handleCloseTicket)
+
+		// 🔒 SECURITY: Ban status and appeal (reachable while banned)
+		v1.GET("/user/:telegram_id/ban", getUserBanStatus)
+		v1.POST("/user/:telegram_id/ban/appeal", handleBanAppealAPI)
+
+		// 🔒 PRIVACY: Data export and account erasure (account owner only)
+		v1.GET("/user/:telegram_id/export", exportUserDataAPI)
+		v1.POST("/user/:telegram_id/erase", eraseUserDataAPI)
 	}
 
 	// Payment callback routes (outside v1, for ZarinPal)
@@ -839,11 +873,7 @@ func authenticateTelegramUser(c *gin.Context) {
 		return
 	}
 
-	if !user.IsActive {
-		c.JSON(http.StatusForbidden, APIResponse{
-			Success: false,
-			Error:   "User account is suspended.",
-		})
+	if rejectIfBanned(c, user.TelegramID, BanScopeMiniApp) {
 		return
 	}
 
@@ -908,6 +938,11 @@ func getUserInfo(c *gin.Context) {
 		return
 	}
 
+	// 🔒 SECURITY: Check Mini App ban
+	if rejectIfBanned(c, telegramID, BanScopeMiniApp) {
+		return
+	}
+
 	// ⚡ PERFORMANCE: Get user from cache
 	user, err := userCache.GetUser(telegramID)
 	if err != nil {
@@ -1129,17 +1164,24 @@ func updateUserProgress(c *gin.Context) {
 type ChatRequest struct {
 	TelegramID     int64    `json:"telegram_id" binding:"required"`
 	Message        string   `json:"message" binding:"required"`
-	RecentMessages []string `json:"recent_messages"` // Last 5 user messages for short-term memory (oldest first)
+	ThreadID       *uint    `json:"thread_id"`       // Chat thread, the active thread when omitted
+	RecentMessages []string `json:"recent_messages"` // Deprecated: ignored, context is built server-side from stored messages
 }
 
 // ChatResponse represents the chat response
 type ChatResponse struct {
-	Response string `json:"response"`
-}
-
-// handleChatRequest handles chat requests to ChatGPT
-func handleChatRequest(c *gin.Context) {
-	var requestData ChatRequest
+	Response  string `json:"response"`
+	ThreadID  uint   `json:"thread_id"`
+	MessageID uint   `json:"message_id,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+	Model     string `json:"model,omitempty"`
+	JobID     uint   `json:"job_id,omitempty"` // Set when the AI failed and the message was queued, poll /jobs/:job_id
+}
+
+// prepareChatRequest binds a chat request, runs the ban, rate limit, validation and quota checks
+// and resolves the chat thread. It writes the error response itself and returns ok=false when
+// the request must not reach the AI.
+func prepareChatRequest(c *gin.Context) (requestData ChatRequest, user *User, thread *ChatThread, ok bool) {
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		c.JSON(http.StatusBadRequest, APIResponse{
 			Success: false,
@@ -1148,6 +1190,16 @@ func handleChatRequest(c *gin.Context) {
 		return
 	}
 
+	// 🔒 SECURITY: The chat runs as this user (tools, memory, quota), so the caller must own it
+	if !requireAccountOwner(c, requestData.TelegramID) {
+		return
+	}
+
+	// 🔒 SECURITY: Check Mini App and chat bans
+	if rejectIfBanned(c, requestData.TelegramID, BanScopeMiniApp, BanScopeChat) {
+		return
+	}
+
 	// 🔒 SECURITY: Only rate limiting (3 messages per minute)
 	if !checkMiniAppRateLimit(requestData.TelegramID) {
 		c.JSON(http.StatusTooManyRequests, APIResponse{
@@ -1211,47 +1263,118 @@ func handleChatRequest(c *gin.Context) {
 		return
 	}
 
-	// Get response from ChatGPT (with short-term memory: last 5 user messages)
-	recentMsgs := requestData.RecentMessages
-	if recentMsgs == nil {
-		recentMsgs = []string{}
+	// 🔒 SECURITY: Prompt-injection and content moderation
+	if rejectIfModerated(c, user, FeatureChat, requestData.Message) {
+		return
 	}
-	response := handleChatGPTMessageAPI(user, requestData.Message, recentMsgs)
 
-	// Increment chat message count for free trial users and users without subscription type
-	if user.SubscriptionType == "free_trial" || user.SubscriptionType == "none" || user.SubscriptionType == "" {
-		user.ChatMessagesUsed++
-		if err := db.Model(&User{}).Where("telegram_id = ?", requestData.TelegramID).Update("chat_messages_used", user.ChatMessagesUsed).Error; err != nil {
-			logger.Error("Failed to increment chat messages used", zap.Error(err))
-		} else {
-			// ⚡ PERFORMANCE: Invalidate cache after update
-			userCache.InvalidateUser(requestData.TelegramID)
+	// Daily and monthly token quota of the plan
+	if rejectIfTokenQuotaExceeded(c, user) {
+		return
+	}
+
+	thread, err = resolveChatThread(requestData.TelegramID, requestData.ThreadID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "Thread not found",
+			})
+			return
 		}
+		logger.Error("Failed to resolve chat thread", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
 	}
 
-	// Save chat message to database
-	chatMessage := ChatMessage{
-		TelegramID: requestData.TelegramID,
-		Message:    requestData.Message,
-		Response:   response,
+	return requestData, user, thread, true
+}
+
+// handleChatRequest handles chat requests to ChatGPT
+func handleChatRequest(c *gin.Context) {
+	requestData, user, thread, ok := prepareChatRequest(c)
+	if !ok {
+		return
 	}
 
-	if err := db.Create(&chatMessage).Error; err != nil {
-		logger.Error("Failed to save chat message", zap.Error(err))
-		// Continue anyway - don't fail the request just because we couldn't save
+	// Get response from ChatGPT (with the thread's conversation memory, shared with the bot)
+	conv := loadConversationContext(thread)
+	response, served, err := handleChatGPTMessageAPI(user, FeatureChat, requestData.Message, conv)
+
+	if served == nil {
+		// During a provider outage the message is answered by the AI job worker and the answer
+		// lands in the thread. Other failures would only fail again, they are not queued.
+		if isRetryableLLMError(err) {
+			job := &AIJob{
+				TelegramID: user.TelegramID,
+				Kind:       AIJobChat,
+				Source:     AIJobSourceMiniApp,
+				ThreadID:   &thread.ID,
+				Input:      requestData.Message,
+			}
+			qerr := enqueueAIJob(job, aiJobRetryBase)
+			if qerr == nil {
+				c.JSON(http.StatusAccepted, APIResponse{
+					Success: true,
+					Data: ChatResponse{
+						Response: "⏳ سرویس هوش مصنوعی در حال حاضر شلوغ است. پیام شما ذخیره شد و پاسخ آن به محض آماده شدن در همین گفتگو نمایش داده می‌شود.",
+						ThreadID: thread.ID,
+						JobID:    job.ID,
+					},
+				})
+				return
+			}
+			logger.Error("Failed to queue chat message", zap.Int64("user_id", user.TelegramID), zap.Error(qerr))
+		}
+		// Neither answered nor queued: nothing is stored or counted against the quota
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Error:   response,
+		})
+		return
+	}
+
+	chatMessage := recordChatExchange(user, thread, requestData.Message, response, served)
+
+	chatResponse := ChatResponse{
+		Response:  response,
+		ThreadID:  thread.ID,
+		MessageID: chatMessage.ID,
+		Provider:  served.Provider,
+		Model:     served.Model,
 	}
 
 	c.JSON(http.StatusOK, APIResponse{
 		Success: true,
-		Data: ChatResponse{
-			Response: response,
-		},
+		Data:    chatResponse,
 	})
 }
 
+// recordChatExchange counts the message against the free-trial quota and saves it to the thread
+func recordChatExchange(user *User, thread *ChatThread, message, response string, served *LLMResponse) *ChatMessage {
+	// Increment chat message count for free trial users and users without subscription type
+	if user.SubscriptionType == "free_trial" || user.SubscriptionType == "none" || user.SubscriptionType == "" {
+		user.ChatMessagesUsed++
+		if err := db.Model(&User{}).Where("telegram_id = ?", user.TelegramID).Update("chat_messages_used", user.ChatMessagesUsed).Error; err != nil {
+			logger.Error("Failed to increment chat messages used", zap.Error(err))
+		} else {
+			// ⚡ PERFORMANCE: Invalidate cache after update
+			userCache.InvalidateUser(user.TelegramID)
+		}
+	}
+
+	return storeChatMessage(thread, message, response, served)
+}
+
 // handleChatGPTMessageAPI handles ChatGPT requests for API (similar to handlers.go function)
-func handleChatGPTMessageAPI(user *User, message string, recentMessages []string) string {
-	return makeChatGPTRequest(user, message, recentMessages)
+// conv is the stored conversation memory (nil for one-off prompts).
+// The returned LLMResponse tells which provider and model served the answer; on failure it is
+// nil, the text is the message for the user and the error tells why.
+func handleChatGPTMessageAPI(user *User, feature, message string, conv *ConversationContext) (string, *LLMResponse, error) {
+	return makeChatGPTRequest(user, feature, message, conv)
 }
 
 // 📦 BACKUP: Old OpenAI implementation - kept for reference
@@ -1364,47 +1487,78 @@ func makeChatGPTRequest_OLD(user *User, message string) string {
 	return response
 }
 
-// ⚡ NEW: Groq-based ChatGPT handler for API
-func makeChatGPTRequest(user *User, message string, recentMessages []string) string {
-	// Check if Groq client is initialized
-	if groqClient == nil {
-		logger.Error("Groq client not initialized",
+// ⚡ NEW: LLM provider based ChatGPT handler for API
+func makeChatGPTRequest(user *User, feature, message string, conv *ConversationContext) (string, *LLMResponse, error) {
+	// Check if AI client is initialized
+	if aiClient == nil {
+		logger.Error("AI client not initialized",
 			zap.Int64("user_id", user.TelegramID))
-		return "❌ سرویس هوش مصنوعی در حال حاضر در دسترس نیست. لطفا بعداً تلاش کنید."
+		return "❌ سرویس هوش مصنوعی در حال حاضر در دسترس نیست. لطفا بعداً تلاش کنید.", nil, errors.New("AI client not initialized")
 	}
 
-	// Generate response using Groq (with short-term memory)
-	response, err := groqClient.GenerateMonetizeAIResponse(message, recentMessages)
+	// Generate response (with conversation memory when given)
+	resp, err := aiClient.ForUser(user).GenerateMonetizeAIResponse(feature, message, conv)
 	if err != nil {
-		logger.Error("Groq API error in web_api",
+		logger.Error("AI API error in web_api",
 			zap.Int64("user_id", user.TelegramID),
+			zap.String("feature", feature),
 			zap.Error(err))
-		return "❌ خطا در دریافت پاسخ. لطفا دوباره تلاش کنید."
+		return "❌ خطا در دریافت پاسخ. لطفا دوباره تلاش کنید.", nil, err
 	}
 
-	logger.Info("Groq response received in web_api",
+	logger.Info("AI response received in web_api",
 		zap.Int64("user_id", user.TelegramID),
-		zap.Int("response_length", len(response)))
+		zap.Int("response_length", len(resp.Content)),
+		zap.String("feature", feature),
+		zap.String("provider", resp.Provider),
+		zap.String("model", resp.Model))
 
-	return response
+	return resp.Content, resp, nil
 }
 
 // getChatHistory returns chat history for a user
 func getChatHistory(c *gin.Context) {
-	telegramIDStr := c.Param("telegram_id")
-	telegramID, err := strconv.ParseInt(telegramIDStr, 10, 64)
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
+		return
+	}
+
+	// Scoped to one thread (?thread_id=, default: the active thread); use the thread messages endpoint for paging
+	var thread *ChatThread
+	var err error
+	if threadID, parseErr := strconv.ParseUint(c.Query("thread_id"), 10, 64); parseErr == nil {
+		id := uint(threadID)
+		thread, err = resolveChatThread(telegramID, &id)
+	} else {
+		thread, err = activeChatThread(telegramID, false)
+		if err == gorm.ErrRecordNotFound {
+			// No conversation yet
+			c.JSON(http.StatusOK, APIResponse{
+				Success: true,
+				Data:    []ChatMessage{},
+			})
+			return
+		}
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "Thread not found",
+			})
+			return
+		}
+		logger.Error("Database error in getting chat thread", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
-			Error:   "Invalid telegram_id",
+			Error:   "Database error",
 		})
 		return
 	}
 
-	var chatMessages []ChatMessage
-	result := db.Where("telegram_id = ?", telegramID).Order("created_at ASC").Find(&chatMessages)
-	if result.Error != nil {
-		logger.Error("Database error in getting chat history", zap.Error(result.Error))
+	page, err := chatMessagePage(thread.ID, "", MaxChatPageSize)
+	if err != nil {
+		logger.Error("Database error in getting chat history", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Error:   "Database error",
@@ -1414,25 +1568,21 @@ func getChatHistory(c *gin.Context) {
 
 	c.JSON(http.StatusOK, APIResponse{
 		Success: true,
-		Data:    chatMessages,
+		Data:    page.Messages,
 	})
 }
 
 // saveChatMessage saves a chat message to database
 func saveChatMessage(c *gin.Context) {
-	telegramIDStr := c.Param("telegram_id")
-	telegramID, err := strconv.ParseInt(telegramIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "Invalid telegram_id",
-		})
+	telegramID, ok := ownerFromRequest(c)
+	if !ok {
 		return
 	}
 
 	var requestData struct {
 		Message  string `json:"message" binding:"required"`
 		Response string `json:"response" binding:"required"`
+		ThreadID *uint  `json:"thread_id"`
 	}
 
 	if err := c.ShouldBindJSON(&requestData); err != nil {
@@ -1443,8 +1593,26 @@ func saveChatMessage(c *gin.Context) {
 		return
 	}
 
+	thread, err := resolveChatThread(telegramID, requestData.ThreadID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Error:   "Thread not found",
+			})
+			return
+		}
+		logger.Error("Database error in resolving chat thread", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
 	chatMessage := ChatMessage{
 		TelegramID: telegramID,
+		ThreadID:   &thread.ID,
 		Message:    requestData.Message,
 		Response:   requestData.Response,
 	}
@@ -1457,6 +1625,7 @@ func saveChatMessage(c *gin.Context) {
 		})
 		return
 	}
+	touchChatThread(thread, requestData.Message)
 
 	c.JSON(http.StatusOK, APIResponse{
 		Success: true,
@@ -1558,8 +1727,15 @@ func updateUserProfile(c *gin.Context) {
 	if requestData.Username != "" {
 		updates["username"] = requestData.Username
 	}
-	updates["phone"] = requestData.Phone
-	updates["email"] = requestData.Email
+	// 🔒 SECURITY: Map updates bypass the gorm serializer, so contact fields are encrypted here
+	if err := setEncryptedContactUpdates(updates, requestData.Phone, user.PhoneNumber, requestData.Email); err != nil {
+		logger.Error("Failed to encrypt user profile fields", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Internal server error",
+		})
+		return
+	}
 	updates["monthly_income"] = requestData.MonthlyIncome
 
 	// ⚡ PERFORMANCE: Use Update instead of Save for better performance
@@ -1572,6 +1748,9 @@ func updateUserProfile(c *gin.Context) {
 		return
 	}
 
+	// 🔒 SECURITY: Flag phone numbers shared by many accounts
+	go checkSharedPhone(telegramID, requestData.Phone)
+
 	logger.Info("User profile updated",
 		zap.Int64("telegram_id", telegramID),
 		zap.String("username", requestData.Username))
@@ -1584,94 +1763,123 @@ func updateUserProfile(c *gin.Context) {
 	})
 }
 
-// BusinessBuilderRequest represents the input for business plan generation
-type BusinessBuilderRequest struct {
-	TelegramID int64  `json:"telegram_id"`
-	UserName   string `json:"user_name"`
-	Interests  string `json:"interests"`
-	Skills     string `json:"skills"`
-	Market     string `json:"market"`
+// extractJSONFromResponse extracts JSON from ChatGPT response (handles markdown code blocks)
+func extractJSONFromResponse(response string) string {
+	// Remove leading/trailing whitespace
+	response = strings.TrimSpace(response)
+
+	// Look for JSON in markdown code blocks
+	if strings.Contains(response, "```json") {
+		// Find the start and end of the JSON block
+		startMarker := "```json"
+		endMarker := "```"
+
+		startIdx := strings.Index(response, startMarker)
+		if startIdx != -1 {
+			startIdx += len(startMarker)
+			endIdx := strings.Index(response[startIdx:], endMarker)
+			if endIdx != -1 {
+				jsonContent := strings.TrimSpace(response[startIdx : startIdx+endIdx])
+				return jsonContent
+			}
+		}
+	}
+
+	// Look for JSON in generic code blocks
+	if strings.Contains(response, "```") {
+		// Find the start and end of any code block
+		startMarker := "```"
+		startIdx := strings.Index(response, startMarker)
+		if startIdx != -1 {
+			startIdx += len(startMarker)
+			// Skip any language identifier on the same line
+			if newlineIdx := strings.Index(response[startIdx:], "\n"); newlineIdx != -1 {
+				startIdx += newlineIdx + 1
+			}
+			endIdx := strings.Index(response[startIdx:], startMarker)
+			if endIdx != -1 {
+				jsonContent := strings.TrimSpace(response[startIdx : startIdx+endIdx])
+				// Check if it looks like JSON
+				if strings.HasPrefix(jsonContent, "{") && strings.HasSuffix(jsonContent, "}") {
+					return jsonContent
+				}
+			}
+		}
+	}
+
+	// If no code blocks found, try to find JSON object directly
+	if strings.Contains(response, "{") && strings.Contains(response, "}") {
+		startIdx := strings.Index(response, "{")
+		lastIdx := strings.LastIndex(response, "}")
+		if startIdx != -1 && lastIdx != -1 && lastIdx > startIdx {
+			jsonContent := strings.TrimSpace(response[startIdx : lastIdx+1])
+			return jsonContent
+		}
+	}
+
+	// Return original response if no JSON structure found
+	return response
 }
 
-// BusinessBuilderResponse represents the structured business plan response
-type BusinessBuilderResponse struct {
-	BusinessName   string   `json:"businessName"`
-	Tagline        string   `json:"tagline"`
-	Description    string   `json:"description"`
-	TargetAudience string   `json:"targetAudience"`
-	Products       []string `json:"products"`
-	Monetization   []string `json:"monetization"`
-	FirstAction    string   `json:"firstAction"`
+// QuizEvaluationRequest represents the quiz evaluation request
+type QuizEvaluationRequest struct {
+	TelegramID int64                  `json:"telegram_id" binding:"required"`
+	StageID    int                    `json:"stage_id" binding:"required"`
+	Answers    map[string]interface{} `json:"answers" binding:"required"`
 }
 
-// handleBusinessBuilderRequest handles AI-powered business plan generation
-func handleBusinessBuilderRequest(c *gin.Context) {
-	var req BusinessBuilderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "Invalid request format",
-		})
-		return
+// quizAnswersText joins the answer values in key order, as checked by moderation
+func quizAnswersText(answers map[string]interface{}) string {
+	keys := make([]string, 0, len(answers))
+	for key := range answers {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	// 📢 Check channel membership
-	if errMsg := checkChannelMembershipAPI(req.TelegramID); errMsg != "" {
-		c.JSON(http.StatusForbidden, APIResponse{
-			Success: false,
-			Error:   errMsg,
-		})
-		return
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, fmt.Sprint(answers[key]))
 	}
+	return strings.Join(values, "\n")
+}
 
-	// Validate required fields
-	if req.UserName == "" || req.Interests == "" || req.Market == "" {
+// QuizEvaluationResponse represents the quiz evaluation response
+type QuizEvaluationResponse struct {
+	EvaluationID      uint             `json:"evaluation_id"`
+	Passed            bool             `json:"passed"`
+	Queued            bool             `json:"queued"` // AI unavailable, the result is sent to the user when graded
+	Score             int              `json:"score"`
+	PassingScore      int              `json:"passing_score"`
+	Criteria          []CriterionScore `json:"criteria,omitempty"`
+	Feedback          string           `json:"feedback"`
+	NextStageUnlocked bool             `json:"next_stage_unlocked"`
+}
+
+// quizQueuedFeedback tells the user their answers were saved while the AI is unavailable
+const quizQueuedFeedback = "پاسخ‌هات ذخیره شد ✅ ارزیابی الان در دسترس نیست و به محض انجام، نتیجه از طریق ربات برات ارسال میشه."
+
+// handleQuizEvaluation grades quiz answers against the session rubric (see grading.go)
+func handleQuizEvaluation(c *gin.Context) {
+	var req QuizEvaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, APIResponse{
 			Success: false,
-			Error:   "نام، علاقه‌مندی‌ها و بازار هدف الزامی هستند",
+			Error:   "Invalid request format",
 		})
 		return
 	}
 
-	// Create structured prompt for ChatGPT
-	prompt := fmt.Sprintf(`تو یک مشاور کسب‌وکار حرفه‌ای و خلاق هستی. بر اساس اطلاعات زیر، یک طرح کسب‌وکار جذاب و عملی بساز:
-
-نام کاربر: %s
-علاقه‌مندی‌ها: %s
-مهارت‌ها: %s
-بازار هدف: %s
-
-اهمیت:
-- نام کسب‌وکار باید خلاقانه و جذاب باشد (نه فقط نام + کسب‌وکار)
-- توضیحات باید مفصل و جذاب باشد
-- محصولات باید عملی و قابل اجرا باشند
-- روش‌های درآمدزایی مشخص و واقعی باشند
-- اولین قدم عملی و قابل انجام باشد
-
-IMPORTANT: پاسخ خود را دقیقاً به صورت JSON بده بدون هیچ متن اضافی و field names باید دقیقاً انگلیسی باشند:
-
-{
-  "businessName": "نام خلاقانه و جذاب برای کسب‌وکار",
-  "tagline": "شعار جذاب و کوتاه که ارزش برند را نشان دهد",
-  "description": "توضیح کامل و جذاب کسب‌وکار در 3-4 جمله که مشکل مخاطب و راه‌حل را نشان دهد",
-  "targetAudience": "مخاطب هدف دقیق و مشخص",
-  "products": ["محصول عملی 1", "محصول عملی 2", "محصول عملی 3"],
-  "monetization": ["روش درآمدزایی مشخص 1", "روش درآمدزایی مشخص 2", "روش درآمدزایی مشخص 3"],
-  "firstAction": "اولین قدم عملی و مشخص که امروز می‌توان انجام داد"
-}`,
-		req.UserName, req.Interests, req.Skills, req.Market)
-
 	// ⚡ PERFORMANCE: Get user from cache
 	user, err := userCache.GetUser(req.TelegramID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, APIResponse{
+			c.JSON(http.StatusInternalServerError, APIResponse{
 				Success: false,
-				Error:   "کاربر یافت نشد",
+				Error:   "User not found",
 			})
 			return
 		}
-		logger.Error("Database error in finding user for business builder", zap.Error(err))
+		logger.Error("Database error in quiz evaluation", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Error:   "Database error",
@@ -1679,159 +1887,56 @@ IMPORTANT: پاسخ خود را دقیقاً به صورت JSON بده بدون
 		return
 	}
 
-	// 🔒 SECURITY: Rate limiting for AI tools
-	if !checkMiniAppRateLimit(req.TelegramID) {
-		c.JSON(http.StatusTooManyRequests, APIResponse{
-			Success: false,
-			Error:   "شما به محدودیت سه تا سوال در دقیقه رسیدید لطفا دقایق دیگر امتحان کنید",
-		})
+	// 🔒 SECURITY: Check Mini App ban
+	if rejectIfBanned(c, req.TelegramID, BanScopeMiniApp) {
 		return
 	}
 
-	// Call ChatGPT API (no recent messages for these specialized tools)
-	response := handleChatGPTMessageAPI(user, prompt, []string{})
-
-	// Extract JSON from response (handle markdown code blocks)
-	cleanResponse := extractJSONFromResponse(response)
-	logger.Info("ChatGPT response for business builder",
-		zap.String("raw_response", response),
-		zap.String("clean_response", cleanResponse))
-
-	// Try to parse the JSON response
-	var businessPlan BusinessBuilderResponse
-
-	// First try to fix malformed JSON with empty keys
-	fixedResponse := fixMalformedBusinessJSON(cleanResponse)
-
-	if err := json.Unmarshal([]byte(fixedResponse), &businessPlan); err != nil {
-		// If JSON parsing fails, log detailed error and return fallback response
-		logger.Error("Failed to parse ChatGPT JSON response for business builder",
-			zap.Error(err),
-			zap.String("response", response),
-			zap.String("clean_response", cleanResponse),
-			zap.String("fixed_response", fixedResponse),
-			zap.String("error_detail", err.Error()))
-
-		// Return a fallback business plan based on user input
-		businessPlan = BusinessBuilderResponse{
-			BusinessName:   fmt.Sprintf("استارتاپ %s", req.Interests),
-			Tagline:        fmt.Sprintf("%s را به زبان خودت بیاموز", req.Interests),
-			Description:    fmt.Sprintf("پلتفرم آموزشی آنلاین برای %s که به کاربران کمک می‌کند مهارت‌های خود را توسعه دهند", req.Market),
-			TargetAudience: req.Market,
-			Products:       []string{"دوره‌های آنلاین", "پروژه‌های عملی", "پشتیبانی تخصصی"},
-			Monetization:   []string{"عضویت ماهیانه", "فروش دوره‌های اختصاصی", "مشاوره تخصصی"},
-			FirstAction:    "ثبت نام در یک دوره آنلاین و آغاز آموزش به‌صورت رایگان",
-		}
-		logger.Info("Using fallback response for business builder due to parsing error")
+	// 🔒 SECURITY: Answers are graded by the AI, they must not carry instructions for it
+	if rejectIfModerated(c, user, FeatureExerciseEvaluation, quizAnswersText(req.Answers)) {
+		return
 	}
 
-	// Ensure arrays are not nil (safety check)
-	if businessPlan.Products == nil {
-		businessPlan.Products = []string{"محصول پایه", "سرویس مشاوره", "پکیج آموزشی"}
-	}
-	if businessPlan.Monetization == nil {
-		businessPlan.Monetization = []string{"فروش مستقیم", "اشتراک ماهیانه", "کمیسیون فروش"}
+	// ⚡ PERFORMANCE: Get session from cache
+	session, err := sessionCache.GetSessionByNumber(req.StageID)
+	if err != nil {
+		logger.Error("Failed to get session for quiz evaluation", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Stage not found",
+		})
+		return
 	}
 
-	logger.Info("Business plan generated successfully",
-		zap.Int64("telegram_id", req.TelegramID),
-		zap.String("business_name", businessPlan.BusinessName))
-
-	c.JSON(http.StatusOK, APIResponse{
-		Success: true,
-		Data:    businessPlan,
-	})
-}
+	// Convert answers to string for ChatGPT analysis
+	answersJSON, _ := json.Marshal(req.Answers)
+	answersStr := string(answersJSON)
 
-// SellKitRequest represents the input for sales kit generation
-type SellKitRequest struct {
-	TelegramID     int64  `json:"telegram_id"`
-	ProductName    string `json:"product_name"`
-	Description    string `json:"description"`
-	TargetAudience string `json:"target_audience"`
-	Benefits       string `json:"benefits"`
-}
-
-// SellKitResponse represents the structured sales kit response
-type SellKitResponse struct {
-	Title            string   `json:"title"`
-	Headline         string   `json:"headline"`
-	Description      string   `json:"description"`
-	Benefits         []string `json:"benefits"`
-	PriceRange       string   `json:"priceRange"`
-	Offer            string   `json:"offer"`
-	VisualSuggestion string   `json:"visualSuggestion"`
-}
-
-// handleSellKitRequest handles AI-powered sales kit generation
-func handleSellKitRequest(c *gin.Context) {
-	var req SellKitRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "Invalid request format",
-		})
-		return
-	}
-
-	// 📢 Check channel membership
-	if errMsg := checkChannelMembershipAPI(req.TelegramID); errMsg != "" {
-		c.JSON(http.StatusForbidden, APIResponse{
-			Success: false,
-			Error:   errMsg,
-		})
-		return
-	}
+	// Evaluate using dedicated AI evaluation (Persian-only, colloquial)
+	logger.Info("Starting quiz evaluation",
+		zap.Int64("user_id", user.TelegramID),
+		zap.Int("stage_id", req.StageID),
+		zap.String("session_title", session.Title),
+		zap.Int("answers_count", len(req.Answers)))
 
-	// Validate required fields
-	if req.ProductName == "" || req.Description == "" || req.TargetAudience == "" {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "نام محصول، توضیحات و مخاطب هدف الزامی هستند",
+	// A submission still waiting for the AI is not graded twice
+	var pending QuizEvaluation
+	if err := db.Where("telegram_id = ? AND session_id = ? AND status = ?", user.TelegramID, session.ID, QuizEvaluationQueued).
+		First(&pending).Error; err == nil {
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Data: QuizEvaluationResponse{
+				EvaluationID: pending.ID,
+				Queued:       true,
+				Feedback:     quizQueuedFeedback,
+			},
 		})
 		return
 	}
 
-	// Create structured prompt for ChatGPT
-	prompt := fmt.Sprintf(`تو یک متخصص بازاریابی و فروش حرفه‌ای هستی. بر اساس اطلاعات زیر، یک کیت فروش حرفه‌ای و جذاب بساز:
-
-نام محصول: %s
-توضیحات: %s
-مخاطب هدف: %s
-مزایای اصلی: %s
-
-اهمیت:
-- عنوان باید جذاب و قانع‌کننده باشد
-- تیتر باید عاطفی و تأثیرگذار باشد
-- توضیحات باید مشکل مخاطب و راه‌حل را نشان دهد
-- مزایا باید عملی و قابل اندازه‌گیری باشند
-- قیمت بر اساس بازار ایران باشد
-- پیشنهاد ویژه جذاب و عملی باشد
-
-IMPORTANT: پاسخ خود را دقیقاً به صورت JSON بده بدون هیچ متن اضافی و field names باید دقیقاً انگلیسی باشند:
-
-{
-  "title": "عنوان جذاب و قانع‌کننده برای محصول",
-  "headline": "تیتر عاطفی و تأثیرگذار که توجه را جلب کند",
-  "description": "توضیح کامل و متقاعدکننده که مشکل و راه‌حل را بیان کند",
-  "benefits": ["مزیت عملی 1", "مزیت عملی 2", "مزیت عملی 3"],
-  "priceRange": "محدوده قیمت به تومان بر اساس بازار ایران",
-  "offer": "پیشنهاد ویژه جذاب با تخفیف یا بونوس",
-  "visualSuggestion": "پیشنهاد مشخص برای تصاویر بازاریابی"
-}`,
-		req.ProductName, req.Description, req.TargetAudience, req.Benefits)
-
-	// ⚡ PERFORMANCE: Get user from cache
-	user, err := userCache.GetUser(req.TelegramID)
+	rubric, err := loadSessionRubric(session.ID)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, APIResponse{
-				Success: false,
-				Error:   "کاربر یافت نشد",
-			})
-			return
-		}
-		logger.Error("Database error in finding user for sellkit", zap.Error(err))
+		logger.Error("Failed to load session rubric", zap.Uint("session_id", session.ID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Error:   "Database error",
@@ -1839,369 +1944,32 @@ IMPORTANT: پاسخ خود را دقیقاً به صورت JSON بده بدون
 		return
 	}
 
-	// 🔒 SECURITY: Rate limiting for AI tools
-	if !checkMiniAppRateLimit(req.TelegramID) {
-		c.JSON(http.StatusTooManyRequests, APIResponse{
-			Success: false,
-			Error:   "شما به محدودیت سه تا سوال در دقیقه رسیدید لطفا دقایق دیگر امتحان کنید",
-		})
-		return
+	evaluation := QuizEvaluation{
+		TelegramID:    user.TelegramID,
+		SessionID:     session.ID,
+		SessionNumber: session.Number,
+		Answers:       answersStr,
+		PassingScore:  rubric.PassingScore,
+		Attempts:      1,
 	}
 
-	// Call ChatGPT API (no recent messages for these specialized tools)
-	response := handleChatGPTMessageAPI(user, prompt, []string{})
-
-	// Extract JSON from response (handle markdown code blocks)
-	cleanResponse := extractJSONFromResponse(response)
-	logger.Info("ChatGPT response for sellkit",
-		zap.String("raw_response", response),
-		zap.String("clean_response", cleanResponse))
-
-	// Try to parse the JSON response
-	var sellKit SellKitResponse
-
-	// First try to fix malformed JSON with empty keys
-	fixedResponse := fixMalformedSellKitJSON(cleanResponse)
-
-	if err := json.Unmarshal([]byte(fixedResponse), &sellKit); err != nil {
-		// If JSON parsing fails, log detailed error and return fallback response
-		logger.Error("Failed to parse ChatGPT JSON response for sellkit",
-			zap.Error(err),
-			zap.String("response", response),
-			zap.String("clean_response", cleanResponse),
-			zap.String("fixed_response", fixedResponse),
-			zap.String("error_detail", err.Error()))
-
-		// Return a fallback sell kit based on user input
-		sellKit = SellKitResponse{
-			Title:            fmt.Sprintf("کیت فروش %s", req.ProductName),
-			Headline:         fmt.Sprintf("بهترین %s برای %s", req.ProductName, req.TargetAudience),
-			Description:      fmt.Sprintf("محصول %s طراحی شده برای %s که مشکلات اصلی آنها را حل می‌کند", req.ProductName, req.TargetAudience),
-			Benefits:         []string{"کیفیت بالا", "قیمت مناسب", "پشتیبانی 24 ساعته", "ضمانت کیفیت"},
-			PriceRange:       "500,000 تا 2,000,000 تومان",
-			Offer:            "تخفیف ویژه 20% برای خریداران اولیه",
-			VisualSuggestion: "تصاویر با کیفیت از محصول و مشتریان راضی",
-		}
-		logger.Info("Using fallback response for sellkit due to parsing error")
-	}
-
-	// Ensure arrays are not nil (safety check)
-	if sellKit.Benefits == nil {
-		sellKit.Benefits = []string{"کیفیت عالی", "قیمت مناسب", "پشتیبانی کامل"}
-	}
-
-	logger.Info("Sell kit generated successfully",
-		zap.Int64("telegram_id", req.TelegramID),
-		zap.String("product_name", req.ProductName))
-
-	c.JSON(http.StatusOK, APIResponse{
-		Success: true,
-		Data:    sellKit,
-	})
-}
-
-// ClientFinderRequest represents the input for client finding
-type ClientFinderRequest struct {
-	TelegramID   int64    `json:"telegram_id"`
-	Product      string   `json:"product"`
-	TargetClient string   `json:"target_client"`
-	Platforms    []string `json:"platforms"`
-}
-
-// ClientFinderResponse represents the structured client finder response
-type ClientFinderResponse struct {
-	Channels        []ClientChannel `json:"channels"`
-	OutreachMessage string          `json:"outreachMessage"`
-	Hashtags        []string        `json:"hashtags"`
-	ActionPlan      []string        `json:"actionPlan"`
-}
-
-// ClientChannel represents a recommended channel for finding clients
-type ClientChannel struct {
-	Name   string `json:"name"`
-	Reason string `json:"reason"`
-}
-
-// handleClientFinderRequest handles AI-powered client finding
-func handleClientFinderRequest(c *gin.Context) {
-	var req ClientFinderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "Invalid request format",
-		})
-		return
-	}
-
-	// 📢 Check channel membership
-	if errMsg := checkChannelMembershipAPI(req.TelegramID); errMsg != "" {
-		c.JSON(http.StatusForbidden, APIResponse{
-			Success: false,
-			Error:   errMsg,
-		})
-		return
-	}
-
-	// Validate required fields
-	if req.Product == "" || req.TargetClient == "" {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "محصول و مخاطب هدف الزامی هستند",
-		})
-		return
-	}
-
-	// Convert platforms array to string
-	platformsStr := "همه پلتفرم‌ها"
-	if len(req.Platforms) > 0 {
-		platformsStr = strings.Join(req.Platforms, ", ")
-	}
-
-	// Create structured prompt for ChatGPT
-	prompt := fmt.Sprintf(`تو یک متخصص بازاریابی و یافتن مشتری هستی. بر اساس اطلاعات زیر، یک راهنمای کامل یافتن مشتری بساز:
-
-محصول/خدمات: %s
-مخاطب هدف: %s
-پلتفرم‌های مورد نظر: %s
-
-اهمیت:
-- کانال‌ها باید بهترین و موثرترین باشند برای مخاطب هدف
-- پیام ارتباط باید شخصی و جذاب باشد
-- هشتگ‌ها باید مرتبط و پر ترافیک باشند
-- برنامه عملی باید مشخص و عملی باشد
-
-IMPORTANT: پاسخ خود را دقیقاً به صورت JSON بده بدون هیچ متن اضافی و field names باید دقیقاً انگلیسی باشند:
-
-{
-  "channels": [
-    {
-      "name": "نام کانال موثر 1",
-      "reason": "دلیل انتخاب و مزیت این کانال"
-    },
-    {
-      "name": "نام کانال موثر 2",
-      "reason": "دلیل انتخاب و مزیت این کانال"
-    },
-    {
-      "name": "نام کانال موثر 3",
-      "reason": "دلیل انتخاب و مزیت این کانال"
-    }
-  ],
-  "outreachMessage": "پیام شخصی و جذاب برای ارتباط با مشتریان بالقوه",
-  "hashtags": ["هشتگ1", "هشتگ2", "هشتگ3", "هشتگ4"],
-  "actionPlan": ["قدم عملی 1", "قدم عملی 2", "قدم عملی 3"]
-}`,
-		req.Product, req.TargetClient, platformsStr)
-
-	// ⚡ PERFORMANCE: Get user from cache
-	user, err := userCache.GetUser(req.TelegramID)
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, APIResponse{
-				Success: false,
-				Error:   "کاربر یافت نشد",
-			})
-			return
-		}
-		logger.Error("Database error in finding user for clientfinder", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Error:   "Database error",
-		})
-		return
-	}
-
-	// 🔒 SECURITY: Rate limiting for AI tools
-	if !checkMiniAppRateLimit(req.TelegramID) {
-		c.JSON(http.StatusTooManyRequests, APIResponse{
-			Success: false,
-			Error:   "شما به محدودیت سه تا سوال در دقیقه رسیدید لطفا دقایق دیگر امتحان کنید",
-		})
-		return
-	}
-
-	// Call ChatGPT API (no recent messages for these specialized tools)
-	response := handleChatGPTMessageAPI(user, prompt, []string{})
-
-	// Extract JSON from response (handle markdown code blocks)
-	cleanResponse := extractJSONFromResponse(response)
-	logger.Info("ChatGPT response for clientfinder",
-		zap.String("raw_response", response),
-		zap.String("clean_response", cleanResponse))
-
-	// Try to parse the JSON response
-	var clientFinder ClientFinderResponse
-
-	// First try to fix malformed JSON with empty keys
-	fixedResponse := fixMalformedClientFinderJSON(cleanResponse)
-
-	if err := json.Unmarshal([]byte(fixedResponse), &clientFinder); err != nil {
-		// If JSON parsing fails, log detailed error and return fallback response
-		logger.Error("Failed to parse ChatGPT JSON response for clientfinder",
-			zap.Error(err),
-			zap.String("response", response),
-			zap.String("clean_response", cleanResponse),
-			zap.String("fixed_response", fixedResponse),
-			zap.String("error_detail", err.Error()))
-
-		// Return a fallback client finder based on user input
-		clientFinder = ClientFinderResponse{
-			Channels: []ClientChannel{
-				{Name: "اینستاگرام", Reason: "پلتفرم اصلی برای ارتباط با مشتریان ایرانی"},
-				{Name: "تلگرام", Reason: "کانال‌های تخصصی و گروه‌های هدفمند"},
-				{Name: "لینکدین", Reason: "شبکه حرفه‌ای برای B2B"},
-			},
-			OutreachMessage: fmt.Sprintf("سلام! محصول %s ما می‌تواند به شما در %s کمک کند. آیا علاقه‌مند به اطلاعات بیشتر هستید؟", req.Product, req.TargetClient),
-			Hashtags:        []string{"#فروش", "#کسب_و_کار", "#ایران", "#آنلاین"},
-			ActionPlan:      []string{"شناسایی مخاطبان هدف", "تولید محتوای جذاب", "ارسال پیام‌های شخصی", "پیگیری منظم"},
-		}
-		logger.Info("Using fallback response for clientfinder due to parsing error")
-	}
-
-	// Ensure arrays are not nil (safety check)
-	if clientFinder.Channels == nil {
-		clientFinder.Channels = []ClientChannel{{Name: "اینستاگرام", Reason: "پلتفرم اصلی"}}
-	}
-	if clientFinder.Hashtags == nil {
-		clientFinder.Hashtags = []string{"#فروش", "#کسب_و_کار"}
-	}
-	if clientFinder.ActionPlan == nil {
-		clientFinder.ActionPlan = []string{"شناسایی مخاطبان", "تولید محتوا", "ارتباط مستقیم"}
-	}
-
-	logger.Info("Client finder generated successfully",
-		zap.Int64("telegram_id", req.TelegramID),
-		zap.String("product", req.Product),
-		zap.String("target_client", req.TargetClient))
-
-	c.JSON(http.StatusOK, APIResponse{
-		Success: true,
-		Data:    clientFinder,
-	})
-}
-
-// SalesPathRequest represents the input for sales path generation
-type SalesPathRequest struct {
-	TelegramID     int64  `json:"telegram_id"`
-	ProductName    string `json:"product_name"`
-	TargetAudience string `json:"target_audience"`
-	SalesChannel   string `json:"sales_channel"`
-	Goal           string `json:"goal"`
-}
-
-// SalesPathResponse represents the structured sales path response
-type SalesPathResponse struct {
-	DailyPlan  []DailyPlan `json:"dailyPlan"`
-	SalesTips  []string    `json:"salesTips"`
-	Engagement []string    `json:"engagement"`
-}
-
-// DailyPlan represents a daily action in the sales path
-type DailyPlan struct {
-	Day     string `json:"day"`
-	Action  string `json:"action"`
-	Content string `json:"content"`
-}
-
-// handleSalesPathRequest handles AI-powered sales path generation
-func handleSalesPathRequest(c *gin.Context) {
-	var req SalesPathRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "Invalid request format",
-		})
-		return
-	}
-
-	// 📢 Check channel membership
-	if errMsg := checkChannelMembershipAPI(req.TelegramID); errMsg != "" {
-		c.JSON(http.StatusForbidden, APIResponse{
-			Success: false,
-			Error:   errMsg,
-		})
-		return
+	// 🔒 POLICY: When the AI cannot grade, the evaluation is queued for retry - never passed automatically
+	grade, evalErr := gradeQuiz(user, session, rubric, answersStr)
+	if evalErr != nil {
+		logger.Error("AI evaluation error, quiz evaluation queued",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Int("stage_id", req.StageID),
+			zap.Error(evalErr))
+		evaluation.queueAfterFailure(evalErr)
+	} else {
+		evaluation.applyGrade(grade, rubric.PassingScore)
 	}
 
-	// Validate required fields
-	if req.ProductName == "" || req.TargetAudience == "" || req.SalesChannel == "" {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "نام محصول، مخاطب هدف و کانال فروش الزامی هستند",
-		})
-		return
-	}
-
-	// Create structured prompt for ChatGPT
-	prompt := fmt.Sprintf(`تو یک متخصص فروش و بازاریابی حرفه‌ای هستی. بر اساس اطلاعات زیر، یک مسیر فروش سریع و عملی برای ۷ روز بساز:
-
-نام محصول/خدمات: %s
-مخاطب هدف: %s
-کانال فروش: %s
-هدف فروش: %s
-
-اهمیت:
-- برنامه ۷ روزه باید عملی و قابل اجرا باشد
-- نکات فروش باید عملی و موثر باشند
-- تاکتیک‌های تعامل باید متنوع و جذاب باشند
-- توجه ویژه به کانال فروش انتخابی
-
-IMPORTANT: پاسخ خود را دقیقاً به صورت JSON بده بدون هیچ متن اضافی و field names باید دقیقاً انگلیسی باشند:
-
-{
-  "dailyPlan": [
-    {
-      "day": "روز ۱",
-      "action": "عنوان اقدام روز اول",
-      "content": "توضیح کامل اقدامات عملی روز اول"
-    },
-    {
-      "day": "روز ۲",
-      "action": "عنوان اقدام روز دوم",
-      "content": "توضیح کامل اقدامات عملی روز دوم"
-    },
-    {
-      "day": "روز ۳",
-      "action": "عنوان اقدام روز سوم",
-      "content": "توضیح کامل اقدامات عملی روز سوم"
-    },
-    {
-      "day": "روز ۴",
-      "action": "عنوان اقدام روز چهارم",
-      "content": "توضیح کامل اقدامات عملی روز چهارم"
-    },
-    {
-      "day": "روز ۵",
-      "action": "عنوان اقدام روز پنجم",
-      "content": "توضیح کامل اقدامات عملی روز پنجم"
-    },
-    {
-      "day": "روز ۶",
-      "action": "عنوان اقدام روز ششم",
-      "content": "توضیح کامل اقدامات عملی روز ششم"
-    },
-    {
-      "day": "روز ۷",
-      "action": "عنوان اقدام روز هفتم",
-      "content": "توضیح کامل اقدامات عملی روز هفتم"
-    }
-  ],
-  "salesTips": ["نکته فروش 1", "نکته فروش 2", "نکته فروش 3", "نکته فروش 4"],
-  "engagement": ["تاکتیک تعامل 1", "تاکتیک تعامل 2", "تاکتیک تعامل 3", "تاکتیک تعامل 4"]
-}`,
-		req.ProductName, req.TargetAudience, req.SalesChannel, req.Goal)
-
-	// ⚡ PERFORMANCE: Get user from cache
-	user, err := userCache.GetUser(req.TelegramID)
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, APIResponse{
-				Success: false,
-				Error:   "کاربر یافت نشد",
-			})
-			return
-		}
-		logger.Error("Database error in finding user for salespath", zap.Error(err))
+	if err := db.Create(&evaluation).Error; err != nil {
+		logger.Error("Failed to save quiz evaluation",
+			zap.Int64("user_id", user.TelegramID),
+			zap.Int("stage_id", req.StageID),
+			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Error:   "Database error",
@@ -2209,576 +1977,49 @@ IMPORTANT: پاسخ خود را دقیقاً به صورت JSON بده بدون
 		return
 	}
 
-	// 🔒 SECURITY: Rate limiting for AI tools
-	if !checkMiniAppRateLimit(req.TelegramID) {
-		c.JSON(http.StatusTooManyRequests, APIResponse{
-			Success: false,
-			Error:   "شما به محدودیت سه تا سوال در دقیقه رسیدید لطفا دقایق دیگر امتحان کنید",
-		})
-		return
-	}
-
-	// Call ChatGPT API (no recent messages for these specialized tools)
-	response := handleChatGPTMessageAPI(user, prompt, []string{})
-
-	// Check if response is an error message (timeout or other ChatGPT issues)
-	if strings.Contains(response, "❌") || strings.Contains(response, "خطا") {
-		// If ChatGPT failed, use fallback response directly
-		logger.Info("ChatGPT API failed, using fallback response for salespath",
-			zap.String("error_response", response))
-
-		salesPath := SalesPathResponse{
-			DailyPlan: []DailyPlan{
-				{Day: "روز ۱", Action: "آماده‌سازی محتوا", Content: "ایجاد پست معرفی محصول و آماده‌سازی پیام‌های فروش"},
-				{Day: "روز ۲", Action: "شروع تعامل", Content: "ارسال پیام به 20 مخاطب هدف و پاسخ به کامنت‌ها"},
-				{Day: "روز ۳", Action: "ارائه پیشنهاد", Content: "ارائه تخفیف ویژه و تماس با مشتریان علاقه‌مند"},
-				{Day: "روز ۴", Action: "پیگیری فروش", Content: "تماس با مشتریان و بستن اولین معاملات"},
-				{Day: "روز ۵", Action: "بهینه‌سازی", Content: "تحلیل نتایج و بهبود استراتژی فروش"},
-				{Day: "روز ۶", Action: "توسعه بازار", Content: "جستجوی مشتریان جدید و گسترش شبکه"},
-				{Day: "روز ۷", Action: "نتیجه‌گیری", Content: "ارزیابی نتایج و برنامه‌ریزی برای هفته بعد"},
-			},
-			SalesTips: []string{
-				"همیشه روی ارزش محصول تمرکز کنید نه قیمت",
-				"مشتریان را گوش دهید و نیازهایشان را درک کنید",
-				"از داستان‌سرایی برای جذب توجه استفاده کنید",
-				"پیگیری منظم و مداوم داشته باشید",
-			},
-			Engagement: []string{
-				"پرسش‌های تعاملی",
-				"محتوای آموزشی",
-				"تخفیف‌های محدود",
-				"گواهی‌نامه‌های کیفیت",
-			},
-		}
-
-		logger.Info("Sales path generated successfully with fallback",
-			zap.Int64("telegram_id", req.TelegramID),
-			zap.String("product_name", req.ProductName),
-			zap.String("sales_channel", req.SalesChannel))
-
+	if evaluation.Status != QuizEvaluationGraded {
 		c.JSON(http.StatusOK, APIResponse{
 			Success: true,
-			Data:    salesPath,
-		})
-		return
-	}
-
-	// Extract JSON from response (handle markdown code blocks)
-	cleanResponse := extractJSONFromResponse(response)
-	logger.Info("ChatGPT response for salespath",
-		zap.String("raw_response", response),
-		zap.String("clean_response", cleanResponse))
-
-	// Try to parse the JSON response
-	var salesPath SalesPathResponse
-
-	// First try to fix malformed JSON with empty keys
-	fixedResponse := fixMalformedSalesPathJSON(cleanResponse)
-
-	if err := json.Unmarshal([]byte(fixedResponse), &salesPath); err != nil {
-		// If JSON parsing fails, log detailed error and return default response for testing
-		logger.Error("Failed to parse ChatGPT JSON response for salespath",
-			zap.Error(err),
-			zap.String("response", response),
-			zap.String("clean_response", cleanResponse),
-			zap.String("fixed_response", fixedResponse),
-			zap.String("error_detail", err.Error()))
-
-		// For testing purposes, return a default response if JSON parsing fails
-		salesPath = SalesPathResponse{
-			DailyPlan: []DailyPlan{
-				{Day: "روز ۱", Action: "آماده‌سازی محتوا", Content: "ایجاد پست معرفی محصول و آماده‌سازی پیام‌های فروش"},
-				{Day: "روز ۲", Action: "شروع تعامل", Content: "ارسال پیام به 20 مخاطب هدف و پاسخ به کامنت‌ها"},
-				{Day: "روز ۳", Action: "ارائه پیشنهاد", Content: "ارائه تخفیف ویژه و تماس با مشتریان علاقه‌مند"},
-				{Day: "روز ۴", Action: "پیگیری فروش", Content: "تماس با مشتریان و بستن اولین معاملات"},
-				{Day: "روز ۵", Action: "بهینه‌سازی", Content: "تحلیل نتایج و بهبود استراتژی فروش"},
-				{Day: "روز ۶", Action: "توسعه بازار", Content: "جستجوی مشتریان جدید و گسترش شبکه"},
-				{Day: "روز ۷", Action: "نتیجه‌گیری", Content: "ارزیابی نتایج و برنامه‌ریزی برای هفته بعد"},
-			},
-			SalesTips: []string{
-				"همیشه روی ارزش محصول تمرکز کنید نه قیمت",
-				"مشتریان را گوش دهید و نیازهایشان را درک کنید",
-				"از داستان‌سرایی برای جذب توجه استفاده کنید",
-				"پیگیری منظم و مداوم داشته باشید",
+			Data: QuizEvaluationResponse{
+				EvaluationID: evaluation.ID,
+				Queued:       true,
+				PassingScore: evaluation.PassingScore,
+				Feedback:     quizQueuedFeedback,
 			},
-			Engagement: []string{
-				"پرسش‌های تعاملی",
-				"محتوای آموزشی",
-				"تخفیف‌های محدود",
-				"گواهی‌نامه‌های کیفیت",
-			},
-		}
-		logger.Info("Using fallback response for salespath due to parsing error")
-	}
-
-	// Ensure arrays are not nil (safety check)
-	if salesPath.DailyPlan == nil {
-		salesPath.DailyPlan = []DailyPlan{{Day: "روز ۱", Action: "شروع", Content: "آغاز فروش"}}
-	}
-	if salesPath.SalesTips == nil {
-		salesPath.SalesTips = []string{"تمرکز روی ارزش", "گوش دادن به مشتری"}
-	}
-	if salesPath.Engagement == nil {
-		salesPath.Engagement = []string{"محتوای جذاب", "تعامل مستقیم"}
-	}
-
-	logger.Info("Sales path generated successfully",
-		zap.Int64("telegram_id", req.TelegramID),
-		zap.String("product_name", req.ProductName),
-		zap.String("sales_channel", req.SalesChannel))
-
-	c.JSON(http.StatusOK, APIResponse{
-		Success: true,
-		Data:    salesPath,
-	})
-}
-
-// fixMalformedBusinessJSON fixes JSON with empty field names by simple string replacement
-func fixMalformedBusinessJSON(jsonStr string) string {
-	// If JSON doesn't have empty keys, return as is
-	if !strings.Contains(jsonStr, `"":`) {
-		return jsonStr
-	}
-
-	// Simple approach: replace empty keys with placeholders first, then replace placeholders
-	result := jsonStr
-
-	// Replace empty keys with unique placeholders
-	result = strings.Replace(result, `"":`, `"__FIELD1__":`, 1)
-	result = strings.Replace(result, `"":`, `"__FIELD2__":`, 1)
-	result = strings.Replace(result, `"":`, `"__FIELD3__":`, 1)
-	result = strings.Replace(result, `"":`, `"__FIELD4__":`, 1)
-	result = strings.Replace(result, `"":`, `"__FIELD5__":`, 1)
-	result = strings.Replace(result, `"":`, `"__FIELD6__":`, 1)
-	result = strings.Replace(result, `"":`, `"__FIELD7__":`, 1)
-
-	// Replace placeholders with correct field names
-	result = strings.Replace(result, `"__FIELD1__":`, `"businessName":`, 1)
-	result = strings.Replace(result, `"__FIELD2__":`, `"tagline":`, 1)
-	result = strings.Replace(result, `"__FIELD3__":`, `"description":`, 1)
-	result = strings.Replace(result, `"__FIELD4__":`, `"targetAudience":`, 1)
-	result = strings.Replace(result, `"__FIELD5__":`, `"products":`, 1)
-	result = strings.Replace(result, `"__FIELD6__":`, `"monetization":`, 1)
-	result = strings.Replace(result, `"__FIELD7__":`, `"firstAction":`, 1)
-
-	return result
-}
-
-// fixMalformedSellKitJSON fixes JSON with empty field names for SellKit
-func fixMalformedSellKitJSON(jsonStr string) string {
-	// If JSON doesn't have empty keys, return as is
-	if !strings.Contains(jsonStr, `"":`) {
-		return jsonStr
-	}
-
-	result := jsonStr
-
-	// Replace empty keys with unique placeholders (SellKit has 7 fields)
-	result = strings.Replace(result, `"":`, `"__FIELD1__":`, 1) // title
-	result = strings.Replace(result, `"":`, `"__FIELD2__":`, 1) // headline
-	result = strings.Replace(result, `"":`, `"__FIELD3__":`, 1) // description
-	result = strings.Replace(result, `"":`, `"__FIELD4__":`, 1) // benefits (array)
-	result = strings.Replace(result, `"":`, `"__FIELD5__":`, 1) // priceRange
-	result = strings.Replace(result, `"":`, `"__FIELD6__":`, 1) // offer
-	result = strings.Replace(result, `"":`, `"__FIELD7__":`, 1) // visualSuggestion
-
-	// Replace placeholders with correct field names
-	result = strings.Replace(result, `"__FIELD1__":`, `"title":`, 1)
-	result = strings.Replace(result, `"__FIELD2__":`, `"headline":`, 1)
-	result = strings.Replace(result, `"__FIELD3__":`, `"description":`, 1)
-	result = strings.Replace(result, `"__FIELD4__":`, `"benefits":`, 1)
-	result = strings.Replace(result, `"__FIELD5__":`, `"priceRange":`, 1)
-	result = strings.Replace(result, `"__FIELD6__":`, `"offer":`, 1)
-	result = strings.Replace(result, `"__FIELD7__":`, `"visualSuggestion":`, 1)
-
-	return result
-}
-
-// fixMalformedClientFinderJSON fixes JSON with empty field names for ClientFinder
-func fixMalformedClientFinderJSON(jsonStr string) string {
-	// If JSON doesn't have empty keys, return as is
-	if !strings.Contains(jsonStr, `"":`) {
-		return jsonStr
-	}
-
-	result := jsonStr
-
-	// ClientFinder has nested structure with many empty keys
-	// Main structure: channels (array), outreachMessage (string), hashtags (array), actionPlan (array)
-	// Each channel object also has empty keys: name, reason
-
-	// Replace main level empty keys first
-	result = strings.Replace(result, `"":`, `"channels":`, 1) // First main field
-
-	// Replace nested empty keys in channels array (name, reason for each channel)
-	result = strings.Replace(result, `"":`, `"name":`, 1)   // First channel name
-	result = strings.Replace(result, `"":`, `"reason":`, 1) // First channel reason
-	result = strings.Replace(result, `"":`, `"name":`, 1)   // Second channel name
-	result = strings.Replace(result, `"":`, `"reason":`, 1) // Second channel reason
-	result = strings.Replace(result, `"":`, `"name":`, 1)   // Third channel name
-	result = strings.Replace(result, `"":`, `"reason":`, 1) // Third channel reason
-
-	// Replace remaining main level fields
-	result = strings.Replace(result, `"":`, `"outreachMessage":`, 1) // Second main field
-	result = strings.Replace(result, `"":`, `"hashtags":`, 1)        // Third main field
-	result = strings.Replace(result, `"":`, `"actionPlan":`, 1)      // Fourth main field
-
-	return result
-}
-
-// fixMalformedSalesPathJSON fixes JSON with empty field names for SalesPath
-func fixMalformedSalesPathJSON(jsonStr string) string {
-	// If JSON doesn't have empty keys, return as is
-	if !strings.Contains(jsonStr, `"":`) {
-		return jsonStr
-	}
-
-	result := jsonStr
-
-	// SalesPath has nested structure with many empty keys
-	// Main structure: dailyPlan (array), salesTips (array), engagement (array)
-	// Each dailyPlan object has empty keys: day, action, content
-
-	// Replace main level empty keys first
-	result = strings.Replace(result, `"":`, `"dailyPlan":`, 1) // First main field
-
-	// Replace nested empty keys in dailyPlan array (day, action, content for each day - 7 days)
-	result = strings.Replace(result, `"":`, `"day":`, 1)     // Day 1 day
-	result = strings.Replace(result, `"":`, `"action":`, 1)  // Day 1 action
-	result = strings.Replace(result, `"":`, `"content":`, 1) // Day 1 content
-	result = strings.Replace(result, `"":`, `"day":`, 1)     // Day 2 day
-	result = strings.Replace(result, `"":`, `"action":`, 1)  // Day 2 action
-	result = strings.Replace(result, `"":`, `"content":`, 1) // Day 2 content
-	result = strings.Replace(result, `"":`, `"day":`, 1)     // Day 3 day
-	result = strings.Replace(result, `"":`, `"action":`, 1)  // Day 3 action
-	result = strings.Replace(result, `"":`, `"content":`, 1) // Day 3 content
-	result = strings.Replace(result, `"":`, `"day":`, 1)     // Day 4 day
-	result = strings.Replace(result, `"":`, `"action":`, 1)  // Day 4 action
-	result = strings.Replace(result, `"":`, `"content":`, 1) // Day 4 content
-	result = strings.Replace(result, `"":`, `"day":`, 1)     // Day 5 day
-	result = strings.Replace(result, `"":`, `"action":`, 1)  // Day 5 action
-	result = strings.Replace(result, `"":`, `"content":`, 1) // Day 5 content
-	result = strings.Replace(result, `"":`, `"day":`, 1)     // Day 6 day
-	result = strings.Replace(result, `"":`, `"action":`, 1)  // Day 6 action
-	result = strings.Replace(result, `"":`, `"content":`, 1) // Day 6 content
-	result = strings.Replace(result, `"":`, `"day":`, 1)     // Day 7 day
-	result = strings.Replace(result, `"":`, `"action":`, 1)  // Day 7 action
-	result = strings.Replace(result, `"":`, `"content":`, 1) // Day 7 content
-
-	// Replace remaining main level fields
-	result = strings.Replace(result, `"":`, `"salesTips":`, 1)  // Second main field
-	result = strings.Replace(result, `"":`, `"engagement":`, 1) // Third main field
-
-	return result
-}
-
-// extractJSONFromResponse extracts JSON from ChatGPT response (handles markdown code blocks)
-func extractJSONFromResponse(response string) string {
-	// Remove leading/trailing whitespace
-	response = strings.TrimSpace(response)
-
-	// Look for JSON in markdown code blocks
-	if strings.Contains(response, "```json") {
-		// Find the start and end of the JSON block
-		startMarker := "```json"
-		endMarker := "```"
-
-		startIdx := strings.Index(response, startMarker)
-		if startIdx != -1 {
-			startIdx += len(startMarker)
-			endIdx := strings.Index(response[startIdx:], endMarker)
-			if endIdx != -1 {
-				jsonContent := strings.TrimSpace(response[startIdx : startIdx+endIdx])
-				return jsonContent
-			}
-		}
-	}
-
-	// Look for JSON in generic code blocks
-	if strings.Contains(response, "```") {
-		// Find the start and end of any code block
-		startMarker := "```"
-		startIdx := strings.Index(response, startMarker)
-		if startIdx != -1 {
-			startIdx += len(startMarker)
-			// Skip any language identifier on the same line
-			if newlineIdx := strings.Index(response[startIdx:], "\n"); newlineIdx != -1 {
-				startIdx += newlineIdx + 1
-			}
-			endIdx := strings.Index(response[startIdx:], startMarker)
-			if endIdx != -1 {
-				jsonContent := strings.TrimSpace(response[startIdx : startIdx+endIdx])
-				// Check if it looks like JSON
-				if strings.HasPrefix(jsonContent, "{") && strings.HasSuffix(jsonContent, "}") {
-					return jsonContent
-				}
-			}
-		}
-	}
-
-	// If no code blocks found, try to find JSON object directly
-	if strings.Contains(response, "{") && strings.Contains(response, "}") {
-		startIdx := strings.Index(response, "{")
-		lastIdx := strings.LastIndex(response, "}")
-		if startIdx != -1 && lastIdx != -1 && lastIdx > startIdx {
-			jsonContent := strings.TrimSpace(response[startIdx : lastIdx+1])
-			return jsonContent
-		}
-	}
-
-	// Return original response if no JSON structure found
-	return response
-}
-
-// QuizEvaluationRequest represents the quiz evaluation request
-type QuizEvaluationRequest struct {
-	TelegramID int64                  `json:"telegram_id" binding:"required"`
-	StageID    int                    `json:"stage_id" binding:"required"`
-	Answers    map[string]interface{} `json:"answers" binding:"required"`
-}
-
-// QuizEvaluationResponse represents the quiz evaluation response
-type QuizEvaluationResponse struct {
-	Passed            bool   `json:"passed"`
-	Score             int    `json:"score"`
-	Feedback          string `json:"feedback"`
-	NextStageUnlocked bool   `json:"next_stage_unlocked"`
-}
-
-// handleQuizEvaluation handles quiz evaluation with ChatGPT
-func handleQuizEvaluation(c *gin.Context) {
-	var req QuizEvaluationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, APIResponse{
-			Success: false,
-			Error:   "Invalid request format",
-		})
-		return
-	}
-
-	// ⚡ PERFORMANCE: Get user from cache
-	user, err := userCache.GetUser(req.TelegramID)
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusInternalServerError, APIResponse{
-				Success: false,
-				Error:   "User not found",
-			})
-			return
-		}
-		logger.Error("Database error in quiz evaluation", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Error:   "Database error",
 		})
 		return
 	}
 
-	// ⚡ PERFORMANCE: Get session from cache
-	session, err := sessionCache.GetSessionByNumber(req.StageID)
-	if err != nil {
-		logger.Error("Failed to get session for quiz evaluation", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Error:   "Stage not found",
-		})
-		return
-	}
-
-	// Convert answers to string for ChatGPT analysis
-	answersJSON, _ := json.Marshal(req.Answers)
-	answersStr := string(answersJSON)
-
-	// Evaluate using dedicated Groq evaluation (Persian-only, colloquial)
-	logger.Info("Starting quiz evaluation",
+	logger.Info("Quiz evaluation completed",
 		zap.Int64("user_id", user.TelegramID),
 		zap.Int("stage_id", req.StageID),
-		zap.String("session_title", session.Title),
-		zap.Int("answers_count", len(req.Answers)))
-
-	var approved bool
-	var feedback string
-	var score int
-
-	approved, feedback, evalErr := groqClient.GenerateExerciseEvaluation(
-		session.Title,
-		session.Description,
-		"",
-		"",
-		answersStr,
-	)
-
-	// Fallback logic: If AI evaluation fails or returns unclear result, do basic validation
-	if evalErr != nil {
-		logger.Error("Groq evaluation error",
-			zap.Int64("user_id", user.TelegramID),
-			zap.Int("stage_id", req.StageID),
-			zap.Error(evalErr))
-
-		// Fallback: Basic validation based on answer length and content
-		answersLength := len(answersStr)
-		if answersLength > 100 {
-			// Substantial answers, likely good
-			approved = true
-			score = 75
-			feedback = "پاسخ‌های شما دریافت شد. با توجه به تلاش شما، این مرحله تایید شد. ادامه دهید!"
-		} else if answersLength > 50 {
-			// Some effort, give partial pass
-			approved = true
-			score = 65
-			feedback = "پاسخ‌های شما دریافت شد. می‌توانید به مرحله بعد بروید، اما پیشنهاد می‌کنم محتوا را دوباره مرور کنید."
-		} else {
-			// Too short, need more
-			approved = false
-			score = 30
-			feedback = "پاسخ‌های شما خیلی کوتاه است. لطفاً با جزئیات بیشتر پاسخ دهید تا بتوانم ارزیابی دقیق‌تری انجام دهم."
-		}
-
-		logger.Info("Using fallback evaluation",
-			zap.Int64("user_id", user.TelegramID),
-			zap.Int("stage_id", req.StageID),
-			zap.Bool("approved", approved),
-			zap.Int("score", score),
-			zap.Int("answers_length", answersLength))
-	} else {
-		logger.Info("Quiz evaluation completed",
-			zap.Int64("user_id", user.TelegramID),
-			zap.Int("stage_id", req.StageID),
-			zap.Bool("approved", approved),
-			zap.Int("feedback_length", len(feedback)))
-
-		// Additional validation: If AI says no but answers are substantial, reconsider
-		if !approved && len(answersStr) > 150 {
-			logger.Warn("AI rejected but answers are substantial, reconsidering...",
-				zap.Int64("user_id", user.TelegramID),
-				zap.Int("stage_id", req.StageID),
-				zap.Int("answers_length", len(answersStr)))
-
-			// If answers are substantial, give benefit of doubt
-			approved = true
-			score = 70
-			if feedback == "" {
-				feedback = "پاسخ‌های شما دریافت شد. با توجه به تلاش شما، این مرحله تایید شد."
-			}
+		zap.Bool("approved", evaluation.Passed),
+		zap.Int("score", evaluation.Score),
+		zap.Int("passing_score", evaluation.PassingScore))
 
-			logger.Info("Reconsidered and approved based on answer length",
-				zap.Int64("user_id", user.TelegramID),
-				zap.Int("stage_id", req.StageID))
-		}
-	}
-	// Calculate score based on approval and answer quality (only if not set in fallback)
-	if score == 0 {
-		if approved {
-			// If approved, give a good score (70-90 range)
-			// Check answer quality from feedback
-			feedbackLower := strings.ToLower(feedback)
-			if strings.Contains(feedbackLower, "عالی") ||
-				strings.Contains(feedbackLower, "کامل") ||
-				strings.Contains(feedbackLower, "عالیه") {
-				score = 90
-			} else if strings.Contains(feedbackLower, "خوب") ||
-				strings.Contains(feedbackLower, "مناسب") {
-				score = 80
-			} else {
-				score = 70 // Minimum passing score
-			}
+	if evaluation.Feedback == "" {
+		if evaluation.Passed {
+			evaluation.Feedback = "عالی! این مرحله رو با موفقیت رد کردی و می‌تونی بری سراغ مرحله بعد."
 		} else {
-			// If not approved, give partial credit based on effort
-			// Check if there's any meaningful content in answers
-			if len(answersStr) > 100 {
-				// Substantial answer, give partial credit
-				score = 40
-			} else if len(answersStr) > 50 {
-				// Some effort, give minimal credit
-				score = 30
-			} else {
-				// Very little or no effort
-				score = 20
-			}
+			evaluation.Feedback = "چند نکته کم بود. دوباره مرور کن و با نکات دقیق‌تر ارسال کن تا قبول شی."
 		}
 	}
 
-	logger.Info("Calculated quiz score",
-		zap.Int64("user_id", user.TelegramID),
-		zap.Int("stage_id", req.StageID),
-		zap.Bool("approved", approved),
-		zap.Int("score", score),
-		zap.Int("answers_length", len(answersStr)))
-
-	// Fallback values if parsing failed
-	if feedback == "" {
-		if approved {
-			feedback = "عالی! این مرحله رو با موفقیت رد کردی و می‌تونی بری سراغ مرحله بعد."
-		} else {
-			feedback = "چند نکته کم بود. دوباره مرور کن و با نکات دقیق‌تر ارسال کن تا قبول شی."
-		}
-	}
+	flagQuizEvaluationForReview(&evaluation)
 
 	nextStageUnlocked := false
-	if approved {
-		// Update user progress - move to next stage
-		newSession := user.CurrentSession + 1
-
-		logger.Info("Attempting to update user session",
-			zap.Int64("user_id", user.TelegramID),
-			zap.Int("old_session", user.CurrentSession),
-			zap.Int("new_session", newSession))
-
-		// Update in database - MUST use explicit WHERE clause
-		// Update both current_session and points
-		updates := map[string]interface{}{
-			"current_session": newSession,
-			"points":          user.Points + score, // Add quiz score to total points
-		}
-		if err := db.Model(&User{}).Where("telegram_id = ?", user.TelegramID).Updates(updates).Error; err != nil {
-			logger.Error("Failed to update user session and points after quiz",
-				zap.Int64("user_id", user.TelegramID),
-				zap.Int("new_session", newSession),
-				zap.Int("score", score),
-				zap.Error(err))
-			// Even if update fails, don't set nextStageUnlocked to true
-			nextStageUnlocked = false
-		} else {
-			// CRITICAL: Update the user object in memory too
-			user.CurrentSession = newSession
-			user.Points += score
-			nextStageUnlocked = true
-
-			// ⚡ PERFORMANCE: Invalidate cache to force refresh on next request
-			userCache.InvalidateUser(user.TelegramID)
-
-			// Verify the update by reading from database
-			var verifyUser User
-			if err := db.Where("telegram_id = ?", user.TelegramID).First(&verifyUser).Error; err != nil {
-				logger.Error("Failed to verify user session update",
-					zap.Int64("user_id", user.TelegramID),
-					zap.Error(err))
-				// If verification fails, still consider it unlocked since update succeeded
-			} else {
-				if verifyUser.CurrentSession == newSession {
-					logger.Info("✅ User session updated successfully - next stage unlocked",
-						zap.Int64("user_id", user.TelegramID),
-						zap.Int("stage_id", req.StageID),
-						zap.Int("old_session", user.CurrentSession-1),
-						zap.Int("new_session", verifyUser.CurrentSession),
-						zap.Int("next_stage_id", newSession+1),
-						zap.Int("score", score),
-						zap.Bool("verified", true))
-				} else {
-					logger.Warn("⚠️ User session update verification mismatch",
-						zap.Int64("user_id", user.TelegramID),
-						zap.Int("expected_session", newSession),
-						zap.Int("actual_session", verifyUser.CurrentSession))
-					// Still consider it unlocked since update succeeded
-				}
-			}
-		}
+	if evaluation.Passed {
+		// Update user progress - move to next stage and add the quiz score to total points
+		nextStageUnlocked = advanceUserSession(user.TelegramID, user.CurrentSession, evaluation.Score)
 	}
 
 	response := QuizEvaluationResponse{
-		Passed:            approved,
-		Score:             score,
-		Feedback:          feedback,
+		EvaluationID:      evaluation.ID,
+		Passed:            evaluation.Passed,
+		Score:             evaluation.Score,
+		PassingScore:      evaluation.PassingScore,
+		Criteria:          evaluation.Criteria,
+		Feedback:          evaluation.Feedback,
 		NextStageUnlocked: nextStageUnlocked,
 	}
 
@@ -2811,7 +2052,17 @@ func handleMiniAppSecurityAPI(c *gin.Context) {
 
 // handleListBlockedMiniAppUsers lists all blocked Mini App users
 func handleListBlockedMiniAppUsers(c *gin.Context) {
-	if len(miniAppBlockedUsers) == 0 {
+	bans, err := listActiveBans(BanScopeMiniApp)
+	if err != nil {
+		logger.Error("Failed to list Mini App bans", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	if len(bans) == 0 {
 		c.JSON(http.StatusOK, APIResponse{
 			Success: true,
 			Data: map[string]interface{}{
@@ -2822,12 +2073,27 @@ func handleListBlockedMiniAppUsers(c *gin.Context) {
 		return
 	}
 
+	telegramIDs := make([]int64, 0, len(bans))
+	for _, ban := range bans {
+		telegramIDs = append(telegramIDs, ban.TelegramID)
+	}
+	violations, err := countBansByUser(telegramIDs)
+	if err != nil {
+		logger.Error("Failed to count user bans", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
 	var blockedUsers []map[string]interface{}
-	for telegramID := range miniAppBlockedUsers {
-		violationCount := miniAppSuspiciousActivityCount[telegramID]
+	for _, ban := range bans {
 		blockedUsers = append(blockedUsers, map[string]interface{}{
-			"telegram_id":     telegramID,
-			"violation_count": violationCount,
+			"telegram_id":     ban.TelegramID,
+			"reason":          ban.Reason,
+			"expires_at":      ban.ExpiresAt,
+			"violation_count": violations[ban.TelegramID],
 		})
 	}
 
@@ -2835,7 +2101,7 @@ func handleListBlockedMiniAppUsers(c *gin.Context) {
 		Success: true,
 		Data: map[string]interface{}{
 			"blocked_users": blockedUsers,
-			"total_blocked": len(miniAppBlockedUsers),
+			"total_blocked": len(bans),
 		},
 	})
 }
@@ -2860,7 +2126,18 @@ func handleUnblockMiniAppUser(c *gin.Context) {
 		return
 	}
 
-	if !miniAppBlockedUsers[telegramID] {
+	// Unblock user
+	lifted, err := liftBans(telegramID, BanScopeMiniApp, nil)
+	if err != nil {
+		logger.Error("Failed to unblock Mini App user", zap.Int64("user_id", telegramID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
+
+	if lifted == 0 {
 		c.JSON(http.StatusBadRequest, APIResponse{
 			Success: false,
 			Error:   "User is not blocked",
@@ -2868,10 +2145,6 @@ func handleUnblockMiniAppUser(c *gin.Context) {
 		return
 	}
 
-	// Unblock user
-	delete(miniAppBlockedUsers, telegramID)
-	miniAppSuspiciousActivityCount[telegramID] = 0
-
 	logger.Info("Mini App user unblocked",
 		zap.Int64("user_id", telegramID))
 
@@ -2903,10 +2176,11 @@ func handleClearMiniAppUserActivity(c *gin.Context) {
 		return
 	}
 
-	// Clear suspicious activity
-	miniAppSuspiciousActivityCount[telegramID] = 0
+	// Clear rate limit state
+	rateLimitMutex.Lock()
 	delete(miniAppRateLimits, telegramID)
 	delete(miniAppCallCounts, telegramID)
+	rateLimitMutex.Unlock()
 
 	logger.Info("Mini App user suspicious activity cleared",
 		zap.Int64("user_id", telegramID))
@@ -2944,8 +2218,20 @@ func handleBlockMiniAppUser(c *gin.Context) {
 		return
 	}
 
+	// Optional temporary ban
+	var duration time.Duration
+	if hours, err := strconv.Atoi(c.PostForm("duration_hours")); err == nil && hours > 0 {
+		duration = time.Duration(hours) * time.Hour
+	}
+
 	// Block user
-	blockMiniAppUser(telegramID, reason)
+	if err := blockMiniAppUser(telegramID, reason, duration, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Error:   "Database error",
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, APIResponse{
 		Success: true,
@@ -3391,6 +2677,8 @@ func handleUserWebLogin(c *gin.Context) {
 		logger.Warn("User web login failed - invalid password",
 			zap.Int64("telegram_id", req.TelegramID),
 			zap.String("remote_addr", c.ClientIP()))
+		reportSecuritySignal(SecurityRuleWebLoginFailure, 0, c.ClientIP(),
+			fmt.Sprintf("Repeated failed web logins from one IP; last telegram_id: %d", req.TelegramID))
 		c.JSON(http.StatusUnauthorized, APIResponse{
 			Success: false,
 			Error:   "Invalid password",
@@ -3405,6 +2693,8 @@ func handleUserWebLogin(c *gin.Context) {
 			logger.Warn("User web login failed - user not registered",
 				zap.Int64("telegram_id", req.TelegramID),
 				zap.String("remote_addr", c.ClientIP()))
+			reportSecuritySignal(SecurityRuleWebLoginFailure, 0, c.ClientIP(),
+				fmt.Sprintf("Repeated failed web logins from one IP; last telegram_id: %d", req.TelegramID))
 			c.JSON(http.StatusUnauthorized, APIResponse{
 				Success: false,
 				Error:   "User not registered in bot. Please register first in Telegram bot.",
@@ -3419,8 +2709,8 @@ func handleUserWebLogin(c *gin.Context) {
 		return
 	}
 
-	// Check if user is active
-	if !user.IsActive {
+	// Check if user is banned from the Mini App
+	if isBanned(user.TelegramID, BanScopeMiniApp) {
 		logger.Warn("User web login failed - user is blocked",
 			zap.Int64("telegram_id", req.TelegramID),
 			zap.String("remote_addr", c.ClientIP()))
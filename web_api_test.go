@@ -222,3 +222,24 @@ func TestNonAPINoRouteRedirectsWithoutSession(t *testing.T) {
 		t.Error("expected X-Request-Id header on redirect response")
 	}
 }
+
+// sessionRouter returns a router whose requests are authenticated as a web session of callerID
+func sessionRouter(callerID int64) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("telegram_id", callerID)
+		c.Set("web_session", true)
+		c.Next()
+	})
+	return r
+}
+
+// serveJSON sends body to the router and returns the recorded response
+func serveJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}